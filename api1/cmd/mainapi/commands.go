@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	cache "github.com/nikita89756/testEffectiveMobile/internal/cache"
+	"github.com/nikita89756/testEffectiveMobile/internal/migrate"
+	"github.com/nikita89756/testEffectiveMobile/internal/purge"
+	"github.com/nikita89756/testEffectiveMobile/internal/seed"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage"
+	"github.com/nikita89756/testEffectiveMobile/internal/warmup"
+	config "github.com/nikita89756/testEffectiveMobile/pkg/config"
+	logger "github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// migrateCmd - migrate up|down|redo|to <version>|status|version (см. migrate.Usage)
+func migrateCmd(ctx context.Context, cfg config.Config, logger logger.Logger, args []string) error {
+	db, err := storage.NewStorage(cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("create storage: %w", err)
+	}
+	provider, err := db.Migrations(cfg.MigrationDir)
+	if err != nil {
+		return fmt.Errorf("load migrations: %w", err)
+	}
+	if provider == nil {
+		logger.Info("У хранилища нет схемы, миграции не нужны", zap.String("driver", cfg.Database.Driver))
+		return nil
+	}
+	return migrate.Run(ctx, provider, args, os.Stdout)
+}
+
+// seedCmd - загрузка людей из JSON файла пачками через BulkCreatePersons, без обогащения.
+// Хранилище оборачивается в CachedStorage, чтобы загрузка сбросила кэш списков запущенного serve
+func seedCmd(ctx context.Context, cfg config.Config, logger logger.Logger, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := flags.String("file", "", `JSON массив людей, "-" - stdin`)
+	batch := flags.Int("batch", seed.DefaultBatchSize, "строк в одной вставке")
+	atomic := flags.Bool("atomic", false, "все или ничего: любая невалидная строка отменяет загрузку")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		flags.Usage()
+		return errors.New("seed: -file is required")
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	db, err := storage.NewStorage(cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("create storage: %w", err)
+	}
+	personCache, err := initCache(cfg.Cache, logger)
+	if err != nil {
+		return fmt.Errorf("create cache client: %w", err)
+	}
+	result, err := seed.Load(ctx, withListCache(db, personCache, cfg.Cache, logger), r, *batch, *atomic)
+	for _, e := range result.Errors {
+		logger.Warn("Строка не загружена", zap.Int("index", e.Index), zap.String("error", e.Error))
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("Загрузка завершена", zap.Int("created", result.Created), zap.Int("failed", len(result.Errors)))
+	return nil
+}
+
+// purgeCmd - один проход очистки мягко удаленных записей, например из cron вместо PURGE_INTERVAL
+func purgeCmd(ctx context.Context, cfg config.Config, logger logger.Logger, args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	retention := flags.Duration("retention", cfg.PurgeRetention, "удалять записи, удаленные раньше, чем столько назад (PURGE_RETENTION)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	db, err := storage.NewStorage(cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("create storage: %w", err)
+	}
+	purged, err := purge.NewPurger(db, *retention, 0, logger).Run(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Info("Очистка завершена", zap.Int64("count", purged))
+	return nil
+}
+
+// warmupCmd - синхронный прогрев кэша. Redis подключается в режиме strict: без кэша прогревать нечего
+func warmupCmd(ctx context.Context, cfg config.Config, logger logger.Logger, args []string) error {
+	if err := flag.NewFlagSet("warmup", flag.ContinueOnError).Parse(args); err != nil {
+		return err
+	}
+	cfg.Cache.StartupMode = "strict"
+	personCache, err := initCache(cfg.Cache, logger)
+	if err != nil {
+		return fmt.Errorf("create cache client: %w", err)
+	}
+	if _, disabled := personCache.(cache.NoopCache); disabled {
+		return errors.New("warmup: cache is not configured")
+	}
+	db, err := storage.NewStorage(cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("create storage: %w", err)
+	}
+	processed, err := warmup.NewWarmer(db, personCache, cfg.Cache.WarmupBatchSize, cfg.Cache.WarmupInterval, logger).Run(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Info("Прогрев кэша завершен", zap.Int("processed", processed))
+	return nil
+}
@@ -1,30 +1,66 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
-	"time"
+	"os"
+	"strings"
 
-	services "github.com/nikita89756/testEffectiveMobile/internal/apis"
-	cache "github.com/nikita89756/testEffectiveMobile/internal/cache"
-	"github.com/nikita89756/testEffectiveMobile/internal/handlers"
-	"github.com/nikita89756/testEffectiveMobile/internal/server"
-	"github.com/nikita89756/testEffectiveMobile/internal/storage"
+	"github.com/nikita89756/testEffectiveMobile/internal/migrate"
 	config "github.com/nikita89756/testEffectiveMobile/pkg/config"
 	logger "github.com/nikita89756/testEffectiveMobile/pkg/logger"
 	"go.uber.org/zap"
 
 	_ "github.com/nikita89756/testEffectiveMobile/docs"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
 )
-const(timeout = 5*time.Second)
 
+// command - подкоманда бинарника, args - аргументы после ее имени
+type command func(ctx context.Context, cfg config.Config, logger logger.Logger, args []string) error
+
+var commands = map[string]command{
+	"serve":   serve,
+	"migrate": migrateCmd,
+	"seed":    seedCmd,
+	"purge":   purgeCmd,
+	"warmup":  warmupCmd,
+}
+
+const usage = `Использование: mainapi [команда] [аргументы]
+
+serve [-migrate]        HTTP сервер (команда по умолчанию)
+%s
+seed -file people.json [-batch 1000] [-atomic]
+                        загрузить людей из JSON массива (формат POST /api/admin/persons/bulk, "-" - stdin)
+purge [-retention 720h] окончательно удалить записи, удаленные раньше retention
+warmup                  прогреть кэш обогащения из таблицы people
+help                    эта подсказка
+`
 
 // @title Effective Mobile API
 // @version 1.0
 // @host 0.0.0.0:8080
 // @BasePath /api
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name Authorization
 func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage(os.Stderr)
+		if name != "help" {
+			os.Exit(2)
+		}
+		return
+	}
+
 	cfg := config.InitConfig()
 
 	logger,err := logger.InitLogger(true, "", cfg.LogLevel)
@@ -34,40 +70,18 @@ func main() {
 	}
 	logger.Info("Инициализация логгера завершена")
 
-	db:= storage.NewStorage(cfg.DatabaseConnection,logger, cfg.DBTimeout)
-
-	err = db.Migrate(cfg.MigrationDir)
-	if err != nil {
-		logger.Error("ошибка миграции базы данных", zap.Error(err))
-		return
-	}
-	cache,err := cache.NewRedisClient(cfg.Cache.Address, cfg.Cache.Password, cfg.Cache.Db,logger)
-	if err != nil {
-		logger.Error("ошибка создания клиента Redis")
-		return
-	}
-
-	addon := services.NewAddonService(timeout,logger)
-
-	handler := handlers.NewHandler(db, logger,addon,cache)
-
-	// TODO server initializer
-
-	server := server.New(cfg.Server.Host, cfg.Server.Port, handler)
-
-	router:=server.CreateRoute()
-
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-
-	err=router.Run()
-
-	if err != nil {
-		log.Fatal(err)
+	err = cmd(context.Background(), cfg, logger, args)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, migrate.ErrUsage):
+		fmt.Fprintln(os.Stderr, migrate.Usage)
+		os.Exit(2)
+	default:
+		logger.Error("Ошибка выполнения команды", zap.String("command", name), zap.Error(err))
+		os.Exit(1)
 	}
-	// defer func() {
-	// 	if err := server.Shutdown(); err != nil {
-	// 		logger.Error("ошибка завершения работы сервера", err)
-	// 	}
-	// }()
+}
 
-}
\ No newline at end of file
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, usage, migrate.Usage)
+}
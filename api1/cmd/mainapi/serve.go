@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	services "github.com/nikita89756/testEffectiveMobile/internal/apis"
+	cache "github.com/nikita89756/testEffectiveMobile/internal/cache"
+	"github.com/nikita89756/testEffectiveMobile/internal/handlers"
+	"github.com/nikita89756/testEffectiveMobile/internal/outbox"
+	"github.com/nikita89756/testEffectiveMobile/internal/poolstats"
+	"github.com/nikita89756/testEffectiveMobile/internal/purge"
+	"github.com/nikita89756/testEffectiveMobile/internal/server"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage"
+	"github.com/nikita89756/testEffectiveMobile/internal/warmup"
+	config "github.com/nikita89756/testEffectiveMobile/pkg/config"
+	logger "github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+const(timeout = 5*time.Second)
+
+// serve - HTTP сервер. Миграции при старте применяются только с -migrate или AUTO_MIGRATE=true
+func serve(ctx context.Context, cfg config.Config, logger logger.Logger, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	migrateOnStart := flags.Bool("migrate", cfg.Database.AutoMigrate, "применить новые миграции перед запуском (AUTO_MIGRATE)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := storage.NewStorage(cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("create storage: %w", err)
+	}
+
+	if *migrateOnStart {
+		if err := migrateUp(ctx, db, cfg.MigrationDir, logger); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+	personCache, err := initCache(cfg.Cache, logger)
+	if err != nil {
+		return fmt.Errorf("create cache client: %w", err)
+	}
+
+	db = withListCache(db, personCache, cfg.Cache, logger)
+
+	addon := services.NewAddonService(timeout,logger)
+
+	handler := handlers.NewHandler(db, logger,addon,personCache)
+
+	warmer := warmup.NewWarmer(db, personCache, cfg.Cache.WarmupBatchSize, cfg.Cache.WarmupInterval, logger)
+	if cfg.Cache.WarmupOnStart {
+		if err := warmer.Start(ctx); err != nil {
+			logger.Error("ошибка запуска прогрева кэша", zap.Error(err))
+		}
+	}
+	if cfg.Database.PurgeInterval > 0 {
+		purge.NewPurger(db, cfg.Database.PurgeRetention, cfg.Database.PurgeInterval, logger).Start(ctx)
+	}
+	if cfg.Database.PoolStatsInterval > 0 {
+		poolstats.NewReporter(db, cfg.Database.PoolStatsInterval, logger).Start(ctx)
+	}
+	publisher, closePublisher, err := initPublisher(cfg.Outbox, logger)
+	if err != nil {
+		return fmt.Errorf("create outbox publisher: %w", err)
+	}
+	defer closePublisher()
+	if publisher != nil {
+		outbox.NewRelay(db, publisher, cfg.Outbox.BatchSize, cfg.Outbox.RelayInterval, logger).Start(ctx)
+	}
+	admin := handlers.NewAdminHandler(db, logger, warmer)
+
+	// TODO server initializer
+
+	server := server.New(cfg.Server.Host, cfg.Server.Port, handler, admin, cfg.Server.AdminToken, cfg.Database.ReadYourWritesWindow)
+
+	router:=server.CreateRoute()
+
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	return router.Run()
+	// defer func() {
+	// 	if err := server.Shutdown(); err != nil {
+	// 		logger.Error("ошибка завершения работы сервера", err)
+	// 	}
+	// }()
+}
+
+
+// migrateUp - применяет новые миграции. Несколько экземпляров, стартующих одновременно, ждут друг друга
+// на advisory lock (см. postgres.Migrations)
+func migrateUp(ctx context.Context, db storage.Storage, dir string, logger logger.Logger) error {
+	provider, err := db.Migrations(dir)
+	if err != nil || provider == nil {
+		return err
+	}
+	results, err := provider.Up(ctx)
+	for _, r := range results {
+		logger.Info("Применена миграция", zap.String("file", r.Source.Path), zap.Duration("duration", r.Duration))
+	}
+	return err
+}
+
+// initPublisher - отправка событий outbox по OUTBOX_PUBLISHER, nil - relay не запускается. Вторым значением
+// возвращается закрытие соединения публикации
+func initPublisher(cfg config.Outbox, logger logger.Logger) (outbox.EventPublisher, func(), error) {
+	switch cfg.Publisher {
+	case "none":
+		logger.Warn("Отправка событий outbox отключена, события копятся в таблице outbox")
+		return nil, func() {}, nil
+	case "http":
+		return outbox.NewHTTPPublisher(cfg.HTTPURL, cfg.HTTPTimeout), func() {}, nil
+	case "nats":
+		publisher, err := outbox.NewNATSPublisher(cfg.NATSURL, cfg.NATSSubject)
+		if err != nil {
+			return nil, nil, err
+		}
+		return publisher, publisher.Close, nil
+	}
+	return outbox.NewLogPublisher(logger), func() {}, nil
+}
+
+// withListCache - оборачивает db в CachedStorage, если кэш включен и CACHE_LIST_TTL > 0. Нужен всем командам,
+// которые меняют людей: иначе запущенный serve отдает старые страницы списков до истечения CACHE_LIST_TTL
+func withListCache(db storage.Storage, personCache cache.Cache, cfg config.Cache, logger logger.Logger) storage.Storage {
+	if _, disabled := personCache.(cache.NoopCache); disabled || cfg.ListTTL <= 0 {
+		return db
+	}
+	return storage.NewCachedStorage(db, personCache, cfg.ListTTL, logger)
+}
+
+// initCache - кэш выбирается по CACHE_DRIVER. Без CACHE_ADDRESS сервис работает с no-op кэшем,
+// в режиме background Redis может быть недоступен при старте и подключается в фоне
+func initCache(cfg config.Cache, logger logger.Logger) (cache.Cache, error) {
+	policy := cache.Policy{FreshTTL: cfg.FreshTTL, StaleTTL: cfg.StaleTTL}
+	switch cfg.Driver {
+	case "none":
+		logger.Info("Кэш отключен")
+		return cache.NewNoopCache(), nil
+	case "memory":
+		logger.Info("Используется кэш в памяти")
+		return cache.NewMemoryCache(policy), nil
+	}
+	if len(cfg.Addresses) == 0 {
+		logger.Warn("Кэш не настроен, сервис работает без Redis")
+		return cache.NewNoopCache(), nil
+	}
+	opts := cache.Options{
+		Mode:                  cfg.Mode,
+		Addrs:                 cfg.Addresses,
+		MasterName:            cfg.MasterName,
+		Username:              cfg.Username,
+		Password:              cfg.Password,
+		SentinelUsername:      cfg.SentinelUsername,
+		SentinelPassword:      cfg.SentinelPassword,
+		DB:                    cfg.Db,
+		TLS:                   cfg.TLS,
+		TLSCAFile:             cfg.TLSCAFile,
+		TLSInsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+		Timeout:               cfg.Timeout,
+		RetryInterval:         cfg.RetryInterval,
+		Policy:                policy,
+	}
+	if cfg.StartupMode == "strict" {
+		return cache.NewRedisClient(opts, logger)
+	}
+	return cache.NewRedisClientWithRetry(opts, logger)
+}
@@ -15,9 +15,254 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/cache/warmup": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Состояние прогрева кэша",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.WarmupStatus"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Заполняет кэш обогащения данными из таблицы people. Прогрев выполняется в фоне.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Запустить прогрев кэша",
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/model.WarmupStatus"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/db/pool": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "sql.DB.Stats() для primary и каждой реплики: открытые, занятые и свободные соединения, сколько раз и сколько\nвсего запросы ждали свободного соединения. Растущий wait_count - признак того, что DB_MAX_OPEN_CONNS мал",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Состояние пула соединений с базой",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.PoolStats"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/persons/bulk": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Вставляет до 10000 записей за запрос без обогащения: возраст, пол и национальность берутся из запроса. Невалидные строки пропускаются и перечислены в errors, ids идут в порядке строк запроса (0 для пропущенных). С atomic=true любая ошибка отменяет вставку всех строк.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Массовая вставка людей",
+                "parameters": [
+                    {
+                        "description": "Люди",
+                        "name": "persons",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.PersonUpdateRequest"
+                            }
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Все или ничего",
+                        "name": "atomic",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.BulkCreateResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/model.BulkCreateResult"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/persons/deleted": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Мягко удаленные записи, которые еще не очищены. Сначала последние удаленные.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Список удаленных людей",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Limit",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.Person"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Проверка работоспособности сервиса и доступности Redis. Недоступный кэш не делает сервис неработоспособным.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Состояние сервиса",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.HealthResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/persons": {
             "get": {
-                "description": "Возвращает список человек учитывая фильтры",
+                "description": "Возвращает список человек учитывая фильтры. Параметры name, surname, patronymic, age, nationality, gender и ids принимают несколько значений через запятую (любое из них). Все фильтры объединяются через И.",
                 "consumes": [
                     "application/json"
                 ],
@@ -31,50 +276,470 @@ const docTemplate = `{
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Name",
+                        "description": "ID через запятую",
+                        "name": "ids",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name, несколько через запятую",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Surname, несколько через запятую",
+                        "name": "surname",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Patronymic, несколько через запятую",
+                        "name": "patronymic",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Имя начинается с",
+                        "name": "name_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Фамилия начинается с",
+                        "name": "surname_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Отчество начинается с",
+                        "name": "patronymic_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Age, несколько через запятую",
+                        "name": "age",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Минимальный возраст включительно",
+                        "name": "age_min",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Максимальный возраст включительно",
+                        "name": "age_max",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Gender (male or female), несколько через запятую",
+                        "name": "gender",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Nationality, несколько через запятую",
+                        "name": "nationality",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Создан не раньше (RFC 3339 или YYYY-MM-DD)",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Создан раньше (RFC 3339 или YYYY-MM-DD)",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Изменен не раньше (RFC 3339 или YYYY-MM-DD)",
+                        "name": "updated_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Изменен раньше (RFC 3339 или YYYY-MM-DD)",
+                        "name": "updated_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Сортировка: поля через запятую, '-' перед полем - по убыванию, например surname,-age. Поля: id, name, surname, patronymic, age, nationality, gender, created_at, updated_at. Последним всегда добавляется id",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы (по умолчанию 20, не больше 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor или prev_cursor из предыдущего ответа, выдается для конкретной сортировки",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "exact",
+                            "estimate"
+                        ],
+                        "type": "string",
+                        "description": "Посчитать общее число записей: exact - точно, estimate - оценка по статистике Postgres",
+                        "name": "total",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Фасеты через запятую: nationality, gender, age. Считаются по всему фильтру, пустые значения не учитываются, age - диапазонами по 10 лет",
+                        "name": "facets",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.PersonPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Добавление и обогащение данными ФИО.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Создает нового пользователя.",
+                "parameters": [
+                    {
+                        "description": "Person info",
+                        "name": "person",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.PersonCreateRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.IdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/persons/duplicates": {
+            "get": {
+                "description": "Группы вероятных дубликатов: совпадают имя, фамилия и отчество без учета регистра и знаков,\nпол и национальность совпадают или не заполнены, возраст отличается не больше чем на 2 года.\nsurvivor_id - запись, которая останется при слиянии без явного выбора",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Поиск дубликатов",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Число групп",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.DuplicateGroup"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/persons/merge": {
+            "post": {
+                "description": "Сливает записи в одну. Если survivor_id не задан, остается запись с наибольшим числом заполненных полей\n(при равенстве - более ранняя). Пустые поля оставшейся записи заполняются из остальных, начиная с последней измененной.\nОстальные записи удаляются мягко, GET /persons/{id} по их ID перенаправляет на оставшуюся запись",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Слияние дубликатов",
+                "parameters": [
+                    {
+                        "description": "ID записей и, необязательно, ID оставшейся записи",
+                        "name": "merge",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.MergeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Person"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия оставшейся записи"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/persons/search": {
+            "get": {
+                "description": "Нечеткий поиск по имени, фамилии и отчеству: учитывает опечатки (pg_trgm) и транслитерацию, \"Ivanov\" находит \"Иванов\" и \"Ivanova\". Лучшие совпадения первыми.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Поиск людей",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Строка поиска",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Limit (по умолчанию 20, не больше 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.SearchResult"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/persons/stats": {
+            "get": {
+                "description": "Число людей по полу, национальности и возрастным корзинам, самые частые имена и фамилии и доля записей с заполненными возрастом, полом и национальностью. Принимает те же фильтры, что и GET /persons. В genders и nationalities пустое value - поле не заполнено.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Статистика по людям",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Ширина возрастной корзины (по умолчанию 10, от 1 до 100)",
+                        "name": "bucket",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Сколько самых частых имен и фамилий вернуть (по умолчанию 10, не больше 100)",
+                        "name": "top",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID через запятую",
+                        "name": "ids",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name, несколько через запятую",
                         "name": "name",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Surname",
+                        "description": "Surname, несколько через запятую",
                         "name": "surname",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Patronymic",
+                        "description": "Patronymic, несколько через запятую",
                         "name": "patronymic",
                         "in": "query"
                     },
                     {
-                        "type": "integer",
-                        "description": "Age",
+                        "type": "string",
+                        "description": "Имя начинается с",
+                        "name": "name_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Фамилия начинается с",
+                        "name": "surname_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Отчество начинается с",
+                        "name": "patronymic_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Age, несколько через запятую",
                         "name": "age",
                         "in": "query"
                     },
+                    {
+                        "type": "integer",
+                        "description": "Минимальный возраст включительно",
+                        "name": "age_min",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Максимальный возраст включительно",
+                        "name": "age_max",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
-                        "description": "Gender (male or female)",
+                        "description": "Gender (male or female), несколько через запятую",
                         "name": "gender",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Nationality",
+                        "description": "Nationality, несколько через запятую",
                         "name": "nationality",
                         "in": "query"
                     },
                     {
-                        "type": "integer",
-                        "description": "Limit",
-                        "name": "limit",
+                        "type": "string",
+                        "description": "Создан не раньше (RFC 3339 или YYYY-MM-DD)",
+                        "name": "created_after",
                         "in": "query"
                     },
                     {
-                        "type": "integer",
-                        "description": "Offset",
-                        "name": "offset",
+                        "type": "string",
+                        "description": "Создан раньше (RFC 3339 или YYYY-MM-DD)",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Изменен не раньше (RFC 3339 или YYYY-MM-DD)",
+                        "name": "updated_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Изменен раньше (RFC 3339 или YYYY-MM-DD)",
+                        "name": "updated_before",
                         "in": "query"
                     }
                 ],
@@ -82,9 +747,68 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/model.Person"
+                            "$ref": "#/definitions/model.Demographics"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/persons/{id}": {
+            "get": {
+                "description": "Получение подробныйх данных о человеке по ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Получение данных о человеке по ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Person ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Person"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия записи для If-Match"
+                            }
+                        }
+                    },
+                    "301": {
+                        "description": "Запись слита с другой (POST /persons/merge)",
+                        "schema": {
+                            "type": "string"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "Адрес оставшейся записи"
                             }
                         }
                     },
@@ -94,6 +818,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/model.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -102,8 +832,8 @@ const docTemplate = `{
                     }
                 }
             },
-            "post": {
-                "description": "Добавление и обогащение данными ФИО.",
+            "put": {
+                "description": "Обновение данных о человеке по ID",
                 "consumes": [
                     "application/json"
                 ],
@@ -113,24 +843,97 @@ const docTemplate = `{
                 "tags": [
                     "persons"
                 ],
-                "summary": "Создает нового пользователя.",
+                "summary": "Обновление данных о человеке",
                 "parameters": [
                     {
-                        "description": "Person info",
+                        "type": "integer",
+                        "description": "Person ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated person info",
                         "name": "person",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/model.PersonCreateRequest"
+                            "$ref": "#/definitions/model.PersonUpdateRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag из GET /persons/{id}, обновление выполняется только если запись не менялась",
+                        "name": "If-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Новая версия записи"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/model.IdResponse"
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
                         }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Мягкое удаление человека по ID. Запись можно восстановить, пока она не очищена по истечении срока хранения",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "Удаление человека",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Person ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
                     },
                     "400": {
                         "description": "Bad Request",
@@ -138,6 +941,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/model.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -145,11 +954,9 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/persons/{id}": {
-            "get": {
-                "description": "Получение подробныйх данных о человеке по ID",
+            },
+            "patch": {
+                "description": "JSON Merge Patch (RFC 7396): поля, которых нет в запросе, не меняются, null очищает поле, нулевой возраст и пустые пол и национальность отклоняются. Очистить можно отчество, возраст, национальность и пол, имя и фамилию - нет. Меняются только переданные колонки, поэтому параллельные изменения других полей не затираются",
                 "consumes": [
                     "application/json"
                 ],
@@ -159,7 +966,7 @@ const docTemplate = `{
                 "tags": [
                     "persons"
                 ],
-                "summary": "Получение данных о человеке по ID",
+                "summary": "Частичное обновление данных о человеке",
                 "parameters": [
                     {
                         "type": "integer",
@@ -167,6 +974,21 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Изменяемые поля, null - очистить",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.PersonPatch"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag из GET /persons/{id}, обновление выполняется только если запись не менялась",
+                        "name": "If-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -174,6 +996,12 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/model.Person"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Новая версия записи"
+                            }
                         }
                     },
                     "400": {
@@ -188,6 +1016,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/model.ErrorResponse"
                         }
                     },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -195,19 +1029,68 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Обновение данных о человеке по ID",
-                "consumes": [
+            }
+        },
+        "/persons/{id}/history": {
+            "get": {
+                "description": "Все изменения записи по возрастанию версии: действие, данные до и после, изменившиеся поля, автор (заголовок X-Actor) и время",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "persons"
+                ],
+                "summary": "История изменений человека",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Person ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.PersonHistory"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/persons/{id}/history/{version}/revert": {
+            "post": {
+                "description": "Возвращает данные человека к состоянию после указанной версии. Откат записывается в историю как новая версия.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "persons"
                 ],
-                "summary": "Обновление данных о человеке",
+                "summary": "Откат к версии",
                 "parameters": [
                     {
                         "type": "integer",
@@ -217,18 +1100,19 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Updated person info",
-                        "name": "person",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/model.PersonUpdateRequest"
-                        }
+                        "type": "integer",
+                        "description": "Version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Person"
+                        }
                     },
                     "400": {
                         "description": "Bad Request",
@@ -249,19 +1133,18 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Удаление человека из базы данных по ID",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/persons/{id}/restore": {
+            "post": {
+                "description": "Снимает пометку удаления с записи, пока она не очищена окончательно",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "persons"
                 ],
-                "summary": "Удаление человека",
+                "summary": "Восстановление удаленного человека",
                 "parameters": [
                     {
                         "type": "integer",
@@ -298,6 +1181,124 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "model.AgeBucket": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "from": {
+                    "type": "integer"
+                },
+                "to": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.BulkCreateResult": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.BulkRowError"
+                    }
+                },
+                "ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "model.BulkRowError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.Coverage": {
+            "type": "object",
+            "properties": {
+                "age": {
+                    "type": "number"
+                },
+                "complete": {
+                    "type": "number"
+                },
+                "gender": {
+                    "type": "number"
+                },
+                "nationality": {
+                    "type": "number"
+                }
+            }
+        },
+        "model.Demographics": {
+            "type": "object",
+            "properties": {
+                "age_buckets": {
+                    "description": "AgeBuckets - только люди с известным возрастом, пустые корзины пропускаются",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.AgeBucket"
+                    }
+                },
+                "coverage": {
+                    "$ref": "#/definitions/model.Coverage"
+                },
+                "genders": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.ValueCount"
+                    }
+                },
+                "nationalities": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.ValueCount"
+                    }
+                },
+                "top_names": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.ValueCount"
+                    }
+                },
+                "top_surnames": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.ValueCount"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.DuplicateGroup": {
+            "type": "object",
+            "properties": {
+                "persons": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Person"
+                    }
+                },
+                "survivor_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "model.ErrorResponse": {
             "type": "object",
             "properties": {
@@ -306,6 +1307,27 @@ const docTemplate = `{
                 }
             }
         },
+        "model.FieldChange": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "from": {},
+                "to": {}
+            }
+        },
+        "model.HealthResponse": {
+            "type": "object",
+            "properties": {
+                "cache": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
         "model.IdResponse": {
             "type": "object",
             "properties": {
@@ -314,6 +1336,20 @@ const docTemplate = `{
                 }
             }
         },
+        "model.MergeRequest": {
+            "type": "object",
+            "properties": {
+                "ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "survivor_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "model.Person": {
             "type": "object",
             "properties": {
@@ -323,6 +1359,10 @@ const docTemplate = `{
                 "created_at": {
                     "type": "string"
                 },
+                "deleted_at": {
+                    "description": "DeletedAt - время мягкого удаления, заполняется только в списке удаленных записей",
+                    "type": "string"
+                },
                 "gender": {
                     "type": "string"
                 },
@@ -343,6 +1383,10 @@ const docTemplate = `{
                 },
                 "updated_at": {
                     "type": "string"
+                },
+                "version": {
+                    "description": "Version - увеличивается при каждом изменении записи, используется для оптимистичной блокировки (ETag)",
+                    "type": "integer"
                 }
             }
         },
@@ -360,6 +1404,94 @@ const docTemplate = `{
                 }
             }
         },
+        "model.PersonHistory": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "after": {
+                    "$ref": "#/definitions/model.Person"
+                },
+                "before": {
+                    "$ref": "#/definitions/model.Person"
+                },
+                "changed_at": {
+                    "type": "string"
+                },
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.FieldChange"
+                    }
+                },
+                "person_id": {
+                    "type": "integer"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.PersonPage": {
+            "type": "object",
+            "properties": {
+                "facets": {
+                    "description": "Facets - число людей по значениям полей из параметра facets для всего фильтра, а не только страницы",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "$ref": "#/definitions/model.ValueCount"
+                        }
+                    }
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Person"
+                    }
+                },
+                "next_cursor": {
+                    "type": "string"
+                },
+                "prev_cursor": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "total_estimated": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "model.PersonPatch": {
+            "type": "object",
+            "properties": {
+                "age": {
+                    "type": "integer"
+                },
+                "gender": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "nationality": {
+                    "type": "string"
+                },
+                "patronymic": {
+                    "type": "string"
+                },
+                "surname": {
+                    "type": "string"
+                }
+            }
+        },
         "model.PersonUpdateRequest": {
             "type": "object",
             "properties": {
@@ -382,6 +1514,124 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "model.PoolStats": {
+            "type": "object",
+            "properties": {
+                "idle": {
+                    "type": "integer"
+                },
+                "in_use": {
+                    "type": "integer"
+                },
+                "max_idle_closed": {
+                    "description": "Max*Closed - сколько соединений закрыто по MaxIdleConns, ConnMaxIdleTime и ConnMaxLifetime",
+                    "type": "integer"
+                },
+                "max_idle_time_closed": {
+                    "type": "integer"
+                },
+                "max_lifetime_closed": {
+                    "type": "integer"
+                },
+                "max_open_connections": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "open_connections": {
+                    "type": "integer"
+                },
+                "wait_count": {
+                    "description": "WaitCount и WaitDurationMs - сколько раз и сколько всего запросы ждали свободного соединения с запуска",
+                    "type": "integer"
+                },
+                "wait_duration_ms": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.SearchResult": {
+            "type": "object",
+            "properties": {
+                "age": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "deleted_at": {
+                    "description": "DeletedAt - время мягкого удаления, заполняется только в списке удаленных записей",
+                    "type": "string"
+                },
+                "gender": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "nationality": {
+                    "type": "string"
+                },
+                "patronymic": {
+                    "type": "string"
+                },
+                "score": {
+                    "type": "number"
+                },
+                "surname": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Version - увеличивается при каждом изменении записи, используется для оптимистичной блокировки (ETag)",
+                    "type": "integer"
+                }
+            }
+        },
+        "model.ValueCount": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.WarmupStatus": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "processed": {
+                    "type": "integer"
+                },
+                "running": {
+                    "type": "boolean"
+                },
+                "started_at": {
+                    "type": "string"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "AdminToken": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
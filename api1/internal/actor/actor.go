@@ -0,0 +1,25 @@
+package actor
+
+import "context"
+
+const (
+	// System - автор изменений, сделанных не по HTTP-запросу (фоновые задачи, тесты)
+	System = "system"
+	// Anonymous - автор HTTP-запроса без заголовка X-Actor
+	Anonymous = "anonymous"
+)
+
+type ctxKey struct{}
+
+// WithActor - сохраняет в контексте автора изменения, он записывается в историю изменений
+func WithActor(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, name)
+}
+
+// FromContext - автор изменения из контекста, System если не задан
+func FromContext(ctx context.Context) string {
+	if name, ok := ctx.Value(ctxKey{}).(string); ok && name != "" {
+		return name
+	}
+	return System
+}
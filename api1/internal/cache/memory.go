@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+)
+
+const (
+	sweepInterval = time.Minute
+)
+
+type memoryEntry struct {
+	stats     model.CachedStats
+	expiresAt time.Time
+}
+
+type memoryList struct {
+	persons   []model.Person
+	expiresAt time.Time
+}
+
+// MemoryCache - кэш в памяти процесса с TTL для локальной разработки и тестов
+type MemoryCache struct {
+	mu          sync.Mutex
+	entries     map[string]memoryEntry
+	lists       map[string]memoryList
+	generations map[string]int64
+	policy      Policy
+	lastSweep   time.Time
+}
+
+func NewMemoryCache(policy Policy) *MemoryCache {
+	return &MemoryCache{
+		entries:     make(map[string]memoryEntry),
+		lists:       make(map[string]memoryList),
+		generations: make(map[string]int64),
+		policy:      policy.withDefaults(),
+		lastSweep:   time.Now(),
+	}
+}
+
+func (c *MemoryCache) SetPersonWithTTL(ctx context.Context, name string, person model.PersonStats) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.entries[name] = memoryEntry{stats: c.policy.entry(person, now), expiresAt: now.Add(c.policy.ttl())}
+	// Просроченные ключи удаляются при чтении, а те, что никто не читает, - периодически при записи
+	if now.Sub(c.lastSweep) > sweepInterval {
+		c.sweep(now)
+	}
+	return nil
+}
+
+func (c *MemoryCache) sweep(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	for key, list := range c.lists {
+		if now.After(list.expiresAt) {
+			delete(c.lists, key)
+		}
+	}
+	c.lastSweep = now
+}
+
+func (c *MemoryCache) SetPersons(ctx context.Context, stats []model.NameStats) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, s := range stats {
+		if entry, ok := c.entries[s.Name]; ok && now.Before(entry.expiresAt) {
+			continue
+		}
+		c.entries[s.Name] = memoryEntry{stats: c.policy.entry(s.PersonStats, now), expiresAt: now.Add(c.policy.ttl())}
+	}
+	return nil
+}
+
+// GetPerson - если ключ не найден или истек его TTL, возвращается ErrKeyNotFound
+func (c *MemoryCache) GetPerson(ctx context.Context, name string) (*model.CachedStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[name]
+	if !ok {
+		return nil, customerrors.ErrKeyNotFound
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, name)
+		return nil, customerrors.ErrKeyNotFound
+	}
+	stats := entry.stats
+	return &stats, nil
+}
+
+func (c *MemoryCache) GetList(ctx context.Context, key string) ([]model.Person, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list, ok := c.lists[key]
+	if !ok || time.Now().After(list.expiresAt) {
+		delete(c.lists, key)
+		return nil, customerrors.ErrKeyNotFound
+	}
+	return append(make([]model.Person, 0, len(list.persons)), list.persons...), nil
+}
+
+func (c *MemoryCache) SetList(ctx context.Context, key string, persons []model.Person, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.lists[key] = memoryList{persons: append([]model.Person(nil), persons...), expiresAt: now.Add(ttl)}
+	if now.Sub(c.lastSweep) > sweepInterval {
+		c.sweep(now)
+	}
+	return nil
+}
+
+func (c *MemoryCache) Generation(ctx context.Context, table string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[table], nil
+}
+
+func (c *MemoryCache) BumpGeneration(ctx context.Context, table string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[table]++
+	return nil
+}
+
+func (c *MemoryCache) Ping(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+)
+
+// NoopCache - кэш-заглушка для запуска без Redis: ничего не хранит, любой ключ отсутствует
+type NoopCache struct{}
+
+func NewNoopCache() Cache {
+	return NoopCache{}
+}
+
+func (NoopCache) SetPersonWithTTL(ctx context.Context, name string, person model.PersonStats) error {
+	return nil
+}
+
+func (NoopCache) SetPersons(ctx context.Context, stats []model.NameStats) error {
+	return nil
+}
+
+func (NoopCache) GetPerson(ctx context.Context, name string) (*model.CachedStats, error) {
+	return nil, customerrors.ErrKeyNotFound
+}
+
+func (NoopCache) GetList(ctx context.Context, key string) ([]model.Person, error) {
+	return nil, customerrors.ErrKeyNotFound
+}
+
+func (NoopCache) SetList(ctx context.Context, key string, persons []model.Person, ttl time.Duration) error {
+	return nil
+}
+
+func (NoopCache) Generation(ctx context.Context, table string) (int64, error) {
+	return 0, nil
+}
+
+func (NoopCache) BumpGeneration(ctx context.Context, table string) error {
+	return nil
+}
+
+func (NoopCache) Ping(ctx context.Context) error {
+	return customerrors.ErrCacheDisabled
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+// Options - настройки подключения к Redis.
+// Mode: standalone (один узел), sentinel (Addrs - адреса sentinel, MasterName - имя мастера) или cluster (Addrs - начальные узлы).
+type Options struct {
+	Mode       string
+	Addrs      []string
+	MasterName string
+	// Username/Password - ACL-пользователь Redis, SentinelUsername/SentinelPassword - для самих sentinel, если они защищены
+	Username         string
+	Password         string
+	SentinelUsername string
+	SentinelPassword string
+	DB               int
+
+	TLS bool
+	// TLSCAFile - сертификат CA в PEM, если сервер использует сертификат частного CA
+	TLSCAFile             string
+	TLSInsecureSkipVerify bool
+
+	Timeout       time.Duration
+	RetryInterval time.Duration
+	Policy        Policy
+}
+
+// newUniversalClient - режим задается явно, а не угадывается по числу адресов, как в redis.NewUniversalClient:
+// кластер с одним начальным узлом и sentinel без MasterName должны давать разные клиенты или ошибку
+func newUniversalClient(opts Options) (redis.UniversalClient, error) {
+	if len(opts.Addrs) == 0 {
+		return nil, fmt.Errorf("не указан адрес Redis")
+	}
+	u := &redis.UniversalOptions{
+		Addrs:            opts.Addrs,
+		MasterName:       opts.MasterName,
+		Username:         opts.Username,
+		Password:         opts.Password,
+		SentinelUsername: opts.SentinelUsername,
+		SentinelPassword: opts.SentinelPassword,
+		DB:               opts.DB,
+		DialTimeout:      opts.Timeout,
+		ReadTimeout:      opts.Timeout,
+		WriteTimeout:     opts.Timeout,
+	}
+	if opts.TLS {
+		tlsConfig, err := newTLSConfig(opts)
+		if err != nil {
+			return nil, err
+		}
+		u.TLSConfig = tlsConfig
+	}
+
+	switch opts.Mode {
+	case ModeStandalone, "":
+		if len(opts.Addrs) > 1 {
+			return nil, fmt.Errorf("в режиме standalone указано несколько адресов Redis: %v", opts.Addrs)
+		}
+		return redis.NewClient(u.Simple()), nil
+	case ModeSentinel:
+		if opts.MasterName == "" {
+			return nil, fmt.Errorf("в режиме sentinel не указано имя мастера")
+		}
+		return redis.NewFailoverClient(u.Failover()), nil
+	case ModeCluster:
+		if opts.DB != 0 {
+			return nil, fmt.Errorf("в режиме cluster поддерживается только DB 0, указано %d", opts.DB)
+		}
+		return redis.NewClusterClient(u.Cluster()), nil
+	}
+	return nil, fmt.Errorf("неизвестный режим Redis: %s", opts.Mode)
+}
+
+func newTLSConfig(opts Options) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.TLSInsecureSkipVerify,
+	}
+	if opts.TLSCAFile == "" {
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(opts.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать CA для Redis: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("в файле %s нет сертификатов в формате PEM", opts.TLSCAFile)
+	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
+}
@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUniversalClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		want    any
+		wantErr bool
+	}{
+		{name: "Standalone", opts: Options{Mode: ModeStandalone, Addrs: []string{"redis:6379"}}, want: &redis.Client{}},
+		{name: "Default mode", opts: Options{Addrs: []string{"redis:6379"}}, want: &redis.Client{}},
+		{name: "Sentinel", opts: Options{Mode: ModeSentinel, Addrs: []string{"s1:26379", "s2:26379"}, MasterName: "mymaster"}, want: &redis.Client{}},
+		{name: "Cluster with one seed", opts: Options{Mode: ModeCluster, Addrs: []string{"node1:6379"}}, want: &redis.ClusterClient{}},
+		{name: "TLS with ACL user", opts: Options{Addrs: []string{"redis:6380"}, Username: "app", Password: "secret", TLS: true}, want: &redis.Client{}},
+		{name: "No address", opts: Options{Mode: ModeStandalone}, wantErr: true},
+		{name: "Standalone with several addresses", opts: Options{Addrs: []string{"a:6379", "b:6379"}}, wantErr: true},
+		{name: "Sentinel without master", opts: Options{Mode: ModeSentinel, Addrs: []string{"s1:26379"}}, wantErr: true},
+		{name: "Cluster with DB", opts: Options{Mode: ModeCluster, Addrs: []string{"node1:6379"}, DB: 1}, wantErr: true},
+		{name: "Unknown mode", opts: Options{Mode: "replica", Addrs: []string{"redis:6379"}}, wantErr: true},
+		{name: "Missing CA file", opts: Options{Addrs: []string{"redis:6380"}, TLS: true, TLSCAFile: "/nonexistent/ca.pem"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newUniversalClient(tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer client.Close()
+			assert.IsType(t, tt.want, client)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+)
+
+const (
+	defaultFreshTTL = 5 * time.Hour
+	defaultStaleTTL = 24 * time.Hour
+)
+
+// Policy - сроки жизни записей обогащения (stale-while-revalidate).
+// FreshTTL запись считается актуальной, затем еще StaleTTL отдается как устаревшая,
+// пока данные обновляются в фоне или внешние API недоступны.
+type Policy struct {
+	FreshTTL time.Duration
+	StaleTTL time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{FreshTTL: defaultFreshTTL, StaleTTL: defaultStaleTTL}
+}
+
+// withDefaults - нулевые значения заменяются значениями по умолчанию, отрицательный StaleTTL отключает устаревшие записи
+func (p Policy) withDefaults() Policy {
+	if p.FreshTTL <= 0 {
+		p.FreshTTL = defaultFreshTTL
+	}
+	if p.StaleTTL == 0 {
+		p.StaleTTL = defaultStaleTTL
+	}
+	if p.StaleTTL < 0 {
+		p.StaleTTL = 0
+	}
+	return p
+}
+
+// ttl - сколько запись хранится в кэше целиком
+func (p Policy) ttl() time.Duration {
+	return p.FreshTTL + p.StaleTTL
+}
+
+func (p Policy) entry(stats model.PersonStats, now time.Time) model.CachedStats {
+	return model.CachedStats{PersonStats: stats, FreshUntil: now.Add(p.FreshTTL)}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
@@ -13,43 +14,138 @@ import (
 	"go.uber.org/zap"
 )
 
-const(
-	defaultTTL = 5 * time.Hour
-)
-
 type Cache interface {
 	SetPersonWithTTL(ctx context.Context, name string, person model.PersonStats) error
-	GetPerson(ctx context.Context, name string) (*model.PersonStats, error)
+	// GetPerson - запись может быть устаревшей (CachedStats.Stale), решение об обновлении принимает вызывающий
+	GetPerson(ctx context.Context, name string) (*model.CachedStats, error)
+	// SetPersons - пакетная запись данных обогащения для прогрева кэша, существующие ключи не перезаписываются
+	SetPersons(ctx context.Context, stats []model.NameStats) error
+	// GetList/SetList - страницы списка людей, ключ строит вызывающий
+	GetList(ctx context.Context, key string) ([]model.Person, error)
+	SetList(ctx context.Context, key string, persons []model.Person, ttl time.Duration) error
+	// Generation - поколение данных таблицы, BumpGeneration увеличивает его после каждого изменения.
+	// Поколение входит в ключи списков, поэтому после изменения старые страницы перестают читаться.
+	Generation(ctx context.Context, table string) (int64, error)
+	BumpGeneration(ctx context.Context, table string) error
+	// Ping - проверка доступности кэша, для no-op кэша возвращает ErrCacheDisabled
+	Ping(ctx context.Context) error
 }
 
+// Ключи Redis разнесены по префиксам: данные обогащения лежат под enrich:<имя>, счетчик поколения под
+// <таблица>:generation, страницы списков под <таблица>:list:... (см. storage.listKey). Имя приходит от клиента,
+// поэтому без префикса запись о человеке с именем "people:generation" затерла бы счетчик поколения
+const enrichPrefix = "enrich:"
 
-type RedisClient struct {
-	client *redis.Client
-	logger logger.Logger
+func enrichKey(name string) string {
+	return enrichPrefix + name
+}
+
+func generationKey(table string) string {
+	return table + ":generation"
 }
 
-func NewRedisClient(addr, password string, db int,logger logger.Logger) (Cache, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       db,
-	})
 
-	ctx := context.Background()
-	_, err := rdb.Ping(ctx).Result()
+type RedisClient struct {
+	// client - redis.Client, FailoverClient или ClusterClient в зависимости от Options.Mode
+	client  redis.UniversalClient
+	logger  logger.Logger
+	timeout time.Duration
+	policy  Policy
+	// available - результат последней проверки соединения, пока Redis недоступен запросы к нему не отправляются
+	available atomic.Bool
+	stop      chan struct{}
+}
+
+// NewRedisClient - создает клиент и проверяет соединение, если Redis недоступен, возвращает ошибку
+func NewRedisClient(opts Options, logger logger.Logger) (Cache, error) {
+	r, err := newRedisClient(opts, logger)
 	if err != nil {
+		return nil, err
+	}
+
+	if err := r.Ping(context.Background()); err != nil {
+		r.client.Close()
 		return nil, fmt.Errorf("не удалось подключиться к Redis: %w", err)
 	}
+	go r.watch(opts.RetryInterval)
+
+	return r, nil
+}
+
+// NewRedisClientWithRetry - создает клиент без ожидания Redis, соединение проверяется в фоне каждые opts.RetryInterval.
+// Пока Redis недоступен, операции с кэшем сразу возвращают ErrCacheUnavailable.
+// Ошибка возвращается только при некорректных настройках.
+func NewRedisClientWithRetry(opts Options, logger logger.Logger) (Cache, error) {
+	r, err := newRedisClient(opts, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.Ping(context.Background()); err != nil {
+		logger.Warn("Redis недоступен, сервис работает без кэша", zap.Strings("addrs", opts.Addrs), zap.Error(err))
+	}
+	go r.watch(opts.RetryInterval)
 
-	return &RedisClient{client: rdb,logger : logger,}, nil
+	return r, nil
 }
+
+func newRedisClient(opts Options, logger logger.Logger) (*RedisClient, error) {
+	rdb, err := newUniversalClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Клиент Redis создан", zap.String("mode", opts.Mode), zap.Strings("addrs", opts.Addrs), zap.Bool("tls", opts.TLS))
+
+	return &RedisClient{client: rdb, logger: logger, timeout: opts.Timeout, policy: opts.Policy.withDefaults(), stop: make(chan struct{})}, nil
+}
+
+func (r *RedisClient) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			wasAvailable := r.available.Load()
+			err := r.Ping(context.Background())
+			if err != nil && wasAvailable {
+				r.logger.Warn("Потеряно соединение с Redis", zap.Error(err))
+			}
+			if err == nil && !wasAvailable {
+				r.logger.Info("Соединение с Redis восстановлено")
+			}
+		}
+	}
+}
+
+// Ping - проверяет соединение с Redis и обновляет признак доступности
+func (r *RedisClient) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	err := r.client.Ping(ctx).Err()
+	r.available.Store(err == nil)
+	return err
+}
+
+// Close - останавливает фоновую проверку соединения и закрывает клиент
+func (r *RedisClient) Close() error {
+	close(r.stop)
+	return r.client.Close()
+}
+
 func (r *RedisClient) SetPersonWithTTL(ctx context.Context, name string, person model.PersonStats, ) error {
-	key := name
-	value, err := json.Marshal(person)
+	if !r.available.Load() {
+		return customerrors.ErrCacheUnavailable
+	}
+	key := enrichKey(name)
+	value, err := json.Marshal(r.policy.entry(person, time.Now()))
 	if err != nil {
 		return fmt.Errorf("ошибка при сериализации объекта Person в JSON: %w", err)
 	}
-	err = r.client.SetEx(ctx, key, value, defaultTTL).Err()
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	err = r.client.SetEx(ctx, key, value, r.policy.ttl()).Err()
 	if err != nil {
 		return fmt.Errorf("ошибка при записи ключа %s с TTL: %w", key, err)
 	}
@@ -57,20 +153,113 @@ func (r *RedisClient) SetPersonWithTTL(ctx context.Context, name string, person
 	return nil
 }
 
-// GetPerson - получить PersonStats по имени из Redis, если ключ не найден, то возвращается ErrKeyNotFound
-func (r *RedisClient) GetPerson(ctx context.Context, name string) (*model.PersonStats, error) {
-	key := name
+// SetPersons - записывает пачку ключей одним pipeline-запросом, SET NX не затирает более свежие данные из API
+func (r *RedisClient) SetPersons(ctx context.Context, stats []model.NameStats) error {
+	if !r.available.Load() {
+		return customerrors.ErrCacheUnavailable
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	now := time.Now()
+	pipe := r.client.Pipeline()
+	for _, s := range stats {
+		value, err := json.Marshal(r.policy.entry(s.PersonStats, now))
+		if err != nil {
+			return fmt.Errorf("ошибка при сериализации объекта Person в JSON: %w", err)
+		}
+		pipe.SetNX(ctx, enrichKey(s.Name), value, r.policy.ttl())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("ошибка при пакетной записи %d ключей: %w", len(stats), err)
+	}
+	r.logger.Debug("Пачка ключей записана в Redis", zap.Int("count", len(stats)))
+	return nil
+}
+
+// GetPerson - получить данные обогащения по имени из Redis, если ключ не найден, то возвращается ErrKeyNotFound.
+// Записи старого формата без fresh_until считаются устаревшими.
+func (r *RedisClient) GetPerson(ctx context.Context, name string) (*model.CachedStats, error) {
+	if !r.available.Load() {
+		return nil, customerrors.ErrCacheUnavailable
+	}
+	key := enrichKey(name)
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
 	value, err := r.client.Get(ctx, key).Result()
 	if err == redis.Nil {
-		return nil, customerrors.ErrKeyNotFound 
+		return nil, customerrors.ErrKeyNotFound
 	} else if err != nil {
 		return nil, fmt.Errorf("ошибка при чтении ключа %s: %w", key, err)
 	}
 
-	var person model.PersonStats
+	var person model.CachedStats
 	err = json.Unmarshal([]byte(value), &person)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при десериализации JSON в объект Person: %w", err)
 	}
 	return &person, nil
 }
+
+func (r *RedisClient) GetList(ctx context.Context, key string) ([]model.Person, error) {
+	if !r.available.Load() {
+		return nil, customerrors.ErrCacheUnavailable
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	value, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, customerrors.ErrKeyNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении ключа %s: %w", key, err)
+	}
+
+	persons := make([]model.Person, 0)
+	if err := json.Unmarshal(value, &persons); err != nil {
+		return nil, fmt.Errorf("ошибка при десериализации списка людей: %w", err)
+	}
+	return persons, nil
+}
+
+func (r *RedisClient) SetList(ctx context.Context, key string, persons []model.Person, ttl time.Duration) error {
+	if !r.available.Load() {
+		return customerrors.ErrCacheUnavailable
+	}
+	value, err := json.Marshal(persons)
+	if err != nil {
+		return fmt.Errorf("ошибка при сериализации списка людей: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	if err := r.client.SetEx(ctx, key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("ошибка при записи ключа %s с TTL: %w", key, err)
+	}
+	return nil
+}
+
+// Generation - если счетчика еще нет, поколение равно 0
+func (r *RedisClient) Generation(ctx context.Context, table string) (int64, error) {
+	if !r.available.Load() {
+		return 0, customerrors.ErrCacheUnavailable
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	gen, err := r.client.Get(ctx, generationKey(table)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("ошибка при чтении поколения %s: %w", table, err)
+	}
+	return gen, nil
+}
+
+func (r *RedisClient) BumpGeneration(ctx context.Context, table string) error {
+	if !r.available.Load() {
+		return customerrors.ErrCacheUnavailable
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	if err := r.client.Incr(ctx, generationKey(table)).Err(); err != nil {
+		return fmt.Errorf("ошибка при увеличении поколения %s: %w", table, err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeRedis - хук go-redis, который выполняет GET, SETEX и INCR над map вместо сервера
+type fakeRedis struct {
+	data map[string]string
+}
+
+func (f *fakeRedis) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (f *fakeRedis) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		args := cmd.Args()
+		key := fmt.Sprint(args[1])
+		switch c := cmd.(type) {
+		case *redis.StringCmd:
+			value, ok := f.data[key]
+			if !ok {
+				c.SetErr(redis.Nil)
+				return redis.Nil
+			}
+			c.SetVal(value)
+		case *redis.StatusCmd:
+			value := args[len(args)-1]
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+			f.data[key] = fmt.Sprint(value)
+			c.SetVal("OK")
+		case *redis.IntCmd:
+			n, err := strconv.ParseInt(f.data[key], 10, 64)
+			if _, ok := f.data[key]; ok && err != nil {
+				err = fmt.Errorf("ERR value is not an integer or out of range")
+				c.SetErr(err)
+				return err
+			}
+			f.data[key] = strconv.FormatInt(n+1, 10)
+			c.SetVal(n + 1)
+		default:
+			return fmt.Errorf("команда %s не поддерживается", cmd.Name())
+		}
+		return nil
+	}
+}
+
+func (f *fakeRedis) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func newFakeRedisClient(t *testing.T) (*RedisClient, *fakeRedis) {
+	fake := &fakeRedis{data: make(map[string]string)}
+	client := redis.NewClient(&redis.Options{Addr: "fake:6379"})
+	client.AddHook(fake)
+	t.Cleanup(func() { client.Close() })
+	r := &RedisClient{client: client, logger: zap.NewNop(), timeout: time.Second, policy: DefaultPolicy(), stop: make(chan struct{})}
+	r.available.Store(true)
+	return r, fake
+}
+
+func TestRedisKeysDoNotOverlap(t *testing.T) {
+	ctx := context.Background()
+	r, fake := newFakeRedisClient(t)
+	stats := model.PersonStats{Age: 30, Gender: "male", Nationality: "RU"}
+
+	require.NoError(t, r.BumpGeneration(ctx, "people"))
+	// имена совпадают с ключами счетчика поколения и страниц списков
+	for _, name := range []string{"people:generation", "generation:people", "people:list:1:abc"} {
+		require.NoError(t, r.SetPersonWithTTL(ctx, name, stats))
+	}
+	require.NoError(t, r.BumpGeneration(ctx, "people"))
+
+	gen, err := r.Generation(ctx, "people")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), gen, "запись обогащения не должна затирать счетчик поколения")
+
+	cached, err := r.GetPerson(ctx, "people:generation")
+	require.NoError(t, err)
+	assert.Equal(t, stats, cached.PersonStats)
+
+	_, err = r.GetList(ctx, "people:list:1:abc")
+	assert.Error(t, err, "запись обогащения не должна читаться как страница списка")
+	for key := range fake.data {
+		assert.True(t, key == generationKey("people") || strings.HasPrefix(key, enrichPrefix), key)
+	}
+}
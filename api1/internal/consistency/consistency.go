@@ -0,0 +1,17 @@
+package consistency
+
+import "context"
+
+type ctxKey struct{}
+
+// WithPrimary - чтения с этим контекстом идут в primary, а не в реплики: клиент только что писал
+// и должен увидеть свои изменения без задержки репликации (read-your-writes)
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKey{}, true)
+}
+
+// Primary - нужно ли читать из primary
+func Primary(ctx context.Context) bool {
+	primary, _ := ctx.Value(ctxKey{}).(bool)
+	return primary
+}
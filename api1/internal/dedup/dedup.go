@@ -0,0 +1,145 @@
+package dedup
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/search"
+)
+
+// AgeTolerance - на сколько лет может отличаться возраст у дубликатов: данные обогащения приблизительные
+const AgeTolerance = 2
+
+// Key - нормализованные имя, фамилия и отчество. У дубликатов ключи совпадают
+func Key(person model.Person) string {
+	key := search.Normalize(person.Name) + "|" + search.Normalize(person.Surname) + "|" + search.Normalize(person.Patronymic)
+	return strings.ReplaceAll(key, "ё", "е")
+}
+
+// Similar - демография не противоречит: пол, национальность и возраст (с точностью до AgeTolerance)
+// совпадают или не заполнены хотя бы у одного из двух
+func Similar(a, b model.Person) bool {
+	if a.Gender != "" && b.Gender != "" && a.Gender != b.Gender {
+		return false
+	}
+	if a.Nationality != "" && b.Nationality != "" && a.Nationality != b.Nationality {
+		return false
+	}
+	if a.Age != 0 && b.Age != 0 && (a.Age-b.Age > AgeTolerance || b.Age-a.Age > AgeTolerance) {
+		return false
+	}
+	return true
+}
+
+// Group - группы вероятных дубликатов среди persons: одинаковый Key и Similar со всеми в группе.
+// Человек попадает в первую по ID подходящую группу. Группы упорядочены по наименьшему ID,
+// люди в группе - по ID, limit = 0 означает без ограничения
+func Group(persons []model.Person, limit int) []model.DuplicateGroup {
+	sorted := slices.Clone(persons)
+	slices.SortFunc(sorted, func(a, b model.Person) int { return cmp.Compare(a.ID, b.ID) })
+
+	// byKey - индексы кластеров в clusters с данным ключом
+	var clusters [][]model.Person
+	byKey := make(map[string][]int)
+	for _, person := range sorted {
+		key := Key(person)
+		placed := false
+		for _, i := range byKey[key] {
+			if similarToAll(person, clusters[i]) {
+				clusters[i] = append(clusters[i], person)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			byKey[key] = append(byKey[key], len(clusters))
+			clusters = append(clusters, []model.Person{person})
+		}
+	}
+
+	groups := make([]model.DuplicateGroup, 0)
+	for _, cluster := range clusters {
+		if len(cluster) < 2 {
+			continue
+		}
+		if limit > 0 && len(groups) == limit {
+			break
+		}
+		groups = append(groups, model.DuplicateGroup{SurvivorID: ChooseSurvivor(cluster).ID, Persons: cluster})
+	}
+	return groups
+}
+
+func similarToAll(person model.Person, cluster []model.Person) bool {
+	for _, other := range cluster {
+		if !Similar(person, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// ChooseSurvivor - остается запись с наибольшим числом заполненных полей,
+// при равенстве более ранняя (по времени создания, затем по ID)
+func ChooseSurvivor(persons []model.Person) model.Person {
+	return slices.MinFunc(persons, func(a, b model.Person) int {
+		if c := cmp.Compare(filled(b), filled(a)); c != 0 {
+			return c
+		}
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+func filled(person model.Person) int {
+	n := 0
+	for _, ok := range []bool{person.Patronymic != "", person.Age != 0, person.Gender != "", person.Nationality != ""} {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Merge - данные объединенной записи: значения survivor сохраняются, пустые поля заполняются
+// из дубликатов, начиная с последнего обновленного. Имя и фамилия всегда берутся у survivor
+func Merge(survivor model.Person, duplicates []model.Person) model.Person {
+	merged := survivor
+	recent := slices.Clone(duplicates)
+	slices.SortStableFunc(recent, func(a, b model.Person) int { return b.UpdatedAt.Compare(a.UpdatedAt) })
+	for _, d := range recent {
+		if merged.Patronymic == "" {
+			merged.Patronymic = d.Patronymic
+		}
+		if merged.Age == 0 {
+			merged.Age = d.Age
+		}
+		if merged.Gender == "" {
+			merged.Gender = d.Gender
+		}
+		if merged.Nationality == "" {
+			merged.Nationality = d.Nationality
+		}
+	}
+	return merged
+}
+
+// Split - survivor и остальные записи из persons. survivorID = 0 - выбор по ChooseSurvivor,
+// ok = false, если записи survivorID нет среди persons
+func Split(persons []model.Person, survivorID int) (survivor model.Person, duplicates []model.Person, ok bool) {
+	if survivorID == 0 {
+		survivorID = ChooseSurvivor(persons).ID
+	}
+	for _, person := range persons {
+		if person.ID == survivorID {
+			survivor, ok = person, true
+			continue
+		}
+		duplicates = append(duplicates, person)
+	}
+	return survivor, duplicates, ok
+}
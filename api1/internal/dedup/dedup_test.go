@@ -0,0 +1,104 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, Key(model.Person{Name: "Пётр", Surname: "Иванов"}), Key(model.Person{Name: " петр ", Surname: "ИВАНОВ"}))
+	assert.Equal(t, Key(model.Person{Name: "Anna-Maria", Surname: "Li"}), Key(model.Person{Name: "anna maria", Surname: "li"}))
+	assert.NotEqual(t, Key(model.Person{Name: "Ivan", Surname: "Petrov"}), Key(model.Person{Name: "Ivan", Surname: "Petrov", Patronymic: "Ivanovich"}))
+}
+
+func TestSimilar(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b model.Person
+		want bool
+	}{
+		{name: "Empty", want: true},
+		{name: "One side empty", a: model.Person{Age: 30, Gender: "male", Nationality: "RU"}, want: true},
+		{name: "Age within tolerance", a: model.Person{Age: 30}, b: model.Person{Age: 32}, want: true},
+		{name: "Age too far", a: model.Person{Age: 30}, b: model.Person{Age: 33}, want: false},
+		{name: "Different gender", a: model.Person{Gender: "male"}, b: model.Person{Gender: "female"}, want: false},
+		{name: "Different nationality", a: model.Person{Nationality: "RU"}, b: model.Person{Nationality: "UA"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Similar(tt.a, tt.b))
+			assert.Equal(t, tt.want, Similar(tt.b, tt.a))
+		})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	persons := []model.Person{
+		{ID: 5, Name: "Ivan", Surname: "Petrov", Gender: "female"},
+		{ID: 1, Name: "Ivan", Surname: "Petrov", Gender: "male"},
+		{ID: 2, Name: "Anna", Surname: "Li"},
+		{ID: 3, Name: "IVAN", Surname: "petrov", Age: 40},
+		{ID: 4, Name: "Ivan", Surname: "Petrov", Gender: "male", Age: 41, Nationality: "RU"},
+		{ID: 6, Name: "Ivan", Surname: "Petrov", Gender: "female"},
+		{ID: 7, Name: "Anna", Surname: "Li"},
+	}
+
+	groups := Group(persons, 0)
+	assert.Equal(t, []model.DuplicateGroup{
+		{SurvivorID: 4, Persons: []model.Person{persons[1], persons[3], persons[4]}},
+		{SurvivorID: 2, Persons: []model.Person{persons[2], persons[6]}},
+		{SurvivorID: 5, Persons: []model.Person{persons[0], persons[5]}},
+	}, groups)
+
+	assert.Len(t, Group(persons, 2), 2)
+	assert.Empty(t, Group(persons[:3], 0))
+}
+
+func TestChooseSurvivor(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		persons []model.Person
+		want    int
+	}{
+		{name: "Most filled", persons: []model.Person{{ID: 1}, {ID: 2, Age: 30}}, want: 2},
+		{name: "Earliest created", persons: []model.Person{{ID: 1, CreatedAt: now}, {ID: 2, CreatedAt: now.Add(-time.Hour)}}, want: 2},
+		{name: "Lowest ID", persons: []model.Person{{ID: 2, CreatedAt: now}, {ID: 1, CreatedAt: now}}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ChooseSurvivor(tt.persons).ID)
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	now := time.Now()
+	survivor := model.Person{ID: 1, Name: "Ivan", Surname: "Petrov", Age: 30}
+	duplicates := []model.Person{
+		{ID: 2, Name: "ivan", Surname: "petrov", Age: 31, Gender: "male", Nationality: "UA", UpdatedAt: now.Add(-time.Hour)},
+		{ID: 3, Name: "IVAN", Surname: "PETROV", Patronymic: "Ivanovich", Nationality: "RU", UpdatedAt: now},
+	}
+
+	assert.Equal(t, model.Person{ID: 1, Name: "Ivan", Surname: "Petrov", Patronymic: "Ivanovich", Age: 30, Gender: "male", Nationality: "RU"},
+		Merge(survivor, duplicates))
+}
+
+func TestSplit(t *testing.T) {
+	persons := []model.Person{{ID: 1}, {ID: 2, Age: 30}, {ID: 3}}
+
+	survivor, duplicates, ok := Split(persons, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 2, survivor.ID)
+	assert.Equal(t, []model.Person{{ID: 1}, {ID: 3}}, duplicates)
+
+	survivor, _, ok = Split(persons, 3)
+	assert.True(t, ok)
+	assert.Equal(t, 3, survivor.ID)
+
+	_, _, ok = Split(persons, 4)
+	assert.False(t, ok)
+}
@@ -0,0 +1,100 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	services "github.com/nikita89756/testEffectiveMobile/internal/apis"
+	cache "github.com/nikita89756/testEffectiveMobile/internal/cache"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Enricher - обогащение ФИО через кэш по схеме stale-while-revalidate:
+// свежая запись отдается из кэша, устаревшая отдается сразу и обновляется в фоне,
+// при промахе данные запрашиваются у внешних API синхронно.
+type Enricher struct {
+	addon  services.AddonService
+	cache  cache.Cache
+	logger logger.Logger
+
+	// refreshing - имена, для которых уже идет фоновое обновление
+	refreshing sync.Map
+	wg         sync.WaitGroup
+}
+
+func NewEnricher(addon services.AddonService, cache cache.Cache, logger logger.Logger) *Enricher {
+	return &Enricher{
+		addon:  addon,
+		cache:  cache,
+		logger: logger,
+	}
+}
+
+// Enrich - заполняет возраст, пол и национальность по имени. Ошибки кэша не прерывают обогащение.
+func (e *Enricher) Enrich(ctx context.Context, person *model.Person) error {
+	cached, err := e.cache.GetPerson(ctx, person.Name)
+	if err == nil {
+		apply(person, cached.PersonStats)
+		if cached.Stale(time.Now()) {
+			e.logger.Info("Данные из кэша устарели, обновляем в фоне", zap.String("name", person.Name))
+			e.refresh(person.Name)
+		} else {
+			e.logger.Info("Успешно получен человек из кэша")
+		}
+		return nil
+	}
+	if !errors.Is(err, customerrors.ErrKeyNotFound) {
+		e.logger.Warn("Кэш недоступен, данные будут получены из API", zap.String("error", err.Error()))
+	}
+
+	if err := e.addon.Addon(person); err != nil {
+		return err
+	}
+	e.store(ctx, person.Name, model.PersonStats{Age: person.Age, Gender: person.Gender, Nationality: person.Nationality})
+	return nil
+}
+
+// Wait - ожидание завершения фоновых обновлений
+func (e *Enricher) Wait() {
+	e.wg.Wait()
+}
+
+func (e *Enricher) refresh(name string) {
+	if _, loaded := e.refreshing.LoadOrStore(name, struct{}{}); loaded {
+		return
+	}
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer e.refreshing.Delete(name)
+
+		person := model.Person{Name: name}
+		if err := e.addon.Addon(&person); err != nil {
+			e.logger.Warn("Не удалось обновить данные обогащения, остаются устаревшие", zap.String("name", name), zap.Error(err))
+			return
+		}
+		e.store(context.Background(), name, model.PersonStats{Age: person.Age, Gender: person.Gender, Nationality: person.Nationality})
+	}()
+}
+
+// store - в кэш попадают только полные данные, поэтому при сбое внешних API устаревшая запись не затирается
+func (e *Enricher) store(ctx context.Context, name string, stats model.PersonStats) {
+	if stats.Age == 0 || stats.Gender == "" || stats.Nationality == "" {
+		e.logger.Warn("Внешние API вернули неполные данные, в кэш не записываем", zap.String("name", name))
+		return
+	}
+	if err := e.cache.SetPersonWithTTL(ctx, name, stats); err != nil {
+		e.logger.Warn("Не удалось записать данные в кэш", zap.String("error", err.Error()))
+	}
+}
+
+func apply(person *model.Person, stats model.PersonStats) {
+	person.Age = stats.Age
+	person.Gender = stats.Gender
+	person.Nationality = stats.Nationality
+}
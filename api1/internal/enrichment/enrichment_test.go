@@ -0,0 +1,101 @@
+package enrichment
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cache "github.com/nikita89756/testEffectiveMobile/internal/cache"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeAddon struct {
+	calls   atomic.Int32
+	failing bool
+	stats   model.PersonStats
+}
+
+func (f *fakeAddon) Addon(p *model.Person) error {
+	f.calls.Add(1)
+	if f.failing {
+		return nil
+	}
+	p.Age = f.stats.Age
+	p.Gender = f.stats.Gender
+	p.Nationality = f.stats.Nationality
+	return nil
+}
+
+func TestEnrich(t *testing.T) {
+	ctx := context.Background()
+	old := model.PersonStats{Age: 30, Gender: "male", Nationality: "RU"}
+	fresh := model.PersonStats{Age: 31, Gender: "male", Nationality: "UA"}
+
+	tests := []struct {
+		name       string
+		policy     cache.Policy
+		cached     bool
+		failing    bool
+		want       model.PersonStats
+		wantCached model.PersonStats
+		wantCalls  int32
+	}{
+		{
+			name:       "Cache miss",
+			policy:     cache.DefaultPolicy(),
+			want:       fresh,
+			wantCached: fresh,
+			wantCalls:  1,
+		},
+		{
+			name:       "Fresh hit",
+			policy:     cache.DefaultPolicy(),
+			cached:     true,
+			want:       old,
+			wantCached: old,
+			wantCalls:  0,
+		},
+		{
+			name:       "Stale hit is refreshed in background",
+			policy:     cache.Policy{FreshTTL: time.Nanosecond, StaleTTL: time.Hour},
+			cached:     true,
+			want:       old,
+			wantCached: fresh,
+			wantCalls:  1,
+		},
+		{
+			name:       "Stale hit while providers are failing",
+			policy:     cache.Policy{FreshTTL: time.Nanosecond, StaleTTL: time.Hour},
+			cached:     true,
+			failing:    true,
+			want:       old,
+			wantCached: old,
+			wantCalls:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cache.NewMemoryCache(tt.policy)
+			if tt.cached {
+				require.NoError(t, c.SetPersonWithTTL(ctx, "Ivan", old))
+			}
+			addon := &fakeAddon{failing: tt.failing, stats: fresh}
+			e := NewEnricher(addon, c, zap.NewNop())
+
+			person := model.Person{Name: "Ivan", Surname: "Ivanov"}
+			require.NoError(t, e.Enrich(ctx, &person))
+			e.Wait()
+
+			assert.Equal(t, tt.want, model.PersonStats{Age: person.Age, Gender: person.Gender, Nationality: person.Nationality})
+			assert.Equal(t, tt.wantCalls, addon.calls.Load())
+
+			cached, err := c.GetPerson(ctx, "Ivan")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCached, cached.PersonStats)
+		})
+	}
+}
@@ -6,5 +6,14 @@ var(
 	ErrPersonNotFound = fmt.Errorf("Person not found")
 	ErrNothingToDelete = fmt.Errorf("Person for deleting not found")
 	ErrNothingToUpdate = fmt.Errorf("Person for updating not found")
+	ErrNothingToRestore = fmt.Errorf("Deleted person for restoring not found")
+	ErrVersionNotFound = fmt.Errorf("Person version not found")
+	ErrVersionConflict = fmt.Errorf("Person was modified concurrently")
 	ErrKeyNotFound = fmt.Errorf("Key not found")
-)
\ No newline at end of file
+	ErrCacheUnavailable = fmt.Errorf("Cache unavailable")
+	ErrCacheDisabled = fmt.Errorf("Cache disabled")
+	ErrWarmupRunning = fmt.Errorf("Cache warm-up already running")
+	ErrInvalidCursor = fmt.Errorf("Invalid cursor")
+	ErrNothingToMerge = fmt.Errorf("Persons for merging not found")
+	ErrBulkRejected = fmt.Errorf("Bulk insert rejected: some rows are invalid")
+)
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage"
+	"github.com/nikita89756/testEffectiveMobile/internal/warmup"
+	"github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// AdminHandler - административные эндпоинты, доступны только с ADMIN_TOKEN
+type AdminHandler struct {
+	storage storage.Storage
+	logger  logger.Logger
+	warmer  *warmup.Warmer
+}
+
+func NewAdminHandler(storage storage.Storage, logger logger.Logger, warmer *warmup.Warmer) *AdminHandler {
+	return &AdminHandler{
+		storage: storage,
+		logger:  logger,
+		warmer:  warmer,
+	}
+}
+
+// @Summary Запустить прогрев кэша
+// @Tags admin
+// @Description Заполняет кэш обогащения данными из таблицы people. Прогрев выполняется в фоне.
+// @Produce json
+// @Security AdminToken
+// @Success 202 {object} model.WarmupStatus
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 409 {object} model.ErrorResponse
+// @Router /admin/cache/warmup [post]
+func (h *AdminHandler) StartCacheWarmup(ctx *gin.Context) {
+	// Прогрев не должен прерываться вместе с HTTP-запросом
+	err := h.warmer.Start(context.Background())
+	if errors.Is(err, customerrors.ErrWarmupRunning) {
+		ctx.JSON(http.StatusConflict, model.ErrorResponse{Error: "Warm-up already running"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Не удалось запустить прогрев кэша", zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, h.warmer.Status())
+}
+
+// @Summary Состояние прогрева кэша
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} model.WarmupStatus
+// @Failure 401 {object} model.ErrorResponse
+// @Router /admin/cache/warmup [get]
+func (h *AdminHandler) GetCacheWarmupStatus(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, h.warmer.Status())
+}
+
+// @Summary Список удаленных людей
+// @Tags admin
+// @Description Мягко удаленные записи, которые еще не очищены. Сначала последние удаленные.
+// @Produce json
+// @Security AdminToken
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {array} model.Person
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/persons/deleted [get]
+func (h *AdminHandler) GetDeletedPersons(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.Query("limit"))
+	if err != nil || limit < 0 {
+		limit = 0
+	}
+	offset, err := strconv.Atoi(ctx.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	persons, err := h.storage.GetDeletedPersons(ctx.Request.Context(), offset, limit)
+	if err != nil {
+		h.logger.Error("Ошибка получения удаленных записей", zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, persons)
+}
+
+// maxBulkSize - строк в одном запросе массовой вставки
+const maxBulkSize = 10000
+
+// @Summary Массовая вставка людей
+// @Tags admin
+// @Description Вставляет до 10000 записей за запрос без обогащения: возраст, пол и национальность берутся из запроса. Невалидные строки пропускаются и перечислены в errors, ids идут в порядке строк запроса (0 для пропущенных). С atomic=true любая ошибка отменяет вставку всех строк.
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param persons body []model.PersonUpdateRequest true "Люди"
+// @Param atomic query bool false "Все или ничего"
+// @Success 200 {object} model.BulkCreateResult
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 401 {object} model.ErrorResponse
+// @Failure 422 {object} model.BulkCreateResult
+// @Failure 500 {object} model.ErrorResponse
+// @Router /admin/persons/bulk [post]
+func (h *AdminHandler) BulkCreatePersons(ctx *gin.Context) {
+	var req []model.PersonUpdateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		h.logger.Debug("Ошибка при парсинге JSON", zap.String("error", err.Error()))
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if len(req) == 0 || len(req) > maxBulkSize {
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: fmt.Sprintf("Expected from 1 to %d persons", maxBulkSize)})
+		return
+	}
+	atomic, err := strconv.ParseBool(ctx.DefaultQuery("atomic", "false"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Invalid atomic value"})
+		return
+	}
+	persons := make([]model.Person, len(req))
+	for i, r := range req {
+		persons[i] = model.Person{Name: r.Name, Surname: r.Surname, Patronymic: r.Patronymic, Age: r.Age, Nationality: r.Nationality, Gender: r.Gender}
+	}
+
+	result, err := h.storage.BulkCreatePersons(ctx.Request.Context(), persons, atomic)
+	if errors.Is(err, customerrors.ErrBulkRejected) {
+		h.logger.Debug("Массовая вставка отклонена", zap.Int("failed", len(result.Errors)))
+		ctx.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Ошибка массовой вставки", zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
+		return
+	}
+	h.logger.Info("Выполнена массовая вставка", zap.Int("created", result.Created), zap.Int("failed", len(result.Errors)))
+	ctx.JSON(http.StatusOK, result)
+}
+
+// @Summary Состояние пула соединений с базой
+// @Tags admin
+// @Description sql.DB.Stats() для primary и каждой реплики: открытые, занятые и свободные соединения, сколько раз и сколько
+// @Description всего запросы ждали свободного соединения. Растущий wait_count - признак того, что DB_MAX_OPEN_CONNS мал
+// @Produce json
+// @Security AdminToken
+// @Success 200 {array} model.PoolStats
+// @Failure 401 {object} model.ErrorResponse
+// @Router /admin/db/pool [get]
+func (h *AdminHandler) GetPoolStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, h.storage.PoolStats())
+}
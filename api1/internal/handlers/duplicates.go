@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"go.uber.org/zap"
+)
+
+// maxMergeIDs - сколько записей можно слить за один запрос
+const maxMergeIDs = 100
+
+// @Summary Поиск дубликатов
+// @Tags persons
+// @Description Группы вероятных дубликатов: совпадают имя, фамилия и отчество без учета регистра и знаков,
+// @Description пол и национальность совпадают или не заполнены, возраст отличается не больше чем на 2 года.
+// @Description survivor_id - запись, которая останется при слиянии без явного выбора
+// @Produce json
+// @Param limit query int false "Число групп" default(20)
+// @Success 200 {array} model.DuplicateGroup
+// @Failure 500 {object} model.ErrorResponse
+// @Router /persons/duplicates [get]
+func (h *Handler) FindDuplicates(ctx *gin.Context) {
+	groups, err := h.storage.FindDuplicates(ctx.Request.Context(), parseLimit(ctx))
+	if err != nil {
+		h.logger.Error("Ошибка поиска дубликатов", zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
+		return
+	}
+	ctx.JSON(http.StatusOK, groups)
+}
+
+// @Summary Слияние дубликатов
+// @Tags persons
+// @Description Сливает записи в одну. Если survivor_id не задан, остается запись с наибольшим числом заполненных полей
+// @Description (при равенстве - более ранняя). Пустые поля оставшейся записи заполняются из остальных, начиная с последней измененной.
+// @Description Остальные записи удаляются мягко, GET /persons/{id} по их ID перенаправляет на оставшуюся запись
+// @Accept json
+// @Produce json
+// @Param merge body model.MergeRequest true "ID записей и, необязательно, ID оставшейся записи"
+// @Success 200 {object} model.Person
+// @Header 200 {string} ETag "Версия оставшейся записи"
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /persons/merge [post]
+func (h *Handler) MergePersons(ctx *gin.Context) {
+	var req model.MergeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := validateMerge(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	person, err := h.storage.MergePersons(ctx.Request.Context(), req.IDs, req.SurvivorID)
+	if errors.Is(err, customerrors.ErrNothingToMerge) {
+		ctx.JSON(http.StatusNotFound, model.ErrorResponse{Error: "Person not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Не удалось слить записи", zap.Ints("ids", req.IDs), zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Faild to merge"})
+		return
+	}
+	h.logger.Info("Записи слиты", zap.Int("id", person.ID), zap.Ints("ids", req.IDs))
+	ctx.Header("ETag", etag(person.Version))
+	ctx.JSON(http.StatusOK, person)
+}
+
+// validateMerge - не меньше двух разных положительных ID, survivor_id (если задан) среди них
+func validateMerge(req model.MergeRequest) error {
+	ids := slices.Compact(slices.Sorted(slices.Values(req.IDs)))
+	if len(ids) < 2 || len(ids) > maxMergeIDs {
+		return fmt.Errorf("Invalid ids: expected from 2 to %d different IDs", maxMergeIDs)
+	}
+	if ids[0] <= 0 {
+		return fmt.Errorf("Invalid ids: IDs must be positive")
+	}
+	if req.SurvivorID != 0 && !slices.Contains(ids, req.SurvivorID) {
+		return fmt.Errorf("Invalid survivor_id: must be one of ids")
+	}
+	return nil
+}
+
+// redirectMerged - если id был слит, перенаправляет на запись, в которую он слит
+func (h *Handler) redirectMerged(ctx *gin.Context, id int) bool {
+	survivorID, err := h.storage.ResolveMergedID(ctx.Request.Context(), id)
+	if err != nil {
+		if !errors.Is(err, customerrors.ErrPersonNotFound) {
+			h.logger.Error("Ошибка получения записи о слиянии", zap.Int("id", id), zap.String("error", err.Error()))
+		}
+		return false
+	}
+	h.logger.Info("Запись слита, перенаправление", zap.Int("id", id), zap.Int("survivor_id", survivorID))
+	ctx.Redirect(http.StatusMovedPermanently, path.Join(path.Dir(ctx.Request.URL.Path), strconv.Itoa(survivorID)))
+	return true
+}
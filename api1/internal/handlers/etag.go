@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// etag - ETag записи строится из ее версии
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// etagMatches - проверка заголовка If-Match: "*" или список ETag через запятую.
+// If-Match использует строгое сравнение, поэтому слабые ETag (W/"...") не совпадают.
+func etagMatches(header string, version int) bool {
+	want := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+)
+
+// parsePersonFilter - фильтр и сортировка из query параметров GET /persons. Ошибка содержит текст для ответа 400
+func parsePersonFilter(ctx *gin.Context) (model.PersonFilter, error) {
+	var (
+		filter model.PersonFilter
+		err    error
+	)
+	filter.Names = parseList(ctx.Query("name"))
+	filter.Surnames = parseList(ctx.Query("surname"))
+	filter.Patronymics = parseList(ctx.Query("patronymic"))
+	filter.Nationalities = parseList(ctx.Query("nationality"))
+	filter.Genders = parseList(ctx.Query("gender"))
+	for _, gender := range filter.Genders {
+		if gender != "male" && gender != "female" {
+			return filter, fmt.Errorf("Invalid gender format")
+		}
+	}
+	filter.NamePrefix = ctx.Query("name_prefix")
+	filter.SurnamePrefix = ctx.Query("surname_prefix")
+	filter.PatronymicPrefix = ctx.Query("patronymic_prefix")
+
+	for _, v := range parseList(ctx.Query("ids")) {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			return filter, fmt.Errorf("Invalid ids: %q is not a positive integer", v)
+		}
+		filter.IDs = append(filter.IDs, id)
+	}
+	for _, v := range parseList(ctx.Query("age")) {
+		age, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || age <= 0 {
+			return filter, fmt.Errorf("Invalid age: %q is not a positive integer", v)
+		}
+		filter.Ages = append(filter.Ages, age)
+	}
+	if filter.AgeMin, err = parseAge(ctx, "age_min"); err != nil {
+		return filter, err
+	}
+	if filter.AgeMax, err = parseAge(ctx, "age_max"); err != nil {
+		return filter, err
+	}
+	if filter.AgeMin != nil && filter.AgeMax != nil && *filter.AgeMin > *filter.AgeMax {
+		return filter, fmt.Errorf("Invalid age range: age_min is greater than age_max")
+	}
+
+	if filter.CreatedAfter, err = parseTime(ctx, "created_after"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedBefore, err = parseTime(ctx, "created_before"); err != nil {
+		return filter, err
+	}
+	if filter.UpdatedAfter, err = parseTime(ctx, "updated_after"); err != nil {
+		return filter, err
+	}
+	if filter.UpdatedBefore, err = parseTime(ctx, "updated_before"); err != nil {
+		return filter, err
+	}
+	if filter.Sort, err = model.ParseSort(ctx.Query("sort")); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseList - значения через запятую, пустые значения пропускаются
+func parseList(value string) []string {
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func parseAge(ctx *gin.Context, param string) (*int64, error) {
+	value := ctx.Query(param)
+	if value == "" {
+		return nil, nil
+	}
+	age, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || age < 0 {
+		return nil, fmt.Errorf("Invalid %s: %q is not a non-negative integer", param, value)
+	}
+	return &age, nil
+}
+
+// parseTime - RFC 3339 (2025-06-01T10:00:00Z) или дата (2025-06-01, начало дня в UTC)
+func parseTime(ctx *gin.Context, param string) (*time.Time, error) {
+	value := ctx.Query(param)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid %s: %q, expected RFC 3339 time or YYYY-MM-DD date", param, value)
+}
@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	services "github.com/nikita89756/testEffectiveMobile/internal/apis"
 	cache "github.com/nikita89756/testEffectiveMobile/internal/cache"
+	"github.com/nikita89756/testEffectiveMobile/internal/enrichment"
 	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
 	"github.com/nikita89756/testEffectiveMobile/internal/model"
 	"github.com/nikita89756/testEffectiveMobile/internal/storage"
@@ -20,6 +23,7 @@ type Handler struct {
 	logger    logger.Logger
 	addOnServ services.AddonService
 	cache     cache.Cache
+	enricher  *enrichment.Enricher
 }
 
 func NewHandler(storage storage.Storage, logger logger.Logger, addOnServ services.AddonService, cache cache.Cache) *Handler {
@@ -28,6 +32,7 @@ func NewHandler(storage storage.Storage, logger logger.Logger, addOnServ service
 		logger:    logger,
 		addOnServ: addOnServ,
 		cache:     cache,
+		enricher:  enrichment.NewEnricher(addOnServ, cache, logger),
 	}
 }
 
@@ -38,6 +43,9 @@ func NewHandler(storage storage.Storage, logger logger.Logger, addOnServ service
 // @Produce json
 // @Param id path int true "Person ID"
 // @Success 200 {object} model.Person
+// @Header 200 {string} ETag "Версия записи для If-Match"
+// @Success 301 {string} string "Запись слита с другой (POST /persons/merge)"
+// @Header 301 {string} Location "Адрес оставшейся записи"
 // @Failure 400 {object} model.ErrorResponse
 // @Failure 404 {object} model.ErrorResponse
 // @Failure 500 {object} model.ErrorResponse
@@ -53,20 +61,26 @@ func (h *Handler) FindPersonByID(ctx *gin.Context) {
 	person, err := h.storage.GetPersonByID(ctx.Request.Context(), id)
 	if err != nil {
 		if errors.Is(err, customerrors.ErrPersonNotFound) {
+			if h.redirectMerged(ctx, id) {
+				return
+			}
 			h.logger.Info("Person not found", zap.Int("id", id))
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "Person not found"})
 			return
 		}
 		h.logger.Error("Error while getting user from database", zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
+		return
 	}
 	h.logger.Info("Успешно получены данные о человеке", zap.Int("id", id))
 	person.ID = id
+	ctx.Header("ETag", etag(person.Version))
 	ctx.JSON(http.StatusOK, person)
 }
 
 // @Summary Удаление человека
 // @Tags persons
-// @Description Удаление человека из базы данных по ID
+// @Description Мягкое удаление человека по ID. Запись можно восстановить, пока она не очищена по истечении срока хранения
 // @Accept json
 // @Produce json
 // @Param id path int true "Person ID"
@@ -98,6 +112,109 @@ func (h *Handler) DeletePersonByID(ctx *gin.Context) {
 
 }
 
+// @Summary Восстановление удаленного человека
+// @Tags persons
+// @Description Снимает пометку удаления с записи, пока она не очищена окончательно
+// @Produce json
+// @Param id path int true "Person ID"
+// @Success 200
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /persons/{id}/restore [post]
+func (h *Handler) RestorePersonByID(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Ivalid ID format"})
+		return
+	}
+
+	err = h.storage.RestorePersonByID(ctx.Request.Context(), id)
+	if errors.Is(err, customerrors.ErrNothingToRestore) {
+		ctx.JSON(http.StatusNotFound, model.ErrorResponse{Error: "Deleted person not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Не удалось восстановить запись", zap.Int("id", id), zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Faild to restore"})
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// @Summary История изменений человека
+// @Tags persons
+// @Description Все изменения записи по возрастанию версии: действие, данные до и после, изменившиеся поля, автор (заголовок X-Actor) и время
+// @Produce json
+// @Param id path int true "Person ID"
+// @Success 200 {array} model.PersonHistory
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /persons/{id}/history [get]
+func (h *Handler) GetPersonHistory(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Ivalid ID format"})
+		return
+	}
+	history, err := h.storage.GetPersonHistory(ctx.Request.Context(), id)
+	if err != nil {
+		h.logger.Error("Ошибка получения истории изменений", zap.Int("id", id), zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
+		return
+	}
+	if len(history) == 0 {
+		ctx.JSON(http.StatusNotFound, model.ErrorResponse{Error: "History not found"})
+		return
+	}
+	for i := range history {
+		history[i].Changes = model.Diff(history[i].Before, history[i].After)
+	}
+	ctx.JSON(http.StatusOK, history)
+}
+
+// @Summary Откат к версии
+// @Tags persons
+// @Description Возвращает данные человека к состоянию после указанной версии. Откат записывается в историю как новая версия.
+// @Produce json
+// @Param id path int true "Person ID"
+// @Param version path int true "Version"
+// @Success 200 {object} model.Person
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /persons/{id}/history/{version}/revert [post]
+func (h *Handler) RevertPerson(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Ivalid ID format"})
+		return
+	}
+	version, err := strconv.Atoi(ctx.Param("version"))
+	if err != nil || version <= 0 {
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Invalid version format"})
+		return
+	}
+
+	person, err := h.storage.RevertPerson(ctx.Request.Context(), id, version)
+	if errors.Is(err, customerrors.ErrVersionNotFound) {
+		ctx.JSON(http.StatusNotFound, model.ErrorResponse{Error: "Version not found"})
+		return
+	}
+	if errors.Is(err, customerrors.ErrNothingToUpdate) {
+		ctx.JSON(http.StatusNotFound, model.ErrorResponse{Error: "Person not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Не удалось откатить запись", zap.Int("id", id), zap.Int("version", version), zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Faild to revert"})
+		return
+	}
+	h.logger.Info("Запись возвращена к версии", zap.Int("id", id), zap.Int("version", version))
+	ctx.JSON(http.StatusOK, person)
+}
+
 // @Summary Обновление данных о человеке
 // @Tags persons
 // @Description Обновение данных о человеке по ID
@@ -105,9 +222,13 @@ func (h *Handler) DeletePersonByID(ctx *gin.Context) {
 // @Produce json
 // @Param id path int true "Person ID"
 // @Param person body model.PersonUpdateRequest true "Updated person info"
+// @Param If-Match header string false "ETag из GET /persons/{id}, обновление выполняется только если запись не менялась"
 // @Success 200
+// @Header 200 {string} ETag "Новая версия записи"
 // @Failure 400 {object} model.ErrorResponse
 // @Failure 404 {object} model.ErrorResponse
+// @Failure 409 {object} model.ErrorResponse
+// @Failure 412 {object} model.ErrorResponse
 // @Failure 500 {object} model.ErrorResponse
 // @Router /persons/{id} [put]
 func (h *Handler) UpdatePersonByID(ctx *gin.Context) {
@@ -135,16 +256,110 @@ func (h *Handler) UpdatePersonByID(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError,model.ErrorResponse{Error: "Internal server error"})
 		return
 	}
+	ifMatch := ctx.GetHeader("If-Match")
+	if ifMatch != "" && !etagMatches(ifMatch, person2.Version) {
+		h.logger.Debug("Версия в If-Match не совпадает", zap.Int("id", id), zap.String("if_match", ifMatch), zap.Int("version", person2.Version))
+		ctx.JSON(http.StatusPreconditionFailed, model.ErrorResponse{Error: "Person was modified"})
+		return
+	}
+	// person2.Version - прочитанная версия, хранилище обновит запись только если она не изменилась с момента чтения
 	createPerson(person2, &person)
 	err = h.storage.UpdatePersonByID(ctx.Request.Context(), person2)
+	if errors.Is(err, customerrors.ErrVersionConflict) {
+		h.logger.Warn("Запись изменена параллельно", zap.Int("id", id))
+		if ifMatch != "" {
+			ctx.JSON(http.StatusPreconditionFailed, model.ErrorResponse{Error: "Person was modified"})
+			return
+		}
+		ctx.JSON(http.StatusConflict, model.ErrorResponse{Error: "Person was modified concurrently, retry"})
+		return
+	}
+	if errors.Is(err, customerrors.ErrNothingToUpdate) {
+		ctx.JSON(http.StatusNotFound, model.ErrorResponse{Error: "Person not found"})
+		return
+	}
 	if err != nil {
 		h.logger.Error("Не удалось обновить запись", zap.Int("id", id), zap.String("error", err.Error()))
 		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Faild to update"})
 		return
 	}
+	ctx.Header("ETag", etag(person2.Version))
 	ctx.Status(http.StatusOK)
 }
 
+// @Summary Частичное обновление данных о человеке
+// @Tags persons
+// @Description JSON Merge Patch (RFC 7396): поля, которых нет в запросе, не меняются, null очищает поле, нулевой возраст и пустые пол и национальность отклоняются. Очистить можно отчество, возраст, национальность и пол, имя и фамилию - нет. Меняются только переданные колонки, поэтому параллельные изменения других полей не затираются
+// @Accept json
+// @Produce json
+// @Param id path int true "Person ID"
+// @Param patch body model.PersonPatch true "Изменяемые поля, null - очистить"
+// @Param If-Match header string false "ETag из GET /persons/{id}, обновление выполняется только если запись не менялась"
+// @Success 200 {object} model.Person
+// @Header 200 {string} ETag "Новая версия записи"
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Failure 412 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /persons/{id} [patch]
+func (h *Handler) PatchPersonByID(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Ivalid ID format"})
+		return
+	}
+	var patch model.PersonPatch
+	if err := ctx.ShouldBindJSON(&patch); err != nil {
+		h.logger.Debug("Неверный формат запроса", zap.String("error", err.Error()))
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if err := patch.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// без If-Match версия не проверяется: UPDATE меняет только переданные колонки, и гонки чтения-записи нет
+	version := 0
+	ifMatch := ctx.GetHeader("If-Match")
+	if ifMatch != "" {
+		current, err := h.storage.GetPersonByID(ctx.Request.Context(), id)
+		if errors.Is(err, customerrors.ErrPersonNotFound) {
+			ctx.JSON(http.StatusNotFound, model.ErrorResponse{Error: "Person not found"})
+			return
+		}
+		if err != nil {
+			h.logger.Error("Ошибка получения данных о человеке", zap.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
+			return
+		}
+		if !etagMatches(ifMatch, current.Version) {
+			h.logger.Debug("Версия в If-Match не совпадает", zap.Int("id", id), zap.String("if_match", ifMatch), zap.Int("version", current.Version))
+			ctx.JSON(http.StatusPreconditionFailed, model.ErrorResponse{Error: "Person was modified"})
+			return
+		}
+		version = current.Version
+	}
+
+	person, err := h.storage.PatchPersonByID(ctx.Request.Context(), id, patch, version)
+	if errors.Is(err, customerrors.ErrVersionConflict) {
+		h.logger.Warn("Запись изменена параллельно", zap.Int("id", id))
+		ctx.JSON(http.StatusPreconditionFailed, model.ErrorResponse{Error: "Person was modified"})
+		return
+	}
+	if errors.Is(err, customerrors.ErrNothingToUpdate) {
+		ctx.JSON(http.StatusNotFound, model.ErrorResponse{Error: "Person not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Не удалось обновить запись", zap.Int("id", id), zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Faild to update"})
+		return
+	}
+	ctx.Header("ETag", etag(person.Version))
+	ctx.JSON(http.StatusOK, person)
+}
+
 func createPerson(person *model.Person, person2 *model.PersonUpdateRequest) {
 	if person2.Name != "" {
 		person.Name = person2.Name
@@ -168,68 +383,188 @@ func createPerson(person *model.Person, person2 *model.PersonUpdateRequest) {
 
 // @Summary Получить список человек
 // @Tags persons
-// @Description Возвращает список человек учитывая фильтры
+// @Description Возвращает список человек учитывая фильтры. Параметры name, surname, patronymic, age, nationality, gender и ids принимают несколько значений через запятую (любое из них). Все фильтры объединяются через И.
 // @Accept json
 // @Produce json
-// @Param name query string false "Name"
-// @Param surname query string false "Surname"
-// @Param patronymic query string false "Patronymic"
-// @Param age query int false "Age"
-// @Param gender query string false "Gender (male or female)"
-// @Param nationality query string false "Nationality"
-// @Param limit query int false "Limit"
-// @Param offset query int false "Offset"
-// @Success 200 {array} model.Person
+// @Param ids query string false "ID через запятую"
+// @Param name query string false "Name, несколько через запятую"
+// @Param surname query string false "Surname, несколько через запятую"
+// @Param patronymic query string false "Patronymic, несколько через запятую"
+// @Param name_prefix query string false "Имя начинается с"
+// @Param surname_prefix query string false "Фамилия начинается с"
+// @Param patronymic_prefix query string false "Отчество начинается с"
+// @Param age query string false "Age, несколько через запятую"
+// @Param age_min query int false "Минимальный возраст включительно"
+// @Param age_max query int false "Максимальный возраст включительно"
+// @Param gender query string false "Gender (male or female), несколько через запятую"
+// @Param nationality query string false "Nationality, несколько через запятую"
+// @Param created_after query string false "Создан не раньше (RFC 3339 или YYYY-MM-DD)"
+// @Param created_before query string false "Создан раньше (RFC 3339 или YYYY-MM-DD)"
+// @Param updated_after query string false "Изменен не раньше (RFC 3339 или YYYY-MM-DD)"
+// @Param updated_before query string false "Изменен раньше (RFC 3339 или YYYY-MM-DD)"
+// @Param sort query string false "Сортировка: поля через запятую, '-' перед полем - по убыванию, например surname,-age. Поля: id, name, surname, patronymic, age, nationality, gender, created_at, updated_at. Последним всегда добавляется id"
+// @Param limit query int false "Размер страницы (по умолчанию 20, не больше 100)"
+// @Param cursor query string false "next_cursor или prev_cursor из предыдущего ответа, выдается для конкретной сортировки"
+// @Param total query string false "Посчитать общее число записей: exact - точно, estimate - оценка по статистике Postgres" Enums(exact, estimate)
+// @Param facets query string false "Фасеты через запятую: nationality, gender, age. Считаются по всему фильтру, пустые значения не учитываются, age - диапазонами по 10 лет"
+// @Success 200 {object} model.PersonPage
 // @Failure 400 {object} model.ErrorResponse
 // @Failure 500 {object} model.ErrorResponse
 // @Router /persons [get]
 func (h *Handler) GetPersons(ctx *gin.Context) {
-	age, err := strconv.Atoi(ctx.Query("age"))
+	filter, err := parsePersonFilter(ctx)
 	if err != nil {
-
+		h.logger.Debug("Неверный фильтр списка людей", zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
 	}
-	person := model.Person{
-		Name:        ctx.Query("name"),
-		Surname:     ctx.Query("surname"),
-		Patronymic:  ctx.Query("patronymic"),
-		Age:         int64(age),
-		Nationality: ctx.Query("nationality"),
-		Gender:      ctx.Query("gender"),
+	total, err := parseTotal(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
 	}
-	limit, err := strconv.Atoi(ctx.Query("limit"))
+	facets, err := model.ParseFacets(ctx.Query("facets"))
 	if err != nil {
-		h.logger.Debug("Неверный формат лимита")
-		if limit < 0 {
-			limit = 0
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+	var after *model.Cursor
+	if value := ctx.Query("cursor"); value != "" {
+		cursor, err := model.DecodeCursor(value, filter.Sort)
+		if err != nil {
+			h.logger.Debug("Неверный курсор", zap.String("cursor", value))
+			ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+			return
 		}
-		limit = 0
+		after = &cursor
 	}
-	offset, err := strconv.Atoi(ctx.Query("offset"))
+	limit := parseLimit(ctx)
+
+	persons, err := h.storage.GetPersonsByFilter(ctx.Request.Context(), filter, after, limit+1)
 	if err != nil {
-		h.logger.Debug("Неверный формат смещения")
-		if offset < 0 {
-			offset = 0
+		h.logger.Error("Ошибка получения данных о людях", zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
+		return
+	}
+	page := newPage(persons, after, filter.Sort, limit)
+	if total != "" {
+		count, estimated, err := h.storage.CountPersons(ctx.Request.Context(), filter, total == "estimate")
+		if err != nil {
+			h.logger.Error("Ошибка подсчета людей", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
+			return
+		}
+		page.Total = &count
+		page.TotalEstimated = estimated
+	}
+	if len(facets) > 0 {
+		page.Facets, err = h.storage.GetPersonFacets(ctx.Request.Context(), filter, facets)
+		if err != nil {
+			h.logger.Error("Ошибка подсчета фасетов", zap.Strings("facets", facets), zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
+			return
 		}
-		offset = 0
 	}
-	if person.Gender != "male" && person.Gender != "female" && person.Gender != "" {
-		h.logger.Debug("Неверный формат пола")
-		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Invalid gender format"})
+	h.logger.Info("Успешно получены данные о людях", zap.Int("count", len(page.Items)))
+	ctx.JSON(http.StatusOK, page)
+}
+
+// @Summary Поиск людей
+// @Tags persons
+// @Description Нечеткий поиск по имени, фамилии и отчеству: учитывает опечатки (pg_trgm) и транслитерацию, "Ivanov" находит "Иванов" и "Ivanova". Лучшие совпадения первыми.
+// @Produce json
+// @Param q query string true "Строка поиска"
+// @Param limit query int false "Limit (по умолчанию 20, не больше 100)"
+// @Param offset query int false "Offset"
+// @Success 200 {array} model.SearchResult
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /persons/search [get]
+func (h *Handler) SearchPersons(ctx *gin.Context) {
+	query := strings.TrimSpace(ctx.Query("q"))
+	if query == "" {
+		h.logger.Debug("Пустая строка поиска")
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Query parameter q is required"})
 		return
 	}
-	persons, err := h.storage.GetPersonsByFilter(ctx.Request.Context(), person, offset, limit)
+	limit := parseLimit(ctx)
+	offset, err := strconv.Atoi(ctx.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	results, err := h.storage.SearchPersons(ctx.Request.Context(), query, offset, limit)
 	if err != nil {
-		h.logger.Error("Ошибка получения данных о людях", zap.String("error", err.Error()))
+		h.logger.Error("Ошибка поиска людей", zap.String("query", query), zap.Error(err))
 		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
 		return
 	}
-	if len(persons) == 0 {
-		h.logger.Warn("Нет людей с такими данными")
-		ctx.JSON(http.StatusNotFound, model.ErrorResponse{Error: "Persons not found"})
+	h.logger.Info("Успешно выполнен поиск людей", zap.String("query", query), zap.Int("count", len(results)))
+	ctx.JSON(http.StatusOK, results)
+}
+
+const (
+	defaultBucketWidth = 10
+	defaultTop         = 10
+)
+
+// @Summary Статистика по людям
+// @Tags persons
+// @Description Число людей по полу, национальности и возрастным корзинам, самые частые имена и фамилии и доля записей с заполненными возрастом, полом и национальностью. Принимает те же фильтры, что и GET /persons. В genders и nationalities пустое value - поле не заполнено.
+// @Produce json
+// @Param bucket query int false "Ширина возрастной корзины (по умолчанию 10, от 1 до 100)"
+// @Param top query int false "Сколько самых частых имен и фамилий вернуть (по умолчанию 10, не больше 100)"
+// @Param ids query string false "ID через запятую"
+// @Param name query string false "Name, несколько через запятую"
+// @Param surname query string false "Surname, несколько через запятую"
+// @Param patronymic query string false "Patronymic, несколько через запятую"
+// @Param name_prefix query string false "Имя начинается с"
+// @Param surname_prefix query string false "Фамилия начинается с"
+// @Param patronymic_prefix query string false "Отчество начинается с"
+// @Param age query string false "Age, несколько через запятую"
+// @Param age_min query int false "Минимальный возраст включительно"
+// @Param age_max query int false "Максимальный возраст включительно"
+// @Param gender query string false "Gender (male or female), несколько через запятую"
+// @Param nationality query string false "Nationality, несколько через запятую"
+// @Param created_after query string false "Создан не раньше (RFC 3339 или YYYY-MM-DD)"
+// @Param created_before query string false "Создан раньше (RFC 3339 или YYYY-MM-DD)"
+// @Param updated_after query string false "Изменен не раньше (RFC 3339 или YYYY-MM-DD)"
+// @Param updated_before query string false "Изменен раньше (RFC 3339 или YYYY-MM-DD)"
+// @Success 200 {object} model.Demographics
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 500 {object} model.ErrorResponse
+// @Router /persons/stats [get]
+func (h *Handler) GetDemographics(ctx *gin.Context) {
+	filter, err := parsePersonFilter(ctx)
+	if err != nil {
+		h.logger.Debug("Неверный фильтр статистики", zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+	opts := model.DemographicsOptions{BucketWidth: defaultBucketWidth, Top: defaultTop}
+	if value := ctx.Query("bucket"); value != "" {
+		width, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || width < 1 || width > 100 {
+			ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "Invalid bucket: expected integer from 1 to 100"})
+			return
+		}
+		opts.BucketWidth = width
+	}
+	if value := ctx.Query("top"); value != "" {
+		top, err := strconv.Atoi(value)
+		if err != nil || top < 1 || top > maxLimit {
+			ctx.JSON(http.StatusBadRequest, model.ErrorResponse{Error: fmt.Sprintf("Invalid top: expected integer from 1 to %d", maxLimit)})
+			return
+		}
+		opts.Top = top
+	}
+
+	stats, err := h.storage.GetDemographics(ctx.Request.Context(), filter, opts)
+	if err != nil {
+		h.logger.Error("Ошибка подсчета статистики", zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
 		return
 	}
-	h.logger.Info("Успешно получены данные о людях", zap.Int("count", len(persons)))
-	ctx.JSON(http.StatusOK, persons)
+	ctx.JSON(http.StatusOK, stats)
 }
 
 // @Summary Создает нового пользователя.
@@ -260,31 +595,11 @@ func (h *Handler) CreatePerson(ctx *gin.Context) {
 	person.Surname = persReq.Surname
 	person.Patronymic = persReq.Patronymic
 
-	perstats, err := h.cache.GetPerson(ctx.Request.Context(), person.Name)
+	err := h.enricher.Enrich(ctx.Request.Context(), &person)
 	if err != nil {
-		h.logger.Error("Ошибка в кэше", zap.String("error", err.Error()))
-		err = h.addOnServ.Addon(&person)
-		if err != nil {
-			h.logger.Error("Ошибка в аддоне", zap.String("error", err.Error()))
-			ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
-			return
-		}
-		if person.Age != 0 && person.Gender != "" && person.Nationality != "" {
-			err = h.cache.SetPersonWithTTL(ctx.Request.Context(), person.Name, model.PersonStats{
-				Age:         person.Age,
-				Gender:      person.Gender,
-				Nationality: person.Nationality,
-			})
-			if err != nil {
-				h.logger.Error("Ошибка в кэше", zap.String("error", err.Error()))
-			}
-		}
-	} else {
-		h.logger.Info("Успешно получен человек из кэша")
-		person.Age = perstats.Age
-		person.Gender = perstats.Gender
-		person.Nationality = perstats.Nationality
-
+		h.logger.Error("Ошибка в аддоне", zap.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Internal server error"})
+		return
 	}
 
 	err = h.storage.CreatePerson(ctx.Request.Context(), &person)
@@ -296,3 +611,23 @@ func (h *Handler) CreatePerson(ctx *gin.Context) {
 	h.logger.Info("Успешно создан человек", zap.Int("id", person.ID))
 	ctx.JSON(http.StatusOK, model.IdResponse{ID: person.ID})
 }
+
+// @Summary Состояние сервиса
+// @Tags health
+// @Description Проверка работоспособности сервиса и доступности Redis. Недоступный кэш не делает сервис неработоспособным.
+// @Produce json
+// @Success 200 {object} model.HealthResponse
+// @Router /health [get]
+func (h *Handler) Health(ctx *gin.Context) {
+	resp := model.HealthResponse{Status: "ok", Cache: "up"}
+
+	err := h.cache.Ping(ctx.Request.Context())
+	if errors.Is(err, customerrors.ErrCacheDisabled) {
+		resp.Cache = "disabled"
+	} else if err != nil {
+		h.logger.Warn("Redis недоступен", zap.String("error", err.Error()))
+		resp.Status = "degraded"
+		resp.Cache = "down"
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
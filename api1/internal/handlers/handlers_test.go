@@ -4,48 +4,63 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	cache "github.com/nikita89756/testEffectiveMobile/internal/cache"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
 	"github.com/nikita89756/testEffectiveMobile/internal/handlers"
+	middleware "github.com/nikita89756/testEffectiveMobile/internal/middlware"
 	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage/memory"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
 
-type mockStorage struct{}
-type mockCache struct{}
 type mockAddonService struct{}
 
-func (m *mockStorage) CreatePerson(ctx context.Context, p *model.Person) error {
-    p.ID = 1
-    return nil
+type downCache struct{}
+
+func (m *downCache) GetPerson(ctx context.Context, name string) (*model.CachedStats, error) {
+    return nil, customerrors.ErrCacheUnavailable
 }
-func (m *mockStorage) GetPersonByID(ctx context.Context, id int) (*model.Person, error) {
-    return &model.Person{ID: id, Name: "Test", Surname: "User"}, nil
+func (m *downCache) SetPersonWithTTL(ctx context.Context, name string, stats model.PersonStats) error {
+    return customerrors.ErrCacheUnavailable
 }
-func (m *mockStorage) DeletePersonByID(ctx context.Context, id int) error {
-    return nil
+func (m *downCache) SetPersons(ctx context.Context, stats []model.NameStats) error {
+    return customerrors.ErrCacheUnavailable
 }
-func (m *mockStorage) UpdatePersonByID(ctx context.Context, p *model.Person) error {
-    return nil
+func (m *downCache) GetList(ctx context.Context, key string) ([]model.Person, error) {
+    return nil, customerrors.ErrCacheUnavailable
 }
-func (m *mockStorage) GetPersonsByFilter(ctx context.Context, filter model.Person, offset, limit int) ([]model.Person, error) {
-    return []model.Person{
-        {ID: 1, Name: "John", Surname: "Doe"},
-    }, nil
+func (m *downCache) SetList(ctx context.Context, key string, persons []model.Person, ttl time.Duration) error {
+    return customerrors.ErrCacheUnavailable
 }
-
-func (m *mockStorage) Migrate(migrationsDir string) error {
-    return nil
+func (m *downCache) Generation(ctx context.Context, table string) (int64, error) {
+    return 0, customerrors.ErrCacheUnavailable
 }
-func (m *mockCache) GetPerson(ctx context.Context, name string) (*model.PersonStats, error) {
-    return &model.PersonStats{}, nil
+func (m *downCache) BumpGeneration(ctx context.Context, table string) error {
+    return customerrors.ErrCacheUnavailable
 }
-func (m *mockCache) SetPersonWithTTL(ctx context.Context, name string, stats model.PersonStats) error {
-    return nil
+func (m *downCache) Ping(ctx context.Context) error {
+    return errors.New("connection refused")
+}
+
+// failingStorage - хранилище, у которого чтение по ID всегда завершается ошибкой err
+type failingStorage struct {
+    storage.Storage
+    err error
+}
+
+func (s *failingStorage) GetPersonByID(ctx context.Context, id int) (*model.Person, error) {
+    return &model.Person{}, s.err
 }
 
 func (m *mockAddonService) Addon(p *model.Person) error {
@@ -55,10 +70,18 @@ func (m *mockAddonService) Addon(p *model.Person) error {
     return nil
 }
 
+func newTestHandler(c cache.Cache, persons ...model.Person) *handlers.Handler {
+    db := memory.NewMemory(zap.NewNop())
+    for i := range persons {
+        _ = db.CreatePerson(context.Background(), &persons[i])
+    }
+    return handlers.NewHandler(db, zap.NewNop(), &mockAddonService{}, c)
+}
+
 func TestCreatePerson(t *testing.T) {
     gin.SetMode(gin.TestMode)
 
-    handler := handlers.NewHandler(&mockStorage{}, zap.NewNop(), &mockAddonService{}, &mockCache{})
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()))
 
     router := gin.New()
     router.POST("/api/persons", handler.CreatePerson)
@@ -80,7 +103,7 @@ func TestCreatePerson(t *testing.T) {
 }
 
 func TestGetPersonByID(t *testing.T) {
-    handler := handlers.NewHandler(&mockStorage{}, zap.NewNop(), &mockAddonService{}, &mockCache{})
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()), model.Person{Name: "Test", Surname: "User"})
 
     router := gin.New()
     router.GET("/api/persons/:id", handler.FindPersonByID)
@@ -97,8 +120,35 @@ func TestGetPersonByID(t *testing.T) {
     assert.Equal(t, "Test", person.Name)
 }
 
+func TestGetPersonByIDStorageError(t *testing.T) {
+    tests := []struct {
+        name string
+        err  error
+    }{
+        {name: "Database error", err: errors.New("connection reset by peer")},
+        // ошибки реплики, которые не переключают чтение на primary, тоже должны доходить до клиента
+        {name: "Replica recovery conflict", err: &pq.Error{Code: "40001", Message: "canceling statement due to conflict with recovery"}},
+        {name: "Replica timeout", err: context.DeadlineExceeded},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            db := &failingStorage{Storage: memory.NewMemory(zap.NewNop()), err: tt.err}
+            handler := handlers.NewHandler(db, zap.NewNop(), &mockAddonService{}, cache.NewMemoryCache(cache.DefaultPolicy()))
+            router := gin.New()
+            router.GET("/api/persons/:id", handler.FindPersonByID)
+
+            w := httptest.NewRecorder()
+            req, _ := http.NewRequest("GET", "/api/persons/1", nil)
+            router.ServeHTTP(w, req)
+
+            assert.Equal(t, http.StatusInternalServerError, w.Code)
+            assert.Empty(t, w.Header().Get("ETag"))
+        })
+    }
+}
+
 func TestGetPersons(t *testing.T) {
-    handler := handlers.NewHandler(&mockStorage{}, zap.NewNop(), &mockAddonService{}, &mockCache{})
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()), model.Person{Name: "John", Surname: "Doe"})
     router := gin.New()
     router.GET("/api/persons", handler.GetPersons)
 
@@ -109,8 +159,598 @@ func TestGetPersons(t *testing.T) {
 
     assert.Equal(t, http.StatusOK, w.Code)
 
-    var people []model.Person
-    _ = json.Unmarshal(w.Body.Bytes(), &people)
-    assert.Len(t, people, 1)
-    assert.Equal(t, "John", people[0].Name)
-}
\ No newline at end of file
+    var page model.PersonPage
+    _ = json.Unmarshal(w.Body.Bytes(), &page)
+    assert.Len(t, page.Items, 1)
+    assert.Equal(t, "John", page.Items[0].Name)
+    assert.Empty(t, page.NextCursor)
+    assert.Nil(t, page.Total)
+}
+
+func TestGetPersonsPagination(t *testing.T) {
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()),
+        model.Person{Name: "Ivan", Surname: "Ivanov", Age: 30},
+        model.Person{Name: "Anna", Surname: "Ivanova", Age: 45},
+        model.Person{Name: "Olga", Surname: "Petrova", Age: 25},
+        model.Person{Name: "Petr", Surname: "Petrov", Age: 30},
+        model.Person{Name: "John", Surname: "Doe", Age: 50},
+    )
+    router := gin.New()
+    router.GET("/api/persons", handler.GetPersons)
+
+    get := func(t *testing.T, query string) (int, model.PersonPage) {
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest("GET", "/api/persons?"+query, nil)
+        router.ServeHTTP(w, req)
+        var page model.PersonPage
+        _ = json.Unmarshal(w.Body.Bytes(), &page)
+        return w.Code, page
+    }
+    ids := func(page model.PersonPage) []int {
+        ids := make([]int, 0, len(page.Items))
+        for _, p := range page.Items {
+            ids = append(ids, p.ID)
+        }
+        return ids
+    }
+
+    t.Run("Forward and back", func(t *testing.T) {
+        code, first := get(t, "sort=age&limit=2")
+        assert.Equal(t, http.StatusOK, code)
+        assert.Equal(t, []int{3, 1}, ids(first))
+        assert.Empty(t, first.PrevCursor)
+        assert.NotEmpty(t, first.NextCursor)
+
+        _, second := get(t, "sort=age&limit=2&cursor="+first.NextCursor)
+        assert.Equal(t, []int{4, 2}, ids(second))
+        assert.NotEmpty(t, second.PrevCursor)
+
+        _, last := get(t, "sort=age&limit=2&cursor="+second.NextCursor)
+        assert.Equal(t, []int{5}, ids(last))
+        assert.Empty(t, last.NextCursor)
+
+        _, back := get(t, "sort=age&limit=2&cursor="+second.PrevCursor)
+        assert.Equal(t, []int{3, 1}, ids(back))
+        assert.Empty(t, back.PrevCursor)
+        assert.NotEmpty(t, back.NextCursor)
+    })
+    t.Run("Totals", func(t *testing.T) {
+        _, page := get(t, "limit=2&total=exact")
+        if assert.NotNil(t, page.Total) {
+            assert.Equal(t, int64(5), *page.Total)
+        }
+        assert.False(t, page.TotalEstimated)
+
+        _, page = get(t, "surname_prefix=Petr&total=estimate")
+        if assert.NotNil(t, page.Total) {
+            assert.Equal(t, int64(2), *page.Total)
+        }
+    })
+    t.Run("Empty page", func(t *testing.T) {
+        code, page := get(t, "name=Nobody")
+        assert.Equal(t, http.StatusOK, code)
+        assert.NotNil(t, page.Items)
+        assert.Empty(t, page.Items)
+    })
+    t.Run("Limit above maximum", func(t *testing.T) {
+        code, page := get(t, "limit=1000")
+        assert.Equal(t, http.StatusOK, code)
+        assert.Len(t, page.Items, 5)
+    })
+    t.Run("Invalid cursor", func(t *testing.T) {
+        code, _ := get(t, "cursor=garbage")
+        assert.Equal(t, http.StatusBadRequest, code)
+    })
+    t.Run("Cursor for another sort", func(t *testing.T) {
+        _, first := get(t, "sort=age&limit=2")
+        code, _ := get(t, "sort=surname&limit=2&cursor="+first.NextCursor)
+        assert.Equal(t, http.StatusBadRequest, code)
+    })
+    t.Run("Invalid total", func(t *testing.T) {
+        code, _ := get(t, "total=all")
+        assert.Equal(t, http.StatusBadRequest, code)
+    })
+    t.Run("Facets", func(t *testing.T) {
+        code, page := get(t, "age_min=30&limit=1&facets=age,gender")
+        assert.Equal(t, http.StatusOK, code)
+        assert.Len(t, page.Items, 1)
+        assert.Equal(t, map[string][]model.ValueCount{
+            "age":    {{Value: "30-39", Count: 2}, {Value: "40-49", Count: 1}, {Value: "50-59", Count: 1}},
+            "gender": {},
+        }, page.Facets, "фасеты считаются по всему фильтру, а не по странице")
+
+        _, page = get(t, "limit=1")
+        assert.Nil(t, page.Facets)
+    })
+    t.Run("Invalid facet", func(t *testing.T) {
+        code, _ := get(t, "facets=name")
+        assert.Equal(t, http.StatusBadRequest, code)
+    })
+}
+
+func TestGetPersonsFilters(t *testing.T) {
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()),
+        model.Person{Name: "Ivan", Surname: "Ivanov", Age: 30, Nationality: "RU", Gender: "male"},
+        model.Person{Name: "Anna", Surname: "Ivanova", Age: 45, Nationality: "UA", Gender: "female"},
+        model.Person{Name: "Olga", Surname: "Petrova", Age: 25, Nationality: "KZ", Gender: "female"},
+    )
+    router := gin.New()
+    router.GET("/api/persons", handler.GetPersons)
+
+    tests := []struct {
+        name     string
+        query    string
+        wantCode int
+        wantIDs  []int
+    }{
+        {name: "Age range", query: "age_min=25&age_max=40", wantCode: http.StatusOK, wantIDs: []int{1, 3}},
+        {name: "Nationality list", query: "nationality=RU,UA", wantCode: http.StatusOK, wantIDs: []int{1, 2}},
+        {name: "Surname prefix", query: "surname_prefix=Ivan&gender=female", wantCode: http.StatusOK, wantIDs: []int{2}},
+        {name: "IDs", query: "ids=3,1", wantCode: http.StatusOK, wantIDs: []int{1, 3}},
+        {name: "Created since date", query: "created_after=2000-01-01", wantCode: http.StatusOK, wantIDs: []int{1, 2, 3}},
+        {name: "Sorted", query: "sort=-age", wantCode: http.StatusOK, wantIDs: []int{2, 1, 3}},
+        {name: "Sorted with filter and page", query: "gender=female&sort=nationality&limit=1", wantCode: http.StatusOK, wantIDs: []int{3}},
+        {name: "Invalid sort field", query: "sort=surname,secret", wantCode: http.StatusBadRequest},
+        {name: "Invalid gender", query: "gender=male,other", wantCode: http.StatusBadRequest},
+        {name: "Invalid age", query: "age=abc", wantCode: http.StatusBadRequest},
+        {name: "Inverted age range", query: "age_min=40&age_max=25", wantCode: http.StatusBadRequest},
+        {name: "Invalid time", query: "updated_before=yesterday", wantCode: http.StatusBadRequest},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            req, _ := http.NewRequest("GET", "/api/persons?"+tt.query, nil)
+            router.ServeHTTP(w, req)
+
+            assert.Equal(t, tt.wantCode, w.Code)
+            if tt.wantIDs == nil {
+                return
+            }
+            var page model.PersonPage
+            _ = json.Unmarshal(w.Body.Bytes(), &page)
+            ids := make([]int, 0, len(page.Items))
+            for _, p := range page.Items {
+                ids = append(ids, p.ID)
+            }
+            assert.Equal(t, tt.wantIDs, ids)
+        })
+    }
+}
+
+func TestSearchPersons(t *testing.T) {
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()),
+        model.Person{Name: "Иван", Surname: "Иванов"},
+        model.Person{Name: "Anna", Surname: "Ivanova"},
+        model.Person{Name: "John", Surname: "Doe"},
+    )
+    router := gin.New()
+    router.GET("/api/persons/search", handler.SearchPersons)
+    router.GET("/api/persons/:id", handler.FindPersonByID)
+
+    tests := []struct {
+        name     string
+        url      string
+        wantCode int
+        wantIDs  []int
+    }{
+        {name: "Transliteration", url: "/api/persons/search?q=Ivanov", wantCode: http.StatusOK, wantIDs: []int{1, 2}},
+        {name: "Limit", url: "/api/persons/search?q=Ivanov&limit=1", wantCode: http.StatusOK, wantIDs: []int{1}},
+        {name: "Nothing found", url: "/api/persons/search?q=Sidorov", wantCode: http.StatusOK, wantIDs: []int{}},
+        {name: "Empty query", url: "/api/persons/search?q=%20", wantCode: http.StatusBadRequest},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            req, _ := http.NewRequest("GET", tt.url, nil)
+            router.ServeHTTP(w, req)
+
+            assert.Equal(t, tt.wantCode, w.Code)
+            if tt.wantIDs == nil {
+                return
+            }
+            var results []model.SearchResult
+            _ = json.Unmarshal(w.Body.Bytes(), &results)
+            ids := make([]int, 0, len(results))
+            for _, r := range results {
+                ids = append(ids, r.ID)
+                assert.Positive(t, r.Score)
+            }
+            assert.Equal(t, tt.wantIDs, ids)
+        })
+    }
+}
+
+func TestCreatePersonCacheDown(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    handler := newTestHandler(&downCache{})
+
+    router := gin.New()
+    router.POST("/api/persons", handler.CreatePerson)
+
+    body, _ := json.Marshal(model.PersonCreateRequest{Name: "John", Surname: "Doe"})
+
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("POST", "/api/persons", bytes.NewBuffer(body))
+    req.Header.Set("Content-Type", "application/json")
+
+    router.ServeHTTP(w, req)
+
+    assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHealth(t *testing.T) {
+    tests := []struct {
+        name       string
+        cache      cache.Cache
+        wantStatus string
+        wantCache  string
+    }{
+        {name: "Redis up", cache: cache.NewMemoryCache(cache.DefaultPolicy()), wantStatus: "ok", wantCache: "up"},
+        {name: "Redis down", cache: &downCache{}, wantStatus: "degraded", wantCache: "down"},
+        {name: "Cache disabled", cache: cache.NewNoopCache(), wantStatus: "ok", wantCache: "disabled"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            handler := newTestHandler(tt.cache)
+            router := gin.New()
+            router.GET("/api/health", handler.Health)
+
+            w := httptest.NewRecorder()
+            req, _ := http.NewRequest("GET", "/api/health", nil)
+            router.ServeHTTP(w, req)
+
+            assert.Equal(t, http.StatusOK, w.Code)
+            var res model.HealthResponse
+            _ = json.Unmarshal(w.Body.Bytes(), &res)
+            assert.Equal(t, tt.wantStatus, res.Status)
+            assert.Equal(t, tt.wantCache, res.Cache)
+        })
+    }
+}
+
+func TestDeleteAndRestorePerson(t *testing.T) {
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()), model.Person{Name: "Test", Surname: "User"})
+
+    router := gin.New()
+    router.GET("/api/persons/:id", handler.FindPersonByID)
+    router.DELETE("/api/persons/:id", handler.DeletePersonByID)
+    router.POST("/api/persons/:id/restore", handler.RestorePersonByID)
+
+    steps := []struct {
+        method, path string
+        wantCode     int
+    }{
+        {"POST", "/api/persons/1/restore", http.StatusNotFound},
+        {"DELETE", "/api/persons/1", http.StatusOK},
+        {"GET", "/api/persons/1", http.StatusNotFound},
+        {"DELETE", "/api/persons/1", http.StatusNotFound},
+        {"POST", "/api/persons/1/restore", http.StatusOK},
+        {"GET", "/api/persons/1", http.StatusOK},
+    }
+    for _, step := range steps {
+        w := httptest.NewRecorder()
+        req, _ := http.NewRequest(step.method, step.path, nil)
+        router.ServeHTTP(w, req)
+        assert.Equal(t, step.wantCode, w.Code, "%s %s", step.method, step.path)
+    }
+}
+
+func TestPersonHistory(t *testing.T) {
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()), model.Person{Name: "Test", Surname: "User"})
+
+    router := gin.New()
+    router.Use(middleware.Actor())
+    router.PUT("/api/persons/:id", handler.UpdatePersonByID)
+    router.GET("/api/persons/:id/history", handler.GetPersonHistory)
+    router.POST("/api/persons/:id/history/:version/revert", handler.RevertPerson)
+
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("PUT", "/api/persons/1", bytes.NewBufferString(`{"surname":"Changed"}`))
+    req.Header.Set("X-Actor", "alice")
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusOK, w.Code)
+
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/api/persons/1/history", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusOK, w.Code)
+
+    var history []model.PersonHistory
+    _ = json.Unmarshal(w.Body.Bytes(), &history)
+    assert.Len(t, history, 2)
+    assert.Equal(t, "alice", history[1].Actor)
+    assert.Equal(t, []model.FieldChange{{Field: "surname", From: "User", To: "Changed"}}, history[1].Changes)
+
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("POST", "/api/persons/1/history/1/revert", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusOK, w.Code)
+
+    var person model.Person
+    _ = json.Unmarshal(w.Body.Bytes(), &person)
+    assert.Equal(t, "User", person.Surname)
+
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("POST", "/api/persons/1/history/10/revert", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusNotFound, w.Code)
+
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/api/persons/2/history", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUpdatePersonIfMatch(t *testing.T) {
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()), model.Person{Name: "Test", Surname: "User"})
+
+    router := gin.New()
+    router.GET("/api/persons/:id", handler.FindPersonByID)
+    router.PUT("/api/persons/:id", handler.UpdatePersonByID)
+
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/persons/1", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+    tests := []struct {
+        name     string
+        ifMatch  string
+        wantCode int
+        wantETag string
+    }{
+        {name: "Matching ETag", ifMatch: `"1"`, wantCode: http.StatusOK, wantETag: `"2"`},
+        {name: "Stale ETag", ifMatch: `"1"`, wantCode: http.StatusPreconditionFailed},
+        {name: "One of ETags", ifMatch: `"1", "2"`, wantCode: http.StatusOK, wantETag: `"3"`},
+        {name: "Weak ETag", ifMatch: `W/"3"`, wantCode: http.StatusPreconditionFailed},
+        {name: "Any", ifMatch: "*", wantCode: http.StatusOK, wantETag: `"4"`},
+        {name: "Without If-Match", wantCode: http.StatusOK, wantETag: `"5"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            req, _ := http.NewRequest("PUT", "/api/persons/1", bytes.NewBufferString(`{"age":40}`))
+            if tt.ifMatch != "" {
+                req.Header.Set("If-Match", tt.ifMatch)
+            }
+            router.ServeHTTP(w, req)
+
+            assert.Equal(t, tt.wantCode, w.Code)
+            assert.Equal(t, tt.wantETag, w.Header().Get("ETag"))
+        })
+    }
+}
+
+func TestBulkCreatePersons(t *testing.T) {
+    db := memory.NewMemory(zap.NewNop())
+    handler := handlers.NewAdminHandler(db, zap.NewNop(), nil)
+    router := gin.New()
+    router.POST("/api/admin/persons/bulk", handler.BulkCreatePersons)
+
+    rows := `[{"name":"Ivan","surname":"Ivanov","age":30,"gender":"male"},{"name":"Anna"},{"name":"Olga","surname":"Petrova"}]`
+    tests := []struct {
+        name        string
+        url         string
+        body        string
+        wantCode    int
+        wantCreated int
+    }{
+        {name: "Atomic rejected", url: "/api/admin/persons/bulk?atomic=true", body: rows, wantCode: http.StatusUnprocessableEntity},
+        {name: "Partial", url: "/api/admin/persons/bulk", body: rows, wantCode: http.StatusOK, wantCreated: 2},
+        {name: "Empty", url: "/api/admin/persons/bulk", body: `[]`, wantCode: http.StatusBadRequest},
+        {name: "Invalid JSON", url: "/api/admin/persons/bulk", body: `{"name":"Ivan"}`, wantCode: http.StatusBadRequest},
+        {name: "Invalid atomic", url: "/api/admin/persons/bulk?atomic=maybe", body: rows, wantCode: http.StatusBadRequest},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            req, _ := http.NewRequest("POST", tt.url, bytes.NewBufferString(tt.body))
+            req.Header.Set("Content-Type", "application/json")
+            router.ServeHTTP(w, req)
+
+            assert.Equal(t, tt.wantCode, w.Code)
+            if tt.wantCode == http.StatusBadRequest {
+                return
+            }
+            var result model.BulkCreateResult
+            _ = json.Unmarshal(w.Body.Bytes(), &result)
+            assert.Equal(t, tt.wantCreated, result.Created)
+            if assert.Len(t, result.Errors, 1) {
+                assert.Equal(t, 1, result.Errors[0].Index)
+            }
+        })
+    }
+
+    persons, err := db.GetPersonsByFilter(context.Background(), model.PersonFilter{}, nil, 0)
+    assert.NoError(t, err)
+    assert.Len(t, persons, 2, "атомарная вставка ничего не создала")
+}
+
+func TestGetDemographics(t *testing.T) {
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()),
+        model.Person{Name: "Ivan", Surname: "Ivanov", Age: 30, Nationality: "RU", Gender: "male"},
+        model.Person{Name: "Anna", Surname: "Ivanova", Age: 45, Nationality: "UA", Gender: "female"},
+        model.Person{Name: "Ivan", Surname: "Petrov"},
+    )
+    router := gin.New()
+    router.GET("/api/persons/stats", handler.GetDemographics)
+    router.GET("/api/persons/:id", handler.FindPersonByID)
+
+    tests := []struct {
+        name      string
+        query     string
+        wantCode  int
+        wantTotal int64
+    }{
+        {name: "All", query: "bucket=20&top=1", wantCode: http.StatusOK, wantTotal: 3},
+        {name: "Filtered", query: "gender=female", wantCode: http.StatusOK, wantTotal: 1},
+        {name: "Invalid bucket", query: "bucket=0", wantCode: http.StatusBadRequest},
+        {name: "Invalid top", query: "top=many", wantCode: http.StatusBadRequest},
+        {name: "Invalid filter", query: "age_min=-1", wantCode: http.StatusBadRequest},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            req, _ := http.NewRequest("GET", "/api/persons/stats?"+tt.query, nil)
+            router.ServeHTTP(w, req)
+
+            assert.Equal(t, tt.wantCode, w.Code)
+            if tt.wantCode != http.StatusOK {
+                return
+            }
+            var stats model.Demographics
+            _ = json.Unmarshal(w.Body.Bytes(), &stats)
+            assert.Equal(t, tt.wantTotal, stats.Total)
+        })
+    }
+
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/persons/stats?bucket=20&top=1", nil)
+    router.ServeHTTP(w, req)
+    var stats model.Demographics
+    _ = json.Unmarshal(w.Body.Bytes(), &stats)
+    assert.Equal(t, []model.AgeBucket{{From: 20, To: 39, Count: 1}, {From: 40, To: 59, Count: 1}}, stats.AgeBuckets)
+    assert.Equal(t, []model.ValueCount{{Value: "Ivan", Count: 2}}, stats.TopNames)
+    assert.Equal(t, 66.7, stats.Coverage.Age)
+}
+
+func TestDuplicatesAndMerge(t *testing.T) {
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()),
+        model.Person{Name: "Ivan", Surname: "Petrov", Age: 30},
+        model.Person{Name: "ivan ", Surname: "PETROV", Gender: "male"},
+        model.Person{Name: "Anna", Surname: "Petrova"},
+    )
+
+    router := gin.New()
+    router.GET("/api/persons/duplicates", handler.FindDuplicates)
+    router.POST("/api/persons/merge", handler.MergePersons)
+    router.GET("/api/persons/:id", handler.FindPersonByID)
+
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/persons/duplicates", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusOK, w.Code)
+
+    var groups []model.DuplicateGroup
+    _ = json.Unmarshal(w.Body.Bytes(), &groups)
+    assert.Len(t, groups, 1)
+    assert.Equal(t, 1, groups[0].SurvivorID)
+    assert.Len(t, groups[0].Persons, 2)
+
+    tests := []struct {
+        name     string
+        body     string
+        wantCode int
+    }{
+        {name: "Invalid body", body: `{"ids":`, wantCode: http.StatusBadRequest},
+        {name: "One ID", body: `{"ids":[1,1]}`, wantCode: http.StatusBadRequest},
+        {name: "Negative ID", body: `{"ids":[-1,2]}`, wantCode: http.StatusBadRequest},
+        {name: "Survivor not in ids", body: `{"ids":[1,2],"survivor_id":3}`, wantCode: http.StatusBadRequest},
+        {name: "Not found", body: `{"ids":[1,42]}`, wantCode: http.StatusNotFound},
+        {name: "Merge", body: `{"ids":[1,2]}`, wantCode: http.StatusOK},
+        {name: "Already merged", body: `{"ids":[1,2]}`, wantCode: http.StatusNotFound},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            req, _ := http.NewRequest("POST", "/api/persons/merge", bytes.NewBufferString(tt.body))
+            router.ServeHTTP(w, req)
+            assert.Equal(t, tt.wantCode, w.Code)
+            if tt.wantCode == http.StatusOK {
+                var person model.Person
+                _ = json.Unmarshal(w.Body.Bytes(), &person)
+                assert.Equal(t, 1, person.ID)
+                assert.Equal(t, int64(30), person.Age)
+                assert.Equal(t, "male", person.Gender)
+                assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+            }
+        })
+    }
+
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/api/persons/2", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusMovedPermanently, w.Code)
+    assert.Equal(t, "/api/persons/1", w.Header().Get("Location"))
+
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/api/persons/3", nil)
+    router.ServeHTTP(w, req)
+    assert.Equal(t, http.StatusOK, w.Code)
+
+    w = httptest.NewRecorder()
+    req, _ = http.NewRequest("GET", "/api/persons/duplicates", nil)
+    router.ServeHTTP(w, req)
+    assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestGetPoolStats(t *testing.T) {
+    handler := handlers.NewAdminHandler(memory.NewMemory(zap.NewNop()), zap.NewNop(), nil)
+    router := gin.New()
+    router.GET("/api/admin/db/pool", handler.GetPoolStats)
+
+    w := httptest.NewRecorder()
+    req, _ := http.NewRequest("GET", "/api/admin/db/pool", nil)
+    router.ServeHTTP(w, req)
+
+    assert.Equal(t, http.StatusOK, w.Code)
+    assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestPatchPerson(t *testing.T) {
+    handler := newTestHandler(cache.NewMemoryCache(cache.DefaultPolicy()),
+        model.Person{Name: "Test", Surname: "User", Patronymic: "Petrovich", Age: 30, Nationality: "RU", Gender: "male"})
+
+    router := gin.New()
+    router.PATCH("/api/persons/:id", handler.PatchPersonByID)
+
+    tests := []struct {
+        name     string
+        id       string
+        body     string
+        ifMatch  string
+        wantCode int
+        want     model.Person
+    }{
+        {
+            name: "Clear with null", id: "1", body: `{"patronymic": null, "nationality": null}`, wantCode: http.StatusOK,
+            want: model.Person{Name: "Test", Surname: "User", Age: 30, Gender: "male", Version: 2},
+        },
+        {
+            name: "Missing fields unchanged", id: "1", body: `{"age": 31}`, ifMatch: `"2"`, wantCode: http.StatusOK,
+            want: model.Person{Name: "Test", Surname: "User", Age: 31, Gender: "male", Version: 3},
+        },
+        {
+            name: "Empty patch", id: "1", body: `{}`, wantCode: http.StatusOK,
+            want: model.Person{Name: "Test", Surname: "User", Age: 31, Gender: "male", Version: 3},
+        },
+        {name: "Stale ETag", id: "1", body: `{"age": 40}`, ifMatch: `"2"`, wantCode: http.StatusPreconditionFailed},
+        {name: "Null name", id: "1", body: `{"name": null}`, wantCode: http.StatusBadRequest},
+        {name: "Invalid gender", id: "1", body: `{"gender": "other"}`, wantCode: http.StatusBadRequest},
+        {name: "Zero age", id: "1", body: `{"age": 0}`, wantCode: http.StatusBadRequest},
+        {name: "Invalid JSON", id: "1", body: `{"age": "old"}`, wantCode: http.StatusBadRequest},
+        {name: "Not found", id: "2", body: `{"age": 40}`, wantCode: http.StatusNotFound},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            req, _ := http.NewRequest("PATCH", "/api/persons/"+tt.id, bytes.NewBufferString(tt.body))
+            req.Header.Set("Content-Type", "application/merge-patch+json")
+            if tt.ifMatch != "" {
+                req.Header.Set("If-Match", tt.ifMatch)
+            }
+            router.ServeHTTP(w, req)
+
+            assert.Equal(t, tt.wantCode, w.Code)
+            if tt.wantCode != http.StatusOK {
+                return
+            }
+            var got model.Person
+            assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+            assert.Equal(t, tt.want, model.Person{Name: got.Name, Surname: got.Surname, Patronymic: got.Patronymic, Age: got.Age,
+                Nationality: got.Nationality, Gender: got.Gender, Version: got.Version})
+            assert.Equal(t, `"`+strconv.Itoa(tt.want.Version)+`"`, w.Header().Get("ETag"))
+        })
+    }
+}
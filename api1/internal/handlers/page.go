@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// parseLimit - размер страницы, без параметра или при неверном значении defaultLimit, не больше maxLimit
+func parseLimit(ctx *gin.Context) int {
+	limit, err := strconv.Atoi(ctx.Query("limit"))
+	if err != nil || limit <= 0 {
+		return defaultLimit
+	}
+	return min(limit, maxLimit)
+}
+
+// parseTotal - "" (не считать), "exact" или "estimate"
+func parseTotal(ctx *gin.Context) (string, error) {
+	total := ctx.Query("total")
+	if total != "" && total != "exact" && total != "estimate" {
+		return "", fmt.Errorf("Invalid total %q, allowed: exact, estimate", total)
+	}
+	return total, nil
+}
+
+// newPage - rows получены с limit+1: лишняя запись означает, что в направлении курсора есть еще страница.
+// Для курсора назад лишняя запись первая, иначе последняя
+func newPage(rows []model.Person, after *model.Cursor, sort []model.SortField, limit int) model.PersonPage {
+	backward := after != nil && after.Backward
+	hasMore := len(rows) > limit
+	if hasMore {
+		if backward {
+			rows = rows[len(rows)-limit:]
+		} else {
+			rows = rows[:limit]
+		}
+	}
+	page := model.PersonPage{Items: rows}
+	if len(rows) == 0 {
+		return page
+	}
+	if hasMore || backward {
+		page.NextCursor = model.NewCursor(rows[len(rows)-1], sort, false).Encode()
+	}
+	if (hasMore && backward) || (after != nil && !backward) {
+		page.PrevCursor = model.NewCursor(rows[0], sort, true).Encode()
+	}
+	return page
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nikita89756/testEffectiveMobile/internal/actor"
+)
+
+// ActorHeader - заголовок с автором изменения для истории изменений
+const ActorHeader = "X-Actor"
+
+// Actor - кладет автора из заголовка X-Actor в контекст запроса
+func Actor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.GetHeader(ActorHeader)
+		if name == "" {
+			name = actor.Anonymous
+		}
+		c.Request = c.Request.WithContext(actor.WithActor(c.Request.Context(), name))
+		c.Next()
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikita89756/testEffectiveMobile/internal/consistency"
+)
+
+const (
+	// ReadPrimaryHeader - "true" отправляет чтения запроса в primary
+	ReadPrimaryHeader = "X-Read-Primary"
+	// ReadPrimaryCookie - выставляется после изменения на window, пока он есть, чтения клиента идут в primary
+	ReadPrimaryCookie = "read_primary"
+)
+
+// ReadYourWrites - чтобы клиент видел свои изменения при чтении из реплик: изменяющие запросы и запросы
+// с заголовком X-Read-Primary или cookie read_primary читают из primary. Изменяющий запрос выставляет
+// cookie на window, window = 0 отключает cookie
+func ReadYourWrites(window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		write := c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead && c.Request.Method != http.MethodOptions
+		_, err := c.Cookie(ReadPrimaryCookie)
+		if write || err == nil || c.GetHeader(ReadPrimaryHeader) == "true" {
+			c.Request = c.Request.WithContext(consistency.WithPrimary(c.Request.Context()))
+		}
+		if write && window > 0 {
+			c.SetCookie(ReadPrimaryCookie, "1", max(1, int(window.Seconds())), "/", "", false, true)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nikita89756/testEffectiveMobile/internal/consistency"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		method      string
+		header      string
+		cookie      bool
+		window      time.Duration
+		wantPrimary bool
+		wantCookie  bool
+	}{
+		{name: "Read", method: http.MethodGet},
+		{name: "Read with header", method: http.MethodGet, header: "true", wantPrimary: true},
+		{name: "Read with cookie", method: http.MethodGet, cookie: true, wantPrimary: true},
+		{name: "Write", method: http.MethodPut, window: 5 * time.Second, wantPrimary: true, wantCookie: true},
+		{name: "Write without window", method: http.MethodPost, wantPrimary: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ReadYourWrites(tt.window))
+			router.Handle(tt.method, "/", func(c *gin.Context) {
+				c.String(http.StatusOK, strconv.FormatBool(consistency.Primary(c.Request.Context())))
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(ReadPrimaryHeader, tt.header)
+			}
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: ReadPrimaryCookie, Value: "1"})
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, strconv.FormatBool(tt.wantPrimary), w.Body.String())
+			cookie := w.Header().Get("Set-Cookie")
+			if tt.wantCookie {
+				assert.Contains(t, cookie, ReadPrimaryCookie+"=1")
+				assert.Contains(t, cookie, "Max-Age=5")
+			} else {
+				assert.Empty(t, cookie)
+			}
+		})
+	}
+}
@@ -7,8 +7,9 @@ import (
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
     c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-    c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-    c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
+    c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+    c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Actor, If-Match")
+    c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
     if c.Request.Method == "OPTIONS" {
         c.AbortWithStatus(204)
         return
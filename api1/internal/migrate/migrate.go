@@ -0,0 +1,113 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/pressly/goose/v3"
+)
+
+// Usage - подсказка по командам Run
+const Usage = `migrate up              применить все новые миграции
+migrate down            откатить последнюю миграцию
+migrate redo            откатить и заново применить последнюю миграцию
+migrate to <version>    применить или откатить миграции до версии version (0 - откатить все)
+migrate status          список миграций и их состояние
+migrate version         текущая версия схемы`
+
+// ErrUsage - неизвестная команда или неверные аргументы
+var ErrUsage = errors.New("migrate: unknown command or invalid arguments")
+
+// Run - выполняет команду миграций args (см. Usage) и пишет результат в out
+func Run(ctx context.Context, provider *goose.Provider, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	switch cmd, args := args[0], args[1:]; {
+	case cmd == "up" && len(args) == 0:
+		results, err := provider.Up(ctx)
+		printResults(out, results...)
+		if err == nil && len(results) == 0 {
+			fmt.Fprintln(out, "нет новых миграций")
+		}
+		return err
+	case cmd == "down" && len(args) == 0:
+		result, err := provider.Down(ctx)
+		printResults(out, result)
+		return err
+	case cmd == "redo" && len(args) == 0:
+		result, err := provider.Down(ctx)
+		printResults(out, result)
+		if err != nil {
+			return err
+		}
+		result, err = provider.UpByOne(ctx)
+		printResults(out, result)
+		return err
+	case cmd == "to" && len(args) == 1:
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("%w: invalid version %q", ErrUsage, args[0])
+		}
+		return to(ctx, provider, version, out)
+	case cmd == "status" && len(args) == 0:
+		return status(ctx, provider, out)
+	case cmd == "version" && len(args) == 0:
+		version, err := provider.GetDBVersion(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, version)
+		return nil
+	}
+	return ErrUsage
+}
+
+// to - вверх до version, если схема старее, и вниз, если новее
+func to(ctx context.Context, provider *goose.Provider, version int64, out io.Writer) error {
+	current, err := provider.GetDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+	var results []*goose.MigrationResult
+	if version >= current {
+		results, err = provider.UpTo(ctx, version)
+	} else {
+		results, err = provider.DownTo(ctx, version)
+	}
+	printResults(out, results...)
+	if err == nil && len(results) == 0 {
+		fmt.Fprintln(out, "схема уже в версии", current)
+	}
+	return err
+}
+
+func status(ctx context.Context, provider *goose.Provider, out io.Writer) error {
+	statuses, err := provider.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tFILE")
+	for _, s := range statuses {
+		applied := "-"
+		if s.State == goose.StateApplied {
+			applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Source.Version, s.State, applied, s.Source.Path)
+	}
+	return w.Flush()
+}
+
+// printResults - результаты goose, в том числе частичные при ошибке (nil пропускаются)
+func printResults(out io.Writer, results ...*goose.MigrationResult) {
+	for _, r := range results {
+		if r != nil {
+			fmt.Fprintln(out, r)
+		}
+	}
+}
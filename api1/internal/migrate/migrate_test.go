@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/storage/sqlite"
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newProvider(t *testing.T) *goose.Provider {
+	db, err := sqlite.ConnectDB("file:"+filepath.Join(t.TempDir(), "people.db"), time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	provider, err := sqlite.NewSQLite(db, zap.NewNop(), time.Second).Migrations("")
+	require.NoError(t, err)
+	return provider
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	provider := newProvider(t)
+	sources := provider.ListSources()
+	require.NotEmpty(t, sources)
+	latest := sources[len(sources)-1].Version
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := Run(ctx, provider, args, &out)
+		return out.String(), err
+	}
+	version := func() int64 {
+		v, err := provider.GetDBVersion(ctx)
+		require.NoError(t, err)
+		return v
+	}
+
+	out, err := run("up")
+	require.NoError(t, err)
+	assert.Equal(t, len(sources), strings.Count(out, "OK"))
+	assert.Equal(t, latest, version())
+
+	out, err = run("up")
+	require.NoError(t, err)
+	assert.Contains(t, out, "нет новых миграций")
+
+	_, err = run("down")
+	require.NoError(t, err)
+	assert.Equal(t, sources[len(sources)-2].Version, version())
+
+	_, err = run("redo")
+	require.NoError(t, err)
+	assert.Equal(t, sources[len(sources)-2].Version, version(), "redo откатывает и применяет одну и ту же миграцию")
+
+	_, err = run("to", "0")
+	require.NoError(t, err)
+	assert.Zero(t, version())
+
+	_, err = run("to", strconv.FormatInt(sources[1].Version, 10))
+	require.NoError(t, err)
+	assert.Equal(t, sources[1].Version, version())
+
+	out, err = run("status")
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(out, string(goose.StateApplied)))
+	assert.Equal(t, len(sources)-2, strings.Count(out, string(goose.StatePending)))
+
+	out, err = run("version")
+	require.NoError(t, err)
+	assert.Equal(t, strconv.FormatInt(sources[1].Version, 10)+"\n", out)
+
+	for _, args := range [][]string{nil, {"sideways"}, {"to"}, {"to", "abc"}, {"up", "1"}} {
+		_, err = run(args...)
+		assert.ErrorIs(t, err, ErrUsage, "%v", args)
+	}
+}
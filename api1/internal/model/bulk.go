@@ -0,0 +1,81 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ограничения совпадают с размерами колонок таблицы people
+const (
+	maxNameLength        = 255
+	maxNationalityLength = 10
+	maxAge               = 150
+)
+
+// Validate - проверка записи перед вставкой. Текст ошибки отдается клиенту как есть
+func (p Person) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.TrimSpace(p.Surname) == "" {
+		return fmt.Errorf("surname is required")
+	}
+	for field, value := range map[string]string{"name": p.Name, "surname": p.Surname, "patronymic": p.Patronymic} {
+		if utf8.RuneCountInString(value) > maxNameLength {
+			return fmt.Errorf("%s is longer than %d characters", field, maxNameLength)
+		}
+	}
+	if p.Age < 0 || p.Age > maxAge {
+		return fmt.Errorf("age must be between 0 and %d", maxAge)
+	}
+	if p.Gender != "" && p.Gender != "male" && p.Gender != "female" {
+		return fmt.Errorf("gender must be male or female")
+	}
+	if utf8.RuneCountInString(p.Nationality) > maxNationalityLength {
+		return fmt.Errorf("nationality is longer than %d characters", maxNationalityLength)
+	}
+	return nil
+}
+
+// BulkRowError - ошибка строки массовой вставки, Index - позиция строки во входном списке
+type BulkRowError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// BulkCreateResult - результат массовой вставки. IDs идут в порядке входных записей, у строк с ошибкой ID = 0.
+// Errors отсортированы по Index
+type BulkCreateResult struct {
+	IDs     []int          `json:"ids"`
+	Created int            `json:"created"`
+	Errors  []BulkRowError `json:"errors,omitempty"`
+}
+
+// NewBulkCreateResult - проверяет записи через Validate, невалидные сразу попадают в Errors.
+// Возвращает индексы записей, которые можно вставлять
+func NewBulkCreateResult(persons []Person) (BulkCreateResult, []int) {
+	result := BulkCreateResult{IDs: make([]int, len(persons))}
+	valid := make([]int, 0, len(persons))
+	for i, p := range persons {
+		if err := p.Validate(); err != nil {
+			result.Fail(i, err.Error())
+			continue
+		}
+		valid = append(valid, i)
+	}
+	return result, valid
+}
+
+// Done - строка index вставлена с идентификатором id
+func (r *BulkCreateResult) Done(index, id int) {
+	r.IDs[index] = id
+	r.Created++
+}
+
+// Fail - строка index не вставлена
+func (r *BulkCreateResult) Fail(index int, message string) {
+	pos, _ := slices.BinarySearchFunc(r.Errors, index, func(e BulkRowError, index int) int { return e.Index - index })
+	r.Errors = slices.Insert(r.Errors, pos, BulkRowError{Index: index, Error: message})
+}
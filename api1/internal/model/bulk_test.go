@@ -0,0 +1,56 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersonValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		person  Person
+		wantErr bool
+	}{
+		{name: "Valid", person: Person{Name: "Иван", Surname: "Иванов", Age: 30, Gender: "male", Nationality: "RU"}},
+		{name: "Without stats", person: Person{Name: "Ivan", Surname: "Ivanov"}},
+		{name: "Blank name", person: Person{Name: " ", Surname: "Ivanov"}, wantErr: true},
+		{name: "No surname", person: Person{Name: "Ivan"}, wantErr: true},
+		{name: "Long patronymic", person: Person{Name: "Ivan", Surname: "Ivanov", Patronymic: strings.Repeat("я", 256)}, wantErr: true},
+		{name: "Cyrillic name at limit", person: Person{Name: strings.Repeat("я", 255), Surname: "Ivanov"}},
+		{name: "Negative age", person: Person{Name: "Ivan", Surname: "Ivanov", Age: -1}, wantErr: true},
+		{name: "Unknown gender", person: Person{Name: "Ivan", Surname: "Ivanov", Gender: "other"}, wantErr: true},
+		{name: "Long nationality", person: Person{Name: "Ivan", Surname: "Ivanov", Nationality: "RUSSIAN_FED"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.person.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBulkCreateResult(t *testing.T) {
+	result, valid := NewBulkCreateResult([]Person{{Name: "Ivan", Surname: "Ivanov"}, {Name: "Anna"}, {Name: "Olga", Surname: "Petrova"}})
+	assert.Equal(t, []int{0, 2}, valid)
+
+	result.Fail(2, "Failed to insert row")
+	result.Done(0, 10)
+	indexes := make([]int, 0, len(result.Errors))
+	for _, e := range result.Errors {
+		indexes = append(indexes, e.Index)
+	}
+	assert.Equal(t, []int{1, 2}, indexes)
+	assert.Equal(t, []int{10, 0, 0}, result.IDs)
+	assert.Equal(t, 1, result.Created)
+
+	result = BulkCreateResult{IDs: make([]int, 3)}
+	result.Fail(2, "Failed to insert row")
+	result.Fail(0, "Failed to insert row")
+	assert.Equal(t, 0, result.Errors[0].Index, "ошибки отсортированы по строкам")
+}
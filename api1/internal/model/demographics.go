@@ -0,0 +1,74 @@
+package model
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// DemographicsOptions - параметры статистики: ширина корзины возраста и число самых частых имен и фамилий
+type DemographicsOptions struct {
+	BucketWidth int64
+	Top         int
+}
+
+// Demographics - статистика по людям, подходящим под фильтр. В Genders и Nationalities
+// значение "" означает, что поле не заполнено (нет обогащения)
+type Demographics struct {
+	Total         int64        `json:"total"`
+	Genders       []ValueCount `json:"genders"`
+	Nationalities []ValueCount `json:"nationalities"`
+	// AgeBuckets - только люди с известным возрастом, пустые корзины пропускаются
+	AgeBuckets  []AgeBucket  `json:"age_buckets"`
+	TopNames    []ValueCount `json:"top_names"`
+	TopSurnames []ValueCount `json:"top_surnames"`
+	Coverage    Coverage     `json:"coverage"`
+}
+
+// ValueCount - число людей с данным значением поля
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// AgeBucket - возраст от From до To включительно
+type AgeBucket struct {
+	From  int64 `json:"from"`
+	To    int64 `json:"to"`
+	Count int64 `json:"count"`
+}
+
+// Coverage - доля людей с заполненными полями обогащения в процентах, Complete - заполнены все три
+type Coverage struct {
+	Age         float64 `json:"age"`
+	Gender      float64 `json:"gender"`
+	Nationality float64 `json:"nationality"`
+	Complete    float64 `json:"complete"`
+}
+
+// NewAgeBucket - корзина, в которую попадает возраст age
+func NewAgeBucket(age, width, count int64) AgeBucket {
+	from := age / width * width
+	return AgeBucket{From: from, To: from + width - 1, Count: count}
+}
+
+// NewCoverage - проценты от total с точностью до 0.1
+func NewCoverage(total, age, gender, nationality, complete int64) Coverage {
+	percent := func(n int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return math.Round(float64(n)*1000/float64(total)) / 10
+	}
+	return Coverage{Age: percent(age), Gender: percent(gender), Nationality: percent(nationality), Complete: percent(complete)}
+}
+
+// SortValueCounts - по убыванию числа, при равенстве по значению. Так же упорядочивают GROUP BY запросы хранилищ
+func SortValueCounts(counts []ValueCount) {
+	slices.SortFunc(counts, func(a, b ValueCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Value, b.Value)
+	})
+}
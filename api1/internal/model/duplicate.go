@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// DuplicateGroup - вероятные дубликаты одного человека, SurvivorID - запись, которая останется
+// при слиянии без явного выбора
+type DuplicateGroup struct {
+	SurvivorID int      `json:"survivor_id"`
+	Persons    []Person `json:"persons"`
+}
+
+// MergeRequest - слияние записей IDs в одну. SurvivorID = 0 - оставшаяся запись выбирается по правилу
+type MergeRequest struct {
+	IDs        []int `json:"ids"`
+	SurvivorID int   `json:"survivor_id"`
+}
+
+// PersonMerge - запись о слиянии: MergedID теперь ведет на SurvivorID
+type PersonMerge struct {
+	MergedID   int       `json:"merged_id"`
+	SurvivorID int       `json:"survivor_id"`
+	Actor      string    `json:"actor"`
+	MergedAt   time.Time `json:"merged_at"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FacetFields - поля, по которым GET /persons может вернуть фасеты
+var FacetFields = []string{"nationality", "gender", "age"}
+
+// FacetAgeBucketWidth - ширина диапазона возраста в фасете age
+const FacetAgeBucketWidth = 10
+
+// ParseFacets - список фасетов через запятую, неизвестное поле - ошибка, повторы пропускаются
+func ParseFacets(value string) ([]string, error) {
+	var facets []string
+	for _, part := range strings.Split(value, ",") {
+		field := strings.TrimSpace(part)
+		if field == "" || slices.Contains(facets, field) {
+			continue
+		}
+		if !slices.Contains(FacetFields, field) {
+			return nil, fmt.Errorf("Invalid facet %q, allowed: %s", field, strings.Join(FacetFields, ", "))
+		}
+		facets = append(facets, field)
+	}
+	return facets, nil
+}
+
+// AgeFacet - фасет age из корзин шириной FacetAgeBucketWidth, значение в виде "20-29"
+// для фильтра age_min=20&age_max=29
+func AgeFacet(buckets []AgeBucket) []ValueCount {
+	facet := make([]ValueCount, 0, len(buckets))
+	for _, b := range buckets {
+		facet = append(facet, ValueCount{Value: strconv.FormatInt(b.From, 10) + "-" + strconv.FormatInt(b.To, 10), Count: b.Count})
+	}
+	return facet
+}
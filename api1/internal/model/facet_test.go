@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFacets(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "Empty", value: "", want: nil},
+		{name: "Several", value: "gender, age", want: []string{"gender", "age"}},
+		{name: "Duplicates skipped", value: "age,age,", want: []string{"age"}},
+		{name: "Unknown field", value: "nationality,surname", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFacets(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAgeFacet(t *testing.T) {
+	facet := AgeFacet([]AgeBucket{NewAgeBucket(7, FacetAgeBucketWidth, 3), NewAgeBucket(42, FacetAgeBucketWidth, 1)})
+	assert.Equal(t, []ValueCount{{Value: "0-9", Count: 3}, {Value: "40-49", Count: 1}}, facet)
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// PersonFilter - фильтр и порядок списка людей. Пустые поля не учитываются, списки означают "любое из значений",
+// границы возраста включительные, *After - включительно, *Before - не включая.
+// Люди без возраста не попадают в выборку, если задан любой фильтр по возрасту.
+type PersonFilter struct {
+	IDs              []int      `json:"ids,omitempty"`
+	Names            []string   `json:"names,omitempty"`
+	Surnames         []string   `json:"surnames,omitempty"`
+	Patronymics      []string   `json:"patronymics,omitempty"`
+	NamePrefix       string     `json:"name_prefix,omitempty"`
+	SurnamePrefix    string     `json:"surname_prefix,omitempty"`
+	PatronymicPrefix string     `json:"patronymic_prefix,omitempty"`
+	Ages             []int64    `json:"ages,omitempty"`
+	AgeMin           *int64     `json:"age_min,omitempty"`
+	AgeMax           *int64     `json:"age_max,omitempty"`
+	Nationalities    []string   `json:"nationalities,omitempty"`
+	Genders          []string   `json:"genders,omitempty"`
+	CreatedAfter     *time.Time `json:"created_after,omitempty"`
+	CreatedBefore    *time.Time `json:"created_before,omitempty"`
+	UpdatedAfter     *time.Time `json:"updated_after,omitempty"`
+	UpdatedBefore    *time.Time `json:"updated_before,omitempty"`
+	// Sort - порядок сортировки, id всегда добавляется последним
+	Sort []SortField `json:"sort,omitempty"`
+}
+
+// Matches - проверка фильтра в Go для хранилища в памяти, повторяет условия SQL
+func (f PersonFilter) Matches(p Person) bool {
+	if (len(f.Ages) > 0 || f.AgeMin != nil || f.AgeMax != nil) && p.Age == 0 {
+		return false
+	}
+	return (len(f.IDs) == 0 || slices.Contains(f.IDs, p.ID)) &&
+		(len(f.Names) == 0 || slices.Contains(f.Names, p.Name)) &&
+		(len(f.Surnames) == 0 || slices.Contains(f.Surnames, p.Surname)) &&
+		(len(f.Patronymics) == 0 || slices.Contains(f.Patronymics, p.Patronymic)) &&
+		strings.HasPrefix(p.Name, f.NamePrefix) &&
+		strings.HasPrefix(p.Surname, f.SurnamePrefix) &&
+		strings.HasPrefix(p.Patronymic, f.PatronymicPrefix) &&
+		(len(f.Ages) == 0 || slices.Contains(f.Ages, p.Age)) &&
+		(f.AgeMin == nil || p.Age >= *f.AgeMin) &&
+		(f.AgeMax == nil || p.Age <= *f.AgeMax) &&
+		(len(f.Nationalities) == 0 || slices.Contains(f.Nationalities, p.Nationality)) &&
+		(len(f.Genders) == 0 || slices.Contains(f.Genders, p.Gender)) &&
+		(f.CreatedAfter == nil || !p.CreatedAt.Before(*f.CreatedAfter)) &&
+		(f.CreatedBefore == nil || p.CreatedAt.Before(*f.CreatedBefore)) &&
+		(f.UpdatedAfter == nil || !p.UpdatedAt.Before(*f.UpdatedAfter)) &&
+		(f.UpdatedBefore == nil || p.UpdatedAt.Before(*f.UpdatedBefore))
+}
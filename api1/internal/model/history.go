@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+// Действия в истории изменений
+const (
+	HistoryCreate  = "create"
+	HistoryUpdate  = "update"
+	HistoryDelete  = "delete"
+	HistoryRestore = "restore"
+	HistoryRevert  = "revert"
+	HistoryMerge   = "merge"
+)
+
+// PersonHistory - запись истории изменений человека. Version - порядковый номер изменения этого человека, начиная с 1.
+// Before пуст для создания, Changes вычисляется из Before и After при чтении.
+type PersonHistory struct {
+	Version   int           `json:"version"`
+	PersonID  int           `json:"person_id"`
+	Action    string        `json:"action"`
+	Before    *Person       `json:"before"`
+	After     *Person       `json:"after"`
+	Changes   []FieldChange `json:"changes"`
+	Actor     string        `json:"actor"`
+	ChangedAt time.Time     `json:"changed_at"`
+}
+
+// FieldChange - изменение одного поля между версиями
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// Diff - изменившиеся поля между двумя состояниями человека, nil означает отсутствие записи
+func Diff(before, after *Person) []FieldChange {
+	var b, a Person
+	if before != nil {
+		b = *before
+	}
+	if after != nil {
+		a = *after
+	}
+	changes := make([]FieldChange, 0)
+	addChange := func(field string, from, to interface{}) {
+		if from != to {
+			changes = append(changes, FieldChange{Field: field, From: from, To: to})
+		}
+	}
+	addChange("name", b.Name, a.Name)
+	addChange("surname", b.Surname, a.Surname)
+	addChange("patronymic", b.Patronymic, a.Patronymic)
+	addChange("age", b.Age, a.Age)
+	addChange("nationality", b.Nationality, a.Nationality)
+	addChange("gender", b.Gender, a.Gender)
+	addChange("deleted", b.DeletedAt != nil, a.DeletedAt != nil)
+	return changes
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	now := time.Now()
+	ivan := &Person{ID: 1, Name: "Ivan", Surname: "Ivanov", Age: 30}
+
+	tests := []struct {
+		name          string
+		before, after *Person
+		want          []FieldChange
+	}{
+		{
+			name:   "Create",
+			before: nil,
+			after:  ivan,
+			want: []FieldChange{
+				{Field: "name", From: "", To: "Ivan"},
+				{Field: "surname", From: "", To: "Ivanov"},
+				{Field: "age", From: int64(0), To: int64(30)},
+			},
+		},
+		{
+			name:   "Update",
+			before: ivan,
+			after:  &Person{ID: 1, Name: "Ivan", Surname: "Petrov", Age: 31, UpdatedAt: now},
+			want: []FieldChange{
+				{Field: "surname", From: "Ivanov", To: "Petrov"},
+				{Field: "age", From: int64(30), To: int64(31)},
+			},
+		},
+		{
+			name:   "Delete",
+			before: ivan,
+			after:  &Person{ID: 1, Name: "Ivan", Surname: "Ivanov", Age: 30, DeletedAt: &now},
+			want:   []FieldChange{{Field: "deleted", From: false, To: true}},
+		},
+		{
+			name:   "No changes",
+			before: ivan,
+			after:  ivan,
+			want:   []FieldChange{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Diff(tt.before, tt.after))
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// OutboxEvent - событие об изменении человека из таблицы outbox. Пишется в одной транзакции с изменением,
+// поэтому не теряется и не появляется без него. ID растет в порядке записи, Version - номер изменения
+// из истории (PersonHistory.Version): получатель по нему отбрасывает повторы и устаревшие события
+type OutboxEvent struct {
+	ID         int64     `json:"id"`
+	Type       string    `json:"type"`
+	PersonID   int       `json:"person_id"`
+	Version    int       `json:"version"`
+	Before     *Person   `json:"before"`
+	After      *Person   `json:"after"`
+	Actor      string    `json:"actor"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// EventType - тип события для действия истории: person.create, person.update и т.д.
+func EventType(action string) string {
+	return "person." + action
+}
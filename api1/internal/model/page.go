@@ -0,0 +1,148 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+)
+
+// Cursor - позиция в списке для keyset пагинации: значения полей сортировки граничной записи.
+// Без Backward выбираются записи после Key, с Backward - записи перед Key
+type Cursor struct {
+	Key      Person
+	Backward bool
+	// Sort - сортировка, для которой выдан курсор, в виде "surname,-age,id"
+	Sort string
+}
+
+// PersonPage - страница списка людей. Total заполняется только по запросу,
+// TotalEstimated означает, что это оценка планировщика, а не точный подсчет
+type PersonPage struct {
+	Items          []Person `json:"items"`
+	NextCursor     string   `json:"next_cursor,omitempty"`
+	PrevCursor     string   `json:"prev_cursor,omitempty"`
+	Total          *int64   `json:"total,omitempty"`
+	TotalEstimated bool     `json:"total_estimated,omitempty"`
+	// Facets - число людей по значениям полей из параметра facets для всего фильтра, а не только страницы
+	Facets map[string][]ValueCount `json:"facets,omitempty"`
+}
+
+// SortKey - сортировка с id в конце в виде "surname,-age,id", записывается в курсор
+func SortKey(fields []SortField) string {
+	fields = WithTiebreaker(fields)
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f.Desc {
+			parts = append(parts, "-"+f.Field)
+		} else {
+			parts = append(parts, f.Field)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// NewCursor - курсор на запись person для текущей сортировки
+func NewCursor(person Person, fields []SortField, backward bool) Cursor {
+	return Cursor{Key: person, Backward: backward, Sort: SortKey(fields)}
+}
+
+// After - запись идет после курсора в порядке сортировки (для Backward - перед ним)
+func (c Cursor) After(p Person, fields []SortField) bool {
+	fields = WithTiebreaker(fields)
+	for _, f := range fields {
+		cmp := comparePersons(p, c.Key, f.Field)
+		if f.Desc != c.Backward {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp > 0
+		}
+	}
+	return false
+}
+
+// cursorData - в курсор попадают только поля сортировки
+type cursorData struct {
+	Sort     string                     `json:"s"`
+	Backward bool                       `json:"b,omitempty"`
+	Values   map[string]json.RawMessage `json:"v"`
+}
+
+// Encode - непрозрачная строка для next_cursor и prev_cursor
+func (c Cursor) Encode() string {
+	data := cursorData{Sort: c.Sort, Backward: c.Backward, Values: make(map[string]json.RawMessage)}
+	for _, part := range strings.Split(c.Sort, ",") {
+		field := strings.TrimPrefix(part, "-")
+		value, _ := json.Marshal(c.Key.SortValue(field))
+		data.Values[field] = value
+	}
+	raw, _ := json.Marshal(data)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor - курсор должен быть выдан для той же сортировки, иначе ErrInvalidCursor
+func DecodeCursor(value string, fields []SortField) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return Cursor{}, customerrors.ErrInvalidCursor
+	}
+	var data cursorData
+	if err := json.Unmarshal(raw, &data); err != nil || data.Sort != SortKey(fields) {
+		return Cursor{}, customerrors.ErrInvalidCursor
+	}
+	c := Cursor{Backward: data.Backward, Sort: data.Sort}
+	for _, f := range WithTiebreaker(fields) {
+		value, ok := data.Values[f.Field]
+		if !ok || c.Key.setSortValue(f.Field, value) != nil {
+			return Cursor{}, customerrors.ErrInvalidCursor
+		}
+	}
+	return c, nil
+}
+
+// SortValue - значение поля сортировки для условия keyset, пустые значения совпадают с COALESCE в SQL
+func (p Person) SortValue(field string) interface{} {
+	switch field {
+	case "name":
+		return p.Name
+	case "surname":
+		return p.Surname
+	case "patronymic":
+		return p.Patronymic
+	case "age":
+		return p.Age
+	case "nationality":
+		return p.Nationality
+	case "gender":
+		return p.Gender
+	case "created_at":
+		return p.CreatedAt
+	case "updated_at":
+		return p.UpdatedAt
+	}
+	return p.ID
+}
+
+func (p *Person) setSortValue(field string, value json.RawMessage) error {
+	switch field {
+	case "name":
+		return json.Unmarshal(value, &p.Name)
+	case "surname":
+		return json.Unmarshal(value, &p.Surname)
+	case "patronymic":
+		return json.Unmarshal(value, &p.Patronymic)
+	case "age":
+		return json.Unmarshal(value, &p.Age)
+	case "nationality":
+		return json.Unmarshal(value, &p.Nationality)
+	case "gender":
+		return json.Unmarshal(value, &p.Gender)
+	case "created_at":
+		return json.Unmarshal(value, &p.CreatedAt)
+	case "updated_at":
+		return json.Unmarshal(value, &p.UpdatedAt)
+	}
+	return json.Unmarshal(value, &p.ID)
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorEncodeDecode(t *testing.T) {
+	created := time.Date(2025, 6, 1, 10, 30, 0, 123456789, time.UTC)
+	person := Person{ID: 7, Name: "Ivan", Surname: "Ivanov", Age: 30, Nationality: "RU", CreatedAt: created}
+	fields := []SortField{{Field: "age", Desc: true}, {Field: "created_at"}}
+
+	encoded := NewCursor(person, fields, true).Encode()
+	got, err := DecodeCursor(encoded, fields)
+	require.NoError(t, err)
+	assert.True(t, got.Backward)
+	assert.Equal(t, "-age,created_at,id", got.Sort)
+	assert.Equal(t, Person{ID: 7, Age: 30, CreatedAt: created}, got.Key, "в курсор попадают только поля сортировки")
+
+	tests := []struct {
+		name   string
+		value  string
+		fields []SortField
+	}{
+		{name: "Another sort", value: encoded, fields: []SortField{{Field: "age"}, {Field: "created_at"}}},
+		{name: "Not base64", value: "not a cursor!", fields: fields},
+		{name: "Not json", value: "bm90IGpzb24", fields: fields},
+		{name: "Empty", value: "", fields: fields},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeCursor(tt.value, tt.fields)
+			assert.ErrorIs(t, err, customerrors.ErrInvalidCursor)
+		})
+	}
+}
+
+func TestCursorAfter(t *testing.T) {
+	fields := []SortField{{Field: "surname"}, {Field: "age", Desc: true}}
+	cursor := NewCursor(Person{ID: 5, Surname: "Ivanov", Age: 30}, fields, false)
+
+	assert.True(t, cursor.After(Person{ID: 1, Surname: "Petrov", Age: 50}, fields))
+	assert.True(t, cursor.After(Person{ID: 1, Surname: "Ivanov", Age: 25}, fields))
+	assert.True(t, cursor.After(Person{ID: 6, Surname: "Ivanov", Age: 30}, fields))
+	assert.False(t, cursor.After(Person{ID: 5, Surname: "Ivanov", Age: 30}, fields), "сама запись курсора не входит")
+	assert.False(t, cursor.After(Person{ID: 9, Surname: "Ivanov", Age: 40}, fields))
+
+	cursor.Backward = true
+	assert.True(t, cursor.After(Person{ID: 9, Surname: "Ivanov", Age: 40}, fields))
+	assert.False(t, cursor.After(Person{ID: 1, Surname: "Petrov", Age: 50}, fields))
+}
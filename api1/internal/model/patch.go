@@ -0,0 +1,110 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Optional - поле JSON Merge Patch (RFC 7396): если поля нет в запросе, Set = false и значение не меняется,
+// null - Set и Null, значение - Set и Value
+type Optional[T any] struct {
+	Value T
+	Set   bool
+	Null  bool
+}
+
+// UnmarshalJSON - encoding/json вызывает его и для null, а для отсутствующего поля не вызывает
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if bytes.Equal(data, []byte("null")) {
+		o.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+// apply - значение поля после патча
+func (o Optional[T]) apply(current T) T {
+	switch {
+	case !o.Set:
+		return current
+	case o.Null:
+		var zero T
+		return zero
+	}
+	return o.Value
+}
+
+// PersonPatch - тело PATCH /persons/{id} (application/merge-patch+json). Отчество, возраст, национальность
+// и пол можно очистить через null, имя и фамилию - нет
+type PersonPatch struct {
+	Name        Optional[string] `json:"name" swaggertype:"string"`
+	Surname     Optional[string] `json:"surname" swaggertype:"string"`
+	Patronymic  Optional[string] `json:"patronymic" swaggertype:"string"`
+	Age         Optional[int64]  `json:"age" swaggertype:"integer"`
+	Nationality Optional[string] `json:"nationality" swaggertype:"string"`
+	Gender      Optional[string] `json:"gender" swaggertype:"string"`
+}
+
+// PatchValue - новое значение колонки people, Value = nil - NULL
+type PatchValue struct {
+	Column string
+	Value  any
+}
+
+// Values - заданные в патче колонки в порядке полей, null пишется как NULL. Отчество, как при создании
+// и обновлении, хранится пустой строкой: GetPersonByID в Postgres читает его без NullString
+func (p PersonPatch) Values() []PatchValue {
+	values := make([]PatchValue, 0, 6)
+	add := func(column string, set bool, value any, null bool) {
+		if !set {
+			return
+		}
+		if null {
+			value = nil
+		}
+		values = append(values, PatchValue{Column: column, Value: value})
+	}
+	add("name", p.Name.Set, p.Name.Value, p.Name.Null)
+	add("surname", p.Surname.Set, p.Surname.Value, p.Surname.Null)
+	add("patronymic", p.Patronymic.Set, p.Patronymic.Value, false)
+	add("age", p.Age.Set, p.Age.Value, p.Age.Null)
+	add("nationality", p.Nationality.Set, p.Nationality.Value, p.Nationality.Null)
+	add("gender", p.Gender.Set, p.Gender.Value, p.Gender.Null)
+	return values
+}
+
+// Apply - применяет патч к person. Хранилища применяют его к заблокированной записи, чтобы записать историю
+func (p PersonPatch) Apply(person *Person) {
+	person.Name = p.Name.apply(person.Name)
+	person.Surname = p.Surname.apply(person.Surname)
+	person.Patronymic = p.Patronymic.apply(person.Patronymic)
+	person.Age = p.Age.apply(person.Age)
+	person.Nationality = p.Nationality.apply(person.Nationality)
+	person.Gender = p.Gender.apply(person.Gender)
+}
+
+// Validate - проверка патча по правилам Person.Validate для заданных полей. Очищает поле только null, поэтому
+// нулевой возраст и пустые пол и национальность отклоняются. Текст ошибки отдается клиенту как есть
+func (p PersonPatch) Validate() error {
+	if p.Name.Null {
+		return fmt.Errorf("name can not be null")
+	}
+	if p.Surname.Null {
+		return fmt.Errorf("surname can not be null")
+	}
+	if p.Age.Set && !p.Age.Null && p.Age.Value == 0 {
+		return fmt.Errorf("age must be between 1 and %d, use null to clear it", maxAge)
+	}
+	if p.Nationality.Set && !p.Nationality.Null && p.Nationality.Value == "" {
+		return fmt.Errorf("nationality can not be empty, use null to clear it")
+	}
+	if p.Gender.Set && !p.Gender.Null && p.Gender.Value == "" {
+		return fmt.Errorf("gender can not be empty, use null to clear it")
+	}
+	// незаданные имя и фамилия не проверяются, поэтому подставляются заведомо допустимые значения
+	person := Person{Name: "-", Surname: "-"}
+	p.Apply(&person)
+	return person.Validate()
+}
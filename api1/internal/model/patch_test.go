@@ -0,0 +1,57 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersonPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []PatchValue
+		wantErr string
+	}{
+		{name: "Empty", body: `{}`, want: []PatchValue{}},
+		{
+			name: "Values and nulls",
+			body: `{"surname": "Petrov", "patronymic": null, "age": 31}`,
+			want: []PatchValue{{Column: "surname", Value: "Petrov"}, {Column: "patronymic", Value: ""}, {Column: "age", Value: int64(31)}},
+		},
+		{
+			name: "Nulls clear stats",
+			body: `{"age": null, "nationality": null, "gender": null}`,
+			want: []PatchValue{{Column: "age"}, {Column: "nationality"}, {Column: "gender"}},
+		},
+		{name: "Zero age", body: `{"age": 0}`, wantErr: "age must be between 1 and 150, use null to clear it"},
+		{name: "Empty nationality", body: `{"nationality": ""}`, wantErr: "nationality can not be empty, use null to clear it"},
+		{name: "Empty gender", body: `{"gender": ""}`, wantErr: "gender can not be empty, use null to clear it"},
+		{name: "Null name", body: `{"name": null}`, wantErr: "name can not be null"},
+		{name: "Empty surname", body: `{"surname": " "}`, wantErr: "surname is required"},
+		{name: "Age out of range", body: `{"age": 200}`, wantErr: "age must be between 0 and 150"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch PersonPatch
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &patch))
+			if tt.wantErr != "" {
+				assert.EqualError(t, patch.Validate(), tt.wantErr)
+				return
+			}
+			require.NoError(t, patch.Validate())
+			assert.Equal(t, tt.want, patch.Values())
+		})
+	}
+}
+
+func TestPersonPatchApply(t *testing.T) {
+	var patch PersonPatch
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "Petr", "patronymic": null, "age": 40}`), &patch))
+
+	person := Person{ID: 1, Name: "Ivan", Surname: "Ivanov", Patronymic: "Ivanovich", Age: 30, Nationality: "RU", Version: 2}
+	patch.Apply(&person)
+	assert.Equal(t, Person{ID: 1, Name: "Petr", Surname: "Ivanov", Age: 40, Nationality: "RU", Version: 2}, person)
+}
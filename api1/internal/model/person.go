@@ -12,6 +12,16 @@ type Person struct {
 	Gender string `json:"gender"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// Version - увеличивается при каждом изменении записи, используется для оптимистичной блокировки (ETag)
+	Version int `json:"version"`
+	// DeletedAt - время мягкого удаления, заполняется только в списке удаленных записей
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// SearchResult - человек из поиска и его релевантность, результаты отсортированы по убыванию Score
+type SearchResult struct {
+	Person
+	Score float64 `json:"score"`
 }
 
 type PersonCreateRequest struct {
@@ -39,6 +49,37 @@ type PersonStats struct {
 	Gender      string `json:"gender"`
 }
 
+// CachedStats - данные обогащения из кэша. После FreshUntil запись считается устаревшей,
+// но еще может отдаваться, пока обновляется в фоне.
+type CachedStats struct {
+	PersonStats
+	FreshUntil time.Time `json:"fresh_until"`
+}
+
+func (c CachedStats) Stale(now time.Time) bool {
+	return !now.Before(c.FreshUntil)
+}
+
+// NameStats - данные обогащения для конкретного имени, используются для прогрева кэша
+type NameStats struct {
+	Name string `json:"name"`
+	PersonStats
+}
+
+// WarmupStatus - состояние последнего прогрева кэша
+type WarmupStatus struct {
+	Running    bool      `json:"running"`
+	Processed  int       `json:"processed"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
-}
\ No newline at end of file
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+	Cache  string `json:"cache"`
+}
@@ -0,0 +1,34 @@
+package model
+
+import "database/sql"
+
+// PoolStats - состояние пула соединений с базой из sql.DB.Stats() или pgxpool.Stat. Name - "primary" или "replica-N"
+type PoolStats struct {
+	Name               string `json:"name"`
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	// WaitCount и WaitDurationMs - сколько раз и сколько всего запросы ждали свободного соединения с запуска
+	WaitCount      int64 `json:"wait_count"`
+	WaitDurationMs int64 `json:"wait_duration_ms"`
+	// Max*Closed - сколько соединений закрыто по MaxIdleConns, ConnMaxIdleTime и ConnMaxLifetime
+	MaxIdleClosed     int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64 `json:"max_lifetime_closed"`
+}
+
+func NewPoolStats(name string, stats sql.DBStats) PoolStats {
+	return PoolStats{
+		Name:               name,
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SortableFields - поля, по которым можно сортировать список людей
+var SortableFields = []string{"id", "name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at"}
+
+// SortField - поле сортировки, Desc - по убыванию
+type SortField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// ParseSort - разбирает "surname,-age,created_at": поля через запятую, "-" перед полем означает по убыванию.
+// Неизвестное или повторяющееся поле - ошибка с текстом для ответа 400
+func ParseSort(value string) ([]SortField, error) {
+	var fields []SortField
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		field := SortField{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if !slices.Contains(SortableFields, field.Field) {
+			return nil, fmt.Errorf("Invalid sort field %q, allowed: %s", field.Field, strings.Join(SortableFields, ", "))
+		}
+		if slices.ContainsFunc(fields, func(f SortField) bool { return f.Field == field.Field }) {
+			return nil, fmt.Errorf("Duplicate sort field %q", field.Field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// WithTiebreaker - сортировка с id в конце, чтобы порядок был однозначным и страницы не пересекались
+func WithTiebreaker(fields []SortField) []SortField {
+	if slices.ContainsFunc(fields, func(f SortField) bool { return f.Field == "id" }) {
+		return fields
+	}
+	return append(slices.Clone(fields), SortField{Field: "id"})
+}
+
+// SortPersons - сортировка в Go для хранилища в памяти. Пустые значения считаются наименьшими, как COALESCE в SQL
+func SortPersons(persons []Person, fields []SortField) {
+	fields = WithTiebreaker(fields)
+	slices.SortFunc(persons, func(a, b Person) int {
+		for _, f := range fields {
+			c := comparePersons(a, b, f.Field)
+			if f.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+}
+
+func comparePersons(a, b Person, field string) int {
+	switch field {
+	case "name":
+		return cmp.Compare(a.Name, b.Name)
+	case "surname":
+		return cmp.Compare(a.Surname, b.Surname)
+	case "patronymic":
+		return cmp.Compare(a.Patronymic, b.Patronymic)
+	case "age":
+		return cmp.Compare(a.Age, b.Age)
+	case "nationality":
+		return cmp.Compare(a.Nationality, b.Nationality)
+	case "gender":
+		return cmp.Compare(a.Gender, b.Gender)
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
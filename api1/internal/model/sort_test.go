@@ -0,0 +1,62 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []SortField
+		wantErr bool
+	}{
+		{name: "Empty", value: "", want: nil},
+		{name: "Several fields", value: "surname,-age, created_at", want: []SortField{{Field: "surname"}, {Field: "age", Desc: true}, {Field: "created_at"}}},
+		{name: "Empty parts skipped", value: "-id,", want: []SortField{{Field: "id", Desc: true}}},
+		{name: "Unknown field", value: "surname,password", wantErr: true},
+		{name: "Column expression", value: "age;drop table people", wantErr: true},
+		{name: "Duplicate field", value: "age,-age", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSort(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSortPersons(t *testing.T) {
+	now := time.Now()
+	persons := []Person{
+		{ID: 1, Surname: "Petrov", Age: 30, CreatedAt: now},
+		{ID: 2, Surname: "Ivanov", Age: 0, CreatedAt: now.Add(time.Second)},
+		{ID: 3, Surname: "Petrov", Age: 45, CreatedAt: now.Add(-time.Second)},
+		{ID: 4, Surname: "Ivanov", Age: 30, CreatedAt: now},
+	}
+	ids := func() []int {
+		res := make([]int, 0, len(persons))
+		for _, p := range persons {
+			res = append(res, p.ID)
+		}
+		return res
+	}
+
+	SortPersons(persons, []SortField{{Field: "surname"}, {Field: "age", Desc: true}})
+	assert.Equal(t, []int{4, 2, 3, 1}, ids(), "пустой возраст наименьший")
+
+	SortPersons(persons, []SortField{{Field: "created_at"}})
+	assert.Equal(t, []int{3, 1, 4, 2}, ids(), "одинаковое время упорядочено по id")
+
+	SortPersons(persons, []SortField{{Field: "id", Desc: true}})
+	assert.Equal(t, []int{4, 3, 2, 1}, ids())
+}
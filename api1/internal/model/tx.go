@@ -0,0 +1,11 @@
+package model
+
+import "database/sql"
+
+// TxOptions - параметры Storage.WithTx. Isolation = sql.LevelDefault - уровень изоляции базы по умолчанию,
+// MaxRetries - сколько раз повторить транзакцию после конфликта сериализации или взаимоблокировки (0 - не повторять)
+type TxOptions struct {
+	Isolation  sql.IsolationLevel
+	ReadOnly   bool
+	MaxRetries int
+}
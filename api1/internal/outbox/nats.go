@@ -0,0 +1,47 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+)
+
+// NATSPublisher - публикует события в NATS JetStream в subject <subject>.<тип события>, например
+// people.events.person.update. Nats-Msg-Id - ID события: повтор в окне дедупликации стрима JetStream отбрасывает сам.
+// Стрим, который принимает эти subject, создается заранее
+type NATSPublisher struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	subject string
+}
+
+func NewNATSPublisher(url, subject string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("people-outbox"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &NATSPublisher{conn: conn, js: js, subject: subject}, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, event model.OutboxEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	_, err = p.js.Publish(ctx, p.subject+"."+event.Type, data, jetstream.WithMsgID(strconv.FormatInt(event.ID, 10)))
+	return err
+}
+
+func (p *NATSPublisher) Close() {
+	p.conn.Close()
+}
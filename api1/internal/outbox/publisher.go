@@ -0,0 +1,75 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// LogPublisher - пишет события в лог. Подходит для разработки и как заглушка, пока получателя нет
+type LogPublisher struct {
+	logger logger.Logger
+}
+
+func NewLogPublisher(logger logger.Logger) *LogPublisher {
+	return &LogPublisher{logger: logger}
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, event model.OutboxEvent) error {
+	p.logger.Info("Событие outbox",
+		zap.Int64("event_id", event.ID),
+		zap.String("type", event.Type),
+		zap.Int("person_id", event.PersonID),
+		zap.Int("version", event.Version),
+		zap.String("actor", event.Actor))
+	return nil
+}
+
+// HTTPPublisher - отправляет событие JSON-телом POST на url. Заголовок Idempotency-Key - ID события,
+// по нему получатель отбрасывает повторы. Успех - любой ответ 2xx
+type HTTPPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPPublisher(url string, timeout time.Duration) *HTTPPublisher {
+	return &HTTPPublisher{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *HTTPPublisher) Publish(ctx context.Context, event model.OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", strconv.FormatInt(event.ID, 10))
+	req.Header.Set("X-Event-Type", event.Type)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// тело дочитывается, чтобы соединение вернулось в пул
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("event receiver responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
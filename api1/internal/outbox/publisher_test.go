@@ -0,0 +1,50 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPPublisher(t *testing.T) {
+	event := model.OutboxEvent{ID: 42, Type: model.EventType(model.HistoryCreate), PersonID: 7, Version: 1,
+		After: &model.Person{ID: 7, Name: "Ivan"}, Actor: "system", OccurredAt: time.Now()}
+
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "Accepted", status: http.StatusAccepted},
+		{name: "Server Error", status: http.StatusServiceUnavailable, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got model.OutboxEvent
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "42", r.Header.Get("Idempotency-Key"))
+				assert.Equal(t, "person.create", r.Header.Get("X-Event-Type"))
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := NewHTTPPublisher(server.URL, time.Second).Publish(context.Background(), event)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 7, got.PersonID)
+			assert.Equal(t, "Ivan", got.After.Name)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// EventPublisher - отправка события во внешнюю систему. Nil-ошибка означает, что получатель принял событие.
+// Одно событие может быть отправлено несколько раз, получатель отбрасывает повторы по ID (или PersonID и Version)
+type EventPublisher interface {
+	Publish(ctx context.Context, event model.OutboxEvent) error
+}
+
+// Source - методы хранилища, которые использует Relay
+type Source interface {
+	GetOutboxEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error)
+	MarkOutboxDelivered(ctx context.Context, ids []int64) error
+}
+
+// Relay - читает недоставленные события outbox по порядку, отправляет их через publisher и отмечает доставленными.
+// Доставка at-least-once: событие отмечается только после успешной отправки, поэтому падение между отправкой
+// и отметкой приводит к повторной отправке, но не к потере. Relay должен работать на одном экземпляре сервиса,
+// иначе порядок событий не гарантируется
+type Relay struct {
+	source    Source
+	publisher EventPublisher
+	batchSize int
+	interval  time.Duration
+	logger    logger.Logger
+}
+
+func NewRelay(source Source, publisher EventPublisher, batchSize int, interval time.Duration, logger logger.Logger) *Relay {
+	return &Relay{
+		source:    source,
+		publisher: publisher,
+		batchSize: batchSize,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// Start - запускает отправку в фоне: сразу и затем каждые interval, пока не отменен ctx
+func (r *Relay) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			if _, err := r.Run(ctx); err != nil {
+				r.logger.Error("Ошибка отправки событий outbox", zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run - отправляет пачки по batchSize, пока не кончатся недоставленные события, и возвращает число доставленных.
+// На первой ошибке отправки проход останавливается, чтобы следующие события не обогнали неотправленное:
+// отправленные до нее отмечаются доставленными, остальные ждут следующего прохода
+func (r *Relay) Run(ctx context.Context) (int, error) {
+	delivered := 0
+	for {
+		events, err := r.source.GetOutboxEvents(ctx, r.batchSize)
+		if err != nil {
+			return delivered, err
+		}
+		sent, publishErr := r.publish(ctx, events)
+		if err := r.source.MarkOutboxDelivered(ctx, sent); err != nil {
+			return delivered, err
+		}
+		delivered += len(sent)
+		if publishErr != nil {
+			return delivered, publishErr
+		}
+		if len(events) < r.batchSize {
+			if delivered > 0 {
+				r.logger.Debug("Отправлены события outbox", zap.Int("count", delivered))
+			}
+			return delivered, nil
+		}
+	}
+}
+
+// publish - отправляет events по одному, возвращает ID отправленных до первой ошибки
+func (r *Relay) publish(ctx context.Context, events []model.OutboxEvent) ([]int64, error) {
+	sent := make([]int64, 0, len(events))
+	for _, event := range events {
+		if err := r.publisher.Publish(ctx, event); err != nil {
+			return sent, fmt.Errorf("publish event %d: %w", event.ID, err)
+		}
+		sent = append(sent, event.ID)
+	}
+	return sent, nil
+}
@@ -0,0 +1,59 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakePublisher - запоминает отправленные события, failOn - ID события, на котором Publish возвращает ошибку
+type fakePublisher struct {
+	events []model.OutboxEvent
+	failOn int64
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, event model.OutboxEvent) error {
+	if event.ID == p.failOn {
+		return errors.New("receiver unavailable")
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemory(zap.NewNop())
+	for _, name := range []string{"Ivan", "Anna", "Olga"} {
+		require.NoError(t, db.CreatePerson(ctx, &model.Person{Name: name, Surname: "Ivanov"}))
+	}
+	require.NoError(t, db.DeletePersonByID(ctx, 1))
+
+	publisher := &fakePublisher{failOn: 3}
+	relay := NewRelay(db, publisher, 2, time.Minute, zap.NewNop())
+
+	delivered, err := relay.Run(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, 2, delivered, "события до ошибки отмечены доставленными")
+	require.Len(t, publisher.events, 2)
+	assert.Equal(t, []int64{1, 2}, []int64{publisher.events[0].ID, publisher.events[1].ID})
+
+	publisher.failOn = 0
+	delivered, err = relay.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, delivered, "следующий проход начинается с неотправленного события")
+	require.Len(t, publisher.events, 4)
+	assert.Equal(t, int64(3), publisher.events[2].ID)
+	assert.Equal(t, "person.delete", publisher.events[3].Type)
+	assert.Equal(t, 2, publisher.events[3].Version)
+
+	delivered, err = relay.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+}
@@ -0,0 +1,77 @@
+package poolstats
+
+import (
+	"context"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Source - откуда берется состояние пулов, обычно storage.Storage
+type Source interface {
+	PoolStats() []model.PoolStats
+}
+
+// Reporter - периодически пишет в лог состояние пулов соединений с базой
+type Reporter struct {
+	source   Source
+	interval time.Duration
+	logger   logger.Logger
+	// waits - WaitCount каждого пула на прошлом проходе
+	waits map[string]int64
+}
+
+func NewReporter(source Source, interval time.Duration, logger logger.Logger) *Reporter {
+	return &Reporter{
+		source:   source,
+		interval: interval,
+		logger:   logger,
+		waits:    make(map[string]int64),
+	}
+}
+
+// Start - запускает запись в лог каждые interval, пока не отменен ctx
+func (r *Reporter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.Run()
+			}
+		}
+	}()
+}
+
+// Run - один проход, возвращает, сколько раз запросы ждали соединения с прошлого прохода по всем пулам.
+// Если ждали, пишется предупреждение: пул мал для нагрузки
+func (r *Reporter) Run() int64 {
+	var waited int64
+	for _, s := range r.source.PoolStats() {
+		fields := []zap.Field{
+			zap.String("pool", s.Name),
+			zap.Int("max_open", s.MaxOpenConnections),
+			zap.Int("open", s.OpenConnections),
+			zap.Int("in_use", s.InUse),
+			zap.Int("idle", s.Idle),
+			zap.Int64("wait_count", s.WaitCount),
+			zap.Int64("wait_duration_ms", s.WaitDurationMs),
+			zap.Int64("max_idle_closed", s.MaxIdleClosed),
+			zap.Int64("max_lifetime_closed", s.MaxLifetimeClosed),
+		}
+		waits := s.WaitCount - r.waits[s.Name]
+		r.waits[s.Name] = s.WaitCount
+		if waits > 0 {
+			waited += waits
+			r.logger.Warn("Запросы ждали свободного соединения с базой", append(fields, zap.Int64("waits", waits))...)
+			continue
+		}
+		r.logger.Info("Состояние пула соединений с базой", fields...)
+	}
+	return waited
+}
@@ -0,0 +1,29 @@
+package poolstats
+
+import (
+	"testing"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeSource struct {
+	stats []model.PoolStats
+}
+
+func (s *fakeSource) PoolStats() []model.PoolStats {
+	return s.stats
+}
+
+func TestRun(t *testing.T) {
+	source := &fakeSource{stats: []model.PoolStats{{Name: "primary", WaitCount: 3}, {Name: "replica-1"}}}
+	r := NewReporter(source, 0, zap.NewNop())
+
+	assert.Equal(t, int64(3), r.Run())
+	assert.Zero(t, r.Run(), "ожидания считаются с прошлого прохода")
+
+	source.stats[0].WaitCount = 5
+	source.stats[1].WaitCount = 1
+	assert.Equal(t, int64(3), r.Run())
+}
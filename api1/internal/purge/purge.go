@@ -0,0 +1,66 @@
+package purge
+
+import (
+	"context"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/storage"
+	"github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Purger - периодически окончательно удаляет записи, которые помечены удаленными дольше retention,
+// и события outbox, доставленные дольше retention назад
+type Purger struct {
+	storage   storage.Storage
+	retention time.Duration
+	interval  time.Duration
+	logger    logger.Logger
+}
+
+func NewPurger(storage storage.Storage, retention, interval time.Duration, logger logger.Logger) *Purger {
+	return &Purger{
+		storage:   storage,
+		retention: retention,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// Start - запускает очистку в фоне: сразу и затем каждые interval, пока не отменен ctx
+func (p *Purger) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			if _, err := p.Run(ctx); err != nil {
+				p.logger.Error("Ошибка очистки удаленных записей", zap.String("error", err.Error()))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run - один проход очистки, возвращает количество окончательно удаленных записей (без событий outbox)
+func (p *Purger) Run(ctx context.Context) (int64, error) {
+	before := time.Now().Add(-p.retention)
+	purged, err := p.storage.PurgeDeleted(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		p.logger.Info("Окончательно удалены записи", zap.Int64("count", purged), zap.Time("deleted_before", before))
+	}
+	events, err := p.storage.PurgeOutbox(ctx, before)
+	if err != nil {
+		return purged, err
+	}
+	if events > 0 {
+		p.logger.Info("Удалены доставленные события outbox", zap.Int64("count", events), zap.Time("delivered_before", before))
+	}
+	return purged, nil
+}
@@ -0,0 +1,37 @@
+package purge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemory(zap.NewNop())
+	for _, name := range []string{"Ivan", "Anna", "Olga"} {
+		require.NoError(t, db.CreatePerson(ctx, &model.Person{Name: name, Surname: "Ivanov"}))
+	}
+	require.NoError(t, db.DeletePersonByID(ctx, 1))
+	require.NoError(t, db.DeletePersonByID(ctx, 2))
+
+	purged, err := NewPurger(db, time.Hour, time.Minute, zap.NewNop()).Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, purged, "записи удалены меньше срока хранения назад")
+
+	purged, err = NewPurger(db, 0, time.Minute, zap.NewNop()).Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+
+	deleted, err := db.GetDeletedPersons(ctx, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+	_, err = db.GetPersonByID(ctx, 3)
+	assert.NoError(t, err, "не удаленные записи не затрагиваются")
+}
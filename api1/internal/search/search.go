@@ -0,0 +1,171 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+)
+
+// Threshold - минимальная похожесть по триграммам, как pg_trgm.similarity_threshold по умолчанию
+const Threshold = 0.3
+
+// exactBonus - прибавка к score за совпадение всех слов запроса целиком, аналог ts_rank в Postgres
+const exactBonus = 0.1
+
+var cyrToLat = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// latToCyr - сначала более длинные сочетания, чтобы "shch" не разобралось как "sh" + "ch"
+var latToCyr = []struct{ lat, cyr string }{
+	{"shch", "щ"}, {"zh", "ж"}, {"kh", "х"}, {"ts", "ц"}, {"ch", "ч"}, {"sh", "ш"}, {"yu", "ю"}, {"ya", "я"},
+	{"a", "а"}, {"b", "б"}, {"c", "к"}, {"d", "д"}, {"e", "е"}, {"f", "ф"}, {"g", "г"}, {"h", "х"},
+	{"i", "и"}, {"j", "й"}, {"k", "к"}, {"l", "л"}, {"m", "м"}, {"n", "н"}, {"o", "о"}, {"p", "п"},
+	{"q", "к"}, {"r", "р"}, {"s", "с"}, {"t", "т"}, {"u", "у"}, {"v", "в"}, {"w", "в"}, {"x", "кс"},
+	{"y", "й"}, {"z", "з"},
+}
+
+// Normalize - нижний регистр и одиночные пробелы между словами
+func Normalize(query string) string {
+	return strings.Join(words(query), " ")
+}
+
+// Variants - нормализованный запрос и его транслитерация (кириллица <-> латиница), без повторов.
+// Нужна, чтобы "Ivanov" находил "Иванов" и наоборот.
+func Variants(query string) []string {
+	query = Normalize(query)
+	if query == "" {
+		return nil
+	}
+	translit := Transliterate(query)
+	if translit == query {
+		return []string{query}
+	}
+	return []string{query, translit}
+}
+
+// Transliterate - кириллица переводится в латиницу, если в строке есть кириллица, иначе латиница в кириллицу
+func Transliterate(s string) string {
+	s = strings.ToLower(s)
+	for _, r := range s {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return toLatin(s)
+		}
+	}
+	return toCyrillic(s)
+}
+
+func toLatin(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if lat, ok := cyrToLat[r]; ok {
+			b.WriteString(lat)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func toCyrillic(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		matched := false
+		for _, pair := range latToCyr {
+			if strings.HasPrefix(s, pair.lat) {
+				b.WriteString(pair.cyr)
+				s = s[len(pair.lat):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			r := []rune(s)[0]
+			b.WriteRune(r)
+			s = s[len(string(r)):]
+		}
+	}
+	return b.String()
+}
+
+// Similarity - похожесть строк по триграммам слов, повторяет similarity() из pg_trgm
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	common := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+// Score - оценка совпадения человека с запросом для хранилищ без pg_trgm.
+// Лучшая похожесть по имени, фамилии и отчеству среди вариантов запроса плюс бонус,
+// если все слова запроса есть в ФИО целиком. 0 означает, что человек не подходит.
+func Score(query string, person model.Person) float64 {
+	fields := []string{person.Name, person.Surname, person.Patronymic}
+	fullName := make(map[string]struct{})
+	for _, field := range fields {
+		for _, w := range words(field) {
+			fullName[w] = struct{}{}
+		}
+	}
+
+	best := 0.0
+	for _, variant := range Variants(query) {
+		score := 0.0
+		for _, field := range fields {
+			if sim := Similarity(variant, field); sim > score {
+				score = sim
+			}
+		}
+		if score < Threshold {
+			score = 0
+		}
+		if containsAll(fullName, words(variant)) {
+			score += exactBonus
+		}
+		if score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+func containsAll(set map[string]struct{}, words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+	for _, w := range words {
+		if _, ok := set[w]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigrams - каждое слово дополняется двумя пробелами в начале и одним в конце, как в pg_trgm
+func trigrams(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, w := range words(s) {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			set[string(r[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
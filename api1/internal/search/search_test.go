@@ -0,0 +1,58 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariants(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "Latin", query: "Ivanov", want: []string{"ivanov", "иванов"}},
+		{name: "Cyrillic", query: "Щукина Юлия", want: []string{"щукина юлия", "shchukina yuliya"}},
+		{name: "Digraphs", query: "Zhukov", want: []string{"zhukov", "жуков"}},
+		{name: "Spaces", query: "  Ivan   Ivanov ", want: []string{"ivan ivanov", "иван иванов"}},
+		{name: "Digits only", query: "42", want: []string{"42"}},
+		{name: "Empty", query: " ", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Variants(tt.query))
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, Similarity("Ivanov", "ivanov"))
+	assert.InDelta(t, 6.0/9, Similarity("ivanov", "ivanova"), 1e-9)
+	assert.InDelta(t, 0.4, Similarity("ivonov", "ivanov"), 1e-9)
+	assert.Zero(t, Similarity("", "ivanov"))
+}
+
+func TestScore(t *testing.T) {
+	ivanov := model.Person{Name: "Иван", Surname: "Иванов", Patronymic: "Петрович"}
+
+	tests := []struct {
+		name  string
+		query string
+		match bool
+	}{
+		{name: "Exact", query: "Иванов", match: true},
+		{name: "Transliteration", query: "Ivanov", match: true},
+		{name: "Typo", query: "Ivonov", match: true},
+		{name: "Full name", query: "иван петрович", match: true},
+		{name: "Other person", query: "Sidorova", match: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.match, Score(tt.query, ivanov) > 0)
+		})
+	}
+
+	assert.Greater(t, Score("Иванов", ivanov), Score("Ivonov", ivanov), "точное совпадение выше опечатки")
+}
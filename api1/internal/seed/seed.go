@@ -0,0 +1,71 @@
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage"
+)
+
+// DefaultBatchSize - строк в одном вызове BulkCreatePersons
+const DefaultBatchSize = 1000
+
+// Load - читает из r JSON массив людей в формате POST /admin/persons/bulk и вставляет его пачками по batchSize.
+// Файл читается потоком, поэтому размер не ограничен памятью. Index в ошибках - позиция строки во всем файле.
+// С atomic все пачки вставляются в одной транзакции: любая невалидная строка отменяет вставку всего файла (ErrBulkRejected)
+func Load(ctx context.Context, s storage.Storage, r io.Reader, batchSize int, atomic bool) (model.BulkCreateResult, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if !atomic {
+		return load(ctx, s, r, batchSize, false)
+	}
+	var result model.BulkCreateResult
+	err := s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) (err error) {
+		result, err = load(ctx, s, r, batchSize, true)
+		return err
+	})
+	return result, err
+}
+
+func load(ctx context.Context, s storage.Storage, r io.Reader, batchSize int, atomic bool) (model.BulkCreateResult, error) {
+	result := model.BulkCreateResult{IDs: make([]int, 0)}
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return result, fmt.Errorf("seed: expected JSON array of persons")
+	}
+
+	batch := make([]model.Person, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		res, err := s.BulkCreatePersons(ctx, batch, atomic)
+		for _, e := range res.Errors {
+			result.Fail(len(result.IDs)+e.Index, e.Error)
+		}
+		result.IDs = append(result.IDs, res.IDs...)
+		result.Created += res.Created
+		batch = batch[:0]
+		return err
+	}
+	for dec.More() {
+		var req model.PersonUpdateRequest
+		if err := dec.Decode(&req); err != nil {
+			return result, fmt.Errorf("seed: person %d: %w", len(result.IDs)+len(batch), err)
+		}
+		batch = append(batch, model.Person{Name: req.Name, Surname: req.Surname, Patronymic: req.Patronymic, Age: req.Age, Nationality: req.Nationality, Gender: req.Gender})
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return result, fmt.Errorf("seed: %w", err)
+	}
+	return result, flush()
+}
@@ -0,0 +1,57 @@
+package seed
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const people = `[
+	{"name": "Ivan", "surname": "Ivanov", "age": 30},
+	{"name": "Anna", "surname": "Ivanova", "gender": "female"},
+	{"name": "Olga", "surname": "Petrova"},
+	{"name": "Petr"},
+	{"name": "Oleg", "surname": "Sidorov", "nationality": "RU"}
+]`
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	count := func(s *memory.Memory) int64 {
+		total, _, err := s.CountPersons(ctx, model.PersonFilter{}, false)
+		require.NoError(t, err)
+		return total
+	}
+
+	t.Run("Partial", func(t *testing.T) {
+		s := memory.NewMemory(zap.NewNop())
+		result, err := Load(ctx, s, strings.NewReader(people), 2, false)
+		require.NoError(t, err)
+		assert.Equal(t, 4, result.Created)
+		assert.Len(t, result.IDs, 5)
+		assert.Zero(t, result.IDs[3])
+		require.Len(t, result.Errors, 1)
+		assert.Equal(t, 3, result.Errors[0].Index, "номер строки считается по всему файлу")
+		assert.Equal(t, int64(4), count(s))
+	})
+	t.Run("Atomic", func(t *testing.T) {
+		s := memory.NewMemory(zap.NewNop())
+		_, err := Load(ctx, s, strings.NewReader(people), 2, true)
+		assert.ErrorIs(t, err, customerrors.ErrBulkRejected)
+		assert.Zero(t, count(s), "уже вставленные пачки откатываются")
+	})
+	t.Run("Invalid JSON", func(t *testing.T) {
+		s := memory.NewMemory(zap.NewNop())
+		_, err := Load(ctx, s, strings.NewReader(`{"name": "Ivan"}`), 0, false)
+		assert.Error(t, err)
+		_, err = Load(ctx, s, strings.NewReader(`[{"name": "Ivan", "surname": "Ivanov"}, {"name": 1}]`), 0, false)
+		assert.Error(t, err)
+		assert.Zero(t, count(s))
+	})
+}
@@ -1,22 +1,31 @@
 package server
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/nikita89756/testEffectiveMobile/internal/handlers"
 	middleware "github.com/nikita89756/testEffectiveMobile/internal/middlware"
 )
 
 type Server struct {
-	Host    string
-	Port    string
-	Handler *handlers.Handler
+	Host       string
+	Port       string
+	Handler    *handlers.Handler
+	Admin      *handlers.AdminHandler
+	AdminToken string
+	// ReadYourWrites - окно, в течение которого после изменения чтения клиента идут в primary
+	ReadYourWrites time.Duration
 }
 
-func New(Host string, Port string, handlers *handlers.Handler) *Server {
+func New(Host string, Port string, handlers *handlers.Handler, admin *handlers.AdminHandler, adminToken string, readYourWrites time.Duration) *Server {
 	return &Server{
-		Host:    Host,
-		Port:    Port,
-		Handler: handlers,
+		Host:           Host,
+		Port:           Port,
+		Handler:        handlers,
+		Admin:          admin,
+		AdminToken:     adminToken,
+		ReadYourWrites: readYourWrites,
 	}
 	
 }
@@ -28,13 +37,32 @@ func (s *Server) CreateRoute() *gin.Engine{
 	router.Use(gin.Recovery())
 	router.Use(gin.ErrorLogger())
 	router.Use(middleware.CORSMiddleware())
+	router.Use(middleware.Actor())
+	router.Use(middleware.ReadYourWrites(s.ReadYourWrites))
 	api := router.Group("/api")
 	{
 		api.GET("/persons", s.Handler.GetPersons)
+		api.GET("/persons/search", s.Handler.SearchPersons)
+		api.GET("/persons/stats", s.Handler.GetDemographics)
+		api.GET("/persons/duplicates", s.Handler.FindDuplicates)
+		api.POST("/persons/merge", s.Handler.MergePersons)
 		api.GET("/persons/:id", s.Handler.FindPersonByID)
 		api.POST("/persons", s.Handler.CreatePerson)
 		api.DELETE("/persons/:id", s.Handler.DeletePersonByID)
 		api.PUT("/persons/:id", s.Handler.UpdatePersonByID)
+		api.PATCH("/persons/:id", s.Handler.PatchPersonByID)
+		api.POST("/persons/:id/restore", s.Handler.RestorePersonByID)
+		api.GET("/persons/:id/history", s.Handler.GetPersonHistory)
+		api.POST("/persons/:id/history/:version/revert", s.Handler.RevertPerson)
+		api.GET("/health", s.Handler.Health)
+	}
+	admin := api.Group("/admin", middleware.AdminAuth(s.AdminToken))
+	{
+		admin.POST("/cache/warmup", s.Admin.StartCacheWarmup)
+		admin.GET("/cache/warmup", s.Admin.GetCacheWarmupStatus)
+		admin.GET("/persons/deleted", s.Admin.GetDeletedPersons)
+		admin.POST("/persons/bulk", s.Admin.BulkCreatePersons)
+		admin.GET("/db/pool", s.Admin.GetPoolStats)
 	}
 
 	return router
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	cache "github.com/nikita89756/testEffectiveMobile/internal/cache"
+	"github.com/nikita89756/testEffectiveMobile/internal/consistency"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const peopleTable = "people"
+
+// CachedStorage - кэширует страницы GetPersonsByFilter по хэшу фильтра, курсора и размера страницы.
+// В ключ входит поколение таблицы people, которое увеличивается при каждом создании, изменении и удалении,
+// поэтому все закэшированные страницы становятся неактуальными без перебора ключей.
+// Если увеличить поколение не удалось (Redis недоступен), устаревшие страницы живут не дольше ttl.
+type CachedStorage struct {
+	Storage
+	cache  cache.Cache
+	ttl    time.Duration
+	logger logger.Logger
+}
+
+func NewCachedStorage(storage Storage, cache cache.Cache, ttl time.Duration, logger logger.Logger) *CachedStorage {
+	return &CachedStorage{
+		Storage: storage,
+		cache:   cache,
+		ttl:     ttl,
+		logger:  logger,
+	}
+}
+
+func (s *CachedStorage) GetPersonsByFilter(ctx context.Context, filter model.PersonFilter, after *model.Cursor, limit int) ([]model.Person, error) {
+	// внутри транзакции видны незафиксированные изменения, кэшировать их нельзя. Чтение из primary
+	// (read-your-writes) тоже идет мимо кэша: страница в нем могла быть прочитана из отстающей реплики
+	if ctx.Value(txKey{}) != nil || consistency.Primary(ctx) {
+		return s.Storage.GetPersonsByFilter(ctx, filter, after, limit)
+	}
+	gen, err := s.cache.Generation(ctx, peopleTable)
+	if err != nil {
+		s.logger.Debug("Кэш списков недоступен, запрос идет в базу", zap.String("error", err.Error()))
+		return s.Storage.GetPersonsByFilter(ctx, filter, after, limit)
+	}
+	key := listKey(gen, filter, after, limit)
+
+	persons, err := s.cache.GetList(ctx, key)
+	if err == nil {
+		s.logger.Debug("Список людей получен из кэша", zap.String("key", key))
+		return persons, nil
+	}
+	if !errors.Is(err, customerrors.ErrKeyNotFound) {
+		s.logger.Warn("Ошибка чтения списка из кэша", zap.String("error", err.Error()))
+	}
+
+	persons, err = s.Storage.GetPersonsByFilter(ctx, filter, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache.SetList(ctx, key, persons, s.ttl); err != nil {
+		s.logger.Warn("Не удалось записать список в кэш", zap.String("error", err.Error()))
+	}
+	return persons, nil
+}
+
+func (s *CachedStorage) CreatePerson(ctx context.Context, person *model.Person) error {
+	if err := s.Storage.CreatePerson(ctx, person); err != nil {
+		return err
+	}
+	s.invalidate(ctx)
+	return nil
+}
+
+func (s *CachedStorage) BulkCreatePersons(ctx context.Context, persons []model.Person, atomic bool) (model.BulkCreateResult, error) {
+	result, err := s.Storage.BulkCreatePersons(ctx, persons, atomic)
+	if result.Created > 0 {
+		s.invalidate(ctx)
+	}
+	return result, err
+}
+
+func (s *CachedStorage) UpdatePersonByID(ctx context.Context, person *model.Person) error {
+	if err := s.Storage.UpdatePersonByID(ctx, person); err != nil {
+		return err
+	}
+	s.invalidate(ctx)
+	return nil
+}
+
+func (s *CachedStorage) PatchPersonByID(ctx context.Context, id int, patch model.PersonPatch, version int) (*model.Person, error) {
+	person, err := s.Storage.PatchPersonByID(ctx, id, patch, version)
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx)
+	return person, nil
+}
+
+func (s *CachedStorage) DeletePersonByID(ctx context.Context, id int) error {
+	if err := s.Storage.DeletePersonByID(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate(ctx)
+	return nil
+}
+
+func (s *CachedStorage) RestorePersonByID(ctx context.Context, id int) error {
+	if err := s.Storage.RestorePersonByID(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate(ctx)
+	return nil
+}
+
+func (s *CachedStorage) RevertPerson(ctx context.Context, id, version int) (*model.Person, error) {
+	person, err := s.Storage.RevertPerson(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx)
+	return person, nil
+}
+
+func (s *CachedStorage) MergePersons(ctx context.Context, ids []int, survivorID int) (*model.Person, error) {
+	person, err := s.Storage.MergePersons(ctx, ids, survivorID)
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx)
+	return person, nil
+}
+
+// WithTx - записи внутри fn сбрасывают кэш сразу, а после фиксации он сбрасывается еще раз:
+// иначе между сбросом и фиксацией в кэш могла попасть страница со старыми данными
+func (s *CachedStorage) WithTx(ctx context.Context, opts model.TxOptions, fn func(ctx context.Context) error) error {
+	err := s.Storage.WithTx(ctx, opts, func(ctx context.Context) error {
+		return fn(context.WithValue(ctx, txKey{}, true))
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate(ctx)
+	return nil
+}
+
+// txKey - маркер контекста внутри WithTx
+type txKey struct{}
+
+func (s *CachedStorage) invalidate(ctx context.Context) {
+	if err := s.cache.BumpGeneration(ctx, peopleTable); err != nil {
+		s.logger.Warn("Не удалось сбросить кэш списков", zap.String("error", err.Error()))
+	}
+}
+
+// listKey - people:list:<поколение>:<sha256 от фильтра и страницы>
+func listKey(gen int64, filter model.PersonFilter, after *model.Cursor, limit int) string {
+	var cursor string
+	if after != nil {
+		cursor = after.Encode()
+	}
+	params, _ := json.Marshal(struct {
+		Filter model.PersonFilter `json:"f"`
+		Cursor string             `json:"c"`
+		Limit  int                `json:"l"`
+	}{filter, cursor, limit})
+	sum := sha256.Sum256(params)
+	return fmt.Sprintf("%s:list:%d:%s", peopleTable, gen, hex.EncodeToString(sum[:16]))
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cache "github.com/nikita89756/testEffectiveMobile/internal/cache"
+	"github.com/nikita89756/testEffectiveMobile/internal/consistency"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// countingStorage - считает обращения к базе за списками
+type countingStorage struct {
+	Storage
+	listCalls int
+}
+
+func (s *countingStorage) GetPersonsByFilter(ctx context.Context, filter model.PersonFilter, after *model.Cursor, limit int) ([]model.Person, error) {
+	s.listCalls++
+	return s.Storage.GetPersonsByFilter(ctx, filter, after, limit)
+}
+
+func TestCachedStorage(t *testing.T) {
+	ctx := context.Background()
+	db := &countingStorage{Storage: memory.NewMemory(zap.NewNop())}
+	s := NewCachedStorage(db, cache.NewMemoryCache(cache.DefaultPolicy()), time.Minute, zap.NewNop())
+
+	require.NoError(t, s.CreatePerson(ctx, &model.Person{Name: "Anna", Surname: "Ivanova", Gender: "female", Nationality: "RU"}))
+	female := model.PersonFilter{Genders: []string{"female"}, Nationalities: []string{"RU"}}
+
+	persons, err := s.GetPersonsByFilter(ctx, female, nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, persons, 1)
+	assert.Equal(t, 1, db.listCalls)
+
+	persons, err = s.GetPersonsByFilter(ctx, female, nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, persons, 1)
+	assert.Equal(t, 1, db.listCalls, "повторный запрос должен браться из кэша")
+
+	_, err = s.GetPersonsByFilter(ctx, female, &model.Cursor{Key: persons[0]}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, db.listCalls, "другая страница - другой ключ")
+
+	require.NoError(t, s.CreatePerson(ctx, &model.Person{Name: "Olga", Surname: "Petrova", Gender: "female", Nationality: "RU"}))
+	persons, err = s.GetPersonsByFilter(ctx, female, nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, persons, 2, "после создания кэш списков должен сброситься")
+	assert.Equal(t, 3, db.listCalls)
+
+	persons[0].Age = 33
+	require.NoError(t, s.UpdatePersonByID(ctx, &persons[0]))
+	persons, err = s.GetPersonsByFilter(ctx, female, nil, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(33), persons[0].Age)
+
+	require.NoError(t, s.DeletePersonByID(ctx, persons[0].ID))
+	persons, err = s.GetPersonsByFilter(ctx, female, nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, persons, 1)
+	assert.Equal(t, 5, db.listCalls)
+
+	duplicate := model.Person{Name: persons[0].Name, Surname: persons[0].Surname, Gender: "female", Nationality: "RU"}
+	require.NoError(t, s.CreatePerson(ctx, &duplicate))
+	persons, err = s.GetPersonsByFilter(ctx, female, nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, persons, 2)
+	_, err = s.MergePersons(ctx, []int{persons[0].ID, duplicate.ID}, persons[0].ID)
+	require.NoError(t, err)
+	persons, err = s.GetPersonsByFilter(ctx, female, nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, persons, 1, "после слияния кэш списков должен сброситься")
+}
+
+func TestCachedStorageWithTx(t *testing.T) {
+	ctx := context.Background()
+	db := &countingStorage{Storage: memory.NewMemory(zap.NewNop())}
+	s := NewCachedStorage(db, cache.NewMemoryCache(cache.DefaultPolicy()), time.Minute, zap.NewNop())
+	errStop := errors.New("stop")
+
+	_, err := s.GetPersonsByFilter(ctx, model.PersonFilter{}, nil, 10)
+	require.NoError(t, err)
+	err = s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+		require.NoError(t, s.CreatePerson(ctx, &model.Person{Name: "Anna", Surname: "Ivanova"}))
+		persons, err := s.GetPersonsByFilter(ctx, model.PersonFilter{}, nil, 10)
+		require.NoError(t, err)
+		assert.Len(t, persons, 1)
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 2, db.listCalls)
+
+	persons, err := s.GetPersonsByFilter(ctx, model.PersonFilter{}, nil, 10)
+	require.NoError(t, err)
+	assert.Empty(t, persons, "незафиксированная страница не должна попасть в кэш")
+	assert.Equal(t, 3, db.listCalls)
+
+	err = s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+		return s.CreatePerson(ctx, &model.Person{Name: "Anna", Surname: "Ivanova"})
+	})
+	require.NoError(t, err)
+	persons, err = s.GetPersonsByFilter(ctx, model.PersonFilter{}, nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, persons, 1)
+}
+
+// replicatedStorage - пишет в primary, читает списки из отстающей реплики, если контекст не требует primary
+type replicatedStorage struct {
+	Storage
+	replica Storage
+}
+
+func (s *replicatedStorage) GetPersonsByFilter(ctx context.Context, filter model.PersonFilter, after *model.Cursor, limit int) ([]model.Person, error) {
+	if consistency.Primary(ctx) {
+		return s.Storage.GetPersonsByFilter(ctx, filter, after, limit)
+	}
+	return s.replica.GetPersonsByFilter(ctx, filter, after, limit)
+}
+
+func TestCachedStorageReadYourWrites(t *testing.T) {
+	ctx := context.Background()
+	db := &countingStorage{Storage: &replicatedStorage{Storage: memory.NewMemory(zap.NewNop()), replica: memory.NewMemory(zap.NewNop())}}
+	s := NewCachedStorage(db, cache.NewMemoryCache(cache.DefaultPolicy()), time.Minute, zap.NewNop())
+
+	require.NoError(t, s.CreatePerson(ctx, &model.Person{Name: "Anna", Surname: "Ivanova"}))
+	persons, err := s.GetPersonsByFilter(ctx, model.PersonFilter{}, nil, 10)
+	require.NoError(t, err)
+	assert.Empty(t, persons, "реплика еще не получила запись")
+	assert.Equal(t, 1, db.listCalls)
+
+	primary := consistency.WithPrimary(ctx)
+	persons, err = s.GetPersonsByFilter(primary, model.PersonFilter{}, nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, persons, 1, "чтение из primary не должно брать страницу реплики из кэша")
+	assert.Equal(t, 2, db.listCalls)
+
+	persons, err = s.GetPersonsByFilter(ctx, model.PersonFilter{}, nil, 10)
+	require.NoError(t, err)
+	assert.Empty(t, persons, "страница из primary не должна попасть в кэш")
+	assert.Equal(t, 2, db.listCalls)
+}
+
+func TestListKey(t *testing.T) {
+	filter := model.PersonFilter{Genders: []string{"female"}, Nationalities: []string{"RU"}}
+
+	after := &model.Cursor{Key: model.Person{ID: 10}, Sort: "id"}
+	assert.Equal(t, listKey(1, filter, nil, 10), listKey(1, filter, nil, 10))
+	assert.NotEqual(t, listKey(1, filter, nil, 10), listKey(2, filter, nil, 10))
+	assert.NotEqual(t, listKey(1, filter, nil, 10), listKey(1, filter, after, 10))
+	assert.NotEqual(t, listKey(1, filter, after, 10), listKey(1, filter, &model.Cursor{Key: model.Person{ID: 10}, Sort: "id", Backward: true}, 10))
+	assert.NotEqual(t, listKey(1, filter, nil, 10), listKey(1, model.PersonFilter{Genders: []string{"female"}}, nil, 10))
+	assert.NotEqual(t, listKey(1, filter, nil, 10), listKey(1, model.PersonFilter{Genders: []string{"female", "RU"}}, nil, 10))
+}
@@ -0,0 +1,618 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/actor"
+	"github.com/nikita89756/testEffectiveMobile/internal/dedup"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/search"
+	logger "github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"github.com/pressly/goose/v3"
+	"go.uber.org/zap"
+)
+
+// Memory - хранилище в памяти процесса для локальной разработки и тестов.
+// Повторяет поведение Postgres: фильтрация, пагинация, временные метки, ошибки not found.
+type Memory struct {
+	mu      sync.RWMutex
+	people  map[int]model.Person
+	history map[int][]model.PersonHistory
+	// merges - слитый ID -> ID записи, в которую он слит
+	merges map[int]int
+	// outbox - события об изменениях в порядке записи, lastEventID - ID последнего события
+	outbox      []outboxEntry
+	lastEventID int64
+	lastID      int
+	logger      logger.Logger
+}
+
+// outboxEntry - событие outbox и время его доставки, nil - еще не доставлено
+type outboxEntry struct {
+	event       model.OutboxEvent
+	deliveredAt *time.Time
+}
+
+func NewMemory(logger logger.Logger) *Memory {
+	logger.Info("Используется хранилище в памяти, данные не сохраняются между перезапусками")
+	return &Memory{
+		people:  make(map[int]model.Person),
+		history: make(map[int][]model.PersonHistory),
+		merges:  make(map[int]int),
+		logger:  logger,
+	}
+}
+
+// Migrations - у хранилища в памяти нет схемы, миграции не нужны
+func (m *Memory) Migrations(dir string) (*goose.Provider, error) {
+	return nil, nil
+}
+
+// PoolStats - у хранилища в памяти нет соединений
+func (m *Memory) PoolStats() []model.PoolStats {
+	return []model.PoolStats{}
+}
+
+func (m *Memory) CreatePerson(ctx context.Context, person *model.Person) error {
+	defer m.lock(ctx)()
+
+	now := time.Now()
+	person.CreatedAt = now
+	person.UpdatedAt = now
+	m.lastID++
+	person.ID = m.lastID
+	person.Version = 1
+	m.people[person.ID] = *person
+	m.addHistory(ctx, model.HistoryCreate, nil, person)
+
+	m.logger.Info("Создана запись в памяти", zap.Int("id", person.ID))
+	return nil
+}
+
+// BulkCreatePersons - в памяти вставка не может упасть, ошибки строк только из валидации
+func (m *Memory) BulkCreatePersons(ctx context.Context, persons []model.Person, atomic bool) (model.BulkCreateResult, error) {
+	result, valid := model.NewBulkCreateResult(persons)
+	if atomic && len(result.Errors) > 0 {
+		return result, customerrors.ErrBulkRejected
+	}
+	defer m.lock(ctx)()
+
+	now := time.Now()
+	for _, i := range valid {
+		person := &persons[i]
+		person.CreatedAt = now
+		person.UpdatedAt = now
+		m.lastID++
+		person.ID = m.lastID
+		person.Version = 1
+		m.people[person.ID] = *person
+		m.addHistory(ctx, model.HistoryCreate, nil, person)
+		result.Done(i, person.ID)
+	}
+	m.logger.Info("Массовая вставка в памяти", zap.Int("created", result.Created), zap.Int("failed", len(result.Errors)))
+	return result, nil
+}
+
+func (m *Memory) GetPersonByID(ctx context.Context, id int) (*model.Person, error) {
+	defer m.rlock(ctx)()
+
+	person, ok := m.people[id]
+	if !ok || person.DeletedAt != nil {
+		return &model.Person{ID: id}, customerrors.ErrPersonNotFound
+	}
+	return &person, nil
+}
+
+func (m *Memory) DeletePersonByID(ctx context.Context, id int) error {
+	defer m.lock(ctx)()
+
+	person, ok := m.people[id]
+	if !ok || person.DeletedAt != nil {
+		m.logger.Debug("Нечего удалять", zap.Int("id", id))
+		return customerrors.ErrNothingToDelete
+	}
+	before := person
+	now := time.Now()
+	person.DeletedAt = &now
+	person.Version++
+	m.people[id] = person
+	m.addHistory(ctx, model.HistoryDelete, &before, &person)
+	m.logger.Info("Успешно удален пользователь", zap.Int("id", id))
+	return nil
+}
+
+func (m *Memory) UpdatePersonByID(ctx context.Context, person *model.Person) error {
+	defer m.lock(ctx)()
+
+	old, ok := m.people[person.ID]
+	if !ok || old.DeletedAt != nil {
+		m.logger.Debug("Нечего обновлять", zap.Int("id", person.ID))
+		return customerrors.ErrNothingToUpdate
+	}
+	if person.Version != 0 && person.Version != old.Version {
+		m.logger.Debug("Версия записи не совпадает", zap.Int("id", person.ID), zap.Int("expected", person.Version), zap.Int("actual", old.Version))
+		return customerrors.ErrVersionConflict
+	}
+	m.update(ctx, &old, person, model.HistoryUpdate)
+
+	m.logger.Info("Успешно обновлен пользователь", zap.Int("id", person.ID))
+	return nil
+}
+
+// PatchPersonByID - патч применяется к текущей записи целиком под блокировкой
+func (m *Memory) PatchPersonByID(ctx context.Context, id int, patch model.PersonPatch, version int) (*model.Person, error) {
+	defer m.lock(ctx)()
+
+	old, ok := m.people[id]
+	if !ok || old.DeletedAt != nil {
+		m.logger.Debug("Нечего обновлять", zap.Int("id", id))
+		return nil, customerrors.ErrNothingToUpdate
+	}
+	if version != 0 && version != old.Version {
+		m.logger.Debug("Версия записи не совпадает", zap.Int("id", id), zap.Int("expected", version), zap.Int("actual", old.Version))
+		return nil, customerrors.ErrVersionConflict
+	}
+	if len(patch.Values()) == 0 {
+		return &old, nil
+	}
+	person := old
+	patch.Apply(&person)
+	m.update(ctx, &old, &person, model.HistoryUpdate)
+
+	m.logger.Info("Успешно обновлен пользователь", zap.Int("id", id))
+	return &person, nil
+}
+
+// update - вызывается под m.mu (см. lock)
+func (m *Memory) update(ctx context.Context, old, person *model.Person, action string) {
+	person.CreatedAt = old.CreatedAt
+	person.UpdatedAt = time.Now()
+	person.DeletedAt = nil
+	person.Version = old.Version + 1
+	m.people[person.ID] = *person
+	m.addHistory(ctx, action, old, person)
+}
+
+// GetPersonsByFilter - записи после курсора в порядке filter.Sort (для курсора назад - ближайшие перед ним),
+// limit = 0 означает без ограничения
+func (m *Memory) GetPersonsByFilter(ctx context.Context, filter model.PersonFilter, after *model.Cursor, limit int) ([]model.Person, error) {
+	unlock := m.rlock(ctx)
+	persons := make([]model.Person, 0)
+	for _, person := range m.people {
+		if person.DeletedAt == nil && filter.Matches(person) && (after == nil || after.After(person, filter.Sort)) {
+			persons = append(persons, person)
+		}
+	}
+	unlock()
+
+	model.SortPersons(persons, filter.Sort)
+
+	if limit > 0 && limit < len(persons) {
+		if after != nil && after.Backward {
+			return persons[len(persons)-limit:], nil
+		}
+		persons = persons[:limit]
+	}
+	return persons, nil
+}
+
+func (m *Memory) CountPersons(ctx context.Context, filter model.PersonFilter, estimate bool) (int64, bool, error) {
+	defer m.rlock(ctx)()
+
+	var total int64
+	for _, person := range m.people {
+		if person.DeletedAt == nil && filter.Matches(person) {
+			total++
+		}
+	}
+	return total, false, nil
+}
+
+func (m *Memory) GetDemographics(ctx context.Context, filter model.PersonFilter, opts model.DemographicsOptions) (*model.Demographics, error) {
+	defer m.rlock(ctx)()
+
+	var (
+		stats                                model.Demographics
+		withAge, withGender, withNationality int64
+		complete                             int64
+	)
+	genders := make(map[string]int64)
+	nationalities := make(map[string]int64)
+	ages := make(map[int64]int64)
+	names := make(map[string]int64)
+	surnames := make(map[string]int64)
+	for _, person := range m.people {
+		if person.DeletedAt != nil || !filter.Matches(person) {
+			continue
+		}
+		stats.Total++
+		genders[person.Gender]++
+		nationalities[person.Nationality]++
+		names[person.Name]++
+		surnames[person.Surname]++
+		if person.Age != 0 {
+			withAge++
+			ages[person.Age/opts.BucketWidth]++
+		}
+		if person.Gender != "" {
+			withGender++
+		}
+		if person.Nationality != "" {
+			withNationality++
+		}
+		if person.Age != 0 && person.Gender != "" && person.Nationality != "" {
+			complete++
+		}
+	}
+	stats.Genders = valueCounts(genders, 0)
+	stats.Nationalities = valueCounts(nationalities, 0)
+	stats.TopNames = valueCounts(names, opts.Top)
+	stats.TopSurnames = valueCounts(surnames, opts.Top)
+	stats.AgeBuckets = make([]model.AgeBucket, 0, len(ages))
+	for bucket, count := range ages {
+		stats.AgeBuckets = append(stats.AgeBuckets, model.NewAgeBucket(bucket*opts.BucketWidth, opts.BucketWidth, count))
+	}
+	sort.Slice(stats.AgeBuckets, func(i, j int) bool { return stats.AgeBuckets[i].From < stats.AgeBuckets[j].From })
+	stats.Coverage = model.NewCoverage(stats.Total, withAge, withGender, withNationality, complete)
+	return &stats, nil
+}
+
+func (m *Memory) GetPersonFacets(ctx context.Context, filter model.PersonFilter, facets []string) (map[string][]model.ValueCount, error) {
+	defer m.rlock(ctx)()
+
+	counts := map[string]map[string]int64{"nationality": {}, "gender": {}}
+	ages := make(map[int64]int64)
+	for _, person := range m.people {
+		if person.DeletedAt != nil || !filter.Matches(person) {
+			continue
+		}
+		if person.Nationality != "" {
+			counts["nationality"][person.Nationality]++
+		}
+		if person.Gender != "" {
+			counts["gender"][person.Gender]++
+		}
+		if person.Age != 0 {
+			ages[person.Age/model.FacetAgeBucketWidth]++
+		}
+	}
+
+	res := make(map[string][]model.ValueCount, len(facets))
+	for _, facet := range facets {
+		switch facet {
+		case "nationality", "gender":
+			res[facet] = valueCounts(counts[facet], 0)
+		case "age":
+			buckets := make([]model.AgeBucket, 0, len(ages))
+			for bucket, count := range ages {
+				buckets = append(buckets, model.NewAgeBucket(bucket*model.FacetAgeBucketWidth, model.FacetAgeBucketWidth, count))
+			}
+			sort.Slice(buckets, func(i, j int) bool { return buckets[i].From < buckets[j].From })
+			res[facet] = model.AgeFacet(buckets)
+		}
+	}
+	return res, nil
+}
+
+// valueCounts - счетчики в порядке model.SortValueCounts, top = 0 означает все значения
+func valueCounts(counts map[string]int64, top int) []model.ValueCount {
+	res := make([]model.ValueCount, 0, len(counts))
+	for value, count := range counts {
+		res = append(res, model.ValueCount{Value: value, Count: count})
+	}
+	model.SortValueCounts(res)
+	if top > 0 && len(res) > top {
+		res = res[:top]
+	}
+	return res
+}
+
+// SearchPersons - оценка считается в Go через search.Score, limit = 0 означает без ограничения
+func (m *Memory) SearchPersons(ctx context.Context, query string, offset, limit int) ([]model.SearchResult, error) {
+	unlock := m.rlock(ctx)
+	results := make([]model.SearchResult, 0)
+	for _, person := range m.people {
+		if person.DeletedAt != nil {
+			continue
+		}
+		if score := search.Score(query, person); score > 0 {
+			results = append(results, model.SearchResult{Person: person, Score: score})
+		}
+	}
+	unlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	if offset >= len(results) {
+		return make([]model.SearchResult, 0), nil
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// GetNameStats - для каждого имени берется последняя обновленная запись с полностью заполненными данными обогащения
+func (m *Memory) GetNameStats(ctx context.Context, afterName string, limit int) ([]model.NameStats, error) {
+	unlock := m.rlock(ctx)
+	latest := make(map[string]model.Person)
+	for _, person := range m.people {
+		if person.DeletedAt != nil || person.Name <= afterName || person.Age == 0 || person.Gender == "" || person.Nationality == "" {
+			continue
+		}
+		cur, ok := latest[person.Name]
+		if !ok || person.UpdatedAt.After(cur.UpdatedAt) || (person.UpdatedAt.Equal(cur.UpdatedAt) && person.ID > cur.ID) {
+			latest[person.Name] = person
+		}
+	}
+	unlock()
+
+	stats := make([]model.NameStats, 0, len(latest))
+	for name, person := range latest {
+		stats = append(stats, model.NameStats{
+			Name:        name,
+			PersonStats: model.PersonStats{Age: person.Age, Gender: person.Gender, Nationality: person.Nationality},
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	if limit > 0 && limit < len(stats) {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+func (m *Memory) RestorePersonByID(ctx context.Context, id int) error {
+	defer m.lock(ctx)()
+
+	person, ok := m.people[id]
+	if !ok || person.DeletedAt == nil {
+		m.logger.Debug("Нечего восстанавливать", zap.Int("id", id))
+		return customerrors.ErrNothingToRestore
+	}
+	before := person
+	person.DeletedAt = nil
+	person.UpdatedAt = time.Now()
+	person.Version++
+	m.people[id] = person
+	m.addHistory(ctx, model.HistoryRestore, &before, &person)
+
+	m.logger.Info("Успешно восстановлен пользователь", zap.Int("id", id))
+	return nil
+}
+
+// GetDeletedPersons - сначала последние удаленные, limit = 0 означает без ограничения
+func (m *Memory) GetDeletedPersons(ctx context.Context, offset, limit int) ([]model.Person, error) {
+	unlock := m.rlock(ctx)
+	persons := make([]model.Person, 0)
+	for _, person := range m.people {
+		if person.DeletedAt != nil {
+			deletedAt := *person.DeletedAt
+			person.DeletedAt = &deletedAt
+			persons = append(persons, person)
+		}
+	}
+	unlock()
+
+	sort.Slice(persons, func(i, j int) bool {
+		if !persons[i].DeletedAt.Equal(*persons[j].DeletedAt) {
+			return persons[i].DeletedAt.After(*persons[j].DeletedAt)
+		}
+		return persons[i].ID < persons[j].ID
+	})
+
+	if offset >= len(persons) {
+		return make([]model.Person, 0), nil
+	}
+	persons = persons[offset:]
+	if limit > 0 && limit < len(persons) {
+		persons = persons[:limit]
+	}
+	return persons, nil
+}
+
+func (m *Memory) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	defer m.lock(ctx)()
+
+	purged := make(map[int]bool)
+	for id, person := range m.people {
+		if person.DeletedAt != nil && person.DeletedAt.Before(before) {
+			delete(m.people, id)
+			delete(m.history, id)
+			purged[id] = true
+		}
+	}
+	for mergedID, survivorID := range m.merges {
+		if purged[mergedID] || purged[survivorID] {
+			delete(m.merges, mergedID)
+		}
+	}
+	return int64(len(purged)), nil
+}
+
+func (m *Memory) GetPersonHistory(ctx context.Context, id int) ([]model.PersonHistory, error) {
+	defer m.rlock(ctx)()
+	return append(make([]model.PersonHistory, 0, len(m.history[id])), m.history[id]...), nil
+}
+
+func (m *Memory) RevertPerson(ctx context.Context, id, version int) (*model.Person, error) {
+	defer m.lock(ctx)()
+
+	idx := slices.IndexFunc(m.history[id], func(e model.PersonHistory) bool { return e.Version == version })
+	if idx < 0 || m.history[id][idx].After == nil {
+		return nil, customerrors.ErrVersionNotFound
+	}
+	old, ok := m.people[id]
+	if !ok || old.DeletedAt != nil {
+		return nil, customerrors.ErrNothingToUpdate
+	}
+	target := m.history[id][idx].After
+	person := &model.Person{
+		ID:          id,
+		Name:        target.Name,
+		Surname:     target.Surname,
+		Patronymic:  target.Patronymic,
+		Age:         target.Age,
+		Nationality: target.Nationality,
+		Gender:      target.Gender,
+	}
+	m.update(ctx, &old, person, model.HistoryRevert)
+
+	m.logger.Info("Данные пользователя возвращены к версии", zap.Int("id", id), zap.Int("version", version))
+	return person, nil
+}
+
+// FindDuplicates - limit = 0 означает без ограничения
+func (m *Memory) FindDuplicates(ctx context.Context, limit int) ([]model.DuplicateGroup, error) {
+	defer m.rlock(ctx)()
+
+	persons := make([]model.Person, 0, len(m.people))
+	for _, person := range m.people {
+		if person.DeletedAt == nil {
+			persons = append(persons, person)
+		}
+	}
+	return dedup.Group(persons, limit), nil
+}
+
+func (m *Memory) MergePersons(ctx context.Context, ids []int, survivorID int) (*model.Person, error) {
+	defer m.lock(ctx)()
+
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	persons := make([]model.Person, 0, len(ids))
+	for _, id := range ids {
+		person, ok := m.people[id]
+		if !ok || person.DeletedAt != nil {
+			m.logger.Debug("Нечего объединять", zap.Int("id", id))
+			return nil, customerrors.ErrNothingToMerge
+		}
+		persons = append(persons, person)
+	}
+	survivor, duplicates, ok := dedup.Split(persons, survivorID)
+	if !ok {
+		return nil, customerrors.ErrNothingToMerge
+	}
+
+	merged := dedup.Merge(survivor, duplicates)
+	m.update(ctx, &survivor, &merged, model.HistoryMerge)
+	delete(m.merges, survivor.ID)
+	now := time.Now()
+	for _, before := range duplicates {
+		after := before
+		after.DeletedAt = &now
+		after.Version++
+		m.people[after.ID] = after
+		m.addHistory(ctx, model.HistoryMerge, &before, &after)
+		for id, to := range m.merges {
+			if to == before.ID {
+				m.merges[id] = survivor.ID
+			}
+		}
+		m.merges[before.ID] = survivor.ID
+	}
+	m.logger.Info("Записи объединены", zap.Int("id", survivor.ID), zap.Int("merged", len(duplicates)))
+	return &merged, nil
+}
+
+// ResolveMergedID - ID записи, в которую был слит id, ErrPersonNotFound если id не сливался
+func (m *Memory) ResolveMergedID(ctx context.Context, id int) (int, error) {
+	defer m.rlock(ctx)()
+
+	survivorID, ok := m.merges[id]
+	if !ok {
+		return 0, customerrors.ErrPersonNotFound
+	}
+	return survivorID, nil
+}
+
+// addHistory - вызывается под m.mu, версия записи истории - версия after.
+// Вместе с записью истории в outbox добавляется событие о ней
+func (m *Memory) addHistory(ctx context.Context, action string, before, after *model.Person) {
+	entry := model.PersonHistory{
+		Version:   after.Version,
+		PersonID:  after.ID,
+		Action:    action,
+		After:     snapshot(after),
+		Actor:     actor.FromContext(ctx),
+		ChangedAt: time.Now(),
+	}
+	if before != nil {
+		entry.Before = snapshot(before)
+	}
+	m.history[after.ID] = append(m.history[after.ID], entry)
+	m.lastEventID++
+	m.outbox = append(m.outbox, outboxEntry{event: model.OutboxEvent{
+		ID:         m.lastEventID,
+		Type:       model.EventType(action),
+		PersonID:   entry.PersonID,
+		Version:    entry.Version,
+		Before:     entry.Before,
+		After:      entry.After,
+		Actor:      entry.Actor,
+		OccurredAt: entry.ChangedAt,
+	}})
+}
+
+// GetOutboxEvents - первые limit недоставленных событий в порядке записи
+func (m *Memory) GetOutboxEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error) {
+	defer m.rlock(ctx)()
+
+	events := make([]model.OutboxEvent, 0)
+	for _, entry := range m.outbox {
+		if len(events) == limit {
+			break
+		}
+		if entry.deliveredAt == nil {
+			events = append(events, entry.event)
+		}
+	}
+	return events, nil
+}
+
+// MarkOutboxDelivered - отмечает события ids доставленными, уже отмеченные не меняются
+func (m *Memory) MarkOutboxDelivered(ctx context.Context, ids []int64) error {
+	defer m.lock(ctx)()
+
+	now := time.Now()
+	for i := range m.outbox {
+		if m.outbox[i].deliveredAt == nil && slices.Contains(ids, m.outbox[i].event.ID) {
+			m.outbox[i].deliveredAt = &now
+		}
+	}
+	return nil
+}
+
+// PurgeOutbox - удаляет события, доставленные раньше before
+func (m *Memory) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) {
+	defer m.lock(ctx)()
+
+	kept := m.outbox[:0:0]
+	for _, entry := range m.outbox {
+		if entry.deliveredAt == nil || !entry.deliveredAt.Before(before) {
+			kept = append(kept, entry)
+		}
+	}
+	purged := int64(len(m.outbox) - len(kept))
+	m.outbox = kept
+	return purged, nil
+}
+
+// snapshot - копия без общих указателей с хранилищем
+func snapshot(person *model.Person) *model.Person {
+	p := *person
+	if person.DeletedAt != nil {
+		deletedAt := *person.DeletedAt
+		p.DeletedAt = &deletedAt
+	}
+	return &p
+}
@@ -0,0 +1,447 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/actor"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func seed(t *testing.T, m *Memory) {
+	persons := []model.Person{
+		{Name: "Ivan", Surname: "Ivanov", Age: 30, Gender: "male", Nationality: "RU"},
+		{Name: "Anna", Surname: "Ivanova", Age: 25, Gender: "female", Nationality: "RU"},
+		{Name: "Olga", Surname: "Petrova", Age: 25, Gender: "female", Nationality: "KZ"},
+		{Name: "Ivan", Surname: "Petrov"},
+	}
+	for i := range persons {
+		require.NoError(t, m.CreatePerson(context.Background(), &persons[i]))
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestGetPersonsByFilter(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+	seed(t, m)
+
+	tests := []struct {
+		name          string
+		filter        model.PersonFilter
+		after         *model.Cursor
+		limit         int
+		wantIDs       []int
+	}{
+		{name: "No filter", wantIDs: []int{1, 2, 3, 4}},
+		{name: "By name", filter: model.PersonFilter{Names: []string{"Ivan"}}, wantIDs: []int{1, 4}},
+		{name: "By age and gender", filter: model.PersonFilter{Ages: []int64{25}, Genders: []string{"female"}}, wantIDs: []int{2, 3}},
+		{name: "Nationality in list", filter: model.PersonFilter{Nationalities: []string{"KZ", "UA"}}, wantIDs: []int{3}},
+		{name: "Age range", filter: model.PersonFilter{AgeMin: ptr[int64](26), AgeMax: ptr[int64](40)}, wantIDs: []int{1}},
+		{name: "Age min skips unknown age", filter: model.PersonFilter{AgeMin: ptr[int64](0)}, wantIDs: []int{1, 2, 3}},
+		{name: "Surname prefix", filter: model.PersonFilter{SurnamePrefix: "Ivan"}, wantIDs: []int{1, 2}},
+		{name: "By IDs", filter: model.PersonFilter{IDs: []int{4, 2, 9}}, wantIDs: []int{2, 4}},
+		{name: "Sorted by age desc", filter: model.PersonFilter{Sort: []model.SortField{{Field: "age", Desc: true}}}, wantIDs: []int{1, 2, 3, 4}},
+		{name: "Sorted by surname with page", filter: model.PersonFilter{Sort: []model.SortField{{Field: "surname"}, {Field: "name", Desc: true}}}, after: &model.Cursor{Key: model.Person{ID: 1, Name: "Ivan", Surname: "Ivanov"}}, limit: 2, wantIDs: []int{2, 4}},
+		{name: "Created in future", filter: model.PersonFilter{CreatedAfter: ptr(time.Now().Add(time.Hour))}, wantIDs: []int{}},
+		{name: "Limit", limit: 2, wantIDs: []int{1, 2}},
+		{name: "After cursor", after: &model.Cursor{Key: model.Person{ID: 1}}, limit: 2, wantIDs: []int{2, 3}},
+		{name: "Before cursor", after: &model.Cursor{Key: model.Person{ID: 4}, Backward: true}, limit: 2, wantIDs: []int{2, 3}},
+		{name: "Cursor at the end", after: &model.Cursor{Key: model.Person{ID: 10}}, wantIDs: []int{}},
+		{name: "Nothing found", filter: model.PersonFilter{Surnames: []string{"Sidorov"}}, wantIDs: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			persons, err := m.GetPersonsByFilter(context.Background(), tt.filter, tt.after, tt.limit)
+			require.NoError(t, err)
+
+			ids := make([]int, 0, len(persons))
+			for _, p := range persons {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+}
+
+func TestUpdateAndDelete(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+	seed(t, m)
+	ctx := context.Background()
+
+	before, err := m.GetPersonByID(ctx, 1)
+	require.NoError(t, err)
+
+	updated := *before
+	updated.Age = 31
+	require.NoError(t, m.UpdatePersonByID(ctx, &updated))
+
+	after, err := m.GetPersonByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(31), after.Age)
+	assert.Equal(t, before.CreatedAt, after.CreatedAt)
+	assert.False(t, after.UpdatedAt.Before(before.UpdatedAt))
+
+	assert.ErrorIs(t, m.UpdatePersonByID(ctx, &model.Person{ID: 99}), customerrors.ErrNothingToUpdate)
+
+	require.NoError(t, m.DeletePersonByID(ctx, 1))
+	assert.ErrorIs(t, m.DeletePersonByID(ctx, 1), customerrors.ErrNothingToDelete)
+	_, err = m.GetPersonByID(ctx, 1)
+	assert.ErrorIs(t, err, customerrors.ErrPersonNotFound)
+}
+
+func TestSoftDelete(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+	seed(t, m)
+	ctx := context.Background()
+
+	require.NoError(t, m.DeletePersonByID(ctx, 2))
+	require.NoError(t, m.DeletePersonByID(ctx, 3))
+
+	persons, err := m.GetPersonsByFilter(ctx, model.PersonFilter{}, nil, 0)
+	require.NoError(t, err)
+	assert.Len(t, persons, 2)
+	assert.ErrorIs(t, m.UpdatePersonByID(ctx, &model.Person{ID: 2}), customerrors.ErrNothingToUpdate)
+
+	deleted, err := m.GetDeletedPersons(ctx, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, deleted, 2)
+	assert.NotNil(t, deleted[0].DeletedAt)
+
+	assert.ErrorIs(t, m.RestorePersonByID(ctx, 1), customerrors.ErrNothingToRestore)
+	require.NoError(t, m.RestorePersonByID(ctx, 2))
+	_, err = m.GetPersonByID(ctx, 2)
+	require.NoError(t, err)
+
+	purged, err := m.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.ErrorIs(t, m.RestorePersonByID(ctx, 3), customerrors.ErrNothingToRestore)
+}
+
+func TestSearchPersons(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+	seed(t, m)
+	ctx := context.Background()
+	require.NoError(t, m.CreatePerson(ctx, &model.Person{Name: "Иван", Surname: "Иванов"}))
+	require.NoError(t, m.DeletePersonByID(ctx, 3))
+
+	tests := []struct {
+		name          string
+		query         string
+		offset, limit int
+		wantIDs       []int
+	}{
+		{name: "Exact and similar", query: "Ivanov", wantIDs: []int{1, 5, 2, 4}},
+		{name: "Cyrillic", query: "иванов", wantIDs: []int{1, 5, 2, 4}},
+		{name: "Typo", query: "Petrof", wantIDs: []int{4}},
+		{name: "Deleted excluded", query: "Olga Petrova", wantIDs: []int{4}},
+		{name: "Page", query: "Ivanov", offset: 1, limit: 1, wantIDs: []int{5}},
+		{name: "Nothing found", query: "Sidorov", wantIDs: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := m.SearchPersons(ctx, tt.query, tt.offset, tt.limit)
+			require.NoError(t, err)
+
+			ids := make([]int, 0, len(results))
+			for _, r := range results {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+}
+
+func TestConcurrentCreate(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = m.CreatePerson(context.Background(), &model.Person{Name: "Ivan", Surname: "Ivanov"})
+		}()
+	}
+	wg.Wait()
+
+	persons, err := m.GetPersonsByFilter(context.Background(), model.PersonFilter{}, nil, 0)
+	require.NoError(t, err)
+	assert.Len(t, persons, 50)
+	assert.Equal(t, 50, persons[49].ID)
+}
+
+func TestHistory(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+	ctx := actor.WithActor(context.Background(), "alice")
+
+	person := model.Person{Name: "Ivan", Surname: "Ivanov", Age: 30}
+	require.NoError(t, m.CreatePerson(ctx, &person))
+	person.Age = 31
+	require.NoError(t, m.UpdatePersonByID(ctx, &person))
+
+	reverted, err := m.RevertPerson(ctx, person.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), reverted.Age)
+
+	history, err := m.GetPersonHistory(ctx, person.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, model.HistoryRevert, history[2].Action)
+	assert.Equal(t, 3, history[2].Version)
+	assert.Equal(t, "alice", history[2].Actor)
+	assert.Equal(t, int64(31), history[2].Before.Age)
+
+	_, err = m.RevertPerson(ctx, person.ID, 4)
+	assert.ErrorIs(t, err, customerrors.ErrVersionNotFound)
+	require.NoError(t, m.DeletePersonByID(ctx, person.ID))
+	_, err = m.RevertPerson(ctx, person.ID, 1)
+	assert.ErrorIs(t, err, customerrors.ErrNothingToUpdate, "удаленную запись нужно сначала восстановить")
+}
+
+func TestBulkCreatePersons(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+	ctx := context.Background()
+	persons := []model.Person{
+		{Name: "Ivan", Surname: "Ivanov"},
+		{Name: "Anna", Surname: "Ivanova", Age: -1},
+		{Name: "Olga", Surname: "Petrova"},
+	}
+
+	result, err := m.BulkCreatePersons(ctx, persons, true)
+	assert.ErrorIs(t, err, customerrors.ErrBulkRejected)
+	assert.Equal(t, 0, result.Created)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, 1, result.Errors[0].Index)
+
+	result, err = m.BulkCreatePersons(ctx, persons, false)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 0, 2}, result.IDs)
+	assert.Equal(t, 2, result.Created)
+	history, err := m.GetPersonHistory(ctx, 2)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+}
+
+func TestGetDemographics(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+	seed(t, m)
+	ctx := context.Background()
+
+	stats, err := m.GetDemographics(ctx, model.PersonFilter{}, model.DemographicsOptions{BucketWidth: 10, Top: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), stats.Total)
+	assert.Equal(t, []model.ValueCount{{Value: "female", Count: 2}, {Value: "", Count: 1}, {Value: "male", Count: 1}}, stats.Genders)
+	assert.Equal(t, []model.ValueCount{{Value: "RU", Count: 2}, {Value: "", Count: 1}, {Value: "KZ", Count: 1}}, stats.Nationalities)
+	assert.Equal(t, []model.AgeBucket{{From: 20, To: 29, Count: 2}, {From: 30, To: 39, Count: 1}}, stats.AgeBuckets)
+	assert.Equal(t, []model.ValueCount{{Value: "Ivan", Count: 2}}, stats.TopNames)
+	assert.Equal(t, []model.ValueCount{{Value: "Ivanov", Count: 1}}, stats.TopSurnames)
+	assert.Equal(t, model.Coverage{Age: 75, Gender: 75, Nationality: 75, Complete: 75}, stats.Coverage)
+
+	stats, err = m.GetDemographics(ctx, model.PersonFilter{Nationalities: []string{"RU"}}, model.DemographicsOptions{BucketWidth: 5})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Total)
+	assert.Equal(t, []model.AgeBucket{{From: 25, To: 29, Count: 1}, {From: 30, To: 34, Count: 1}}, stats.AgeBuckets)
+	assert.Len(t, stats.TopSurnames, 2, "top = 0 - все значения")
+	assert.Equal(t, 100.0, stats.Coverage.Complete)
+
+	stats, err = m.GetDemographics(ctx, model.PersonFilter{Names: []string{"Nobody"}}, model.DemographicsOptions{BucketWidth: 10, Top: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Total)
+	assert.Empty(t, stats.AgeBuckets)
+	assert.Equal(t, model.Coverage{}, stats.Coverage)
+}
+
+func TestGetPersonFacets(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+	seed(t, m)
+	ctx := context.Background()
+
+	facets, err := m.GetPersonFacets(ctx, model.PersonFilter{}, []string{"nationality", "gender", "age"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]model.ValueCount{
+		"nationality": {{Value: "RU", Count: 2}, {Value: "KZ", Count: 1}},
+		"gender":      {{Value: "female", Count: 2}, {Value: "male", Count: 1}},
+		"age":         {{Value: "20-29", Count: 2}, {Value: "30-39", Count: 1}},
+	}, facets, "люди без обогащения не считаются")
+
+	facets, err = m.GetPersonFacets(ctx, model.PersonFilter{Genders: []string{"female"}, Sort: []model.SortField{{Field: "age"}}}, []string{"nationality"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]model.ValueCount{"nationality": {{Value: "KZ", Count: 1}, {Value: "RU", Count: 1}}}, facets)
+
+	facets, err = m.GetPersonFacets(ctx, model.PersonFilter{Names: []string{"Nobody"}}, []string{"gender"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]model.ValueCount{"gender": {}}, facets)
+}
+
+func TestMergePersons(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+	ctx := context.Background()
+	persons := []model.Person{
+		{Name: "Ivan", Surname: "Petrov", Age: 30},
+		{Name: "ivan", Surname: "PETROV", Gender: "male"},
+		{Name: "Иван", Surname: "Петров"},
+		{Name: "IVAN", Surname: "petrov", Nationality: "RU"},
+	}
+	for i := range persons {
+		require.NoError(t, m.CreatePerson(ctx, &persons[i]))
+	}
+
+	groups, err := m.FindDuplicates(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, 1, groups[0].SurvivorID)
+	assert.Len(t, groups[0].Persons, 3)
+
+	merged, err := m.MergePersons(ctx, []int{2, 1}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, merged.ID)
+	assert.Equal(t, int64(30), merged.Age)
+	assert.Equal(t, "male", merged.Gender)
+	assert.Equal(t, 2, merged.Version)
+	_, err = m.GetPersonByID(ctx, 2)
+	assert.ErrorIs(t, err, customerrors.ErrPersonNotFound)
+	history, err := m.GetPersonHistory(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, model.HistoryMerge, history[len(history)-1].Action)
+
+	_, err = m.MergePersons(ctx, []int{1, 2}, 0)
+	assert.ErrorIs(t, err, customerrors.ErrNothingToMerge)
+
+	merged, err = m.MergePersons(ctx, []int{1, 4}, 4)
+	require.NoError(t, err)
+	assert.Equal(t, 4, merged.ID)
+	assert.Equal(t, "RU", merged.Nationality)
+	assert.Equal(t, "male", merged.Gender)
+
+	for id, want := range map[int]int{1: 4, 2: 4} {
+		got, err := m.ResolveMergedID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "id %d", id)
+	}
+	_, err = m.ResolveMergedID(ctx, 4)
+	assert.ErrorIs(t, err, customerrors.ErrPersonNotFound)
+
+	require.NoError(t, m.RestorePersonByID(ctx, 1))
+	_, err = m.MergePersons(ctx, []int{1, 4}, 1)
+	require.NoError(t, err)
+	_, err = m.ResolveMergedID(ctx, 1)
+	assert.ErrorIs(t, err, customerrors.ErrPersonNotFound, "оставшаяся запись больше не перенаправляется")
+	got, err := m.ResolveMergedID(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got)
+
+	require.NoError(t, m.RestorePersonByID(ctx, 2))
+	require.NoError(t, m.DeletePersonByID(ctx, 1))
+	purged, err := m.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+	for _, id := range []int{2, 4} {
+		_, err = m.ResolveMergedID(ctx, id)
+		assert.ErrorIs(t, err, customerrors.ErrPersonNotFound, "слияние с очищенной записью удаляется вместе с ней, id %d", id)
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	s := NewMemory(zap.NewNop())
+	ctx := context.Background()
+	errStop := errors.New("stop")
+	count := func(ctx context.Context) int64 {
+		total, _, err := s.CountPersons(ctx, model.PersonFilter{}, false)
+		require.NoError(t, err)
+		return total
+	}
+
+	person := model.Person{Name: "Ivan", Surname: "Petrov"}
+	err := s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+		if err := s.CreatePerson(ctx, &person); err != nil {
+			return err
+		}
+		person.Age = 30
+		return s.UpdatePersonByID(ctx, &person)
+	})
+	require.NoError(t, err)
+	got, err := s.GetPersonByID(ctx, person.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), got.Age)
+	assert.Equal(t, 2, got.Version)
+
+	err = s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+		require.NoError(t, s.CreatePerson(ctx, &model.Person{Name: "Anna", Surname: "Li"}))
+		require.NoError(t, s.DeletePersonByID(ctx, person.ID))
+		_, err := s.GetPersonByID(ctx, person.ID)
+		assert.ErrorIs(t, err, customerrors.ErrPersonNotFound, "внутри транзакции видны ее изменения")
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, int64(1), count(ctx), "ошибка fn откатывает все изменения")
+	_, err = s.GetPersonByID(ctx, person.ID)
+	require.NoError(t, err)
+
+	assert.Panics(t, func() {
+		_ = s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+			require.NoError(t, s.DeletePersonByID(ctx, person.ID))
+			panic("boom")
+		})
+	})
+	_, err = s.GetPersonByID(ctx, person.ID)
+	assert.NoError(t, err, "паника откатывает транзакцию")
+
+	err = s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+		require.NoError(t, s.CreatePerson(ctx, &model.Person{Name: "Olga", Surname: "Petrova"}))
+		nested := s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+			require.NoError(t, s.DeletePersonByID(ctx, person.ID))
+			return errStop
+		})
+		assert.ErrorIs(t, nested, errStop)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count(ctx), "вложенная транзакция откатывается отдельно от внешней")
+}
+
+func TestOutbox(t *testing.T) {
+	m := NewMemory(zap.NewNop())
+	ctx := context.Background()
+
+	person := model.Person{Name: "Ivan", Surname: "Petrov"}
+	require.NoError(t, m.CreatePerson(ctx, &person))
+	person.Age = 30
+	require.NoError(t, m.UpdatePersonByID(ctx, &person))
+	require.NoError(t, m.DeletePersonByID(ctx, person.ID))
+
+	events, err := m.GetOutboxEvents(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "person.create", events[0].Type)
+	assert.Equal(t, 2, events[1].Version)
+
+	err = m.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+		require.NoError(t, m.MarkOutboxDelivered(ctx, []int64{events[0].ID}))
+		return errors.New("stop")
+	})
+	require.Error(t, err)
+	events, err = m.GetOutboxEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 3, "откат транзакции возвращает отметки доставки")
+
+	require.NoError(t, m.MarkOutboxDelivered(ctx, []int64{events[0].ID, events[1].ID}))
+	events, err = m.GetOutboxEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "person.delete", events[0].Type)
+
+	purged, err := m.PurgeOutbox(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+}
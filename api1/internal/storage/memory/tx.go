@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+)
+
+// txKey - маркер транзакции WithTx в контексте: блокировка m.mu уже взята, методы не берут ее повторно
+type txKey struct {
+	m *Memory
+}
+
+func (m *Memory) inTx(ctx context.Context) bool {
+	return ctx.Value(txKey{m}) != nil
+}
+
+// lock - берет m.mu на запись, внутри WithTx ничего не делает. Возвращает функцию освобождения
+func (m *Memory) lock(ctx context.Context) func() {
+	if m.inTx(ctx) {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+// rlock - берет m.mu на чтение, внутри WithTx ничего не делает. Возвращает функцию освобождения
+func (m *Memory) rlock(ctx context.Context) func() {
+	if m.inTx(ctx) {
+		return func() {}
+	}
+	m.mu.RLock()
+	return m.mu.RUnlock
+}
+
+// state - копия данных для отката транзакции
+type state struct {
+	people  map[int]model.Person
+	history map[int][]model.PersonHistory
+	merges  map[int]int
+	outbox  []outboxEntry
+	// lastEventID не откатывается: ID событий, как и последовательность в Postgres, могут идти с пропусками
+	lastID int
+}
+
+// WithTx - транзакции выполняются по одной под блокировкой m.mu, поэтому изоляция всегда полная и повторять
+// нечего: opts не используются. При ошибке или панике fn данные возвращаются к копии, снятой перед fn.
+// Внутри fn хранилище нужно вызывать с переданным контекстом, иначе вызов будет ждать конца транзакции
+func (m *Memory) WithTx(ctx context.Context, opts model.TxOptions, fn func(ctx context.Context) error) (err error) {
+	if !m.inTx(ctx) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		ctx = context.WithValue(ctx, txKey{m}, true)
+	}
+	saved := state{
+		people:  maps.Clone(m.people),
+		history: make(map[int][]model.PersonHistory, len(m.history)),
+		merges:  maps.Clone(m.merges),
+		// MarkOutboxDelivered меняет элементы на месте, поэтому срез копируется целиком
+		outbox: slices.Clone(m.outbox),
+		lastID: m.lastID,
+	}
+	// записи истории только добавляются, достаточно запомнить длину срезов
+	for id, entries := range m.history {
+		saved.history[id] = entries[:len(entries):len(entries)]
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			m.restore(saved)
+			panic(r)
+		}
+		if err != nil {
+			m.restore(saved)
+		}
+	}()
+	return fn(ctx)
+}
+
+func (m *Memory) restore(saved state) {
+	m.people = saved.people
+	m.history = saved.history
+	m.merges = saved.merges
+	m.outbox = saved.outbox
+	m.lastID = saved.lastID
+}
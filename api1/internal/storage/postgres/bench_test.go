@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// benchSeed - сколько людей должно быть в базе бенчмарков, чтобы фильтр шел по индексам, а не по паре страниц
+const benchSeed = 10000
+
+// benchStorage - общие методы Postgres и Pgx, которые сравнивают бенчмарки
+type benchStorage interface {
+	CreatePerson(ctx context.Context, person *model.Person) error
+	GetPersonsByFilter(ctx context.Context, filter model.PersonFilter, after *model.Cursor, limit int) ([]model.Person, error)
+}
+
+// benchStorages - Postgres (database/sql и lib/pq) и Pgx на одной базе из POSTGRES_BENCH_DSN с примененными миграциями
+// и не меньше benchSeed записями. Без POSTGRES_BENCH_DSN бенчмарк пропускается
+func benchStorages(b *testing.B) []struct {
+	name    string
+	storage benchStorage
+} {
+	dsn := os.Getenv("POSTGRES_BENCH_DSN")
+	if dsn == "" {
+		b.Skip("POSTGRES_BENCH_DSN не задан")
+	}
+	pool := PoolConfig{MaxOpenConns: 10, MaxIdleConns: 10}
+	pqStorage := NewPostgres(ConnectDB(dsn, 5*time.Second, pool), zap.NewNop(), 5*time.Second)
+	b.Cleanup(pqStorage.Close)
+	db, err := ConnectPgx(dsn, 5*time.Second, pool)
+	require.NoError(b, err)
+	pgxStorage := NewPgx(db, zap.NewNop(), 5*time.Second)
+	b.Cleanup(pgxStorage.Close)
+
+	ctx := context.Background()
+	provider, err := pqStorage.Migrations("")
+	require.NoError(b, err)
+	_, err = provider.Up(ctx)
+	require.NoError(b, err)
+
+	total, _, err := pqStorage.CountPersons(ctx, model.PersonFilter{}, false)
+	require.NoError(b, err)
+	if missing := benchSeed - int(total); missing > 0 {
+		persons := make([]model.Person, missing)
+		for i := range persons {
+			persons[i] = benchPerson(i)
+		}
+		_, err := pqStorage.BulkCreatePersons(ctx, persons, true)
+		require.NoError(b, err)
+	}
+	return []struct {
+		name    string
+		storage benchStorage
+	}{{"pq", pqStorage}, {"pgx", pgxStorage}}
+}
+
+func benchPerson(i int) model.Person {
+	genders := []string{"male", "female"}
+	return model.Person{
+		Name:        "Name" + strconv.Itoa(i%500),
+		Surname:     "Surname" + strconv.Itoa(i%2000),
+		Age:         int64(18 + i%60),
+		Nationality: "RU",
+		Gender:      genders[i%2],
+	}
+}
+
+func BenchmarkGetPersonsByFilter(b *testing.B) {
+	ctx := context.Background()
+	ageMin := int64(30)
+	filter := model.PersonFilter{
+		Genders: []string{"female"},
+		AgeMin:  &ageMin,
+		Sort:    []model.SortField{{Field: "surname"}},
+	}
+	for _, s := range benchStorages(b) {
+		b.Run(s.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := s.storage.GetPersonsByFilter(ctx, filter, nil, 50); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCreatePerson(b *testing.B) {
+	ctx := context.Background()
+	for _, s := range benchStorages(b) {
+		b.Run(s.name, func(b *testing.B) {
+			b.ReportAllocs()
+			i := 0
+			for b.Loop() {
+				person := benchPerson(i)
+				i++
+				if err := s.storage.CreatePerson(ctx, &person); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+)
+
+// queryBuilder - собирает условия WHERE. Значения передаются только параметрами $n,
+// в текст запроса попадают лишь имена колонок из кода
+type queryBuilder struct {
+	conds []string
+	args  []interface{}
+	// native - массивы передаются срезами как есть (pgx кодирует их сам), иначе через pq.Array
+	native bool
+}
+
+// arg - добавляет параметр и возвращает его плейсхолдер
+func (b *queryBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// array - параметр-массив для = ANY(...)
+func (b *queryBuilder) array(v interface{}) string {
+	if b.native {
+		return b.arg(v)
+	}
+	return b.arg(pq.Array(v))
+}
+
+func (b *queryBuilder) where(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+func (b *queryBuilder) whereSQL() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
+
+// personFilter - условия для не удаленных людей по фильтру
+func personFilter(f model.PersonFilter) *queryBuilder {
+	return filterPersons(&queryBuilder{}, f)
+}
+
+// pgxFilter - personFilter для Pgx
+func pgxFilter(f model.PersonFilter) *queryBuilder {
+	return filterPersons(&queryBuilder{native: true}, f)
+}
+
+func filterPersons(b *queryBuilder, f model.PersonFilter) *queryBuilder {
+	b.where("deleted_at IS NULL")
+	if len(f.IDs) > 0 {
+		b.where("id = ANY(" + b.array(f.IDs) + ")")
+	}
+	b.in("name", f.Names)
+	b.in("surname", f.Surnames)
+	b.in("patronymic", f.Patronymics)
+	b.in("nationality", f.Nationalities)
+	b.in("gender", f.Genders)
+	b.prefix("name", f.NamePrefix)
+	b.prefix("surname", f.SurnamePrefix)
+	b.prefix("patronymic", f.PatronymicPrefix)
+	if len(f.Ages) > 0 {
+		b.where("age = ANY(" + b.array(f.Ages) + ")")
+	}
+	if f.AgeMin != nil {
+		b.where("age >= " + b.arg(*f.AgeMin))
+	}
+	if f.AgeMax != nil {
+		b.where("age <= " + b.arg(*f.AgeMax))
+	}
+	if f.CreatedAfter != nil {
+		b.where("created_at >= " + b.arg(*f.CreatedAfter))
+	}
+	if f.CreatedBefore != nil {
+		b.where("created_at < " + b.arg(*f.CreatedBefore))
+	}
+	if f.UpdatedAfter != nil {
+		b.where("updated_at >= " + b.arg(*f.UpdatedAfter))
+	}
+	if f.UpdatedBefore != nil {
+		b.where("updated_at < " + b.arg(*f.UpdatedBefore))
+	}
+	return b
+}
+
+func (b *queryBuilder) in(column string, values []string) {
+	if len(values) > 0 {
+		b.where(column + " = ANY(" + b.array(values) + ")")
+	}
+}
+
+// prefix - % и _ в значении экранируются, чтобы искалось именно начало строки
+func (b *queryBuilder) prefix(column, value string) {
+	if value != "" {
+		b.where(column + " LIKE " + b.arg(likeEscaper.Replace(value)+"%"))
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// sortColumns - выражения для полей сортировки. NULL заменяется пустым значением, чтобы порядок совпадал
+// во всех хранилищах: пустые значения считаются наименьшими
+var sortColumns = map[string]string{
+	"id":          "id",
+	"name":        "name",
+	"surname":     "surname",
+	"patronymic":  "COALESCE(patronymic, '')",
+	"age":         "COALESCE(age, 0)",
+	"nationality": "COALESCE(nationality, '')",
+	"gender":      "COALESCE(gender, '')",
+	"created_at":  "created_at",
+	"updated_at":  "updated_at",
+}
+
+// sortFields - поля из model.SortableFields с id в конце, прочие поля пропускаются
+func sortFields(fields []model.SortField) []model.SortField {
+	known := make([]model.SortField, 0, len(fields)+1)
+	for _, f := range model.WithTiebreaker(fields) {
+		if _, ok := sortColumns[f.Field]; ok {
+			known = append(known, f)
+		}
+	}
+	return known
+}
+
+// orderBy - ORDER BY по полям сортировки, reverse переворачивает направление всех полей
+func orderBy(fields []model.SortField, reverse bool) string {
+	fields = sortFields(fields)
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		part := sortColumns[f.Field]
+		if f.Desc != reverse {
+			part += " DESC"
+		}
+		parts = append(parts, part)
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// keyset - записи после курсора в порядке сортировки (для Backward - перед ним):
+// (f1 > v1) OR (f1 = v1 AND f2 > v2) OR ..., для полей по убыванию знак обратный
+func (b *queryBuilder) keyset(after *model.Cursor, fields []model.SortField) {
+	fields = sortFields(fields)
+	values := make([]string, 0, len(fields))
+	for _, f := range fields {
+		values = append(values, b.arg(after.Key.SortValue(f.Field)))
+	}
+	ors := make([]string, 0, len(fields))
+	for i, f := range fields {
+		ands := make([]string, 0, i+1)
+		for j, prev := range fields[:i] {
+			ands = append(ands, sortColumns[prev.Field]+" = "+values[j])
+		}
+		op := " > "
+		if f.Desc != after.Backward {
+			op = " < "
+		}
+		ands = append(ands, sortColumns[f.Field]+op+values[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	b.where("(" + strings.Join(ors, " OR ") + ")")
+}
@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+	"os"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrations - миграции из dir, а если dir пуст - встроенные в бинарник. Провайдер берет advisory lock
+// на время миграции, поэтому экземпляры сервиса, стартующие одновременно, применяют миграции по очереди
+func (p *Postgres) Migrations(dir string) (*goose.Provider, error) {
+	return newProvider(p.db, dir)
+}
+
+// Migrations - как у Postgres, но через отдельное подключение database/sql: goose не работает с pgxpool.
+// Соединения подключения закрываются после миграции и не занимают место в лимите базы
+func (p *Pgx) Migrations(dir string) (*goose.Provider, error) {
+	db := stdlib.OpenDB(*p.pool.Config().ConnConfig)
+	db.SetMaxIdleConns(0)
+	return newProvider(db, dir)
+}
+
+func newProvider(db *sql.DB, dir string) (*goose.Provider, error) {
+	var fsys fs.FS = os.DirFS(dir)
+	if dir == "" {
+		sub, err := fs.Sub(migrations, "migrations")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, fsys, goose.WithSessionLocker(locker))
+}
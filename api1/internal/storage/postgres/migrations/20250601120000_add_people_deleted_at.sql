@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE people ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+-- Частичный индекс для очистки и списка удаленных записей
+CREATE INDEX IF NOT EXISTS idx_people_deleted_at ON people (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_people_deleted_at;
+ALTER TABLE people DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
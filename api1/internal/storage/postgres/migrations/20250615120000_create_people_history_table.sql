@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS people_history (
+    id BIGSERIAL PRIMARY KEY,
+    person_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    before_data JSONB NULL,
+    after_data JSONB NULL,
+    actor VARCHAR(255) NOT NULL,
+    changed_at TIMESTAMP NOT NULL,
+    UNIQUE (person_id, version)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS people_history;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+ALTER TABLE people ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(surname, '') || ' ' || coalesce(patronymic, ''))) STORED;
+CREATE INDEX IF NOT EXISTS idx_people_search_vector ON people USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_people_name_trgm ON people USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_people_surname_trgm ON people USING GIN (surname gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_people_patronymic_trgm ON people USING GIN (patronymic gin_trgm_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_people_patronymic_trgm;
+DROP INDEX IF EXISTS idx_people_surname_trgm;
+DROP INDEX IF EXISTS idx_people_name_trgm;
+DROP INDEX IF EXISTS idx_people_search_vector;
+ALTER TABLE people DROP COLUMN IF EXISTS search_vector;
+-- +goose StatementEnd
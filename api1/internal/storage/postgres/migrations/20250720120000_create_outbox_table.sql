@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    person_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    before_data JSONB NULL,
+    after_data JSONB NULL,
+    actor VARCHAR(255) NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    delivered_at TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_undelivered ON outbox (id) WHERE delivered_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS outbox;
+-- +goose StatementEnd
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/lib/pq"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"go.uber.org/zap"
+)
+
+// Запросы к outbox. Чтение и отметка идут только в primary: событие, прочитанное с отстающей реплики,
+// было бы отправлено повторно после отметки
+const (
+	outboxEventsQuery    = `SELECT id, person_id, version, action, before_data, after_data, actor, occurred_at FROM outbox WHERE delivered_at IS NULL ORDER BY id LIMIT $1`
+	outboxDeliveredQuery = `UPDATE outbox SET delivered_at = $1 WHERE id = ANY($2) AND delivered_at IS NULL`
+	outboxPurgeQuery     = `DELETE FROM outbox WHERE delivered_at IS NOT NULL AND delivered_at < $1`
+)
+
+// GetOutboxEvents - первые limit недоставленных событий в порядке записи
+func (p *Postgres) GetOutboxEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	rows, err := p.conn(ctx).QueryContext(ctx, outboxEventsQuery, limit)
+	if err != nil {
+		p.logger.Error("Ошибка чтения outbox", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]model.OutboxEvent, 0)
+	for rows.Next() {
+		var (
+			event         model.OutboxEvent
+			action        string
+			before, after sql.NullString
+		)
+		if err := rows.Scan(&event.ID, &event.PersonID, &event.Version, &action, &before, &after, &event.Actor, &event.OccurredAt); err != nil {
+			p.logger.Error("Ошибка чтения outbox", zap.Error(err))
+			return nil, fmt.Errorf("repository outbox scan failed: %w", err)
+		}
+		event.Type = model.EventType(action)
+		if event.Before, err = fromSnapshot(before); err != nil {
+			return nil, err
+		}
+		if event.After, err = fromSnapshot(after); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		p.logger.Error("Ошибка чтения outbox", zap.Error(err))
+		return nil, fmt.Errorf("repository outbox scan failed: %w", err)
+	}
+	return events, nil
+}
+
+// MarkOutboxDelivered - отмечает события ids доставленными, уже отмеченные не меняются
+func (p *Postgres) MarkOutboxDelivered(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if _, err := p.conn(ctx).ExecContext(ctx, outboxDeliveredQuery, time.Now(), pq.Array(ids)); err != nil {
+		p.logger.Error("Ошибка отметки доставки событий outbox", zap.Int("count", len(ids)), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// PurgeOutbox - удаляет события, доставленные раньше before
+func (p *Postgres) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	res, err := p.conn(ctx).ExecContext(ctx, outboxPurgeQuery, before)
+	if err != nil {
+		p.logger.Error("Ошибка очистки outbox", zap.Error(err))
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *Pgx) GetOutboxEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	rows, err := p.q(ctx).Query(ctx, outboxEventsQuery, limit)
+	if err != nil {
+		p.logger.Error("Ошибка чтения outbox", zap.Error(err))
+		return nil, err
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.OutboxEvent, error) {
+		var (
+			event  model.OutboxEvent
+			action string
+		)
+		err := row.Scan(&event.ID, &event.PersonID, &event.Version, &action, &event.Before, &event.After, &event.Actor, &event.OccurredAt)
+		event.Type = model.EventType(action)
+		return event, err
+	})
+	if err != nil {
+		p.logger.Error("Ошибка чтения outbox", zap.Error(err))
+		return nil, fmt.Errorf("repository outbox scan failed: %w", err)
+	}
+	return events, nil
+}
+
+func (p *Pgx) MarkOutboxDelivered(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if _, err := p.q(ctx).Exec(ctx, outboxDeliveredQuery, time.Now(), ids); err != nil {
+		p.logger.Error("Ошибка отметки доставки событий outbox", zap.Int("count", len(ids)), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (p *Pgx) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tag, err := p.q(ctx).Exec(ctx, outboxPurgeQuery, before)
+	if err != nil {
+		p.logger.Error("Ошибка очистки outbox", zap.Error(err))
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,194 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	logger "github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// pgxQuerier - общие методы пула и pgx.Tx: запросы идут в пул или в транзакцию WithTx
+type pgxQuerier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// pgxPool - методы *pgxpool.Pool, которые использует Pgx. В тестах пул подменяется pgxmock
+type pgxPool interface {
+	pgxQuerier
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+	Stat() *pgxpool.Stat
+	Config() *pgxpool.Config
+	Close()
+}
+
+// Pgx - хранилище в Postgres через pgx и pgxpool с той же схемой, что и у Postgres. Запрос готовится один раз
+// на соединение и дальше берется из кэша, значения передаются в бинарном формате без sql.Null* оберток,
+// независимые запросы уходят в базу одной пачкой (pgx.Batch). Реплики для чтения не поддерживаются
+type Pgx struct {
+	pool    pgxPool
+	logger  logger.Logger
+	timeout time.Duration
+}
+
+// ConnectPgx - пул pgxpool по строке подключения с настройками pool (см. PoolConfig.applyPgx)
+func ConnectPgx(connectionString string, timeout time.Duration, pool PoolConfig) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(connectionString)
+	if err != nil {
+		return nil, err
+	}
+	pool.applyPgx(cfg)
+	// запрос готовится при первом выполнении на соединении, дальше выполняется по кэшу без разбора и планирования
+	cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	db, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func NewPgx(pool pgxPool, logger logger.Logger, timeout time.Duration) *Pgx {
+	logger.Info("Подключение к базе данных через pgx завершено")
+	return &Pgx{
+		pool:    pool,
+		logger:  logger,
+		timeout: timeout,
+	}
+}
+
+func (p *Pgx) Close() {
+	p.pool.Close()
+	p.logger.Info("Подключение к базе данных закрыто")
+}
+
+// pgxTxKey - ключ транзакции WithTx в контексте, привязан к пулу как txKey
+type pgxTxKey struct {
+	pool pgxPool
+}
+
+func (p *Pgx) tx(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(pgxTxKey{p.pool}).(pgx.Tx)
+	return tx, ok
+}
+
+// q - транзакция WithTx из контекста или пул
+func (p *Pgx) q(ctx context.Context) pgxQuerier {
+	if tx, ok := p.tx(ctx); ok {
+		return tx
+	}
+	return p.pool
+}
+
+// begin - новая транзакция, а внутри WithTx - точка сохранения в общей транзакции (opts тогда не применяются)
+func (p *Pgx) begin(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	if tx, ok := p.tx(ctx); ok {
+		return tx.Begin(ctx)
+	}
+	return p.pool.BeginTx(ctx, opts)
+}
+
+// atomically - fn с одним запросом или одной пачкой запросов. Вне WithTx они атомарны сами по себе
+// и обходятся без BEGIN и COMMIT, внутри WithTx выполняются в точке сохранения, чтобы ошибка
+// не прерывала общую транзакцию
+func (p *Pgx) atomically(ctx context.Context, fn func(q pgxQuerier) error) error {
+	tx, ok := p.tx(ctx)
+	if !ok {
+		return fn(p.pool)
+	}
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer rollback(ctx, sp)
+	if err = fn(sp); err != nil {
+		return err
+	}
+	return sp.Commit(ctx)
+}
+
+// rollback - откат после ошибки или незавершенной транзакции. Контекст запроса к этому моменту может быть
+// отменен, а откат точки сохранения должен пройти, иначе общая транзакция WithTx останется в ошибке
+func rollback(ctx context.Context, tx pgx.Tx) {
+	_ = tx.Rollback(context.WithoutCancel(ctx))
+}
+
+// WithTx - то же, что Postgres.WithTx: вложенный WithTx - точка сохранения, конфликты сериализации
+// и взаимоблокировки повторяются до opts.MaxRetries раз. Контекст fn нельзя использовать из нескольких горутин
+func (p *Pgx) WithTx(ctx context.Context, opts model.TxOptions, fn func(ctx context.Context) error) error {
+	if tx, ok := p.tx(ctx); ok {
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			p.logger.Error("Ошибка создания точки сохранения", zap.Error(err))
+			return err
+		}
+		return runPgxTx(ctx, sp, fn)
+	}
+	txOpts, err := pgxTxOptions(opts)
+	if err != nil {
+		return err
+	}
+	return retry(ctx, p.logger, opts.MaxRetries, func() error {
+		tx, err := p.pool.BeginTx(ctx, txOpts)
+		if err != nil {
+			p.logger.Error("Ошибка начала транзакции", zap.String("error", err.Error()))
+			return err
+		}
+		return runPgxTx(context.WithValue(ctx, pgxTxKey{p.pool}, tx), tx, fn)
+	})
+}
+
+// runPgxTx - fn в транзакции tx: commit при успехе, rollback при ошибке или панике
+func runPgxTx(ctx context.Context, tx pgx.Tx, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rollback(ctx, tx)
+			panic(r)
+		}
+		if err != nil {
+			rollback(ctx, tx)
+		}
+	}()
+	if err = fn(ctx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// pgxTxOptions - уровни изоляции, которые поддерживает Postgres, остальные - ошибка, как у lib/pq
+func pgxTxOptions(opts model.TxOptions) (pgx.TxOptions, error) {
+	var txOpts pgx.TxOptions
+	if opts.ReadOnly {
+		txOpts.AccessMode = pgx.ReadOnly
+	}
+	switch opts.Isolation {
+	case sql.LevelDefault:
+	case sql.LevelReadUncommitted:
+		txOpts.IsoLevel = pgx.ReadUncommitted
+	case sql.LevelReadCommitted:
+		txOpts.IsoLevel = pgx.ReadCommitted
+	case sql.LevelRepeatableRead:
+		txOpts.IsoLevel = pgx.RepeatableRead
+	case sql.LevelSerializable:
+		txOpts.IsoLevel = pgx.Serializable
+	default:
+		return txOpts, fmt.Errorf("pgx: isolation level not supported: %s", opts.Isolation)
+	}
+	return txOpts, nil
+}
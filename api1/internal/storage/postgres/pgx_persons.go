@@ -0,0 +1,934 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nikita89756/testEffectiveMobile/internal/actor"
+	"github.com/nikita89756/testEffectiveMobile/internal/dedup"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/search"
+	"go.uber.org/zap"
+)
+
+// pgxPersonColumns - колонки people до version. NULL заменяется пустым значением, чтобы читать сразу в поля model.Person
+const pgxPersonColumns = `id, name, surname, COALESCE(patronymic, ''), COALESCE(age, 0), COALESCE(nationality, ''), COALESCE(gender, ''), created_at, updated_at, version`
+
+// personFields - поля model.Person в порядке pgxPersonColumns
+func personFields(person *model.Person) []any {
+	return []any{&person.ID, &person.Name, &person.Surname, &person.Patronymic, &person.Age, &person.Nationality, &person.Gender, &person.CreatedAt, &person.UpdatedAt, &person.Version}
+}
+
+// collectPersons - записи из rows с колонками pgxPersonColumns
+func collectPersons(rows pgx.Rows) ([]model.Person, error) {
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Person, error) {
+		var person model.Person
+		err := row.Scan(personFields(&person)...)
+		return person, err
+	})
+}
+
+// pgxStats - возраст, национальность и пол, пустые значения пишутся как NULL
+func pgxStats(person *model.Person) (pgtype.Int8, pgtype.Text, pgtype.Text) {
+	return pgtype.Int8{Int64: person.Age, Valid: person.Age != 0},
+		pgtype.Text{String: person.Nationality, Valid: person.Nationality != ""},
+		pgtype.Text{String: person.Gender, Valid: person.Gender != ""}
+}
+
+// queueUpdate - см. Postgres.updateWithHistory: UPDATE, запись истории и событие одним запросом в пачке batch.
+// Снимки before и after pgx сам кодирует в JSONB, nil - NULL. Новую версию возвращает RETURNING version
+func queueUpdate(ctx context.Context, batch *pgx.Batch, update string, args []any, action string, before, after *model.Person) *pgx.QueuedQuery {
+	n := len(args)
+	args = append(args, action, before, after, actor.FromContext(ctx), time.Now())
+	return batch.Queue(updateHistoryQuery(update, n), args...)
+}
+
+// scanVersion - after.Version из RETURNING version запроса queueUpdate
+func scanVersion(after *model.Person) func(row pgx.Row) error {
+	return func(row pgx.Row) error {
+		return row.Scan(&after.Version)
+	}
+}
+
+// CreatePerson - запись, ее история и событие в outbox одним запросом: история берет id из RETURNING вставки
+func (p *Pgx) CreatePerson(ctx context.Context, person *model.Person) error {
+	query := `WITH created AS (
+			INSERT INTO people (name, surname, patronymic, age, nationality, gender, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $7) RETURNING id),
+		history AS (
+			INSERT INTO people_history (person_id, version, action, after_data, actor, changed_at)
+			SELECT id, 1, $8, jsonb_set($9::jsonb, '{id}', to_jsonb(id)), $10, $7 FROM created ` + historyReturning + `)
+		` + outboxFromHistory + ` RETURNING person_id`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	now := time.Now()
+	person.CreatedAt = now
+	person.UpdatedAt = now
+	person.Version = 1
+	age, nationality, gender := pgxStats(person)
+	snapshot := *person
+	err := p.atomically(ctx, func(q pgxQuerier) error {
+		return q.QueryRow(ctx, query, person.Name, person.Surname, person.Patronymic, age, nationality, gender, now,
+			model.HistoryCreate, &snapshot, actor.FromContext(ctx)).Scan(&person.ID)
+	})
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return err
+	}
+	p.logger.Info("Создана запись в таблице person", zap.Int("id", person.ID))
+	return nil
+}
+
+// BulkCreatePersons - как Postgres.BulkCreatePersons: COPY через pgx.CopyFrom в бинарном формате, а если COPY
+// не прошел и atomic не задан - пачки по bulkChunkSize строк, каждая в своей точке сохранения
+func (p *Pgx) BulkCreatePersons(ctx context.Context, persons []model.Person, atomic bool) (model.BulkCreateResult, error) {
+	result, valid := model.NewBulkCreateResult(persons)
+	if atomic && len(result.Errors) > 0 {
+		return result, customerrors.ErrBulkRejected
+	}
+	if len(valid) == 0 {
+		return result, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout*time.Duration(1+len(valid)/bulkChunkSize))
+	defer cancel()
+
+	now := time.Now()
+	for _, i := range valid {
+		persons[i].CreatedAt = now
+		persons[i].UpdatedAt = now
+		persons[i].Version = 1
+	}
+	err := p.copyPersons(ctx, persons, valid)
+	if err == nil {
+		for _, i := range valid {
+			result.Done(i, persons[i].ID)
+		}
+		p.logger.Info("Массовая вставка через COPY", zap.Int("created", result.Created), zap.Int("failed", len(result.Errors)))
+		return result, nil
+	}
+	if atomic {
+		p.logger.Error("Ошибка массовой вставки через COPY", zap.Error(err))
+		return model.BulkCreateResult{IDs: make([]int, len(persons))}, err
+	}
+	p.logger.Warn("COPY не выполнен, вставка пачками INSERT", zap.Error(err))
+	if err := p.insertChunks(ctx, persons, valid, &result); err != nil {
+		return model.BulkCreateResult{IDs: make([]int, len(persons))}, err
+	}
+	p.logger.Info("Массовая вставка пачками INSERT", zap.Int("created", result.Created), zap.Int("failed", len(result.Errors)))
+	return result, nil
+}
+
+// copyPersons - COPY строк rows в people и записей о создании в people_history одной транзакцией,
+// события в outbox копируются из истории
+func (p *Pgx) copyPersons(ctx context.Context, persons []model.Person, rows []int) error {
+	tx, err := p.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer rollback(ctx, tx)
+
+	ids, err := pgxReserveIDs(ctx, tx, len(rows))
+	if err != nil {
+		return err
+	}
+	for k, i := range rows {
+		persons[i].ID = ids[k]
+	}
+	columns := []string{"id", "name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version"}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"people"}, columns, pgx.CopyFromSlice(len(rows), func(k int) ([]any, error) {
+		person := &persons[rows[k]]
+		age, nationality, gender := pgxStats(person)
+		return []any{person.ID, person.Name, person.Surname, person.Patronymic, age, nationality, gender, person.CreatedAt, person.UpdatedAt, person.Version}, nil
+	}))
+	if err != nil {
+		return err
+	}
+	who := actor.FromContext(ctx)
+	columns = []string{"person_id", "version", "action", "after_data", "actor", "changed_at"}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"people_history"}, columns, pgx.CopyFromSlice(len(rows), func(k int) ([]any, error) {
+		person := &persons[rows[k]]
+		return []any{person.ID, 1, model.HistoryCreate, person, who, person.CreatedAt}, nil
+	}))
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, copyOutboxQuery, ids); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// insertChunks - вставка без COPY: пачки по bulkChunkSize, ошибки отдельных строк попадают в result
+func (p *Pgx) insertChunks(ctx context.Context, persons []model.Person, rows []int, result *model.BulkCreateResult) error {
+	tx, err := p.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции", zap.String("error", err.Error()))
+		return err
+	}
+	defer rollback(ctx, tx)
+
+	for start := 0; start < len(rows); start += bulkChunkSize {
+		chunk := rows[start:min(start+bulkChunkSize, len(rows))]
+		if err := p.insertChunk(ctx, tx, persons, chunk); err == nil {
+			for _, i := range chunk {
+				result.Done(i, persons[i].ID)
+			}
+			continue
+		}
+		for _, i := range chunk {
+			if err := p.insertChunk(ctx, tx, persons, []int{i}); err != nil {
+				p.logger.Warn("Строка массовой вставки пропущена", zap.Int("index", i), zap.Error(err))
+				persons[i].ID = 0
+				result.Fail(i, "Failed to insert row")
+				continue
+			}
+			result.Done(i, persons[i].ID)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		p.logger.Error("Ошибка коммита транзакции", zap.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// insertChunk - строки rows, их история и события одной пачкой подготовленных INSERT в точке сохранения.
+// При ошибке пачка откатывается до точки сохранения, транзакция остается рабочей
+func (p *Pgx) insertChunk(ctx context.Context, tx pgx.Tx, persons []model.Person, rows []int) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer rollback(ctx, sp)
+
+	ids, err := pgxReserveIDs(ctx, sp, len(rows))
+	if err != nil {
+		return err
+	}
+	batch := &pgx.Batch{}
+	who := actor.FromContext(ctx)
+	for k, i := range rows {
+		person := &persons[i]
+		person.ID = ids[k]
+		age, nationality, gender := pgxStats(person)
+		batch.Queue(`INSERT INTO people (id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			person.ID, person.Name, person.Surname, person.Patronymic, age, nationality, gender, person.CreatedAt, person.UpdatedAt, person.Version)
+		batch.Queue(`WITH history AS (INSERT INTO people_history (person_id, version, action, after_data, actor, changed_at) VALUES ($1, 1, $2, $3, $4, $5) `+
+			historyReturning+`) `+outboxFromHistory, person.ID, model.HistoryCreate, person, who, person.CreatedAt)
+	}
+	if err := sp.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	return sp.Commit(ctx)
+}
+
+// pgxReserveIDs - см. reserveIDs
+func pgxReserveIDs(ctx context.Context, q pgxQuerier, n int) ([]int, error) {
+	rows, err := q.Query(ctx, `SELECT nextval(pg_get_serial_sequence('people', 'id')) FROM generate_series(1, $1)`, n)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != n {
+		return nil, fmt.Errorf("reserve ids: got %d of %d", len(ids), n)
+	}
+	return ids, nil
+}
+
+func (p *Pgx) GetPersonByID(ctx context.Context, id int) (*model.Person, error) {
+	query := `SELECT ` + pgxPersonColumns + ` FROM people WHERE id = $1 AND deleted_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	person := &model.Person{ID: id}
+	err := p.q(ctx).QueryRow(ctx, query, id).Scan(personFields(person)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return person, customerrors.ErrPersonNotFound
+	}
+	if err != nil {
+		return person, err
+	}
+	p.logger.Info("Получена запись из таблицы people", zap.Int("id", id))
+	return person, nil
+}
+
+// DeletePersonByID - запись блокируется и читается для истории, пометка удаления и история уходят одной пачкой
+func (p *Pgx) DeletePersonByID(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции", zap.Error(err))
+		return err
+	}
+	defer rollback(ctx, tx)
+
+	before, err := p.lockPerson(ctx, tx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && before.DeletedAt != nil) {
+		p.logger.Debug("Нечего удалять из базы", zap.Int("id", id))
+		return customerrors.ErrNothingToDelete
+	}
+	if err != nil {
+		p.logger.Error("Ошибка получения записи перед удалением", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+
+	now := time.Now()
+	after := *before
+	after.DeletedAt = &now
+	batch := &pgx.Batch{}
+	queueUpdate(ctx, batch, `UPDATE people SET deleted_at = $1, version = version + 1 WHERE id = $2`, []any{now, id}, model.HistoryDelete, before, &after).
+		QueryRow(scanVersion(&after))
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		p.logger.Error("Ошибка выполнения запроса при удалении", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после удаления", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+	p.logger.Info("Успешно удален пользователь", zap.Int("id", id))
+	return nil
+}
+
+func (p *Pgx) UpdatePersonByID(ctx context.Context, person *model.Person) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции при обновлении", zap.Error(err))
+		return err
+	}
+	defer rollback(ctx, tx)
+
+	if err = p.updateTx(ctx, tx, person, model.HistoryUpdate); err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после обновления", zap.Int("id", person.ID), zap.Error(err))
+		return err
+	}
+	p.logger.Info("Успешно обновлен пользователь", zap.Int("id", person.ID))
+	return nil
+}
+
+// updateTx - см. Postgres.updateTx. UPDATE и запись истории уходят одной пачкой
+func (p *Pgx) updateTx(ctx context.Context, tx pgx.Tx, person *model.Person, action string) error {
+	query := `UPDATE people SET name = $1, surname = $2, patronymic = $3, age = $4, nationality = $5, gender = $6, updated_at = $7, version = version + 1 WHERE id = $8 AND deleted_at IS NULL AND version = $9`
+
+	before, err := p.lockPerson(ctx, tx, person.ID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && before.DeletedAt != nil) {
+		p.logger.Debug("Нечего обновлять в базе", zap.Int("id", person.ID))
+		return customerrors.ErrNothingToUpdate
+	}
+	if err != nil {
+		p.logger.Error("Ошибка получения записи перед обновлением", zap.Int("id", person.ID), zap.Error(err))
+		return err
+	}
+
+	// Без ожидаемой версии обновление безусловное: строка уже заблокирована, версия не изменится до конца транзакции
+	if person.Version == 0 {
+		person.Version = before.Version
+	}
+	if person.Version != before.Version {
+		p.logger.Debug("Версия записи не совпадает", zap.Int("id", person.ID), zap.Int("expected", person.Version), zap.Int("actual", before.Version))
+		return customerrors.ErrVersionConflict
+	}
+
+	person.CreatedAt = before.CreatedAt
+	person.UpdatedAt = time.Now()
+	after := *person
+	age, nationality, gender := pgxStats(person)
+
+	batch := &pgx.Batch{}
+	args := []any{person.Name, person.Surname, person.Patronymic, age, nationality, gender, person.UpdatedAt, person.ID, person.Version}
+	queueUpdate(ctx, batch, query, args, action, before, &after).
+		QueryRow(func(row pgx.Row) error {
+			err := row.Scan(&after.Version)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return customerrors.ErrVersionConflict
+			}
+			return err
+		})
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		if errors.Is(err, customerrors.ErrVersionConflict) {
+			p.logger.Debug("Версия записи изменилась (0 rows affected)", zap.Int("id", person.ID))
+			return err
+		}
+		p.logger.Error("Ошибка выполнения запроса при обновлении", zap.Int("id", person.ID), zap.Error(err))
+		return err
+	}
+	person.Version = after.Version
+	return nil
+}
+
+// PatchPersonByID - см. Postgres.PatchPersonByID. UPDATE и запись истории уходят одной пачкой
+func (p *Pgx) PatchPersonByID(ctx context.Context, id int, patch model.PersonPatch, version int) (*model.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции при обновлении", zap.Error(err))
+		return nil, err
+	}
+	defer rollback(ctx, tx)
+
+	before, err := p.lockPerson(ctx, tx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && before.DeletedAt != nil) {
+		p.logger.Debug("Нечего обновлять в базе", zap.Int("id", id))
+		return nil, customerrors.ErrNothingToUpdate
+	}
+	if err != nil {
+		p.logger.Error("Ошибка получения записи перед обновлением", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	if version != 0 && version != before.Version {
+		p.logger.Debug("Версия записи не совпадает", zap.Int("id", id), zap.Int("expected", version), zap.Int("actual", before.Version))
+		return nil, customerrors.ErrVersionConflict
+	}
+	values := patch.Values()
+	if len(values) == 0 {
+		return before, nil
+	}
+
+	after := *before
+	patch.Apply(&after)
+	after.UpdatedAt = time.Now()
+	b := &queryBuilder{native: true}
+	query := `UPDATE people SET ` + patchSQL(b, values) + `, updated_at = ` + b.arg(after.UpdatedAt) + `, version = version + 1 WHERE id = ` + b.arg(id)
+	batch := &pgx.Batch{}
+	queueUpdate(ctx, batch, query, b.args, model.HistoryUpdate, before, &after).QueryRow(scanVersion(&after))
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		p.logger.Error("Ошибка выполнения запроса при частичном обновлении", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после обновления", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	p.logger.Info("Успешно обновлен пользователь", zap.Int("id", id), zap.Int("fields", len(values)))
+	return &after, nil
+}
+
+// GetPersonsByFilter - см. Postgres.GetPersonsByFilter
+func (p *Pgx) GetPersonsByFilter(ctx context.Context, filter model.PersonFilter, after *model.Cursor, limit int) ([]model.Person, error) {
+	b := pgxFilter(filter)
+	backward := after != nil && after.Backward
+	if after != nil {
+		b.keyset(after, filter.Sort)
+	}
+	// NULL в LIMIT означает без ограничения
+	lim := pgtype.Int8{Int64: int64(limit), Valid: limit > 0}
+	query := "SELECT " + pgxPersonColumns + " FROM people" + b.whereSQL() + orderBy(filter.Sort, backward) + " LIMIT " + b.arg(lim)
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	persons, err := p.queryPersons(ctx, query, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	if backward {
+		slices.Reverse(persons)
+	}
+	p.logger.Info("Получены записи из таблицы person", zap.Int("count", len(persons)))
+	return persons, nil
+}
+
+// queryPersons - выполняет запрос, выбирающий колонки pgxPersonColumns, и читает записи
+func (p *Pgx) queryPersons(ctx context.Context, query string, args ...any) ([]model.Person, error) {
+	rows, err := p.q(ctx).Query(ctx, query, args...)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	persons, err := collectPersons(rows)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("repository find with filters scan failed: %w", err)
+	}
+	return persons, nil
+}
+
+// CountPersons - см. Postgres.CountPersons
+func (p *Pgx) CountPersons(ctx context.Context, filter model.PersonFilter, estimate bool) (int64, bool, error) {
+	b := pgxFilter(filter)
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if !estimate {
+		var total int64
+		if err := p.q(ctx).QueryRow(ctx, "SELECT COUNT(*) FROM people"+b.whereSQL(), b.args...).Scan(&total); err != nil {
+			p.logger.Error("Ошибка подсчета записей", zap.Error(err))
+			return 0, false, err
+		}
+		return total, false, nil
+	}
+
+	var plan []byte
+	if err := p.q(ctx).QueryRow(ctx, "EXPLAIN (FORMAT JSON) SELECT 1 FROM people"+b.whereSQL(), b.args...).Scan(&plan); err != nil {
+		p.logger.Error("Ошибка оценки числа записей", zap.Error(err))
+		return 0, false, err
+	}
+	var explain []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explain); err != nil {
+		p.logger.Error("Не удалось разобрать план запроса", zap.ByteString("plan", plan), zap.Error(err))
+		return 0, false, fmt.Errorf("repository count estimate parse failed: %w", err)
+	}
+	if len(explain) == 0 {
+		return 0, false, fmt.Errorf("repository count estimate: empty plan")
+	}
+	return int64(explain[0].Plan.Rows), true, nil
+}
+
+// GetDemographics - все счетчики одной пачкой запросов в read-only транзакции REPEATABLE READ,
+// чтобы они были посчитаны по одному снимку данных
+func (p *Pgx) GetDemographics(ctx context.Context, filter model.PersonFilter, opts model.DemographicsOptions) (*model.Demographics, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.begin(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rollback(ctx, tx)
+
+	stats := &model.Demographics{}
+	var withAge, withGender, withNationality, complete int64
+	batch := &pgx.Batch{}
+	b := pgxFilter(filter)
+	query := `SELECT COUNT(*), COUNT(age), COUNT(gender), COUNT(nationality),
+		COUNT(*) FILTER (WHERE age IS NOT NULL AND gender IS NOT NULL AND nationality IS NOT NULL) FROM people` + b.whereSQL()
+	batch.Queue(query, b.args...).QueryRow(func(row pgx.Row) error {
+		return row.Scan(&stats.Total, &withAge, &withGender, &withNationality, &complete)
+	})
+	queueGroupCounts(batch, pgxFilter(filter), "COALESCE(gender, '')", 0, func(counts []model.ValueCount) { stats.Genders = counts })
+	queueGroupCounts(batch, pgxFilter(filter), "COALESCE(nationality, '')", 0, func(counts []model.ValueCount) { stats.Nationalities = counts })
+	queueGroupCounts(batch, pgxFilter(filter), "name", opts.Top, func(counts []model.ValueCount) { stats.TopNames = counts })
+	queueGroupCounts(batch, pgxFilter(filter), "surname", opts.Top, func(counts []model.ValueCount) { stats.TopSurnames = counts })
+	b = pgxFilter(filter)
+	b.where("age IS NOT NULL")
+	queueAgeBuckets(batch, b, opts.BucketWidth, func(buckets []model.AgeBucket) { stats.AgeBuckets = buckets })
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		p.logger.Error("Ошибка подсчета статистики", zap.Error(err))
+		return nil, err
+	}
+	stats.Coverage = model.NewCoverage(stats.Total, withAge, withGender, withNationality, complete)
+	return stats, nil
+}
+
+// GetPersonFacets - все фасеты одной пачкой запросов
+func (p *Pgx) GetPersonFacets(ctx context.Context, filter model.PersonFilter, facets []string) (map[string][]model.ValueCount, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	res := make(map[string][]model.ValueCount, len(facets))
+	batch := &pgx.Batch{}
+	for _, facet := range facets {
+		// имя колонки попадает в текст запроса, поэтому только из списка
+		if !slices.Contains(model.FacetFields, facet) {
+			continue
+		}
+		b := pgxFilter(filter)
+		b.where(facet + " IS NOT NULL")
+		if facet == "age" {
+			queueAgeBuckets(batch, b, model.FacetAgeBucketWidth, func(buckets []model.AgeBucket) {
+				res[facet] = model.AgeFacet(buckets)
+			})
+			continue
+		}
+		queueGroupCounts(batch, b, facet, 0, func(counts []model.ValueCount) {
+			res[facet] = counts
+		})
+	}
+	if batch.Len() == 0 {
+		return res, nil
+	}
+	if err := p.q(ctx).SendBatch(ctx, batch).Close(); err != nil {
+		p.logger.Error("Ошибка подсчета статистики", zap.Error(err))
+		return nil, err
+	}
+	return res, nil
+}
+
+// queueGroupCounts - запрос groupCounts в пачку batch, done получает результат при чтении пачки
+func queueGroupCounts(batch *pgx.Batch, b *queryBuilder, column string, top int, done func([]model.ValueCount)) {
+	query := groupCountsQuery(b, column, top)
+	batch.Queue(query, b.args...).Query(func(rows pgx.Rows) error {
+		counts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.ValueCount, error) {
+			var c model.ValueCount
+			err := row.Scan(&c.Value, &c.Count)
+			return c, err
+		})
+		if err != nil {
+			return err
+		}
+		done(counts)
+		return nil
+	})
+}
+
+// queueAgeBuckets - запрос ageBuckets в пачку batch, done получает результат при чтении пачки
+func queueAgeBuckets(batch *pgx.Batch, b *queryBuilder, width int64, done func([]model.AgeBucket)) {
+	query := ageBucketsQuery(b, width)
+	batch.Queue(query, b.args...).Query(func(rows pgx.Rows) error {
+		buckets, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.AgeBucket, error) {
+			var bucket, count int64
+			err := row.Scan(&bucket, &count)
+			return model.NewAgeBucket(bucket*width, width, count), err
+		})
+		if err != nil {
+			return err
+		}
+		done(buckets)
+		return nil
+	})
+}
+
+// SearchPersons - см. Postgres.SearchPersons
+func (p *Pgx) SearchPersons(ctx context.Context, query string, offset, limit int) ([]model.SearchResult, error) {
+	variants := search.Variants(query)
+	if len(variants) == 0 {
+		return make([]model.SearchResult, 0), nil
+	}
+	translit := variants[len(variants)-1]
+	sqlQuery := `WITH q AS (SELECT websearch_to_tsquery('simple', $1) || websearch_to_tsquery('simple', $2) AS ts)
+		SELECT ` + pgxPersonColumns + `,
+			GREATEST(similarity(name, $1), similarity(surname, $1), similarity(coalesce(patronymic, ''), $1),
+				similarity(name, $2), similarity(surname, $2), similarity(coalesce(patronymic, ''), $2)) + ts_rank(search_vector, q.ts) AS score
+		FROM people, q
+		WHERE deleted_at IS NULL AND (search_vector @@ q.ts OR name % $1 OR surname % $1 OR patronymic % $1 OR name % $2 OR surname % $2 OR patronymic % $2)
+		ORDER BY score DESC, id LIMIT $3 OFFSET $4`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	lim := pgtype.Int8{Int64: int64(limit), Valid: limit > 0}
+	rows, err := p.q(ctx).Query(ctx, sqlQuery, variants[0], translit, lim, offset)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	results, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.SearchResult, error) {
+		var result model.SearchResult
+		err := row.Scan(append(personFields(&result.Person), &result.Score)...)
+		return result, err
+	})
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("repository search scan failed: %w", err)
+	}
+	p.logger.Info("Выполнен поиск людей", zap.Int("count", len(results)))
+	return results, nil
+}
+
+// GetNameStats - см. Postgres.GetNameStats
+func (p *Pgx) GetNameStats(ctx context.Context, afterName string, limit int) ([]model.NameStats, error) {
+	query := `SELECT DISTINCT ON (name) name, age, gender, nationality FROM people WHERE name > $1 AND age IS NOT NULL AND gender IS NOT NULL AND nationality IS NOT NULL AND deleted_at IS NULL ORDER BY name, updated_at DESC LIMIT $2`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	rows, err := p.q(ctx).Query(ctx, query, afterName, limit)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	stats, err := pgx.AppendRows(make([]model.NameStats, 0, limit), rows, func(row pgx.CollectableRow) (model.NameStats, error) {
+		var s model.NameStats
+		err := row.Scan(&s.Name, &s.Age, &s.Gender, &s.Nationality)
+		return s, err
+	})
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("repository name stats scan failed: %w", err)
+	}
+	p.logger.Debug("Получены данные обогащения по именам", zap.Int("count", len(stats)))
+	return stats, nil
+}
+
+func (p *Pgx) RestorePersonByID(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции при восстановлении", zap.Error(err))
+		return err
+	}
+	defer rollback(ctx, tx)
+
+	before, err := p.lockPerson(ctx, tx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && before.DeletedAt == nil) {
+		p.logger.Debug("Нечего восстанавливать", zap.Int("id", id))
+		return customerrors.ErrNothingToRestore
+	}
+	if err != nil {
+		p.logger.Error("Ошибка получения записи перед восстановлением", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+
+	after := *before
+	after.DeletedAt = nil
+	after.UpdatedAt = time.Now()
+	batch := &pgx.Batch{}
+	queueUpdate(ctx, batch, `UPDATE people SET deleted_at = NULL, updated_at = $1, version = version + 1 WHERE id = $2`, []any{after.UpdatedAt, id}, model.HistoryRestore, before, &after).
+		QueryRow(scanVersion(&after))
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		p.logger.Error("Ошибка выполнения запроса при восстановлении", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после восстановления", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+	p.logger.Info("Успешно восстановлен пользователь", zap.Int("id", id))
+	return nil
+}
+
+// GetDeletedPersons - limit = 0 означает без ограничения
+func (p *Pgx) GetDeletedPersons(ctx context.Context, offset, limit int) ([]model.Person, error) {
+	query := `SELECT ` + pgxPersonColumns + `, deleted_at FROM people WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id LIMIT $1 OFFSET $2`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	// NULL в LIMIT означает без ограничения
+	lim := pgtype.Int8{Int64: int64(limit), Valid: limit > 0}
+	rows, err := p.q(ctx).Query(ctx, query, lim, offset)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	persons, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Person, error) {
+		var person model.Person
+		err := row.Scan(append(personFields(&person), &person.DeletedAt)...)
+		return person, err
+	})
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("repository deleted persons scan failed: %w", err)
+	}
+	return persons, nil
+}
+
+// PurgeDeleted - вместе с записями удаляется и их история. Оба DELETE уходят одной пачкой,
+// которая выполняется как одна транзакция
+func (p *Pgx) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var purged int64
+	err := p.atomically(ctx, func(q pgxQuerier) error {
+		batch := &pgx.Batch{}
+		batch.Queue(`DELETE FROM people_history WHERE person_id IN (SELECT id FROM people WHERE deleted_at IS NOT NULL AND deleted_at < $1)`, before)
+		batch.Queue(purgeMergesQuery, before)
+		batch.Queue(`DELETE FROM people WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before).Exec(func(tag pgconn.CommandTag) error {
+			purged = tag.RowsAffected()
+			return nil
+		})
+		return q.SendBatch(ctx, batch).Close()
+	})
+	if err != nil {
+		p.logger.Error("Ошибка очистки удаленных записей", zap.Error(err))
+		return 0, err
+	}
+	return purged, nil
+}
+
+func (p *Pgx) GetPersonHistory(ctx context.Context, id int) ([]model.PersonHistory, error) {
+	query := `SELECT version, action, before_data, after_data, actor, changed_at FROM people_history WHERE person_id = $1 ORDER BY version`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	rows, err := p.q(ctx).Query(ctx, query, id)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	// снимки из JSONB pgx читает прямо в *model.Person, NULL - nil
+	history, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.PersonHistory, error) {
+		entry := model.PersonHistory{PersonID: id}
+		err := row.Scan(&entry.Version, &entry.Action, &entry.Before, &entry.After, &entry.Actor, &entry.ChangedAt)
+		return entry, err
+	})
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("repository history scan failed: %w", err)
+	}
+	return history, nil
+}
+
+func (p *Pgx) RevertPerson(ctx context.Context, id, version int) (*model.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции при откате", zap.Error(err))
+		return nil, err
+	}
+	defer rollback(ctx, tx)
+
+	var target *model.Person
+	err = tx.QueryRow(ctx, `SELECT after_data FROM people_history WHERE person_id = $1 AND version = $2`, id, version).Scan(&target)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, customerrors.ErrVersionNotFound
+	}
+	if err != nil {
+		p.logger.Error("Ошибка получения версии", zap.Int("id", id), zap.Int("version", version), zap.Error(err))
+		return nil, err
+	}
+	if target == nil {
+		return nil, customerrors.ErrVersionNotFound
+	}
+
+	person := &model.Person{
+		ID:          id,
+		Name:        target.Name,
+		Surname:     target.Surname,
+		Patronymic:  target.Patronymic,
+		Age:         target.Age,
+		Nationality: target.Nationality,
+		Gender:      target.Gender,
+	}
+	if err = p.updateTx(ctx, tx, person, model.HistoryRevert); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после отката", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	p.logger.Info("Данные пользователя возвращены к версии", zap.Int("id", id), zap.Int("version", version))
+	return person, nil
+}
+
+// FindDuplicates - см. Postgres.FindDuplicates
+func (p *Pgx) FindDuplicates(ctx context.Context, limit int) ([]model.DuplicateGroup, error) {
+	query := `SELECT ` + pgxPersonColumns + ` FROM (
+		SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version,
+			COUNT(*) OVER (PARTITION BY ` + dupKey + `) AS namesakes
+		FROM people WHERE deleted_at IS NULL) candidates WHERE namesakes > 1 ORDER BY id`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	rows, err := p.q(ctx).Query(ctx, query)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	persons, err := collectPersons(rows)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("repository duplicates scan failed: %w", err)
+	}
+	groups := dedup.Group(persons, limit)
+	p.logger.Info("Найдены группы дубликатов", zap.Int("candidates", len(persons)), zap.Int("groups", len(groups)))
+	return groups, nil
+}
+
+// MergePersons - см. Postgres.MergePersons. Удаление дубликатов, их история и записи о слиянии уходят одной пачкой
+func (p *Pgx) MergePersons(ctx context.Context, ids []int, survivorID int) (*model.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции при слиянии", zap.Error(err))
+		return nil, err
+	}
+	defer rollback(ctx, tx)
+
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	persons := make([]model.Person, 0, len(ids))
+	for _, id := range ids {
+		person, err := p.lockPerson(ctx, tx, id)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && person.DeletedAt != nil) {
+			p.logger.Debug("Нечего объединять", zap.Int("id", id))
+			return nil, customerrors.ErrNothingToMerge
+		}
+		if err != nil {
+			p.logger.Error("Ошибка получения записи перед слиянием", zap.Int("id", id), zap.Error(err))
+			return nil, err
+		}
+		persons = append(persons, *person)
+	}
+	survivor, duplicates, ok := dedup.Split(persons, survivorID)
+	if !ok {
+		return nil, customerrors.ErrNothingToMerge
+	}
+
+	merged := dedup.Merge(survivor, duplicates)
+	if err = p.updateTx(ctx, tx, &merged, model.HistoryMerge); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	mergedIDs := make([]int, 0, len(duplicates))
+	batch := &pgx.Batch{}
+	for _, before := range duplicates {
+		after := before
+		after.DeletedAt = &now
+		queueUpdate(ctx, batch, `UPDATE people SET deleted_at = $1, version = version + 1 WHERE id = $2`, []any{now, before.ID}, model.HistoryMerge, &before, &after)
+		mergedIDs = append(mergedIDs, before.ID)
+	}
+	// survivor мог быть раньше слит и восстановлен - его старая запись о слиянии больше не нужна
+	batch.Queue(`DELETE FROM person_merges WHERE merged_id = $1`, survivor.ID)
+	batch.Queue(`UPDATE person_merges SET survivor_id = $1 WHERE survivor_id = ANY($2)`, survivor.ID, mergedIDs)
+	batch.Queue(`INSERT INTO person_merges (merged_id, survivor_id, actor, merged_at) SELECT unnest($1::int[]), $2, $3, $4
+		ON CONFLICT (merged_id) DO UPDATE SET survivor_id = EXCLUDED.survivor_id, actor = EXCLUDED.actor, merged_at = EXCLUDED.merged_at`,
+		mergedIDs, survivor.ID, actor.FromContext(ctx), now)
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		p.logger.Error("Ошибка записи слияния", zap.Int("id", survivor.ID), zap.Error(err))
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после слияния", zap.Int("id", survivor.ID), zap.Error(err))
+		return nil, err
+	}
+	p.logger.Info("Записи объединены", zap.Int("id", survivor.ID), zap.Ints("merged", mergedIDs))
+	return &merged, nil
+}
+
+// ResolveMergedID - ID записи, в которую был слит id, ErrPersonNotFound если id не сливался
+func (p *Pgx) ResolveMergedID(ctx context.Context, id int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var survivorID int
+	err := p.q(ctx).QueryRow(ctx, `SELECT survivor_id FROM person_merges WHERE merged_id = $1`, id).Scan(&survivorID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, customerrors.ErrPersonNotFound
+	}
+	if err != nil {
+		p.logger.Error("Ошибка получения записи о слиянии", zap.Int("id", id), zap.Error(err))
+		return 0, err
+	}
+	return survivorID, nil
+}
+
+// lockPerson - читает запись, в том числе удаленную, и блокирует ее до конца транзакции
+func (p *Pgx) lockPerson(ctx context.Context, tx pgx.Tx, id int) (*model.Person, error) {
+	query := `SELECT ` + pgxPersonColumns + `, deleted_at FROM people WHERE id = $1 FOR UPDATE`
+	var person model.Person
+	if err := tx.QueryRow(ctx, query, id).Scan(append(personFields(&person), &person.DeletedAt)...); err != nil {
+		return nil, err
+	}
+	return &person, nil
+}
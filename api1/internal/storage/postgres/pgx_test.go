@@ -0,0 +1,257 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var pgxColumns = []string{"id", "name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version"}
+
+func newTestPgx(t *testing.T) (*Pgx, pgxmock.PgxPoolIface) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err, "Не удалось создать pgxmock")
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания pgxmock были выполнены")
+		mock.Close()
+	})
+	return NewPgx(mock, zap.NewNop(), time.Second), mock
+}
+
+func anyArgs(n int) []any {
+	args := make([]any, n)
+	for i := range args {
+		args[i] = pgxmock.AnyArg()
+	}
+	return args
+}
+
+// expectPgxLock - чтение и блокировка записи перед изменением
+func expectPgxLock(mock pgxmock.PgxPoolIface, id int, deleted bool) {
+	var deletedAt *time.Time
+	if deleted {
+		now := time.Now()
+		deletedAt = &now
+	}
+	rows := pgxmock.NewRows(append(pgxColumns, "deleted_at")).
+		AddRow(id, "John", "Doe", "Smith", int64(30), "USA", "male", time.Now(), time.Now(), 1, deletedAt)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM people WHERE id = $1 FOR UPDATE")).WithArgs(id).WillReturnRows(rows)
+}
+
+func TestPgxCreatePerson(t *testing.T) {
+	r, mock := newTestPgx(t)
+	person := &model.Person{Name: "John", Surname: "Doe", Age: 30, Gender: "male"}
+
+	mock.ExpectQuery("WITH created AS").
+		WithArgs("John", "Doe", "", pgtype.Int8{Int64: 30, Valid: true}, pgtype.Text{}, pgtype.Text{String: "male", Valid: true},
+			pgxmock.AnyArg(), model.HistoryCreate, pgxmock.AnyArg(), "system").
+		WillReturnRows(pgxmock.NewRows([]string{"person_id"}).AddRow(7))
+
+	require.NoError(t, r.CreatePerson(context.Background(), person))
+	assert.Equal(t, 7, person.ID)
+	assert.Equal(t, 1, person.Version)
+	assert.False(t, person.CreatedAt.IsZero())
+}
+
+func TestPgxGetPersonByID(t *testing.T) {
+	query := regexp.QuoteMeta("FROM people WHERE id = $1 AND deleted_at IS NULL")
+
+	t.Run("Found", func(t *testing.T) {
+		r, mock := newTestPgx(t)
+		mock.ExpectQuery(query).WithArgs(1).WillReturnRows(pgxmock.NewRows(pgxColumns).
+			AddRow(1, "John", "Doe", "", int64(0), "", "", time.Now(), time.Now(), 3))
+
+		person, err := r.GetPersonByID(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, "John", person.Name)
+		assert.Equal(t, 3, person.Version)
+	})
+	t.Run("Not Found", func(t *testing.T) {
+		r, mock := newTestPgx(t)
+		mock.ExpectQuery(query).WithArgs(2).WillReturnError(pgx.ErrNoRows)
+
+		_, err := r.GetPersonByID(context.Background(), 2)
+		assert.ErrorIs(t, err, customerrors.ErrPersonNotFound)
+	})
+}
+
+func TestPgxGetPersonsByFilter(t *testing.T) {
+	r, mock := newTestPgx(t)
+	filter := model.PersonFilter{Genders: []string{"male"}, Sort: []model.SortField{{Field: "name"}}}
+
+	// массивы передаются срезами, без pq.Array
+	mock.ExpectQuery(regexp.QuoteMeta("FROM people WHERE deleted_at IS NULL AND gender = ANY($1) ORDER BY name, id LIMIT $2")).
+		WithArgs([]string{"male"}, pgtype.Int8{Int64: 2, Valid: true}).
+		WillReturnRows(pgxmock.NewRows(pgxColumns).
+			AddRow(1, "Ann", "Doe", "", int64(0), "", "male", time.Now(), time.Now(), 1).
+			AddRow(2, "Bob", "Doe", "", int64(40), "RU", "male", time.Now(), time.Now(), 1))
+
+	persons, err := r.GetPersonsByFilter(context.Background(), filter, nil, 2)
+	require.NoError(t, err)
+	require.Len(t, persons, 2)
+	assert.Equal(t, "Ann", persons[0].Name)
+	assert.Equal(t, int64(40), persons[1].Age)
+}
+
+func TestPgxUpdatePersonByID(t *testing.T) {
+	update := regexp.QuoteMeta("UPDATE people SET name = $1")
+
+	t.Run("Success", func(t *testing.T) {
+		r, mock := newTestPgx(t)
+		mock.ExpectBegin()
+		expectPgxLock(mock, 1, false)
+		batch := mock.ExpectBatch()
+		batch.ExpectQuery(update).
+			WithArgs("Jane", "Doe", "", pgtype.Int8{}, pgtype.Text{}, pgtype.Text{}, pgxmock.AnyArg(), 1, 1,
+				model.HistoryUpdate, pgxmock.AnyArg(), pgxmock.AnyArg(), "system", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectCommit()
+
+		person := &model.Person{ID: 1, Name: "Jane", Surname: "Doe"}
+		require.NoError(t, r.UpdatePersonByID(context.Background(), person))
+		assert.Equal(t, 2, person.Version)
+	})
+	t.Run("Version Conflict", func(t *testing.T) {
+		r, mock := newTestPgx(t)
+		mock.ExpectBegin()
+		expectPgxLock(mock, 1, false)
+		mock.ExpectRollback()
+
+		err := r.UpdatePersonByID(context.Background(), &model.Person{ID: 1, Name: "Jane", Surname: "Doe", Version: 5})
+		assert.ErrorIs(t, err, customerrors.ErrVersionConflict)
+	})
+	t.Run("Compare And Swap Failed", func(t *testing.T) {
+		r, mock := newTestPgx(t)
+		mock.ExpectBegin()
+		expectPgxLock(mock, 1, false)
+		batch := mock.ExpectBatch()
+		batch.ExpectQuery(update).
+			WithArgs("Jane", "Doe", "", pgtype.Int8{}, pgtype.Text{}, pgtype.Text{}, pgxmock.AnyArg(), 1, 1,
+				model.HistoryUpdate, pgxmock.AnyArg(), pgxmock.AnyArg(), "system", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"version"}))
+		mock.ExpectRollback()
+
+		err := r.UpdatePersonByID(context.Background(), &model.Person{ID: 1, Name: "Jane", Surname: "Doe", Version: 1})
+		assert.ErrorIs(t, err, customerrors.ErrVersionConflict)
+	})
+	t.Run("Deleted", func(t *testing.T) {
+		r, mock := newTestPgx(t)
+		mock.ExpectBegin()
+		expectPgxLock(mock, 1, true)
+		mock.ExpectRollback()
+
+		err := r.UpdatePersonByID(context.Background(), &model.Person{ID: 1, Name: "Jane", Surname: "Doe"})
+		assert.ErrorIs(t, err, customerrors.ErrNothingToUpdate)
+	})
+}
+
+func TestPgxPurgeDeleted(t *testing.T) {
+	r, mock := newTestPgx(t)
+	before := time.Now().Add(-time.Hour)
+	batch := mock.ExpectBatch()
+	batch.ExpectExec(regexp.QuoteMeta("DELETE FROM people_history WHERE person_id IN")).WithArgs(before).WillReturnResult(pgxmock.NewResult("DELETE", 5))
+	batch.ExpectExec(regexp.QuoteMeta("DELETE FROM person_merges WHERE survivor_id IN")).WithArgs(before).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	batch.ExpectExec(regexp.QuoteMeta("DELETE FROM people WHERE deleted_at IS NOT NULL AND deleted_at < $1")).WithArgs(before).WillReturnResult(pgxmock.NewResult("DELETE", 3))
+
+	purged, err := r.PurgeDeleted(context.Background(), before)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+}
+
+func TestPgxGetDemographics(t *testing.T) {
+	r, mock := newTestPgx(t)
+	mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	batch := mock.ExpectBatch()
+	batch.ExpectQuery("SELECT COUNT").WillReturnRows(pgxmock.NewRows([]string{"total", "age", "gender", "nationality", "complete"}).
+		AddRow(int64(2), int64(1), int64(2), int64(1), int64(1)))
+	batch.ExpectQuery("SELECT COALESCE\\(gender").WillReturnRows(pgxmock.NewRows([]string{"value", "count"}).AddRow("male", int64(2)))
+	batch.ExpectQuery("SELECT COALESCE\\(nationality").WillReturnRows(pgxmock.NewRows([]string{"value", "count"}).AddRow("", int64(1)).AddRow("RU", int64(1)))
+	batch.ExpectQuery("SELECT name").WithArgs(5).WillReturnRows(pgxmock.NewRows([]string{"value", "count"}).AddRow("Ivan", int64(2)))
+	batch.ExpectQuery("SELECT surname").WithArgs(5).WillReturnRows(pgxmock.NewRows([]string{"value", "count"}).AddRow("Ivanov", int64(2)))
+	batch.ExpectQuery("SELECT age /").WithArgs(int64(10)).WillReturnRows(pgxmock.NewRows([]string{"bucket", "count"}).AddRow(int64(3), int64(1)))
+	mock.ExpectRollback()
+
+	stats, err := r.GetDemographics(context.Background(), model.PersonFilter{}, model.DemographicsOptions{Top: 5, BucketWidth: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Total)
+	assert.Equal(t, []model.ValueCount{{Value: "male", Count: 2}}, stats.Genders)
+	assert.Len(t, stats.Nationalities, 2)
+	assert.Equal(t, []model.AgeBucket{model.NewAgeBucket(30, 10, 1)}, stats.AgeBuckets)
+}
+
+func TestPgxWithTx(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Commit", func(t *testing.T) {
+		r, mock := newTestPgx(t)
+		mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+		// CreatePerson внутри транзакции - точка сохранения
+		mock.ExpectBegin()
+		mock.ExpectQuery("WITH created AS").WithArgs(anyArgs(10)...).WillReturnRows(pgxmock.NewRows([]string{"person_id"}).AddRow(1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM people WHERE id = $1 AND deleted_at IS NULL")).WithArgs(1).
+			WillReturnRows(pgxmock.NewRows(pgxColumns).AddRow(1, "John", "Doe", "", int64(0), "", "", time.Now(), time.Now(), 1))
+		mock.ExpectCommit()
+
+		err := r.WithTx(ctx, model.TxOptions{Isolation: sql.LevelSerializable}, func(ctx context.Context) error {
+			person := &model.Person{Name: "John", Surname: "Doe"}
+			if err := r.CreatePerson(ctx, person); err != nil {
+				return err
+			}
+			_, err := r.GetPersonByID(ctx, person.ID)
+			return err
+		})
+		require.NoError(t, err)
+	})
+	t.Run("Rollback", func(t *testing.T) {
+		r, mock := newTestPgx(t)
+		mock.ExpectBeginTx(pgx.TxOptions{})
+		mock.ExpectBegin()
+		expectPgxLock(mock, 1, true)
+		mock.ExpectRollback()
+		mock.ExpectRollback()
+
+		err := r.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+			return r.DeletePersonByID(ctx, 1)
+		})
+		assert.ErrorIs(t, err, customerrors.ErrNothingToDelete)
+	})
+	t.Run("Retry", func(t *testing.T) {
+		r, mock := newTestPgx(t)
+		mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+		mock.ExpectRollback()
+		mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+		mock.ExpectCommit()
+
+		calls := 0
+		err := r.WithTx(ctx, model.TxOptions{Isolation: sql.LevelSerializable, MaxRetries: 1}, func(ctx context.Context) error {
+			calls++
+			if calls == 1 {
+				return &pgconn.PgError{Code: "40001"}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+	t.Run("Unsupported Isolation", func(t *testing.T) {
+		r, _ := newTestPgx(t)
+		err := r.WithTx(ctx, model.TxOptions{Isolation: sql.LevelLinearizable}, func(ctx context.Context) error {
+			return errors.New("не должна вызываться")
+		})
+		assert.ErrorContains(t, err, "isolation level not supported")
+	})
+}
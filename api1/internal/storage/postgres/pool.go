@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+)
+
+// PoolConfig - настройки пула соединений, 0 оставляет значение database/sql по умолчанию
+// (без ограничения для MaxOpenConns, ConnMaxLifetime и ConnMaxIdleTime, 2 для MaxIdleConns)
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+func (c PoolConfig) apply(db *sql.DB) {
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+	if c.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+}
+
+// applyPgx - те же настройки для pgxpool. Отдельного лимита простаивающих соединений у pgxpool нет,
+// MaxIdleConns не применяется: простаивающие соединения закрываются по ConnMaxIdleTime
+func (c PoolConfig) applyPgx(cfg *pgxpool.Config) {
+	if c.MaxOpenConns > 0 {
+		cfg.MaxConns = int32(c.MaxOpenConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		cfg.MaxConnLifetime = c.ConnMaxLifetime
+	}
+	if c.ConnMaxIdleTime > 0 {
+		cfg.MaxConnIdleTime = c.ConnMaxIdleTime
+	}
+}
+
+// PoolStats - пул primary и пулы реплик в порядке DATABASE_REPLICAS
+func (p *Postgres) PoolStats() []model.PoolStats {
+	stats := []model.PoolStats{model.NewPoolStats("primary", p.db.Stats())}
+	for i, r := range p.replicas {
+		stats = append(stats, model.NewPoolStats("replica-"+strconv.Itoa(i+1), r.db.Stats()))
+	}
+	return stats
+}
+
+// PoolStats - пул pgxpool под именем primary. WaitCount - сколько раз пришлось ждать соединения,
+// MaxIdleClosed всегда 0 (см. applyPgx)
+func (p *Pgx) PoolStats() []model.PoolStats {
+	s := p.pool.Stat()
+	return []model.PoolStats{{
+		Name:               "primary",
+		MaxOpenConnections: int(s.MaxConns()),
+		OpenConnections:    int(s.TotalConns()),
+		InUse:              int(s.AcquiredConns()),
+		Idle:               int(s.IdleConns()),
+		WaitCount:          s.EmptyAcquireCount(),
+		WaitDurationMs:     s.EmptyAcquireWaitTime().Milliseconds(),
+		MaxIdleTimeClosed:  s.MaxIdleDestroyCount(),
+		MaxLifetimeClosed:  s.MaxLifetimeDestroyCount(),
+	}}
+}
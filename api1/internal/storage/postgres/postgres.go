@@ -3,16 +3,22 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/nikita89756/testEffectiveMobile/internal/actor"
+	"github.com/nikita89756/testEffectiveMobile/internal/dedup"
 	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
 	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/search"
 	logger "github.com/nikita89756/testEffectiveMobile/pkg/logger"
-	"github.com/pressly/goose/v3"
 	"go.uber.org/zap"
 )
 
@@ -20,15 +26,20 @@ type Postgres struct {
 	db      *sql.DB
 	logger  logger.Logger
 	timeout time.Duration
+	// replicas - реплики для чтения (см. WithReplicas), next - счетчик для выбора реплики по кругу
+	replicas   []*replica
+	next       atomic.Uint64
+	retryAfter time.Duration
 }
 
 
 
-func ConnectDB(connectionString string,timeout time.Duration) *sql.DB {
+func ConnectDB(connectionString string,timeout time.Duration, pool PoolConfig) *sql.DB {
 		db, err := sql.Open("postgres", connectionString)
 	if err != nil {
 		panic(err)
 	}
+	pool.apply(db)
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	if err = db.PingContext(ctx); err != nil {
@@ -48,22 +59,15 @@ func NewPostgres(db *sql.DB, logger logger.Logger, timeout time.Duration) *Postg
 	}
 }
 
-func (p *Postgres) Migrate(migrationsDir string) error {
-		if err := goose.SetDialect("postgres"); err != nil {
-		return fmt.Errorf("goose: failed driver postgres: %w", err)
-	}
-
-	if err := goose.Up(p.db, migrationsDir); err != nil {
-		return fmt.Errorf("goose: migration faild: %w", err)
-	}
-
-	return nil 
-}
-
 func (p *Postgres) Close() {
 	if err := p.db.Close(); err != nil {
 		p.logger.Error("Ошибка закрытия подключения к базе данных", zap.String("error", err.Error()))
 	}
+	for _, r := range p.replicas {
+		if err := r.db.Close(); err != nil {
+			p.logger.Error("Ошибка закрытия подключения к реплике", zap.String("error", err.Error()))
+		}
+	}
 	p.logger.Info("Подключение к базе данных закрыто")
 }
 
@@ -71,7 +75,7 @@ func (p *Postgres) CreatePerson(ctx context.Context,person *model.Person) error
 	query := `INSERT INTO people (name,surname,patronymic, age ,nationality,gender,created_at,updated_at) VALUES ($1, $2, $3, $4, $5, $6,$7,$8) RETURNING id`
 	ctx, cancel := context.WithTimeout(ctx, p.timeout)
 	defer cancel()
-	tx, err := p.db.BeginTx(ctx, nil)
+	tx, err := p.conn(ctx).begin(ctx, nil)
 	if err != nil {
 		p.logger.Error("Ошибка начала транзакции", zap.String("error", err.Error()))
 		return err
@@ -99,6 +103,10 @@ func (p *Postgres) CreatePerson(ctx context.Context,person *model.Person) error
 		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
 		return err
 	}
+	person.Version = 1
+	if err = p.insertHistory(ctx, tx, model.HistoryCreate, nil, person); err != nil {
+		return err
+	}
 	if err = tx.Commit(); err != nil {
 		p.logger.Error("Ошибка коммита транзакции", zap.String("error", err.Error()))
 		return err
@@ -109,19 +117,243 @@ func (p *Postgres) CreatePerson(ctx context.Context,person *model.Person) error
 
 }
 
+// bulkChunkSize - строк в одном INSERT при вставке без COPY. На каждую такую пачку к таймауту запроса
+// добавляется еще один таймаут
+const bulkChunkSize = 1000
+
+// BulkCreatePersons - строки вставляются через COPY в одной транзакции. COPY не возвращает сгенерированные id,
+// поэтому они заранее берутся из последовательности. Если COPY не прошел и atomic не задан, строки вставляются
+// многострочными INSERT по bulkChunkSize, каждая пачка в своем SAVEPOINT. Пачка с ошибкой повторяется по одной строке,
+// чтобы отбросить только плохие строки
+func (p *Postgres) BulkCreatePersons(ctx context.Context, persons []model.Person, atomic bool) (model.BulkCreateResult, error) {
+	result, valid := model.NewBulkCreateResult(persons)
+	if atomic && len(result.Errors) > 0 {
+		return result, customerrors.ErrBulkRejected
+	}
+	if len(valid) == 0 {
+		return result, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout*time.Duration(1+len(valid)/bulkChunkSize))
+	defer cancel()
+
+	now := time.Now()
+	for _, i := range valid {
+		persons[i].CreatedAt = now
+		persons[i].UpdatedAt = now
+		persons[i].Version = 1
+	}
+	err := p.copyPersons(ctx, persons, valid)
+	if err == nil {
+		for _, i := range valid {
+			result.Done(i, persons[i].ID)
+		}
+		p.logger.Info("Массовая вставка через COPY", zap.Int("created", result.Created), zap.Int("failed", len(result.Errors)))
+		return result, nil
+	}
+	if atomic {
+		p.logger.Error("Ошибка массовой вставки через COPY", zap.Error(err))
+		return model.BulkCreateResult{IDs: make([]int, len(persons))}, err
+	}
+	p.logger.Warn("COPY не выполнен, вставка пачками INSERT", zap.Error(err))
+	if err := p.insertChunks(ctx, persons, valid, &result); err != nil {
+		return model.BulkCreateResult{IDs: make([]int, len(persons))}, err
+	}
+	p.logger.Info("Массовая вставка пачками INSERT", zap.Int("created", result.Created), zap.Int("failed", len(result.Errors)))
+	return result, nil
+}
+
+// copyPersons - COPY строк rows в people и записей о создании в people_history одной транзакцией,
+// события в outbox копируются из истории
+func (p *Postgres) copyPersons(ctx context.Context, persons []model.Person, rows []int) error {
+	tx, err := p.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids, err := reserveIDs(ctx, tx, len(rows))
+	if err != nil {
+		return err
+	}
+	for k, i := range rows {
+		persons[i].ID = ids[k]
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("people", "id", "name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version"))
+	if err != nil {
+		return err
+	}
+	for _, i := range rows {
+		person := &persons[i]
+		age, nationality, gender := nullStats(person)
+		if _, err := stmt.ExecContext(ctx, person.ID, person.Name, person.Surname, person.Patronymic, age, nationality, gender, person.CreatedAt, person.UpdatedAt, person.Version); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	// Exec без аргументов завершает COPY и отправляет данные
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	stmt, err = tx.PrepareContext(ctx, pq.CopyIn("people_history", "person_id", "version", "action", "after_data", "actor", "changed_at"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	who := actor.FromContext(ctx)
+	for _, i := range rows {
+		afterData, err := toSnapshot(&persons[i])
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, persons[i].ID, 1, model.HistoryCreate, afterData, who, persons[i].CreatedAt); err != nil {
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, copyOutboxQuery, pq.Array(ids)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertChunks - вставка без COPY: пачки по bulkChunkSize, ошибки отдельных строк попадают в result
+func (p *Postgres) insertChunks(ctx context.Context, persons []model.Person, rows []int, result *model.BulkCreateResult) error {
+	tx, err := p.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции", zap.String("error", err.Error()))
+		return err
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(rows); start += bulkChunkSize {
+		chunk := rows[start:min(start+bulkChunkSize, len(rows))]
+		if err := p.insertChunk(ctx, tx, persons, chunk); err == nil {
+			for _, i := range chunk {
+				result.Done(i, persons[i].ID)
+			}
+			continue
+		}
+		for _, i := range chunk {
+			if err := p.insertChunk(ctx, tx, persons, []int{i}); err != nil {
+				p.logger.Warn("Строка массовой вставки пропущена", zap.Int("index", i), zap.Error(err))
+				persons[i].ID = 0
+				result.Fail(i, "Failed to insert row")
+				continue
+			}
+			result.Done(i, persons[i].ID)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		p.logger.Error("Ошибка коммита транзакции", zap.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// insertChunk - один INSERT на все строки rows и один на их историю и события внутри SAVEPOINT.
+// При ошибке пачка откатывается до SAVEPOINT, транзакция остается рабочей
+func (p *Postgres) insertChunk(ctx context.Context, tx *txn, persons []model.Person, rows []int) (err error) {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT bulk_chunk"); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT bulk_chunk"); rbErr != nil {
+				err = errors.Join(err, rbErr)
+			}
+		}
+	}()
+
+	ids, err := reserveIDs(ctx, tx, len(rows))
+	if err != nil {
+		return err
+	}
+	people := &queryBuilder{}
+	history := &queryBuilder{}
+	peopleValues := make([]string, 0, len(rows))
+	historyValues := make([]string, 0, len(rows))
+	who := actor.FromContext(ctx)
+	for k, i := range rows {
+		person := &persons[i]
+		person.ID = ids[k]
+		age, nationality, gender := nullStats(person)
+		peopleValues = append(peopleValues, "("+strings.Join([]string{
+			people.arg(person.ID), people.arg(person.Name), people.arg(person.Surname), people.arg(person.Patronymic),
+			people.arg(age), people.arg(nationality), people.arg(gender),
+			people.arg(person.CreatedAt), people.arg(person.UpdatedAt), people.arg(person.Version),
+		}, ", ")+")")
+		afterData, err := toSnapshot(person)
+		if err != nil {
+			return err
+		}
+		historyValues = append(historyValues, "("+strings.Join([]string{
+			history.arg(person.ID), "1", history.arg(model.HistoryCreate), history.arg(afterData), history.arg(who), history.arg(person.CreatedAt),
+		}, ", ")+")")
+	}
+	query := "INSERT INTO people (id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version) VALUES " + strings.Join(peopleValues, ", ")
+	if _, err := tx.ExecContext(ctx, query, people.args...); err != nil {
+		return err
+	}
+	query = "WITH history AS (INSERT INTO people_history (person_id, version, action, after_data, actor, changed_at) VALUES " +
+		strings.Join(historyValues, ", ") + " " + historyReturning + ") " + outboxFromHistory
+	if _, err := tx.ExecContext(ctx, query, history.args...); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT bulk_chunk")
+	return err
+}
+
+// reserveIDs - n значений из последовательности people.id. Значения не возвращаются при откате, это дает только пропуски в id
+func reserveIDs(ctx context.Context, tx *txn, n int) ([]int, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT nextval(pg_get_serial_sequence('people', 'id')) FROM generate_series(1, $1)`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int, 0, n)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) != n {
+		return nil, fmt.Errorf("reserve ids: got %d of %d", len(ids), n)
+	}
+	return ids, nil
+}
+
+func nullStats(person *model.Person) (sql.NullInt64, sql.NullString, sql.NullString) {
+	return sql.NullInt64{Int64: person.Age, Valid: person.Age != 0},
+		sql.NullString{String: person.Nationality, Valid: person.Nationality != ""},
+		sql.NullString{String: person.Gender, Valid: person.Gender != ""}
+}
+
 func (p *Postgres) GetPersonByID(ctx context.Context,id int) (*model.Person, error) {
 	var(
 		age sql.NullInt64
 		nationality sql.NullString
 		gender sql.NullString
 	)
-	query := `SELECT name,surname,patronymic, age ,nationality,gender,created_at,updated_at FROM people WHERE id = $1`
+	query := `SELECT name,surname,patronymic, age ,nationality,gender,created_at,updated_at,version FROM people WHERE id = $1 AND deleted_at IS NULL`
 	ctx, cancel := context.WithTimeout(ctx, p.timeout)
 	defer cancel()
 
 	person := &model.Person{ID:id}
-	row := p.db.QueryRowContext(ctx, query, id)
-	err:= row.Scan(&person.Name,&person.Surname,&person.Patronymic,&age,&nationality,&gender,&person.CreatedAt,&person.UpdatedAt)
+	err := p.read(ctx, func(db conn) error {
+		return db.QueryRowContext(ctx, query, id).Scan(&person.Name,&person.Surname,&person.Patronymic,&age,&nationality,&gender,&person.CreatedAt,&person.UpdatedAt,&person.Version)
+	})
 	if errors.Is(err,sql.ErrNoRows){
 		return person , customerrors.ErrPersonNotFound
 	}
@@ -145,7 +377,7 @@ func (p *Postgres) DeletePersonByID(ctx context.Context, id int) error {
 	ctx, cancel := context.WithTimeout(ctx, p.timeout)
 	defer cancel()
 
-	tx, err := p.db.BeginTx(ctx, nil)
+	tx, err := p.conn(ctx).begin(ctx, nil)
 	if err != nil {
 		p.logger.Error("Ошибка начала транзакции", zap.Error(err))
 		return err
@@ -156,42 +388,45 @@ func (p *Postgres) DeletePersonByID(ctx context.Context, id int) error {
 		_ = tx.Rollback()
 	}()
 
-	query := `DELETE FROM people WHERE id = $1`
-	res, err := tx.ExecContext(ctx, query, id)
-
-	if err != nil {
-		p.logger.Error("Ошибка выполнения запроса ExecContext", zap.Int("id", id), zap.Error(err))
-
-		return err
+	before, err := p.lockPerson(ctx, tx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && before.DeletedAt != nil) {
+		p.logger.Debug("Нечего удалять из базы", zap.Int("id", id))
+		return customerrors.ErrNothingToDelete
 	}
-
-	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		p.logger.Error("Ошибка получения RowsAffected после удаления", zap.Int("id", id), zap.Error(err))
-
+		p.logger.Error("Ошибка получения записи перед удалением", zap.Int("id", id), zap.Error(err))
 		return err
 	}
 
-	if rowsAffected == 0 {
+	now := time.Now()
+	query := `UPDATE people SET deleted_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NULL`
+	after := *before
+	after.DeletedAt = &now
+	err = p.updateWithHistory(ctx, tx, query, []any{now, id}, model.HistoryDelete, before, &after)
+	if errors.Is(err, sql.ErrNoRows) {
 		p.logger.Debug("Нечего удалять из базы (0 rows affected)", zap.Int("id", id))
 		return customerrors.ErrNothingToDelete
 	}
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса при удалении", zap.Int("id", id), zap.Error(err))
+
+		return err
+	}
 	if err = tx.Commit(); err != nil {
 		p.logger.Error("Ошибка коммита транзакции после удаления", zap.Int("id", id), zap.Error(err))
 
 		return err
 	}
-	p.logger.Info("Успешно удален пользователь", zap.Int("id", id), zap.Int64("rowsAffected", rowsAffected))
+	p.logger.Info("Успешно удален пользователь", zap.Int("id", id))
 	return nil 
 }
 
 
 func (p *Postgres) UpdatePersonByID(ctx context.Context, person *model.Person) error {
-	query := `UPDATE people SET name = $1, surname = $2, patronymic = $3, age = $4, nationality = $5, gender = $6, updated_at = $7 WHERE id = $8`
 	ctx, cancel := context.WithTimeout(ctx, p.timeout)
 	defer cancel()
 
-	tx, err := p.db.BeginTx(ctx, nil)
+	tx, err := p.conn(ctx).begin(ctx, nil)
 	if err != nil {
 		p.logger.Error("Ошибка начала транзакции при обновлении", zap.Error(err))
 		return err
@@ -200,8 +435,44 @@ func (p *Postgres) UpdatePersonByID(ctx context.Context, person *model.Person) e
 		_ = tx.Rollback()
 	}()
 
+	if err = p.updateTx(ctx, tx, person, model.HistoryUpdate); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после обновления", zap.Int("id", person.ID), zap.Error(err))
+		return err
+	}
+
+	p.logger.Info("Успешно обновлен пользователь", zap.Int("id", person.ID))
+	return nil
+}
+
+// updateTx - обновление в транзакции tx с записью в историю как action
+func (p *Postgres) updateTx(ctx context.Context, tx *txn, person *model.Person, action string) error {
+	query := `UPDATE people SET name = $1, surname = $2, patronymic = $3, age = $4, nationality = $5, gender = $6, updated_at = $7, version = version + 1 WHERE id = $8 AND deleted_at IS NULL AND version = $9`
+
+	before, err := p.lockPerson(ctx, tx, person.ID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && before.DeletedAt != nil) {
+		p.logger.Debug("Нечего обновлять в базе", zap.Int("id", person.ID))
+		return customerrors.ErrNothingToUpdate
+	}
+	if err != nil {
+		p.logger.Error("Ошибка получения записи перед обновлением", zap.Int("id", person.ID), zap.Error(err))
+		return err
+	}
+
+	// Без ожидаемой версии обновление безусловное: строка уже заблокирована, версия не изменится до конца транзакции
+	if person.Version == 0 {
+		person.Version = before.Version
+	}
+	if person.Version != before.Version {
+		p.logger.Debug("Версия записи не совпадает", zap.Int("id", person.ID), zap.Int("expected", person.Version), zap.Int("actual", before.Version))
+		return customerrors.ErrVersionConflict
+	}
 
 	now := time.Now()
+	person.CreatedAt = before.CreatedAt
 	person.UpdatedAt = now
 
 	age := sql.NullInt64{Valid: person.Age != 0}
@@ -217,7 +488,7 @@ func (p *Postgres) UpdatePersonByID(ctx context.Context, person *model.Person) e
 		nationality.String = person.Nationality
 	}
 
-	res, err := tx.ExecContext(ctx, query,
+	args := []any{
 		person.Name,
 		person.Surname,
 		person.Patronymic,
@@ -226,106 +497,908 @@ func (p *Postgres) UpdatePersonByID(ctx context.Context, person *model.Person) e
 		gender,
 		person.UpdatedAt,
 		person.ID,
-	)
+		person.Version,
+	}
+	err = p.updateWithHistory(ctx, tx, query, args, action, before, person)
+	if errors.Is(err, sql.ErrNoRows) {
+		p.logger.Debug("Версия записи изменилась (0 rows affected)", zap.Int("id", person.ID))
+		return customerrors.ErrVersionConflict
+	}
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса при обновлении", zap.Int("id", person.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
 
+// PatchPersonByID - запись блокируется, чтобы проверить версию и записать историю, затем один UPDATE меняет
+// только колонки из патча
+func (p *Postgres) PatchPersonByID(ctx context.Context, id int, patch model.PersonPatch, version int) (*model.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции при обновлении", zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	before, err := p.lockPerson(ctx, tx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && before.DeletedAt != nil) {
+		p.logger.Debug("Нечего обновлять в базе", zap.Int("id", id))
+		return nil, customerrors.ErrNothingToUpdate
+	}
 	if err != nil {
-		p.logger.Error("Ошибка выполнения запроса ExecContext при обновлении", zap.Int("id", person.ID), zap.Error(err))
+		p.logger.Error("Ошибка получения записи перед обновлением", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	if version != 0 && version != before.Version {
+		p.logger.Debug("Версия записи не совпадает", zap.Int("id", id), zap.Int("expected", version), zap.Int("actual", before.Version))
+		return nil, customerrors.ErrVersionConflict
+	}
+	values := patch.Values()
+	if len(values) == 0 {
+		return before, nil
+	}
+
+	after := *before
+	patch.Apply(&after)
+	after.UpdatedAt = time.Now()
+	b := &queryBuilder{}
+	query := `UPDATE people SET ` + patchSQL(b, values) + `, updated_at = ` + b.arg(after.UpdatedAt) + `, version = version + 1 WHERE id = ` + b.arg(id)
+	if err = p.updateWithHistory(ctx, tx, query, b.args, model.HistoryUpdate, before, &after); err != nil {
+		p.logger.Error("Ошибка выполнения запроса при частичном обновлении", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после обновления", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	p.logger.Info("Успешно обновлен пользователь", zap.Int("id", id), zap.Int("fields", len(values)))
+	return &after, nil
+}
+
+// patchSQL - SET для колонок из патча. NULL пишется в текст запроса, значения передаются параметрами
+func patchSQL(b *queryBuilder, values []model.PatchValue) string {
+	set := make([]string, 0, len(values))
+	for _, v := range values {
+		if v.Value == nil {
+			set = append(set, v.Column+" = NULL")
+			continue
+		}
+		set = append(set, v.Column+" = "+b.arg(v.Value))
+	}
+	return strings.Join(set, ", ")
+}
+
+// GetPersonsByFilter - условия и сортировка собираются из заданных полей фильтра, страница выбирается по ключу
+// сортировки без OFFSET. Для курсора назад записи выбираются в обратном порядке и разворачиваются.
+// limit = 0 означает без ограничения
+func (p *Postgres) GetPersonsByFilter(ctx context.Context, filter model.PersonFilter, after *model.Cursor, limit int) ([]model.Person, error) {
+	b := personFilter(filter)
+	backward := after != nil && after.Backward
+	if after != nil {
+		b.keyset(after, filter.Sort)
+	}
+	// NULL в LIMIT означает без ограничения
+	lim := sql.NullInt64{Int64: int64(limit), Valid: limit > 0}
+	query := "SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version FROM people" + b.whereSQL() +
+		orderBy(filter.Sort, backward) + " LIMIT " + b.arg(lim)
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var persons []model.Person
+	err := p.read(ctx, func(db conn) (err error) {
+		persons, err = p.queryPersons(ctx, db, query, b.args...)
 		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if backward {
+		slices.Reverse(persons)
+	}
+	p.logger.Info("Получены записи из таблицы person", zap.String("count", strconv.Itoa(len(persons))))
+	return persons, nil
+}
+
+// queryPersons - выполняет запрос, выбирающий колонки people до version, и читает записи
+func (p *Postgres) queryPersons(ctx context.Context, q queryer, query string, args ...any) ([]model.Person, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	persons := make([]model.Person, 0)
+	for rows.Next() {
+		person := model.Person{}
+		var age sql.NullInt64
+		var gender sql.NullString
+		var nationality sql.NullString
+		var patronymic sql.NullString
+
+		if err := rows.Scan(
+			&person.ID,
+			&person.Name,
+			&person.Surname,
+			&patronymic,
+			&age,
+			&nationality,
+			&gender,
+			&person.CreatedAt,
+			&person.UpdatedAt,
+			&person.Version,
+		); err != nil {
+			p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+			return nil, fmt.Errorf("repository find with filters scan failed: %w", err)
+		}
+
+		if patronymic.Valid {
+			person.Patronymic = patronymic.String
+		}
+		if age.Valid {
+			person.Age = age.Int64
+		}
+		if gender.Valid {
+			person.Gender = gender.String
+		}
+		if nationality.Valid {
+			person.Nationality = nationality.String
+		}
+		persons = append(persons, person)
 	}
+	if err := rows.Err(); err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
+	}
+	return persons, nil
+}
 
-	rowsAffected, err := res.RowsAffected()
+// CountPersons - с estimate число строк берется из плана запроса (EXPLAIN) без сканирования таблицы
+func (p *Postgres) CountPersons(ctx context.Context, filter model.PersonFilter, estimate bool) (int64, bool, error) {
+	b := personFilter(filter)
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if !estimate {
+		var total int64
+		err := p.read(ctx, func(db conn) error {
+			return db.QueryRowContext(ctx, "SELECT COUNT(*) FROM people"+b.whereSQL(), b.args...).Scan(&total)
+		})
+		if err != nil {
+			p.logger.Error("Ошибка подсчета записей", zap.Error(err))
+			return 0, false, err
+		}
+		return total, false, nil
+	}
+
+	var plan []byte
+	err := p.read(ctx, func(db conn) error {
+		return db.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) SELECT 1 FROM people"+b.whereSQL(), b.args...).Scan(&plan)
+	})
 	if err != nil {
-		p.logger.Error("Ошибка получения RowsAffected после обновления", zap.Int("id", person.ID), zap.Error(err))
+		p.logger.Error("Ошибка оценки числа записей", zap.Error(err))
+		return 0, false, err
+	}
+	var explain []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explain); err != nil {
+		p.logger.Error("Не удалось разобрать план запроса", zap.ByteString("plan", plan), zap.Error(err))
+		return 0, false, fmt.Errorf("repository count estimate parse failed: %w", err)
+	}
+	if len(explain) == 0 {
+		return 0, false, fmt.Errorf("repository count estimate: empty plan")
+	}
+	return int64(explain[0].Plan.Rows), true, nil
+}
+
+// GetDemographics - несколько GROUP BY по одному фильтру в read-only транзакции REPEATABLE READ,
+// чтобы все счетчики были посчитаны по одному снимку данных
+func (p *Postgres) GetDemographics(ctx context.Context, filter model.PersonFilter, opts model.DemographicsOptions) (*model.Demographics, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var stats *model.Demographics
+	err := p.read(ctx, func(db conn) (err error) {
+		stats, err = p.demographics(ctx, db, filter, opts)
 		return err
+	})
+	return stats, err
+}
+
+func (p *Postgres) demographics(ctx context.Context, db conn, filter model.PersonFilter, opts model.DemographicsOptions) (*model.Demographics, error) {
+	tx, err := db.begin(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции", zap.String("error", err.Error()))
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	if rowsAffected == 0 {
-		p.logger.Debug("Нечего обновлять в базе (0 rows affected)", zap.Int("id", person.ID))
-		return customerrors.ErrNothingToUpdate
+	stats := &model.Demographics{}
+	var withAge, withGender, withNationality, complete int64
+	b := personFilter(filter)
+	query := `SELECT COUNT(*), COUNT(age), COUNT(gender), COUNT(nationality),
+		COUNT(*) FILTER (WHERE age IS NOT NULL AND gender IS NOT NULL AND nationality IS NOT NULL) FROM people` + b.whereSQL()
+	if err := tx.QueryRowContext(ctx, query, b.args...).Scan(&stats.Total, &withAge, &withGender, &withNationality, &complete); err != nil {
+		p.logger.Error("Ошибка подсчета статистики", zap.Error(err))
+		return nil, err
+	}
+	stats.Coverage = model.NewCoverage(stats.Total, withAge, withGender, withNationality, complete)
+	if stats.Genders, err = p.groupCounts(ctx, tx, personFilter(filter), "COALESCE(gender, '')", 0); err != nil {
+		return nil, err
+	}
+	if stats.Nationalities, err = p.groupCounts(ctx, tx, personFilter(filter), "COALESCE(nationality, '')", 0); err != nil {
+		return nil, err
+	}
+	if stats.TopNames, err = p.groupCounts(ctx, tx, personFilter(filter), "name", opts.Top); err != nil {
+		return nil, err
+	}
+	if stats.TopSurnames, err = p.groupCounts(ctx, tx, personFilter(filter), "surname", opts.Top); err != nil {
+		return nil, err
 	}
 
-	if err = tx.Commit(); err != nil {
-		p.logger.Error("Ошибка коммита транзакции после обновления", zap.Int("id", person.ID), zap.Error(err))
+	b = personFilter(filter)
+	b.where("age IS NOT NULL")
+	if stats.AgeBuckets, err = p.ageBuckets(ctx, tx, b, opts.BucketWidth); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetPersonFacets - один GROUP BY на фасет с условием из personFilter, как в GetPersonsByFilter, но без курсора
+func (p *Postgres) GetPersonFacets(ctx context.Context, filter model.PersonFilter, facets []string) (map[string][]model.ValueCount, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var res map[string][]model.ValueCount
+	err := p.read(ctx, func(db conn) (err error) {
+		res, err = p.facets(ctx, db, filter, facets)
 		return err
+	})
+	return res, err
+}
+
+func (p *Postgres) facets(ctx context.Context, q queryer, filter model.PersonFilter, facets []string) (map[string][]model.ValueCount, error) {
+	res := make(map[string][]model.ValueCount, len(facets))
+	for _, facet := range facets {
+		// имя колонки попадает в текст запроса, поэтому только из списка
+		if !slices.Contains(model.FacetFields, facet) {
+			continue
+		}
+		b := personFilter(filter)
+		b.where(facet + " IS NOT NULL")
+		if facet == "age" {
+			buckets, err := p.ageBuckets(ctx, q, b, model.FacetAgeBucketWidth)
+			if err != nil {
+				return nil, err
+			}
+			res[facet] = model.AgeFacet(buckets)
+			continue
+		}
+		counts, err := p.groupCounts(ctx, q, b, facet, 0)
+		if err != nil {
+			return nil, err
+		}
+		res[facet] = counts
 	}
+	return res, nil
+}
 
-	p.logger.Info("Успешно обновлен пользователь", zap.Int("id", person.ID), zap.Int64("rowsAffected", rowsAffected))
-	return nil
+// groupCounts - число людей по значениям column с условием b, порядок как в model.SortValueCounts.
+// COLLATE "C" сравнивает строки побайтово, как Go. top = 0 означает все значения
+func (p *Postgres) groupCounts(ctx context.Context, q queryer, b *queryBuilder, column string, top int) ([]model.ValueCount, error) {
+	rows, err := q.QueryContext(ctx, groupCountsQuery(b, column, top), b.args...)
+	if err != nil {
+		p.logger.Error("Ошибка подсчета статистики", zap.String("column", column), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make([]model.ValueCount, 0)
+	for rows.Next() {
+		var c model.ValueCount
+		if err := rows.Scan(&c.Value, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
 }
 
+// ageBuckets - число людей по корзинам возраста шириной width с условием b, по возрастанию возраста
+func (p *Postgres) ageBuckets(ctx context.Context, q queryer, b *queryBuilder, width int64) ([]model.AgeBucket, error) {
+	rows, err := q.QueryContext(ctx, ageBucketsQuery(b, width), b.args...)
+	if err != nil {
+		p.logger.Error("Ошибка подсчета статистики", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	buckets := make([]model.AgeBucket, 0)
+	for rows.Next() {
+		var bucket, count int64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, model.NewAgeBucket(bucket*width, width, count))
+	}
+	return buckets, rows.Err()
+}
+
+// groupCountsQuery - запрос для groupCounts, параметры добавляются в b
+func groupCountsQuery(b *queryBuilder, column string, top int) string {
+	query := "SELECT " + column + ", COUNT(*) FROM people" + b.whereSQL() + " GROUP BY 1 ORDER BY 2 DESC, " + column + ` COLLATE "C"`
+	if top > 0 {
+		query += " LIMIT " + b.arg(top)
+	}
+	return query
+}
+
+// ageBucketsQuery - запрос для ageBuckets, параметры добавляются в b
+func ageBucketsQuery(b *queryBuilder, width int64) string {
+	return "SELECT age / " + b.arg(width) + ", COUNT(*) FROM people" + b.whereSQL() + " GROUP BY 1 ORDER BY 1"
+}
 
-func (p *Postgres) GetPersonsByFilter(ctx context.Context,person model.Person,offset,limit int) ([]model.Person,error){
-	args := make([]interface{}, 0)
-	args = appendArgs(args, person)
-	query := "SELECT id, name,surname,patronymic, age ,nationality,gender,created_at,updated_at FROM people WHERE ($1 = '' or name = $1) and($2 = '' or surname = $2) and ($3 = '' or patronymic = $3) and ($4 = 0 or age = $4) and ($5 = '' or nationality = $5) and ($6 = '' or gender = $6) ORDER BY id "
-	
-	// Обработать когда нет LIMIT и OFFSET
-	if limit == 0 {
-		query += " LIMIT ALL OFFSET $7"
-		args = append(args, offset)
-	}else{
-		query += " LIMIT $7 OFFSET $8"
-		p.logger.Info("Limit and offset", zap.String("limit", strconv.Itoa(limit)), zap.String("offset", strconv.Itoa(offset)))
-		args = append(args, limit, offset)
+// queryer - conn или *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// SearchPersons - запрос ищется как есть и в транслитерации ($1 и $2). Кандидаты отбираются по GIN индексам:
+// триграммная похожесть (%) по каждому полю или полнотекстовое совпадение слов. Score = лучшая similarity + ts_rank.
+// limit = 0 означает без ограничения
+func (p *Postgres) SearchPersons(ctx context.Context, query string, offset, limit int) ([]model.SearchResult, error) {
+	variants := search.Variants(query)
+	if len(variants) == 0 {
+		return make([]model.SearchResult, 0), nil
 	}
+	translit := variants[len(variants)-1]
+	sqlQuery := `WITH q AS (SELECT websearch_to_tsquery('simple', $1) || websearch_to_tsquery('simple', $2) AS ts)
+		SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version,
+			GREATEST(similarity(name, $1), similarity(surname, $1), similarity(coalesce(patronymic, ''), $1),
+				similarity(name, $2), similarity(surname, $2), similarity(coalesce(patronymic, ''), $2)) + ts_rank(search_vector, q.ts) AS score
+		FROM people, q
+		WHERE deleted_at IS NULL AND (search_vector @@ q.ts OR name % $1 OR surname % $1 OR patronymic % $1 OR name % $2 OR surname % $2 OR patronymic % $2)
+		ORDER BY score DESC, id LIMIT $3 OFFSET $4`
 	ctx, cancel := context.WithTimeout(ctx, p.timeout)
 	defer cancel()
 
-	rows , err:=p.db.QueryContext(ctx,query,args...)
+	lim := sql.NullInt64{Int64: int64(limit), Valid: limit > 0}
+	rows, err := p.conn(ctx).QueryContext(ctx, sqlQuery, variants[0], translit, lim, offset)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
 
-	if err != nil{
+	results := make([]model.SearchResult, 0)
+	for rows.Next() {
+		var (
+			result      model.SearchResult
+			patronymic  sql.NullString
+			age         sql.NullInt64
+			nationality sql.NullString
+			gender      sql.NullString
+		)
+		if err := rows.Scan(&result.ID, &result.Name, &result.Surname, &patronymic, &age, &nationality, &gender, &result.CreatedAt, &result.UpdatedAt, &result.Version, &result.Score); err != nil {
+			p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+			return nil, fmt.Errorf("repository search scan failed: %w", err)
+		}
+		result.Patronymic = patronymic.String
+		result.Age = age.Int64
+		result.Nationality = nationality.String
+		result.Gender = gender.String
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
+	}
+	p.logger.Info("Выполнен поиск людей", zap.Int("count", len(results)))
+	return results, nil
+}
+
+// GetNameStats - для каждого имени берется последняя обновленная запись с полностью заполненными данными обогащения.
+// Пагинация по имени (keyset), чтобы не сканировать таблицу через OFFSET.
+func (p *Postgres) GetNameStats(ctx context.Context, afterName string, limit int) ([]model.NameStats, error) {
+	query := `SELECT DISTINCT ON (name) name, age, gender, nationality FROM people WHERE name > $1 AND age IS NOT NULL AND gender IS NOT NULL AND nationality IS NOT NULL AND deleted_at IS NULL ORDER BY name, updated_at DESC LIMIT $2`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	rows, err := p.conn(ctx).QueryContext(ctx, query, afterName, limit)
+	if err != nil {
 		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
-		return nil ,err
+		return nil, err
 	}
 	defer rows.Close()
-	
-	persons := make([]model.Person, 0)
+
+	stats := make([]model.NameStats, 0, limit)
 	for rows.Next() {
-			person := model.Person{}
-			var age sql.NullInt64
-			var gender sql.NullString
-			var nationality sql.NullString
-			var patronymic sql.NullString
-
-			if err := rows.Scan(
-				&person.ID,
-				&person.Name,
-				&person.Surname,
-				&patronymic,
-				&age,
-				&gender,
-				&nationality,
-				&person.CreatedAt,
-				&person.UpdatedAt,
-			); err != nil {
-				p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
-				return nil, fmt.Errorf("repository find with filters scan failed: %w", err)
-			}
+		var s model.NameStats
+		if err := rows.Scan(&s.Name, &s.Age, &s.Gender, &s.Nationality); err != nil {
+			p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+			return nil, fmt.Errorf("repository name stats scan failed: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
+	}
+	p.logger.Debug("Получены данные обогащения по именам", zap.Int("count", len(stats)))
+	return stats, nil
+}
 
-			if patronymic.Valid {
-				person.Patronymic = patronymic.String
-			}
-			if age.Valid {
-				person.Age = age.Int64
-			}
-			if gender.Valid {
-				person.Gender = gender.String
-			}
-			if nationality.Valid {
-				person.Nationality = nationality.String
-			}
-			persons = append(persons, person)
+func (p *Postgres) RestorePersonByID(ctx context.Context, id int) error {
+	query := `UPDATE people SET deleted_at = NULL, updated_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NOT NULL`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции при восстановлении", zap.Error(err))
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	before, err := p.lockPerson(ctx, tx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && before.DeletedAt == nil) {
+		p.logger.Debug("Нечего восстанавливать", zap.Int("id", id))
+		return customerrors.ErrNothingToRestore
+	}
+	if err != nil {
+		p.logger.Error("Ошибка получения записи перед восстановлением", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+
+	after := *before
+	after.DeletedAt = nil
+	after.UpdatedAt = time.Now()
+	if err = p.updateWithHistory(ctx, tx, query, []any{after.UpdatedAt, id}, model.HistoryRestore, before, &after); err != nil {
+		p.logger.Error("Ошибка выполнения запроса при восстановлении", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после восстановления", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+	p.logger.Info("Успешно восстановлен пользователь", zap.Int("id", id))
+	return nil
+}
+
+// GetDeletedPersons - limit = 0 означает без ограничения
+func (p *Postgres) GetDeletedPersons(ctx context.Context, offset, limit int) ([]model.Person, error) {
+	query := `SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version, deleted_at FROM people WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id LIMIT $1 OFFSET $2`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	// NULL в LIMIT означает без ограничения
+	lim := sql.NullInt64{Int64: int64(limit), Valid: limit > 0}
+	rows, err := p.conn(ctx).QueryContext(ctx, query, lim, offset)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	persons := make([]model.Person, 0)
+	for rows.Next() {
+		var (
+			person      model.Person
+			patronymic  sql.NullString
+			age         sql.NullInt64
+			nationality sql.NullString
+			gender      sql.NullString
+			deletedAt   time.Time
+		)
+		if err := rows.Scan(&person.ID, &person.Name, &person.Surname, &patronymic, &age, &nationality, &gender, &person.CreatedAt, &person.UpdatedAt, &person.Version, &deletedAt); err != nil {
+			p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+			return nil, fmt.Errorf("repository deleted persons scan failed: %w", err)
 		}
+		person.Patronymic = patronymic.String
+		person.Age = age.Int64
+		person.Nationality = nationality.String
+		person.Gender = gender.String
+		person.DeletedAt = &deletedAt
+		persons = append(persons, person)
+	}
 	if err := rows.Err(); err != nil {
 		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
 		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
 	}
-	p.logger.Info("Получены записи из таблицы person", zap.String("count", strconv.Itoa(len(persons))))
 	return persons, nil
 }
 
-func appendArgs(args []interface{}, person model.Person) []interface{} {
-	args = append(args, person.Name , person.Surname, person.Patronymic,person.Age,person.Nationality,person.Gender)
-	return args
+// PurgeDeleted - вместе с записями удаляется и их история
+// purgeMergesQuery - записи о слияниях, в которых участвует очищаемая запись
+const purgeMergesQuery = `DELETE FROM person_merges WHERE survivor_id IN (SELECT id FROM people WHERE deleted_at IS NOT NULL AND deleted_at < $1)
+	OR merged_id IN (SELECT id FROM people WHERE deleted_at IS NOT NULL AND deleted_at < $1)`
+
+func (p *Postgres) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции при очистке", zap.Error(err))
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM people_history WHERE person_id IN (SELECT id FROM people WHERE deleted_at IS NOT NULL AND deleted_at < $1)`, before)
+	if err != nil {
+		p.logger.Error("Ошибка очистки истории удаленных записей", zap.Error(err))
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, purgeMergesQuery, before)
+	if err != nil {
+		p.logger.Error("Ошибка очистки слияний удаленных записей", zap.Error(err))
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM people WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+	if err != nil {
+		p.logger.Error("Ошибка очистки удаленных записей", zap.Error(err))
+		return 0, err
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		p.logger.Error("Ошибка получения RowsAffected после очистки", zap.Error(err))
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после очистки", zap.Error(err))
+		return 0, err
+	}
+	return purged, nil
+}
+
+func (p *Postgres) GetPersonHistory(ctx context.Context, id int) ([]model.PersonHistory, error) {
+	query := `SELECT version, action, before_data, after_data, actor, changed_at FROM people_history WHERE person_id = $1 ORDER BY version`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	rows, err := p.conn(ctx).QueryContext(ctx, query, id)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]model.PersonHistory, 0)
+	for rows.Next() {
+		entry := model.PersonHistory{PersonID: id}
+		var before, after sql.NullString
+		if err := rows.Scan(&entry.Version, &entry.Action, &before, &after, &entry.Actor, &entry.ChangedAt); err != nil {
+			p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+			return nil, fmt.Errorf("repository history scan failed: %w", err)
+		}
+		if entry.Before, err = fromSnapshot(before); err != nil {
+			return nil, err
+		}
+		if entry.After, err = fromSnapshot(after); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
+	}
+	return history, nil
+}
+
+func (p *Postgres) RevertPerson(ctx context.Context, id, version int) (*model.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции при откате", zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var data sql.NullString
+	err = tx.QueryRowContext(ctx, `SELECT after_data FROM people_history WHERE person_id = $1 AND version = $2`, id, version).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, customerrors.ErrVersionNotFound
+	}
+	if err != nil {
+		p.logger.Error("Ошибка получения версии", zap.Int("id", id), zap.Int("version", version), zap.Error(err))
+		return nil, err
+	}
+	target, err := fromSnapshot(data)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, customerrors.ErrVersionNotFound
+	}
+
+	person := &model.Person{
+		ID:          id,
+		Name:        target.Name,
+		Surname:     target.Surname,
+		Patronymic:  target.Patronymic,
+		Age:         target.Age,
+		Nationality: target.Nationality,
+		Gender:      target.Gender,
+	}
+	if err = p.updateTx(ctx, tx, person, model.HistoryRevert); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после отката", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	p.logger.Info("Данные пользователя возвращены к версии", zap.Int("id", id), zap.Int("version", version))
+	return person, nil
+}
+
+// dupKey - ФИО без регистра и знаков для отбора кандидатов в дубликаты. Ключ грубее dedup.Key
+// (слова склеиваются), поэтому кандидаты не теряются, а окончательно группы собирает dedup.Group
+const dupKey = `translate(regexp_replace(lower(name), '[^[:alnum:]]+', '', 'g'), 'ё', 'е'),
+	translate(regexp_replace(lower(surname), '[^[:alnum:]]+', '', 'g'), 'ё', 'е'),
+	translate(regexp_replace(lower(COALESCE(patronymic, '')), '[^[:alnum:]]+', '', 'g'), 'ё', 'е')`
+
+// FindDuplicates - в базе выбираются записи, у которых есть однофамильцы с тем же именем и отчеством,
+// группы с учетом демографии собираются в dedup.Group. limit = 0 означает без ограничения
+func (p *Postgres) FindDuplicates(ctx context.Context, limit int) ([]model.DuplicateGroup, error) {
+	query := `SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version FROM (
+		SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version,
+			COUNT(*) OVER (PARTITION BY ` + dupKey + `) AS namesakes
+		FROM people WHERE deleted_at IS NULL) candidates WHERE namesakes > 1 ORDER BY id`
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	rows, err := p.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	persons := make([]model.Person, 0)
+	for rows.Next() {
+		var (
+			person      model.Person
+			patronymic  sql.NullString
+			age         sql.NullInt64
+			nationality sql.NullString
+			gender      sql.NullString
+		)
+		if err := rows.Scan(&person.ID, &person.Name, &person.Surname, &patronymic, &age, &nationality, &gender, &person.CreatedAt, &person.UpdatedAt, &person.Version); err != nil {
+			p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+			return nil, fmt.Errorf("repository duplicates scan failed: %w", err)
+		}
+		person.Patronymic = patronymic.String
+		person.Age = age.Int64
+		person.Nationality = nationality.String
+		person.Gender = gender.String
+		persons = append(persons, person)
+	}
+	if err := rows.Err(); err != nil {
+		p.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
+	}
+	groups := dedup.Group(persons, limit)
+	p.logger.Info("Найдены группы дубликатов", zap.Int("candidates", len(persons)), zap.Int("groups", len(groups)))
+	return groups, nil
+}
+
+// MergePersons - записи блокируются по возрастанию ID, чтобы встречные слияния не взаимоблокировались.
+// Дубликаты удаляются мягко, прежние слияния в них переводятся на survivor, чтобы старый ID вел на живую запись
+func (p *Postgres) MergePersons(ctx context.Context, ids []int, survivorID int) (*model.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	tx, err := p.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции при слиянии", zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	persons := make([]model.Person, 0, len(ids))
+	for _, id := range ids {
+		person, err := p.lockPerson(ctx, tx, id)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && person.DeletedAt != nil) {
+			p.logger.Debug("Нечего объединять", zap.Int("id", id))
+			return nil, customerrors.ErrNothingToMerge
+		}
+		if err != nil {
+			p.logger.Error("Ошибка получения записи перед слиянием", zap.Int("id", id), zap.Error(err))
+			return nil, err
+		}
+		persons = append(persons, *person)
+	}
+	survivor, duplicates, ok := dedup.Split(persons, survivorID)
+	if !ok {
+		return nil, customerrors.ErrNothingToMerge
+	}
+
+	merged := dedup.Merge(survivor, duplicates)
+	if err = p.updateTx(ctx, tx, &merged, model.HistoryMerge); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	mergedIDs := make([]int, 0, len(duplicates))
+	for _, before := range duplicates {
+		after := before
+		after.DeletedAt = &now
+		if err = p.updateWithHistory(ctx, tx, `UPDATE people SET deleted_at = $1, version = version + 1 WHERE id = $2`, []any{now, before.ID}, model.HistoryMerge, &before, &after); err != nil {
+			p.logger.Error("Ошибка удаления дубликата при слиянии", zap.Int("id", before.ID), zap.Error(err))
+			return nil, err
+		}
+		mergedIDs = append(mergedIDs, before.ID)
+	}
+
+	// survivor мог быть раньше слит и восстановлен - его старая запись о слиянии больше не нужна
+	if _, err = tx.ExecContext(ctx, `DELETE FROM person_merges WHERE merged_id = $1`, survivor.ID); err != nil {
+		p.logger.Error("Ошибка записи слияния", zap.Int("id", survivor.ID), zap.Error(err))
+		return nil, err
+	}
+	if _, err = tx.ExecContext(ctx, `UPDATE person_merges SET survivor_id = $1 WHERE survivor_id = ANY($2)`, survivor.ID, pq.Array(mergedIDs)); err != nil {
+		p.logger.Error("Ошибка записи слияния", zap.Int("id", survivor.ID), zap.Error(err))
+		return nil, err
+	}
+	query := `INSERT INTO person_merges (merged_id, survivor_id, actor, merged_at) SELECT unnest($1::int[]), $2, $3, $4
+		ON CONFLICT (merged_id) DO UPDATE SET survivor_id = EXCLUDED.survivor_id, actor = EXCLUDED.actor, merged_at = EXCLUDED.merged_at`
+	if _, err = tx.ExecContext(ctx, query, pq.Array(mergedIDs), survivor.ID, actor.FromContext(ctx), now); err != nil {
+		p.logger.Error("Ошибка записи слияния", zap.Int("id", survivor.ID), zap.Error(err))
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		p.logger.Error("Ошибка коммита транзакции после слияния", zap.Int("id", survivor.ID), zap.Error(err))
+		return nil, err
+	}
+	p.logger.Info("Записи объединены", zap.Int("id", survivor.ID), zap.Ints("merged", mergedIDs))
+	return &merged, nil
+}
+
+// ResolveMergedID - ID записи, в которую был слит id, ErrPersonNotFound если id не сливался
+func (p *Postgres) ResolveMergedID(ctx context.Context, id int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var survivorID int
+	err := p.conn(ctx).QueryRowContext(ctx, `SELECT survivor_id FROM person_merges WHERE merged_id = $1`, id).Scan(&survivorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, customerrors.ErrPersonNotFound
+	}
+	if err != nil {
+		p.logger.Error("Ошибка получения записи о слиянии", zap.Int("id", id), zap.Error(err))
+		return 0, err
+	}
+	return survivorID, nil
 }
 
+// lockPerson - читает запись, в том числе удаленную, и блокирует ее до конца транзакции
+func (p *Postgres) lockPerson(ctx context.Context, tx *txn, id int) (*model.Person, error) {
+	query := `SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version, deleted_at FROM people WHERE id = $1 FOR UPDATE`
+	var (
+		person      model.Person
+		patronymic  sql.NullString
+		age         sql.NullInt64
+		nationality sql.NullString
+		gender      sql.NullString
+		deletedAt   sql.NullTime
+	)
+	err := tx.QueryRowContext(ctx, query, id).Scan(&person.ID, &person.Name, &person.Surname, &patronymic, &age, &nationality, &gender, &person.CreatedAt, &person.UpdatedAt, &person.Version, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	person.Patronymic = patronymic.String
+	person.Age = age.Int64
+	person.Nationality = nationality.String
+	person.Gender = gender.String
+	if deletedAt.Valid {
+		person.DeletedAt = &deletedAt.Time
+	}
+	return &person, nil
+}
+
+// historyReturning и outboxFromHistory - продолжение CTE history с INSERT в people_history: те же строки
+// пишутся событиями в outbox тем же запросом, то есть в транзакции самого изменения
+const (
+	historyReturning  = `RETURNING person_id, version, action, before_data, after_data, actor, changed_at`
+	outboxFromHistory = `INSERT INTO outbox (person_id, version, action, before_data, after_data, actor, occurred_at)
+		SELECT person_id, version, action, before_data, after_data, actor, changed_at FROM history`
+)
+
+// insertHistoryQuery - запись создания и события о нем: person_id, version, action, before_data, after_data, actor, changed_at
+const insertHistoryQuery = `WITH history AS (INSERT INTO people_history (person_id, version, action, before_data, after_data, actor, changed_at) VALUES ($1, $2, $3, $4, $5, $6, $7) ` +
+	historyReturning + `) ` + outboxFromHistory
+
+// updateHistoryQuery - UPDATE people из update с n параметрами, запись изменения и событие о нем одним запросом.
+// Версия истории и снимка after берется из RETURNING обновленной строки, поэтому совпадает с people.version и для
+// записей, созданных до появления истории. Параметры после параметров update: action, before_data, after_data, actor,
+// changed_at. Если UPDATE не изменил строку, запрос не возвращает строк
+func updateHistoryQuery(update string, n int) string {
+	arg := func(i int) string {
+		return "$" + strconv.Itoa(n+i)
+	}
+	return `WITH updated AS (` + update + ` RETURNING id, version),
+		history AS (INSERT INTO people_history (person_id, version, action, before_data, after_data, actor, changed_at)
+			SELECT id, version, ` + arg(1) + `::varchar, ` + arg(2) + `::jsonb, jsonb_set(` + arg(3) + `::jsonb, '{version}', to_jsonb(version)), ` +
+		arg(4) + `::varchar, ` + arg(5) + `::timestamp FROM updated ` + historyReturning + `)
+		` + outboxFromHistory + ` RETURNING version`
+}
+
+// copyOutboxQuery - события о создании записей $1, история которых записана через COPY
+const copyOutboxQuery = `INSERT INTO outbox (person_id, version, action, before_data, after_data, actor, occurred_at)
+	SELECT person_id, version, action, before_data, after_data, actor, changed_at FROM people_history WHERE person_id = ANY($1) AND version = 1 ORDER BY person_id`
+
+// updateWithHistory - выполняет update с args и пишет изменение в историю и outbox тем же запросом (updateHistoryQuery).
+// after.Version - версия из RETURNING, sql.ErrNoRows - UPDATE не нашел строку
+func (p *Postgres) updateWithHistory(ctx context.Context, tx *txn, update string, args []any, action string, before, after *model.Person) error {
+	beforeData, err := toSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterData, err := toSnapshot(after)
+	if err != nil {
+		return err
+	}
+	n := len(args)
+	args = append(args, action, beforeData, afterData, actor.FromContext(ctx), time.Now())
+	return tx.QueryRowContext(ctx, updateHistoryQuery(update, n), args...).Scan(&after.Version)
+}
+
+// insertHistory - пишет создание в people_history и событие в outbox в транзакции самого изменения
+func (p *Postgres) insertHistory(ctx context.Context, tx *txn, action string, before, after *model.Person) error {
+	query := insertHistoryQuery
+
+	beforeData, err := toSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterData, err := toSnapshot(after)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, query, after.ID, after.Version, action, beforeData, afterData, actor.FromContext(ctx), time.Now()); err != nil {
+		p.logger.Error("Ошибка записи истории изменений", zap.Int("id", after.ID), zap.String("action", action), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func toSnapshot(person *model.Person) (sql.NullString, error) {
+	if person == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(person)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("history snapshot marshal failed: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func fromSnapshot(data sql.NullString) (*model.Person, error) {
+	if !data.Valid {
+		return nil, nil
+	}
+	var person model.Person
+	if err := json.Unmarshal([]byte(data.String), &person); err != nil {
+		return nil, fmt.Errorf("history snapshot unmarshal failed: %w", err)
+	}
+	return &person, nil
+}
@@ -3,12 +3,17 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"net"
 	"regexp"
 	"testing"
 	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/nikita89756/testEffectiveMobile/internal/actor"
+	"github.com/nikita89756/testEffectiveMobile/internal/consistency"
 	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
 	"github.com/nikita89756/testEffectiveMobile/internal/model"
 	"github.com/stretchr/testify/assert"
@@ -16,6 +21,29 @@ import (
 	"go.uber.org/zap"
 )
 
+var lockQuery = regexp.QuoteMeta(`SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version, deleted_at FROM people WHERE id = $1 FOR UPDATE`)
+
+// expectLock - чтение и блокировка записи перед изменением
+func expectLock(mock sqlmock.Sqlmock, id int, deleted bool) {
+	var deletedAt interface{}
+	if deleted {
+		deletedAt = time.Now()
+	}
+	rows := sqlmock.NewRows([]string{"id", "name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version", "deleted_at"}).
+		AddRow(id, "John", "Doe", "Smith", 30, "USA", "male", time.Now(), time.Now(), 1, deletedAt)
+	mock.ExpectQuery(lockQuery).WithArgs(id).WillReturnRows(rows)
+}
+
+// withHistory - аргументы UPDATE вместе с аргументами записи истории в том же запросе
+func withHistory(action string, args ...driver.Value) []driver.Value {
+	return append(args, action, sqlmock.AnyArg(), sqlmock.AnyArg(), "system", sqlmock.AnyArg())
+}
+
+// versionRows - версия, которую возвращает UPDATE ... RETURNING version
+func versionRows(version int) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"version"}).AddRow(version)
+}
+
 func TestCreatePerson(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -81,6 +109,7 @@ func TestCreatePerson(t *testing.T) {
 						sqlmock.AnyArg(),         
 						sqlmock.AnyArg(),         
 					).WillReturnRows(rows)
+				mock.ExpectExec("INSERT INTO people_history").WillReturnResult(sqlmock.NewResult(1, 1))
 
 				mock.ExpectCommit() 
 			},
@@ -143,6 +172,7 @@ func TestCreatePerson(t *testing.T) {
 							expectedAge, expectedNationality, expectedGender,
 							sqlmock.AnyArg(), sqlmock.AnyArg(),
 						).WillReturnRows(rows)
+					mock.ExpectExec("INSERT INTO people_history").WillReturnResult(sqlmock.NewResult(1, 1))
 
 					mock.ExpectCommit().WillReturnError(sql.ErrTxDone) 
 
@@ -190,9 +220,10 @@ func TestGetPersonByID(t *testing.T) {
 		Gender:      "female",
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Version:     2,
 	}
 
-	selectCols := []string{"name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at"}
+	selectCols := []string{"name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version"}
 
 	type args struct {
 		ctx context.Context
@@ -224,9 +255,10 @@ func TestGetPersonByID(t *testing.T) {
 						sql.NullString{String: expectedPerson.Gender, Valid: expectedPerson.Gender != ""},
 						expectedPerson.CreatedAt,
 						expectedPerson.UpdatedAt,
+						expectedPerson.Version,
 					)
 
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT name,surname,patronymic, age ,nationality,gender,created_at,updated_at FROM people WHERE id = $1`)).WithArgs(args.id).WillReturnRows(rows)
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT name,surname,patronymic, age ,nationality,gender,created_at,updated_at,version FROM people WHERE id = $1 AND deleted_at IS NULL`)).WithArgs(args.id).WillReturnRows(rows)
 			},
 			want:    expectedPerson,
 			wantErr: nil,
@@ -238,7 +270,7 @@ func TestGetPersonByID(t *testing.T) {
 				id:  testID + 1, 
 			},
 			mockBehavior: func(mock sqlmock.Sqlmock, args args) {
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT name,surname,patronymic, age ,nationality,gender,created_at,updated_at FROM people WHERE id = $1`)).
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT name,surname,patronymic, age ,nationality,gender,created_at,updated_at,version FROM people WHERE id = $1 AND deleted_at IS NULL`)).
 					WithArgs(args.id).
 					WillReturnError(sql.ErrNoRows) 
 			},
@@ -253,7 +285,7 @@ func TestGetPersonByID(t *testing.T) {
 				id:  testID,
 			},
 			mockBehavior: func(mock sqlmock.Sqlmock, args args) {
-				mock.ExpectQuery(regexp.QuoteMeta(`SELECT name,surname,patronymic, age ,nationality,gender,created_at,updated_at FROM people WHERE id = $1`)).
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT name,surname,patronymic, age ,nationality,gender,created_at,updated_at,version FROM people WHERE id = $1 AND deleted_at IS NULL`)).
 					WithArgs(args.id).
 					WillReturnError(errors.New("db query error")) 
 			},
@@ -313,7 +345,8 @@ func TestDeletePersonByID(t *testing.T) {
 			},
 			mockBehavior: func(args args) {
 				mock.ExpectBegin() 
-				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM people WHERE id = $1")).WithArgs(args.id).WillReturnResult(sqlmock.NewResult(0, 1)) 
+				expectLock(mock, args.id, false) 
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE people SET deleted_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NULL")).WithArgs(withHistory(model.HistoryDelete, sqlmock.AnyArg(), args.id)...).WillReturnRows(versionRows(2))
 
 				mock.ExpectCommit()
 			},
@@ -329,7 +362,7 @@ func TestDeletePersonByID(t *testing.T) {
 			mockBehavior: func(args args) {
 				mock.ExpectBegin()
 
-				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM people WHERE id = $1")).WithArgs(args.id).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(lockQuery).WithArgs(args.id).WillReturnError(sql.ErrNoRows)
 				mock.ExpectRollback()
 			},
 			wantErr:       true,
@@ -343,8 +376,9 @@ func TestDeletePersonByID(t *testing.T) {
 			},
 			mockBehavior: func(args args) {
 				mock.ExpectBegin()
+				expectLock(mock, args.id, false)
 
-				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM people WHERE id = $1")).WithArgs(args.id).WillReturnError(sql.ErrConnDone)
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE people SET deleted_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NULL")).WithArgs(withHistory(model.HistoryDelete, sqlmock.AnyArg(), args.id)...).WillReturnError(sql.ErrConnDone)
 
 				mock.ExpectRollback()
 			},
@@ -359,8 +393,9 @@ func TestDeletePersonByID(t *testing.T) {
 			},
 			mockBehavior: func(args args) {
 				mock.ExpectBegin()
+				expectLock(mock, args.id, false)
 
-				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM people WHERE id = $1")).WithArgs(args.id).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE people SET deleted_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NULL")).WithArgs(withHistory(model.HistoryDelete, sqlmock.AnyArg(), args.id)...).WillReturnRows(versionRows(2))
 
 				mock.ExpectCommit().WillReturnError(sql.ErrTxDone)
 
@@ -443,14 +478,15 @@ func TestUpdatePersonByID(t *testing.T) {
 			},
 			mockBehavior: func(args args) {
 				mock.ExpectBegin()
+				expectLock(mock, args.person.ID, false)
 
 				expectedAge := sql.NullInt64{Valid: args.person.Age != 0, Int64: int64(args.person.Age)}
 				expectedNationality := sql.NullString{Valid: args.person.Nationality != "", String: args.person.Nationality}
 				expectedGender := sql.NullString{Valid: args.person.Gender != "", String: args.person.Gender}
 
-				query := regexp.QuoteMeta("UPDATE people SET name = $1, surname = $2, patronymic = $3, age = $4, nationality = $5, gender = $6, updated_at = $7 WHERE id = $8")
-				mock.ExpectExec(query).
-					WithArgs(
+				query := regexp.QuoteMeta("UPDATE people SET name = $1, surname = $2, patronymic = $3, age = $4, nationality = $5, gender = $6, updated_at = $7, version = version + 1 WHERE id = $8 AND deleted_at IS NULL AND version = $9")
+				mock.ExpectQuery(query).
+					WithArgs(withHistory(model.HistoryUpdate,
 						args.person.Name,
 						args.person.Surname,
 						args.person.Patronymic,
@@ -459,8 +495,9 @@ func TestUpdatePersonByID(t *testing.T) {
 						expectedGender,
 						sqlmock.AnyArg(),
 						args.person.ID,
-					).
-					WillReturnResult(sqlmock.NewResult(0, 1))
+						1,
+					)...).
+					WillReturnRows(versionRows(2))
 
 				mock.ExpectCommit()
 			},
@@ -483,19 +520,7 @@ func TestUpdatePersonByID(t *testing.T) {
 			mockBehavior: func(args args) {
 				mock.ExpectBegin()
 
-				expectedAge := sql.NullInt64{Valid: args.person.Age != 0, Int64: int64(args.person.Age)}
-				expectedNationality := sql.NullString{Valid: args.person.Nationality != "", String: args.person.Nationality}
-				expectedGender := sql.NullString{Valid: args.person.Gender != "", String: args.person.Gender}
-
-				query := regexp.QuoteMeta("UPDATE people SET name = $1, surname = $2, patronymic = $3, age = $4, nationality = $5, gender = $6, updated_at = $7 WHERE id = $8")
-				mock.ExpectExec(query).
-					WithArgs(
-						args.person.Name, args.person.Surname, args.person.Patronymic,
-						expectedAge, expectedNationality, expectedGender,
-						sqlmock.AnyArg(),
-						args.person.ID,
-					).
-					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(lockQuery).WithArgs(args.person.ID).WillReturnError(sql.ErrNoRows)
 
 				mock.ExpectRollback()
 			},
@@ -510,18 +535,19 @@ func TestUpdatePersonByID(t *testing.T) {
 			},
 			mockBehavior: func(args args) {
 				mock.ExpectBegin()
+				expectLock(mock, args.person.ID, false)
 
 				expectedAge := sql.NullInt64{Valid: args.person.Age != 0, Int64: int64(args.person.Age)}
 				expectedNationality := sql.NullString{Valid: args.person.Nationality != "", String: args.person.Nationality}
 				expectedGender := sql.NullString{Valid: args.person.Gender != "", String: args.person.Gender}
 
-				query := regexp.QuoteMeta("UPDATE people SET name = $1, surname = $2, patronymic = $3, age = $4, nationality = $5, gender = $6, updated_at = $7 WHERE id = $8")
-				mock.ExpectExec(query).
-					WithArgs(
+				query := regexp.QuoteMeta("UPDATE people SET name = $1, surname = $2, patronymic = $3, age = $4, nationality = $5, gender = $6, updated_at = $7, version = version + 1 WHERE id = $8 AND deleted_at IS NULL AND version = $9")
+				mock.ExpectQuery(query).
+					WithArgs(withHistory(model.HistoryUpdate,
 						args.person.Name, args.person.Surname, args.person.Patronymic,
 						expectedAge, expectedNationality, expectedGender,
-						sqlmock.AnyArg(), args.person.ID,
-					).
+						sqlmock.AnyArg(), args.person.ID, 1,
+					)...).
 					WillReturnError(sql.ErrConnDone)
 
 				mock.ExpectRollback()
@@ -529,34 +555,6 @@ func TestUpdatePersonByID(t *testing.T) {
 			wantErr:       true,
 			expectedError: sql.ErrConnDone,
 		},
-		{
-			name: "RowsAffected Error",
-			args: args{
-				ctx:    context.Background(),
-				person: basePerson,
-			},
-			mockBehavior: func(args args) {
-				mock.ExpectBegin()
-
-				expectedAge := sql.NullInt64{Valid: args.person.Age != 0, Int64: int64(args.person.Age)}
-				expectedNationality := sql.NullString{Valid: args.person.Nationality != "", String: args.person.Nationality}
-				expectedGender := sql.NullString{Valid: args.person.Gender != "", String: args.person.Gender}
-
-				query := regexp.QuoteMeta("UPDATE people SET name = $1, surname = $2, patronymic = $3, age = $4, nationality = $5, gender = $6, updated_at = $7 WHERE id = $8")
-
-				mock.ExpectExec(query).
-					WithArgs(
-						args.person.Name, args.person.Surname, args.person.Patronymic,
-						expectedAge, expectedNationality, expectedGender,
-						sqlmock.AnyArg(), args.person.ID,
-					).
-					WillReturnError(errors.New("simulated error before RowsAffected"))
-
-				mock.ExpectRollback()
-			},
-			wantErr:       true,
-			expectedError: errors.New("simulated error before RowsAffected"),
-		},
 		{
 			name: "Commit Error",
 			args: args{
@@ -565,19 +563,20 @@ func TestUpdatePersonByID(t *testing.T) {
 			},
 			mockBehavior: func(args args) {
 				mock.ExpectBegin()
+				expectLock(mock, args.person.ID, false)
 
 				expectedAge := sql.NullInt64{Valid: args.person.Age != 0, Int64: int64(args.person.Age)}
 				expectedNationality := sql.NullString{Valid: args.person.Nationality != "", String: args.person.Nationality}
 				expectedGender := sql.NullString{Valid: args.person.Gender != "", String: args.person.Gender}
 
-				query := regexp.QuoteMeta("UPDATE people SET name = $1, surname = $2, patronymic = $3, age = $4, nationality = $5, gender = $6, updated_at = $7 WHERE id = $8")
-				mock.ExpectExec(query).
-					WithArgs(
+				query := regexp.QuoteMeta("UPDATE people SET name = $1, surname = $2, patronymic = $3, age = $4, nationality = $5, gender = $6, updated_at = $7, version = version + 1 WHERE id = $8 AND deleted_at IS NULL AND version = $9")
+				mock.ExpectQuery(query).
+					WithArgs(withHistory(model.HistoryUpdate,
 						args.person.Name, args.person.Surname, args.person.Patronymic,
 						expectedAge, expectedNationality, expectedGender,
-						sqlmock.AnyArg(), args.person.ID,
-					).
-					WillReturnResult(sqlmock.NewResult(0, 1))
+						sqlmock.AnyArg(), args.person.ID, 1,
+					)...).
+					WillReturnRows(versionRows(2))
 
 				mock.ExpectCommit().WillReturnError(sql.ErrTxDone)
 
@@ -615,6 +614,7 @@ func TestUpdatePersonByID(t *testing.T) {
 				}
 			} else {
 				assert.NoError(t, err)
+				assert.Equal(t, 2, currentPerson.Version)
 			}
 
 			err = mock.ExpectationsWereMet()
@@ -624,3 +624,776 @@ func TestUpdatePersonByID(t *testing.T) {
 }
 
 
+
+func TestGetNameStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+
+	r := NewPostgres(db, zap.NewNop(), 1*time.Second)
+	query := regexp.QuoteMeta(`SELECT DISTINCT ON (name) name, age, gender, nationality FROM people WHERE name > $1 AND age IS NOT NULL AND gender IS NOT NULL AND nationality IS NOT NULL AND deleted_at IS NULL ORDER BY name, updated_at DESC LIMIT $2`)
+
+	t.Run("Success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"name", "age", "gender", "nationality"}).
+			AddRow("Anna", 25, "female", "RU").
+			AddRow("Ivan", 30, "male", "UA")
+		mock.ExpectQuery(query).WithArgs("", 2).WillReturnRows(rows)
+
+		got, err := r.GetNameStats(context.Background(), "", 2)
+		require.NoError(t, err)
+		assert.Equal(t, []model.NameStats{
+			{Name: "Anna", PersonStats: model.PersonStats{Age: 25, Gender: "female", Nationality: "RU"}},
+			{Name: "Ivan", PersonStats: model.PersonStats{Age: 30, Gender: "male", Nationality: "UA"}},
+		}, got)
+	})
+	t.Run("DB Error", func(t *testing.T) {
+		mock.ExpectQuery(query).WithArgs("Ivan", 2).WillReturnError(sql.ErrConnDone)
+
+		_, err := r.GetNameStats(context.Background(), "Ivan", 2)
+		assert.ErrorIs(t, err, sql.ErrConnDone)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestGetPersonsByFilter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+
+	r := NewPostgres(db, zap.NewNop(), 1*time.Second)
+	selectPeople := `SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version FROM people`
+	cols := []string{"id", "name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version"}
+	ageMin, ageMax := int64(25), int64(40)
+	after := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("No filter", func(t *testing.T) {
+		rows := sqlmock.NewRows(cols).AddRow(1, "Ivan", "Ivanov", nil, 30, "RU", "male", time.Now(), time.Now(), 2)
+		mock.ExpectQuery(regexp.QuoteMeta(selectPeople+` WHERE deleted_at IS NULL ORDER BY id LIMIT $1`)).
+			WithArgs(nil).WillReturnRows(rows)
+
+		got, err := r.GetPersonsByFilter(context.Background(), model.PersonFilter{}, nil, 0)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, "RU", got[0].Nationality)
+		assert.Equal(t, "male", got[0].Gender)
+		assert.Equal(t, 2, got[0].Version)
+	})
+	t.Run("All conditions", func(t *testing.T) {
+		filter := model.PersonFilter{
+			IDs:           []int{1, 2},
+			Nationalities: []string{"RU", "UA"},
+			SurnamePrefix: "Iv_%",
+			AgeMin:        &ageMin,
+			AgeMax:        &ageMax,
+			CreatedAfter:  &after,
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(selectPeople+` WHERE deleted_at IS NULL AND id = ANY($1) AND nationality = ANY($2) AND surname LIKE $3 AND age >= $4 AND age <= $5 AND created_at >= $6 ORDER BY id LIMIT $7`)).
+			WithArgs("{1,2}", "{\"RU\",\"UA\"}", `Iv\_\%%`, ageMin, ageMax, after, 10).
+			WillReturnRows(sqlmock.NewRows(cols))
+
+		got, err := r.GetPersonsByFilter(context.Background(), filter, nil, 10)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+	t.Run("Sorted after cursor", func(t *testing.T) {
+		filter := model.PersonFilter{Genders: []string{"female"}, Sort: []model.SortField{{Field: "surname"}, {Field: "age", Desc: true}, {Field: "password"}}}
+		cursor := &model.Cursor{Key: model.Person{ID: 7, Surname: "Petrova", Age: 30}}
+		mock.ExpectQuery(regexp.QuoteMeta(selectPeople+` WHERE deleted_at IS NULL AND gender = ANY($1) AND ((surname > $2) OR (surname = $2 AND COALESCE(age, 0) < $3) OR (surname = $2 AND COALESCE(age, 0) = $3 AND id > $4)) ORDER BY surname, COALESCE(age, 0) DESC, id LIMIT $5`)).
+			WithArgs(`{"female"}`, "Petrova", int64(30), 7, 10).
+			WillReturnRows(sqlmock.NewRows(cols))
+
+		_, err := r.GetPersonsByFilter(context.Background(), filter, cursor, 10)
+		require.NoError(t, err)
+	})
+	t.Run("Before cursor", func(t *testing.T) {
+		rows := sqlmock.NewRows(cols).
+			AddRow(4, "Ivan", "Ivanov", nil, nil, nil, nil, time.Now(), time.Now(), 1).
+			AddRow(3, "Anna", "Ivanova", nil, nil, nil, nil, time.Now(), time.Now(), 1)
+		mock.ExpectQuery(regexp.QuoteMeta(selectPeople+` WHERE deleted_at IS NULL AND ((id < $1)) ORDER BY id DESC LIMIT $2`)).
+			WithArgs(5, 2).WillReturnRows(rows)
+
+		got, err := r.GetPersonsByFilter(context.Background(), model.PersonFilter{}, &model.Cursor{Key: model.Person{ID: 5}, Backward: true}, 2)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, 3, got[0].ID)
+		assert.Equal(t, 4, got[1].ID)
+	})
+	t.Run("DB Error", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(selectPeople)).WillReturnError(sql.ErrConnDone)
+
+		_, err := r.GetPersonsByFilter(context.Background(), model.PersonFilter{Genders: []string{"female"}}, nil, 10)
+		assert.ErrorIs(t, err, sql.ErrConnDone)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestCountPersons(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+
+	r := NewPostgres(db, zap.NewNop(), 1*time.Second)
+	filter := model.PersonFilter{Genders: []string{"female"}}
+
+	t.Run("Exact", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM people WHERE deleted_at IS NULL AND gender = ANY($1)`)).
+			WithArgs(`{"female"}`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+
+		total, estimated, err := r.CountPersons(context.Background(), filter, false)
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), total)
+		assert.False(t, estimated)
+	})
+	t.Run("Estimate", func(t *testing.T) {
+		plan := `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "people", "Plan Rows": 1250}}]`
+		mock.ExpectQuery(regexp.QuoteMeta(`EXPLAIN (FORMAT JSON) SELECT 1 FROM people WHERE deleted_at IS NULL AND gender = ANY($1)`)).
+			WithArgs(`{"female"}`).WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow([]byte(plan)))
+
+		total, estimated, err := r.CountPersons(context.Background(), filter, true)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1250), total)
+		assert.True(t, estimated)
+	})
+	t.Run("Invalid plan", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`EXPLAIN (FORMAT JSON)`)).WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow([]byte(`[]`)))
+
+		_, _, err := r.CountPersons(context.Background(), model.PersonFilter{}, true)
+		assert.Error(t, err)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestSearchPersons(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+
+	r := NewPostgres(db, zap.NewNop(), 1*time.Second)
+	query := `FROM people, q\s+WHERE deleted_at IS NULL AND \(search_vector @@ q.ts OR name % \$1 .* ORDER BY score DESC, id LIMIT \$3 OFFSET \$4`
+
+	t.Run("Transliteration", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version", "score"}).
+			AddRow(2, "Иван", "Иванов", nil, 30, "RU", nil, time.Now(), time.Now(), 1, 1.06).
+			AddRow(1, "Anna", "Ivanova", "", nil, nil, "female", time.Now(), time.Now(), 3, 0.67)
+		mock.ExpectQuery(query).WithArgs("ivanov", "иванов", 10, 0).WillReturnRows(rows)
+
+		got, err := r.SearchPersons(context.Background(), " Ivanov ", 0, 10)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, "Иванов", got[0].Surname)
+		assert.Equal(t, int64(30), got[0].Age)
+		assert.Equal(t, 1.06, got[0].Score)
+		assert.Equal(t, "female", got[1].Gender)
+		assert.Equal(t, 3, got[1].Version)
+	})
+	t.Run("Without limit", func(t *testing.T) {
+		mock.ExpectQuery(query).WithArgs("42", "42", nil, 5).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		got, err := r.SearchPersons(context.Background(), "42", 5, 0)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+	t.Run("Empty query", func(t *testing.T) {
+		got, err := r.SearchPersons(context.Background(), " ", 0, 10)
+		require.NoError(t, err)
+		assert.Empty(t, got, "пустой запрос не идет в базу")
+	})
+	t.Run("DB Error", func(t *testing.T) {
+		mock.ExpectQuery(query).WillReturnError(sql.ErrConnDone)
+
+		_, err := r.SearchPersons(context.Background(), "Ivan", 0, 10)
+		assert.ErrorIs(t, err, sql.ErrConnDone)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestRestoreAndPurge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+
+	r := NewPostgres(db, zap.NewNop(), 1*time.Second)
+	restore := regexp.QuoteMeta(`UPDATE people SET deleted_at = NULL, updated_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NOT NULL`)
+
+	t.Run("Restore", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectLock(mock, 1, true)
+		mock.ExpectQuery(restore).WithArgs(withHistory(model.HistoryRestore, sqlmock.AnyArg(), 1)...).WillReturnRows(versionRows(2))
+		mock.ExpectCommit()
+		assert.NoError(t, r.RestorePersonByID(context.Background(), 1))
+	})
+	t.Run("Restore Not Deleted", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectLock(mock, 2, false)
+		mock.ExpectRollback()
+		assert.ErrorIs(t, r.RestorePersonByID(context.Background(), 2), customerrors.ErrNothingToRestore)
+	})
+	t.Run("Purge", func(t *testing.T) {
+		before := time.Now().Add(-time.Hour)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM people_history WHERE person_id IN`)).WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 5))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM person_merges WHERE survivor_id IN`)).WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM people WHERE deleted_at IS NOT NULL AND deleted_at < $1`)).WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectCommit()
+		purged, err := r.PurgeDeleted(context.Background(), before)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), purged)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestRevertPerson(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+
+	r := NewPostgres(db, zap.NewNop(), 1*time.Second)
+	version := regexp.QuoteMeta(`SELECT after_data FROM people_history WHERE person_id = $1 AND version = $2`)
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(version).WithArgs(1, 2).WillReturnRows(sqlmock.NewRows([]string{"after_data"}).AddRow(`{"id":1,"name":"Jane","surname":"Doe","age":25}`))
+		expectLock(mock, 1, false)
+		mock.ExpectQuery("UPDATE people SET name").WithArgs(withHistory(model.HistoryRevert, "Jane", "Doe", "", sql.NullInt64{Int64: 25, Valid: true}, sql.NullString{}, sql.NullString{}, sqlmock.AnyArg(), 1, 1)...).WillReturnRows(versionRows(2))
+		mock.ExpectCommit()
+
+		person, err := r.RevertPerson(context.Background(), 1, 2)
+		require.NoError(t, err)
+		assert.Equal(t, "Jane", person.Name)
+		assert.Equal(t, int64(25), person.Age)
+		assert.Equal(t, 2, person.Version)
+	})
+	t.Run("Version Not Found", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(version).WithArgs(1, 9).WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		_, err := r.RevertPerson(context.Background(), 1, 9)
+		assert.ErrorIs(t, err, customerrors.ErrVersionNotFound)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestUpdateVersionConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+
+	r := NewPostgres(db, zap.NewNop(), 1*time.Second)
+
+	t.Run("Stale Version", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectLock(mock, 1, false)
+		mock.ExpectRollback()
+
+		err := r.UpdatePersonByID(context.Background(), &model.Person{ID: 1, Name: "John", Surname: "Doe", Version: 5})
+		assert.ErrorIs(t, err, customerrors.ErrVersionConflict)
+	})
+	t.Run("Compare And Swap Failed", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectLock(mock, 1, false)
+		mock.ExpectQuery("UPDATE people SET name").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+		mock.ExpectRollback()
+
+		err := r.UpdatePersonByID(context.Background(), &model.Person{ID: 1, Name: "John", Surname: "Doe", Version: 1})
+		assert.ErrorIs(t, err, customerrors.ErrVersionConflict)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestBulkCreatePersons(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+
+	r := NewPostgres(db, zap.NewNop(), 1*time.Second)
+	reserve := regexp.QuoteMeta(`SELECT nextval(pg_get_serial_sequence('people', 'id')) FROM generate_series(1, $1)`)
+	ok := sqlmock.NewResult(0, 1)
+	newPersons := func() []model.Person {
+		return []model.Person{
+			{Name: "Ivan", Surname: "Ivanov", Age: 30, Nationality: "RU"},
+			{Name: "Anna", Surname: "Ivanova", Gender: "unknown"},
+			{Name: "Olga", Surname: "Petrova", Gender: "female"},
+		}
+	}
+
+	t.Run("COPY", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(reserve).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(5).AddRow(6))
+		people := mock.ExpectPrepare(regexp.QuoteMeta(`COPY "people" ("id", "name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version") FROM STDIN`))
+		people.ExpectExec().WithArgs(5, "Ivan", "Ivanov", "", int64(30), "RU", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), 1).WillReturnResult(ok)
+		people.ExpectExec().WithArgs(6, "Olga", "Petrova", "", nil, nil, "female", sqlmock.AnyArg(), sqlmock.AnyArg(), 1).WillReturnResult(ok)
+		people.ExpectExec().WillReturnResult(ok)
+		history := mock.ExpectPrepare(regexp.QuoteMeta(`COPY "people_history"`))
+		history.ExpectExec().WithArgs(5, 1, model.HistoryCreate, sqlmock.AnyArg(), actor.System, sqlmock.AnyArg()).WillReturnResult(ok)
+		history.ExpectExec().WithArgs(6, 1, model.HistoryCreate, sqlmock.AnyArg(), actor.System, sqlmock.AnyArg()).WillReturnResult(ok)
+		history.ExpectExec().WillReturnResult(ok)
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox")).WithArgs("{5,6}").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		persons := newPersons()
+		result, err := r.BulkCreatePersons(context.Background(), persons, false)
+		require.NoError(t, err)
+		assert.Equal(t, []int{5, 0, 6}, result.IDs)
+		assert.Equal(t, 2, result.Created)
+		require.Len(t, result.Errors, 1)
+		assert.Equal(t, 1, result.Errors[0].Index)
+		assert.Equal(t, 6, persons[2].ID)
+	})
+	t.Run("Fallback to INSERT", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(reserve).WillReturnError(errors.New("COPY is not supported"))
+		mock.ExpectRollback()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT bulk_chunk").WillReturnResult(ok)
+		mock.ExpectQuery(reserve).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(7).AddRow(8))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO people (id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10), ($11,`)).
+			WillReturnError(errors.New("value too long"))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT bulk_chunk").WillReturnResult(ok)
+
+		mock.ExpectExec("SAVEPOINT bulk_chunk").WillReturnResult(ok)
+		mock.ExpectQuery(reserve).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(9))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO people (id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`)).
+			WithArgs(9, "Ivan", "Ivanov", "", int64(30), "RU", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), 1).WillReturnResult(ok)
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO people_history (person_id, version, action, after_data, actor, changed_at) VALUES ($1, 1, $2, $3, $4, $5)`)).
+			WithArgs(9, model.HistoryCreate, sqlmock.AnyArg(), actor.System, sqlmock.AnyArg()).WillReturnResult(ok)
+		mock.ExpectExec("RELEASE SAVEPOINT bulk_chunk").WillReturnResult(ok)
+
+		mock.ExpectExec("SAVEPOINT bulk_chunk").WillReturnResult(ok)
+		mock.ExpectQuery(reserve).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(10))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO people (`)).WillReturnError(errors.New("value too long"))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT bulk_chunk").WillReturnResult(ok)
+		mock.ExpectCommit()
+
+		persons := newPersons()
+		result, err := r.BulkCreatePersons(context.Background(), persons, false)
+		require.NoError(t, err)
+		assert.Equal(t, []int{9, 0, 0}, result.IDs)
+		assert.Equal(t, 1, result.Created)
+		require.Len(t, result.Errors, 2)
+		assert.Equal(t, 2, result.Errors[1].Index)
+		assert.Equal(t, 0, persons[2].ID)
+	})
+	t.Run("Atomic with invalid row", func(t *testing.T) {
+		result, err := r.BulkCreatePersons(context.Background(), newPersons(), true)
+		assert.ErrorIs(t, err, customerrors.ErrBulkRejected)
+		assert.Equal(t, 0, result.Created)
+	})
+	t.Run("Atomic COPY error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(reserve).WithArgs(1).WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
+
+		result, err := r.BulkCreatePersons(context.Background(), newPersons()[:1], true)
+		assert.ErrorIs(t, err, sql.ErrConnDone)
+		assert.Equal(t, []int{0}, result.IDs)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestGetDemographics(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+
+	r := NewPostgres(db, zap.NewNop(), 1*time.Second)
+	filter := model.PersonFilter{Nationalities: []string{"RU", "KZ"}}
+	where := ` FROM people WHERE deleted_at IS NULL AND nationality = ANY($1)`
+	countCols := []string{"value", "count"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`COUNT(*) FILTER (WHERE age IS NOT NULL AND gender IS NOT NULL AND nationality IS NOT NULL)`+where)).
+		WithArgs(`{"RU","KZ"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "age", "gender", "nationality", "complete"}).AddRow(3, 2, 3, 3, 2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(gender, ''), COUNT(*)`+where+` GROUP BY 1 ORDER BY 2 DESC, COALESCE(gender, '') COLLATE "C"`)).
+		WillReturnRows(sqlmock.NewRows(countCols).AddRow("female", 2).AddRow("male", 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(nationality, ''), COUNT(*)`+where)).
+		WillReturnRows(sqlmock.NewRows(countCols).AddRow("RU", 2).AddRow("KZ", 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT name, COUNT(*)`+where+` GROUP BY 1 ORDER BY 2 DESC, name COLLATE "C" LIMIT $2`)).
+		WithArgs(`{"RU","KZ"}`, 5).
+		WillReturnRows(sqlmock.NewRows(countCols).AddRow("Anna", 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT surname, COUNT(*)`+where)).
+		WillReturnRows(sqlmock.NewRows(countCols).AddRow("Ivanova", 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT age / $2, COUNT(*)`+where+` AND age IS NOT NULL GROUP BY 1 ORDER BY 1`)).
+		WithArgs(`{"RU","KZ"}`, int64(20)).
+		WillReturnRows(sqlmock.NewRows([]string{"bucket", "count"}).AddRow(1, 2))
+	mock.ExpectRollback()
+
+	stats, err := r.GetDemographics(context.Background(), filter, model.DemographicsOptions{BucketWidth: 20, Top: 5})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Total)
+	assert.Equal(t, model.Coverage{Age: 66.7, Gender: 100, Nationality: 100, Complete: 66.7}, stats.Coverage)
+	assert.Equal(t, []model.ValueCount{{Value: "female", Count: 2}, {Value: "male", Count: 1}}, stats.Genders)
+	assert.Equal(t, []model.AgeBucket{{From: 20, To: 39, Count: 2}}, stats.AgeBuckets)
+
+	mock.ExpectBegin().WillReturnError(sql.ErrConnDone)
+	_, err = r.GetDemographics(context.Background(), filter, model.DemographicsOptions{BucketWidth: 20, Top: 5})
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestGetPersonFacets(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+
+	r := NewPostgres(db, zap.NewNop(), 1*time.Second)
+	filter := model.PersonFilter{SurnamePrefix: "Iv"}
+	countCols := []string{"value", "count"}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT gender, COUNT(*) FROM people WHERE deleted_at IS NULL AND surname LIKE $1 AND gender IS NOT NULL GROUP BY 1 ORDER BY 2 DESC, gender COLLATE "C"`)).
+		WithArgs("Iv%").
+		WillReturnRows(sqlmock.NewRows(countCols).AddRow("male", 3).AddRow("female", 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT age / $2, COUNT(*) FROM people WHERE deleted_at IS NULL AND surname LIKE $1 AND age IS NOT NULL GROUP BY 1 ORDER BY 1`)).
+		WithArgs("Iv%", int64(model.FacetAgeBucketWidth)).
+		WillReturnRows(sqlmock.NewRows([]string{"bucket", "count"}).AddRow(2, 1).AddRow(3, 3))
+
+	facets, err := r.GetPersonFacets(context.Background(), filter, []string{"gender", "surname", "age"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]model.ValueCount{
+		"gender": {{Value: "male", Count: 3}, {Value: "female", Count: 1}},
+		"age":    {{Value: "20-29", Count: 1}, {Value: "30-39", Count: 3}},
+	}, facets, "неизвестное поле пропускается")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT nationality, COUNT(*)`)).WillReturnError(sql.ErrConnDone)
+	_, err = r.GetPersonFacets(context.Background(), filter, []string{"nationality"})
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestMergePersons(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+
+	r := NewPostgres(db, zap.NewNop(), 1*time.Second)
+
+	t.Run("Find Duplicates", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version"}).
+			AddRow(1, "Ivan", "Petrov", nil, 30, nil, nil, time.Now(), time.Now(), 1).
+			AddRow(2, "ivan", "PETROV", nil, nil, nil, "male", time.Now(), time.Now(), 1).
+			AddRow(3, "Ivan-Petr", "Petrov", nil, nil, nil, nil, time.Now(), time.Now(), 1).
+			AddRow(4, "IvanPetr", "Petrov", nil, nil, nil, nil, time.Now(), time.Now(), 1)
+		mock.ExpectQuery(`COUNT\(\*\) OVER \(PARTITION BY .+\) AS namesakes\s+FROM people WHERE deleted_at IS NULL\) candidates WHERE namesakes > 1 ORDER BY id`).
+			WillReturnRows(rows)
+
+		groups, err := r.FindDuplicates(context.Background(), 0)
+		require.NoError(t, err)
+		require.Len(t, groups, 1, "Ivan-Petr и IvanPetr - кандидаты по ключу базы, но разные по dedup.Key")
+		assert.Equal(t, 1, groups[0].SurvivorID)
+		assert.Len(t, groups[0].Persons, 2)
+	})
+	t.Run("Merge", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectLock(mock, 1, false)
+		expectLock(mock, 2, false)
+		expectLock(mock, 1, false)
+		mock.ExpectQuery("UPDATE people SET name").WithArgs(withHistory(model.HistoryMerge, "John", "Doe", "Smith", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 1, 1)...).WillReturnRows(versionRows(2))
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE people SET deleted_at = $1, version = version + 1 WHERE id = $2`)).WithArgs(withHistory(model.HistoryMerge, sqlmock.AnyArg(), 2)...).WillReturnRows(versionRows(2))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM person_merges WHERE merged_id = $1`)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE person_merges SET survivor_id = $1 WHERE survivor_id = ANY($2)`)).WithArgs(1, "{2}").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO person_merges (merged_id, survivor_id, actor, merged_at) SELECT unnest($1::int[])`)).WithArgs("{2}", 1, "system", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		person, err := r.MergePersons(context.Background(), []int{2, 1, 2}, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, person.ID)
+		assert.Equal(t, 2, person.Version)
+	})
+	t.Run("Merge Deleted", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectLock(mock, 1, false)
+		expectLock(mock, 2, true)
+		mock.ExpectRollback()
+
+		_, err := r.MergePersons(context.Background(), []int{1, 2}, 0)
+		assert.ErrorIs(t, err, customerrors.ErrNothingToMerge)
+	})
+	t.Run("Resolve", func(t *testing.T) {
+		resolve := regexp.QuoteMeta(`SELECT survivor_id FROM person_merges WHERE merged_id = $1`)
+		mock.ExpectQuery(resolve).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"survivor_id"}).AddRow(1))
+		mock.ExpectQuery(resolve).WithArgs(3).WillReturnError(sql.ErrNoRows)
+
+		id, err := r.ResolveMergedID(context.Background(), 2)
+		require.NoError(t, err)
+		assert.Equal(t, 1, id)
+		_, err = r.ResolveMergedID(context.Background(), 3)
+		assert.ErrorIs(t, err, customerrors.ErrPersonNotFound)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestReplicaRouting(t *testing.T) {
+	primary, primaryMock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer primary.Close()
+	replica, replicaMock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer replica.Close()
+
+	r := NewPostgres(primary, zap.NewNop(), 1*time.Second).WithReplicas(time.Minute, replica)
+	query := regexp.QuoteMeta(`SELECT name,surname,patronymic, age ,nationality,gender,created_at,updated_at,version FROM people WHERE id = $1 AND deleted_at IS NULL`)
+	row := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version"}).
+			AddRow("John", "Doe", "", nil, nil, nil, time.Now(), time.Now(), 1)
+	}
+
+	t.Run("Replica", func(t *testing.T) {
+		replicaMock.ExpectQuery(query).WithArgs(1).WillReturnRows(row())
+		_, err := r.GetPersonByID(context.Background(), 1)
+		assert.NoError(t, err)
+	})
+	t.Run("Query Error Not Retried", func(t *testing.T) {
+		replicaMock.ExpectQuery(query).WithArgs(1).WillReturnError(&pq.Error{Code: "42P01"})
+		_, err := r.GetPersonByID(context.Background(), 1)
+		assert.Error(t, err)
+	})
+	t.Run("Read Your Writes", func(t *testing.T) {
+		primaryMock.ExpectQuery(query).WithArgs(1).WillReturnRows(row())
+		_, err := r.GetPersonByID(consistency.WithPrimary(context.Background()), 1)
+		assert.NoError(t, err)
+	})
+	t.Run("Fallback To Primary", func(t *testing.T) {
+		replicaMock.ExpectQuery(query).WithArgs(1).WillReturnError(&pq.Error{Code: "57P03"})
+		primaryMock.ExpectQuery(query).WithArgs(1).WillReturnRows(row())
+		_, err := r.GetPersonByID(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.False(t, r.replicas[0].available(time.Now()))
+	})
+	t.Run("Replica Down", func(t *testing.T) {
+		primaryMock.ExpectQuery(`SELECT COUNT\(\*\) FROM people`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		total, _, err := r.CountPersons(context.Background(), model.PersonFilter{}, false)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), total)
+	})
+	t.Run("Replica Back", func(t *testing.T) {
+		r.replicas[0].downUntil.Store(0)
+		replicaMock.ExpectQuery("SELECT id, name, surname").WillReturnRows(sqlmock.NewRows([]string{"id", "name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version"}).
+			AddRow(1, "John", "Doe", nil, nil, nil, nil, time.Now(), time.Now(), 1))
+		persons, err := r.GetPersonsByFilter(context.Background(), model.PersonFilter{}, nil, 10)
+		require.NoError(t, err)
+		assert.Len(t, persons, 1)
+	})
+
+	assert.NoError(t, primaryMock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+	assert.NoError(t, replicaMock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Bad conn", err: driver.ErrBadConn, want: true},
+		{name: "Network", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: true},
+		{name: "Connection exception", err: &pq.Error{Code: "08006"}, want: true},
+		{name: "Starting up", err: &pq.Error{Code: "57P03"}, want: true},
+		{name: "Query canceled", err: &pq.Error{Code: "57014"}, want: false},
+		{name: "Undefined table", err: &pq.Error{Code: "42P01"}, want: false},
+		{name: "No rows", err: sql.ErrNoRows, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, unavailable(tt.err))
+		})
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer primary.Close()
+	replica, _, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer replica.Close()
+
+	PoolConfig{MaxOpenConns: 7, MaxIdleConns: 3, ConnMaxLifetime: time.Minute}.apply(primary)
+	r := NewPostgres(primary, zap.NewNop(), 1*time.Second).WithReplicas(time.Minute, replica)
+
+	stats := r.PoolStats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "primary", stats[0].Name)
+	assert.Equal(t, 7, stats[0].MaxOpenConnections)
+	assert.Equal(t, "replica-1", stats[1].Name)
+	assert.Zero(t, stats[1].MaxOpenConnections, "без настроек пул не ограничен")
+}
+
+func TestWithTx(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+	r := NewPostgres(db, zap.NewNop(), 2*time.Second)
+	ctx := context.Background()
+	update := regexp.QuoteMeta("UPDATE people SET name = $1")
+
+	t.Run("Commit", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT uow_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		expectLock(mock, 1, false)
+		mock.ExpectQuery(update).WillReturnRows(versionRows(2))
+		mock.ExpectExec("RELEASE SAVEPOINT uow_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT name,surname").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"name", "surname", "patronymic", "age", "nationality", "gender", "created_at", "updated_at", "version"}).
+			AddRow("Jane", "Doe", "", nil, nil, nil, time.Now(), time.Now(), 2))
+		mock.ExpectCommit()
+
+		err := r.WithTx(ctx, model.TxOptions{Isolation: sql.LevelSerializable}, func(ctx context.Context) error {
+			if err := r.UpdatePersonByID(ctx, &model.Person{ID: 1, Name: "Jane", Surname: "Doe"}); err != nil {
+				return err
+			}
+			person, err := r.GetPersonByID(ctx, 1)
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, 2, person.Version, "чтение внутри транзакции видит изменение")
+			return nil
+		})
+		require.NoError(t, err)
+	})
+	t.Run("Rollback", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT uow_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		expectLock(mock, 1, true)
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT uow_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := r.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+			return r.UpdatePersonByID(ctx, &model.Person{ID: 1, Name: "Jane", Surname: "Doe"})
+		})
+		assert.ErrorIs(t, err, customerrors.ErrNothingToUpdate)
+	})
+	t.Run("Panic", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		assert.PanicsWithValue(t, "boom", func() {
+			_ = r.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error { panic("boom") })
+		})
+	})
+	t.Run("Retry", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		calls := 0
+		err := r.WithTx(ctx, model.TxOptions{Isolation: sql.LevelSerializable, MaxRetries: 2}, func(ctx context.Context) error {
+			calls++
+			if calls == 1 {
+				return &pq.Error{Code: "40001"}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+	t.Run("Retries Exhausted", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		calls := 0
+		err := r.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+			calls++
+			return &pq.Error{Code: "40P01"}
+		})
+		var pqErr *pq.Error
+		require.ErrorAs(t, err, &pqErr)
+		assert.Equal(t, 1, calls, "без MaxRetries транзакция не повторяется")
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+	r := NewPostgres(db, zap.NewNop(), time.Second)
+	ctx := context.Background()
+
+	t.Run("Events", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "person_id", "version", "action", "before_data", "after_data", "actor", "occurred_at"}).
+			AddRow(int64(10), 1, 1, model.HistoryCreate, nil, `{"id":1,"name":"John"}`, "system", time.Now()).
+			AddRow(int64(11), 1, 2, model.HistoryDelete, `{"id":1,"name":"John"}`, `{"id":1,"name":"John"}`, "admin", time.Now())
+		mock.ExpectQuery(regexp.QuoteMeta(outboxEventsQuery)).WithArgs(100).WillReturnRows(rows)
+
+		events, err := r.GetOutboxEvents(ctx, 100)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, "person.create", events[0].Type)
+		assert.Nil(t, events[0].Before)
+		assert.Equal(t, "John", events[0].After.Name)
+		assert.Equal(t, 2, events[1].Version)
+	})
+	t.Run("Mark Delivered", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(outboxDeliveredQuery)).WithArgs(sqlmock.AnyArg(), "{10,11}").WillReturnResult(sqlmock.NewResult(0, 2))
+		require.NoError(t, r.MarkOutboxDelivered(ctx, []int64{10, 11}))
+		require.NoError(t, r.MarkOutboxDelivered(ctx, nil), "пустой список не обращается к базе")
+	})
+	t.Run("Purge", func(t *testing.T) {
+		before := time.Now()
+		mock.ExpectExec(regexp.QuoteMeta(outboxPurgeQuery)).WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 7))
+		purged, err := r.PurgeOutbox(ctx, before)
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), purged)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
+
+func TestPatchPersonByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "Не удалось создать sqlmock")
+	defer db.Close()
+	r := NewPostgres(db, zap.NewNop(), time.Second)
+	patch := model.PersonPatch{
+		Surname:     model.Optional[string]{Set: true, Value: "Petrov"},
+		Patronymic:  model.Optional[string]{Set: true, Null: true},
+		Nationality: model.Optional[string]{Set: true, Value: "RU"},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectLock(mock, 1, false)
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE people SET surname = $1, patronymic = $2, nationality = $3, updated_at = $4, version = version + 1 WHERE id = $5`)).
+			WithArgs(withHistory(model.HistoryUpdate, "Petrov", "", "RU", sqlmock.AnyArg(), 1)...).WillReturnRows(versionRows(2))
+		mock.ExpectCommit()
+
+		person, err := r.PatchPersonByID(context.Background(), 1, patch, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "John", person.Name)
+		assert.Equal(t, "Petrov", person.Surname)
+		assert.Empty(t, person.Patronymic)
+		assert.Equal(t, 2, person.Version)
+	})
+	t.Run("Version Conflict", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectLock(mock, 1, false)
+		mock.ExpectRollback()
+
+		_, err := r.PatchPersonByID(context.Background(), 1, patch, 5)
+		assert.ErrorIs(t, err, customerrors.ErrVersionConflict)
+	})
+	t.Run("Deleted", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectLock(mock, 1, true)
+		mock.ExpectRollback()
+
+		_, err := r.PatchPersonByID(context.Background(), 1, patch, 0)
+		assert.ErrorIs(t, err, customerrors.ErrNothingToUpdate)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Не все ожидания sqlmock были выполнены")
+}
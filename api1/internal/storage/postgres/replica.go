@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nikita89756/testEffectiveMobile/internal/consistency"
+	"go.uber.org/zap"
+)
+
+// replica - реплика для чтения, downUntil - до какого момента (UnixNano) она считается недоступной
+type replica struct {
+	db        *sql.DB
+	downUntil atomic.Int64
+}
+
+func (r *replica) available(now time.Time) bool {
+	return now.UnixNano() >= r.downUntil.Load()
+}
+
+// OpenReplica - подключение к реплике без проверки: недоступная при старте реплика
+// пропускается при чтении и подхватывается, когда поднимется
+func OpenReplica(connectionString string, pool PoolConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return nil, err
+	}
+	pool.apply(db)
+	return db, nil
+}
+
+// WithReplicas - GetPersonByID, GetPersonsByFilter, CountPersons, GetDemographics и GetPersonFacets читают
+// из реплик по кругу. Недоступная реплика пропускается retryAfter, если недоступны все - чтение идет в primary.
+// Вызывается до начала работы хранилища
+func (p *Postgres) WithReplicas(retryAfter time.Duration, replicas ...*sql.DB) *Postgres {
+	p.retryAfter = retryAfter
+	for i, db := range replicas {
+		r := &replica{db: db}
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		if err := db.PingContext(ctx); err != nil {
+			p.logger.Warn("Реплика недоступна, чтение идет в primary", zap.Int("replica", i), zap.Error(err))
+			r.downUntil.Store(time.Now().Add(retryAfter).UnixNano())
+		}
+		cancel()
+		p.replicas = append(p.replicas, r)
+	}
+	p.logger.Info("Подключены реплики для чтения", zap.Int("count", len(p.replicas)))
+	return p
+}
+
+// read - выполняет чтение fn на реплике, а если реплики нет, все недоступны или контекст требует
+// read-your-writes (consistency.Primary) - на primary, внутри WithTx - в транзакции. fn может вызываться несколько раз
+// и должна каждый раз заново заполнять результат
+func (p *Postgres) read(ctx context.Context, fn func(db conn) error) error {
+	if c := p.conn(ctx); len(p.replicas) == 0 || c.uow != nil || consistency.Primary(ctx) {
+		return fn(c)
+	}
+	start := int(p.next.Add(1) % uint64(len(p.replicas)))
+	for i := range p.replicas {
+		n := (start + i) % len(p.replicas)
+		r := p.replicas[n]
+		if !r.available(time.Now()) {
+			continue
+		}
+		err := fn(conn{db: r.db})
+		if err == nil || ctx.Err() != nil || !unavailable(err) {
+			return err
+		}
+		p.logger.Warn("Реплика недоступна, чтение переключено", zap.Int("replica", n), zap.Duration("retry_after", p.retryAfter), zap.Error(err))
+		r.downUntil.Store(time.Now().Add(p.retryAfter).UnixNano())
+	}
+	return fn(p.conn(ctx))
+}
+
+// unavailable - ошибка соединения или состояния сервера, а не запроса: такое чтение можно повторить на primary
+func unavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// 08 - connection exception, 57P - сервер останавливается или еще не готов принимать запросы
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	logger "github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// retryBackoff - пауза перед повтором транзакции, растет линейно с номером попытки
+const retryBackoff = 20 * time.Millisecond
+
+// txKey - ключ транзакции WithTx в контексте. Привязан к пулу, чтобы транзакция одного хранилища
+// не подхватывалась другим (и репликами)
+type txKey struct {
+	db *sql.DB
+}
+
+// unitOfWork - транзакция WithTx, savepoints - счетчик для имен точек сохранения
+type unitOfWork struct {
+	tx         *sql.Tx
+	savepoints int
+}
+
+// txn - транзакция метода хранилища. Внутри WithTx это точка сохранения в общей транзакции:
+// Commit освобождает ее, Rollback откатывает изменения только этого метода
+type txn struct {
+	*sql.Tx
+	ctx       context.Context
+	savepoint string
+	done      bool
+}
+
+func (t *txn) Commit() error {
+	if t.savepoint == "" {
+		return t.Tx.Commit()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.Tx.ExecContext(t.ctx, "RELEASE SAVEPOINT "+t.savepoint)
+	return err
+}
+
+func (t *txn) Rollback() error {
+	if t.savepoint == "" {
+		return t.Tx.Rollback()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.Tx.ExecContext(t.ctx, "ROLLBACK TO SAVEPOINT "+t.savepoint)
+	return err
+}
+
+// conn - куда идут запросы: пул (primary или реплика) или транзакция WithTx из контекста
+type conn struct {
+	db  *sql.DB
+	uow *unitOfWork
+}
+
+func (p *Postgres) conn(ctx context.Context) conn {
+	uow, _ := ctx.Value(txKey{p.db}).(*unitOfWork)
+	return conn{db: p.db, uow: uow}
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if c.uow != nil {
+		return c.uow.tx.QueryContext(ctx, query, args...)
+	}
+	return c.db.QueryContext(ctx, query, args...)
+}
+
+func (c conn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if c.uow != nil {
+		return c.uow.tx.QueryRowContext(ctx, query, args...)
+	}
+	return c.db.QueryRowContext(ctx, query, args...)
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if c.uow != nil {
+		return c.uow.tx.ExecContext(ctx, query, args...)
+	}
+	return c.db.ExecContext(ctx, query, args...)
+}
+
+// begin - новая транзакция, а внутри WithTx - точка сохранения. opts внутри WithTx не применяются:
+// уровень изоляции задает внешняя транзакция
+func (c conn) begin(ctx context.Context, opts *sql.TxOptions) (*txn, error) {
+	if c.uow == nil {
+		tx, err := c.db.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &txn{Tx: tx}, nil
+	}
+	c.uow.savepoints++
+	name := "uow_" + strconv.Itoa(c.uow.savepoints)
+	if _, err := c.uow.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return nil, err
+	}
+	// откат точки сохранения должен пройти и после отмены контекста запроса
+	return &txn{Tx: c.uow.tx, ctx: context.WithoutCancel(ctx), savepoint: name}, nil
+}
+
+// WithTx - вызовы хранилища с контекстом, переданным в fn, выполняются в одной транзакции.
+// Ошибка или паника fn откатывают транзакцию (паника пробрасывается дальше). При конфликте
+// сериализации или взаимоблокировке транзакция повторяется до opts.MaxRetries раз, поэтому fn
+// должна быть готова к повторному вызову. Вложенный WithTx - точка сохранения во внешней транзакции.
+// Контекст fn нельзя использовать из нескольких горутин одновременно
+func (p *Postgres) WithTx(ctx context.Context, opts model.TxOptions, fn func(ctx context.Context) error) error {
+	if c := p.conn(ctx); c.uow != nil {
+		tx, err := c.begin(ctx, nil)
+		if err != nil {
+			p.logger.Error("Ошибка создания точки сохранения", zap.Error(err))
+			return err
+		}
+		return runTx(ctx, tx, fn)
+	}
+	return retry(ctx, p.logger, opts.MaxRetries, func() error {
+		return p.withTx(ctx, opts, fn)
+	})
+}
+
+// retry - выполняет транзакцию run и повторяет ее после конфликта (см. retryable) до maxRetries раз
+func retry(ctx context.Context, log logger.Logger, maxRetries int, run func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || attempt > maxRetries || !retryable(err) {
+			return err
+		}
+		log.Warn("Конфликт транзакций, транзакция будет повторена", zap.Int("attempt", attempt), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		}
+	}
+}
+
+func (p *Postgres) withTx(ctx context.Context, opts model.TxOptions, fn func(ctx context.Context) error) error {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		p.logger.Error("Ошибка начала транзакции", zap.String("error", err.Error()))
+		return err
+	}
+	return runTx(context.WithValue(ctx, txKey{p.db}, &unitOfWork{tx: tx}), &txn{Tx: tx}, fn)
+}
+
+// runTx - fn в транзакции tx: commit при успехе, rollback при ошибке или панике
+func runTx(ctx context.Context, tx *txn, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if err = fn(ctx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// retryable - 40001 serialization_failure и 40P01 deadlock_detected: транзакцию можно повторить целиком.
+// Ошибки приходят от lib/pq (Postgres) или от pgx (Pgx)
+func retryable(err error) bool {
+	var code string
+	var pqErr *pq.Error
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pqErr):
+		code = string(pqErr.Code)
+	case errors.As(err, &pgErr):
+		code = pgErr.Code
+	}
+	return code == "40001" || code == "40P01"
+}
@@ -0,0 +1,154 @@
+package sqlite
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+)
+
+// queryBuilder - собирает условия WHERE. Значения передаются только параметрами ?n,
+// в текст запроса попадают лишь имена колонок из кода
+type queryBuilder struct {
+	conds []string
+	args  []any
+}
+
+// arg - добавляет параметр и возвращает его плейсхолдер
+func (b *queryBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return "?" + strconv.Itoa(len(b.args))
+}
+
+func (b *queryBuilder) where(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+func (b *queryBuilder) whereSQL() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
+
+// personFilter - условия для не удаленных людей по фильтру. Время хранится строкой с часовым поясом,
+// поэтому сравнивается через julianday, а не как строка
+func personFilter(f model.PersonFilter) *queryBuilder {
+	b := &queryBuilder{}
+	b.where("deleted_at IS NULL")
+	in(b, "id", f.IDs)
+	in(b, "name", f.Names)
+	in(b, "surname", f.Surnames)
+	in(b, "patronymic", f.Patronymics)
+	in(b, "nationality", f.Nationalities)
+	in(b, "gender", f.Genders)
+	in(b, "age", f.Ages)
+	b.prefix("name", f.NamePrefix)
+	b.prefix("surname", f.SurnamePrefix)
+	b.prefix("patronymic", f.PatronymicPrefix)
+	if f.AgeMin != nil {
+		b.where("age >= " + b.arg(*f.AgeMin))
+	}
+	if f.AgeMax != nil {
+		b.where("age <= " + b.arg(*f.AgeMax))
+	}
+	if f.CreatedAfter != nil {
+		b.where("julianday(created_at) >= julianday(" + b.arg(*f.CreatedAfter) + ")")
+	}
+	if f.CreatedBefore != nil {
+		b.where("julianday(created_at) < julianday(" + b.arg(*f.CreatedBefore) + ")")
+	}
+	if f.UpdatedAfter != nil {
+		b.where("julianday(updated_at) >= julianday(" + b.arg(*f.UpdatedAfter) + ")")
+	}
+	if f.UpdatedBefore != nil {
+		b.where("julianday(updated_at) < julianday(" + b.arg(*f.UpdatedBefore) + ")")
+	}
+	return b
+}
+
+func in[T any](b *queryBuilder, column string, values []T) {
+	if len(values) == 0 {
+		return
+	}
+	placeholders := make([]string, 0, len(values))
+	for _, v := range values {
+		placeholders = append(placeholders, b.arg(v))
+	}
+	b.where(column + " IN (" + strings.Join(placeholders, ", ") + ")")
+}
+
+// prefix - сравнение начала строки без LIKE: LIKE в SQLite не различает регистр латиницы и требует экранирования
+func (b *queryBuilder) prefix(column, value string) {
+	if value != "" {
+		p := b.arg(value)
+		b.where("substr(" + column + ", 1, length(" + p + ")) = " + p)
+	}
+}
+
+// sortColumns - выражения для полей сортировки. NULL заменяется пустым значением, чтобы порядок совпадал
+// во всех хранилищах: пустые значения считаются наименьшими. Время с разными поясами сравнивается через julianday
+var sortColumns = map[string]string{
+	"id":          "id",
+	"name":        "name",
+	"surname":     "surname",
+	"patronymic":  "COALESCE(patronymic, '')",
+	"age":         "COALESCE(age, 0)",
+	"nationality": "COALESCE(nationality, '')",
+	"gender":      "COALESCE(gender, '')",
+	"created_at":  "julianday(created_at)",
+	"updated_at":  "julianday(updated_at)",
+}
+
+// sortFields - поля из model.SortableFields с id в конце, прочие поля пропускаются
+func sortFields(fields []model.SortField) []model.SortField {
+	known := make([]model.SortField, 0, len(fields)+1)
+	for _, f := range model.WithTiebreaker(fields) {
+		if _, ok := sortColumns[f.Field]; ok {
+			known = append(known, f)
+		}
+	}
+	return known
+}
+
+// orderBy - ORDER BY по полям сортировки, reverse переворачивает направление всех полей
+func orderBy(fields []model.SortField, reverse bool) string {
+	fields = sortFields(fields)
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		part := sortColumns[f.Field]
+		if f.Desc != reverse {
+			part += " DESC"
+		}
+		parts = append(parts, part)
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// keyset - записи после курсора в порядке сортировки (для Backward - перед ним):
+// (f1 > v1) OR (f1 = v1 AND f2 > v2) OR ..., для полей по убыванию знак обратный
+func (b *queryBuilder) keyset(after *model.Cursor, fields []model.SortField) {
+	fields = sortFields(fields)
+	values := make([]string, 0, len(fields))
+	for _, f := range fields {
+		p := b.arg(after.Key.SortValue(f.Field))
+		if strings.HasPrefix(sortColumns[f.Field], "julianday(") {
+			p = "julianday(" + p + ")"
+		}
+		values = append(values, p)
+	}
+	ors := make([]string, 0, len(fields))
+	for i, f := range fields {
+		ands := make([]string, 0, i+1)
+		for j, prev := range fields[:i] {
+			ands = append(ands, sortColumns[prev.Field]+" = "+values[j])
+		}
+		op := " > "
+		if f.Desc != after.Backward {
+			op = " < "
+		}
+		ands = append(ands, sortColumns[f.Field]+op+values[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	b.where("(" + strings.Join(ors, " OR ") + ")")
+}
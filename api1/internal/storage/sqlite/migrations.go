@@ -0,0 +1,26 @@
+package sqlite
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrations - миграции из dir, а если dir пуст - встроенные в бинарник. Advisory lock не нужен:
+// у файла базы один писатель, и SQLite сам не даст двум процессам менять схему одновременно
+func (s *SQLite) Migrations(dir string) (*goose.Provider, error) {
+	var fsys fs.FS = os.DirFS(dir)
+	if dir == "" {
+		sub, err := fs.Sub(migrations, "migrations")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+	return goose.NewProvider(goose.DialectSQLite3, s.db, fsys)
+}
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS person_merges (
+    merged_id INTEGER PRIMARY KEY,
+    survivor_id INTEGER NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    merged_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_person_merges_survivor_id ON person_merges (survivor_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS person_merges;
+-- +goose StatementEnd
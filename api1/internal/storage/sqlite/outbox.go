@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"go.uber.org/zap"
+)
+
+// GetOutboxEvents - первые limit недоставленных событий в порядке записи
+func (s *SQLite) GetOutboxEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error) {
+	query := `SELECT id, person_id, version, action, before_data, after_data, actor, occurred_at FROM outbox WHERE delivered_at IS NULL ORDER BY id LIMIT ?1`
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, limit)
+	if err != nil {
+		s.logger.Error("Ошибка чтения outbox", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]model.OutboxEvent, 0)
+	for rows.Next() {
+		var (
+			event         model.OutboxEvent
+			action        string
+			before, after sql.NullString
+		)
+		if err := rows.Scan(&event.ID, &event.PersonID, &event.Version, &action, &before, &after, &event.Actor, &event.OccurredAt); err != nil {
+			s.logger.Error("Ошибка чтения outbox", zap.Error(err))
+			return nil, fmt.Errorf("repository outbox scan failed: %w", err)
+		}
+		event.Type = model.EventType(action)
+		if event.Before, err = fromSnapshot(before); err != nil {
+			return nil, err
+		}
+		if event.After, err = fromSnapshot(after); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository outbox scan failed: %w", err)
+	}
+	return events, nil
+}
+
+// MarkOutboxDelivered - отмечает события ids доставленными, уже отмеченные не меняются
+func (s *SQLite) MarkOutboxDelivered(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	b := &queryBuilder{}
+	now := b.arg(time.Now())
+	b.where("delivered_at IS NULL")
+	in(b, "id", ids)
+	query := `UPDATE outbox SET delivered_at = ` + now + b.whereSQL()
+	if _, err := s.conn(ctx).ExecContext(ctx, query, b.args...); err != nil {
+		s.logger.Error("Ошибка отметки доставки событий outbox", zap.Int("count", len(ids)), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// PurgeOutbox - удаляет события, доставленные раньше before
+func (s *SQLite) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	res, err := s.conn(ctx).ExecContext(ctx, `DELETE FROM outbox WHERE delivered_at IS NOT NULL AND julianday(delivered_at) < julianday(?1)`, before)
+	if err != nil {
+		s.logger.Error("Ошибка очистки outbox", zap.Error(err))
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,1026 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/actor"
+	"github.com/nikita89756/testEffectiveMobile/internal/dedup"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/search"
+	logger "github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+)
+
+// SQLite - хранилище на SQLite (драйвер modernc.org/sqlite, без cgo) для небольших установок без Postgres.
+// Поведение совпадает с Postgres: пустые возраст, пол и национальность хранятся как NULL.
+type SQLite struct {
+	db      *sql.DB
+	logger  logger.Logger
+	timeout time.Duration
+}
+
+// ConnectDB - dsn это путь к файлу базы, например "file:people.db?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)".
+// Время всегда пишется в формате SQLite ("2006-01-02 15:04:05.999999999-07:00"), чтобы его понимали julianday и datetime
+func ConnectDB(dsn string, timeout time.Duration) (*sql.DB, error) {
+	if !strings.Contains(dsn, "_time_format=") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_time_format=sqlite"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite допускает одного писателя, а база ":memory:" существует только в рамках одного соединения
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func NewSQLite(db *sql.DB, logger logger.Logger, timeout time.Duration) *SQLite {
+	logger.Info("Подключение к базе SQLite завершено")
+	return &SQLite{
+		db:      db,
+		logger:  logger,
+		timeout: timeout,
+	}
+}
+
+// PoolStats - у SQLite одно соединение (см. ConnectDB), wait_count показывает, как часто запросы ждут друг друга
+func (s *SQLite) PoolStats() []model.PoolStats {
+	return []model.PoolStats{model.NewPoolStats("primary", s.db.Stats())}
+}
+
+func (s *SQLite) Close() {
+	if err := s.db.Close(); err != nil {
+		s.logger.Error("Ошибка закрытия подключения к базе данных", zap.String("error", err.Error()))
+	}
+	s.logger.Info("Подключение к базе данных закрыто")
+}
+
+func (s *SQLite) CreatePerson(ctx context.Context, person *model.Person) error {
+	query := `INSERT INTO people (name, surname, patronymic, age, nationality, gender, created_at, updated_at) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8) RETURNING id`
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		s.logger.Error("Ошибка начала транзакции", zap.String("error", err.Error()))
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	person.CreatedAt = now
+	person.UpdatedAt = now
+
+	age, nationality, gender := nullStats(person)
+	row := tx.QueryRowContext(ctx, query, person.Name, person.Surname, person.Patronymic, age, nationality, gender, person.CreatedAt, person.UpdatedAt)
+	if err := row.Scan(&person.ID); err != nil {
+		s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return err
+	}
+	person.Version = 1
+	if err := s.insertHistory(ctx, tx, model.HistoryCreate, nil, person); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Ошибка коммита транзакции", zap.String("error", err.Error()))
+		return err
+	}
+	s.logger.Info("Создана запись в таблице person", zap.Int("id", person.ID))
+	return nil
+}
+
+// bulkChunkSize - на каждые bulkChunkSize строк массовой вставки к таймауту запроса добавляется еще один таймаут
+const bulkChunkSize = 1000
+
+// BulkCreatePersons - COPY в SQLite нет, строки вставляются подготовленным запросом в одной транзакции.
+// Без atomic каждая строка пишется в своем SAVEPOINT, и ошибка откатывает только ее
+func (s *SQLite) BulkCreatePersons(ctx context.Context, persons []model.Person, atomic bool) (model.BulkCreateResult, error) {
+	query := `INSERT INTO people (name, surname, patronymic, age, nationality, gender, created_at, updated_at) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8) RETURNING id`
+	result, valid := model.NewBulkCreateResult(persons)
+	if atomic && len(result.Errors) > 0 {
+		return result, customerrors.ErrBulkRejected
+	}
+	if len(valid) == 0 {
+		return result, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout*time.Duration(1+len(valid)/bulkChunkSize))
+	defer cancel()
+
+	tx, err := s.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		s.logger.Error("Ошибка начала транзакции", zap.String("error", err.Error()))
+		return result, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		s.logger.Error("Ошибка подготовки запроса", zap.String("error", err.Error()))
+		return result, err
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	insert := func(person *model.Person) error {
+		age, nationality, gender := nullStats(person)
+		if err := stmt.QueryRowContext(ctx, person.Name, person.Surname, person.Patronymic, age, nationality, gender, now, now).Scan(&person.ID); err != nil {
+			return err
+		}
+		person.CreatedAt = now
+		person.UpdatedAt = now
+		person.Version = 1
+		return s.insertHistory(ctx, tx, model.HistoryCreate, nil, person)
+	}
+	for _, i := range valid {
+		person := &persons[i]
+		if atomic {
+			if err := insert(person); err != nil {
+				s.logger.Error("Ошибка массовой вставки", zap.Int("index", i), zap.Error(err))
+				return model.BulkCreateResult{IDs: make([]int, len(persons))}, err
+			}
+			result.Done(i, person.ID)
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT bulk_row"); err != nil {
+			return result, err
+		}
+		if err := insert(person); err != nil {
+			s.logger.Warn("Строка массовой вставки пропущена", zap.Int("index", i), zap.Error(err))
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT bulk_row"); err != nil {
+				return result, err
+			}
+			person.ID = 0
+			result.Fail(i, "Failed to insert row")
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT bulk_row"); err != nil {
+			return result, err
+		}
+		result.Done(i, person.ID)
+	}
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Ошибка коммита транзакции", zap.String("error", err.Error()))
+		return model.BulkCreateResult{IDs: make([]int, len(persons))}, err
+	}
+	s.logger.Info("Массовая вставка в таблицу people", zap.Int("created", result.Created), zap.Int("failed", len(result.Errors)))
+	return result, nil
+}
+
+func (s *SQLite) GetPersonByID(ctx context.Context, id int) (*model.Person, error) {
+	query := `SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version FROM people WHERE id = ?1 AND deleted_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	person, err := scanPerson(s.conn(ctx).QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return &model.Person{ID: id}, customerrors.ErrPersonNotFound
+	}
+	if err != nil {
+		return &model.Person{ID: id}, err
+	}
+	s.logger.Info("Получена запись из таблицы people", zap.Int("id", id))
+	return person, nil
+}
+
+func (s *SQLite) DeletePersonByID(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		s.logger.Error("Ошибка начала транзакции", zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := s.getPerson(ctx, tx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && before.DeletedAt != nil) {
+		s.logger.Debug("Нечего удалять из базы", zap.Int("id", id))
+		return customerrors.ErrNothingToDelete
+	}
+	if err != nil {
+		s.logger.Error("Ошибка получения записи перед удалением", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+
+	// Время удаления хранится строкой в UTC, чтобы очистка могла сравнивать его с границей хранения
+	now := time.Now().UTC()
+	after := *before
+	after.DeletedAt = &now
+	if err := tx.QueryRowContext(ctx, `UPDATE people SET deleted_at = ?1, version = version + 1 WHERE id = ?2 RETURNING version`, now, id).Scan(&after.Version); err != nil {
+		s.logger.Error("Ошибка выполнения запроса при удалении", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+	if err := s.insertHistory(ctx, tx, model.HistoryDelete, before, &after); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Ошибка коммита транзакции после удаления", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+	s.logger.Info("Успешно удален пользователь", zap.Int("id", id))
+	return nil
+}
+
+func (s *SQLite) UpdatePersonByID(ctx context.Context, person *model.Person) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		s.logger.Error("Ошибка начала транзакции при обновлении", zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.updateTx(ctx, tx, person, model.HistoryUpdate); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Ошибка коммита транзакции после обновления", zap.Int("id", person.ID), zap.Error(err))
+		return err
+	}
+	s.logger.Info("Успешно обновлен пользователь", zap.Int("id", person.ID))
+	return nil
+}
+
+// updateTx - обновление в транзакции tx с записью в историю как action
+func (s *SQLite) updateTx(ctx context.Context, tx *txn, person *model.Person, action string) error {
+	query := `UPDATE people SET name = ?1, surname = ?2, patronymic = ?3, age = ?4, nationality = ?5, gender = ?6, updated_at = ?7, version = version + 1 WHERE id = ?8 AND version = ?9 RETURNING version`
+
+	before, err := s.getPerson(ctx, tx, person.ID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && before.DeletedAt != nil) {
+		s.logger.Debug("Нечего обновлять в базе", zap.Int("id", person.ID))
+		return customerrors.ErrNothingToUpdate
+	}
+	if err != nil {
+		s.logger.Error("Ошибка получения записи перед обновлением", zap.Int("id", person.ID), zap.Error(err))
+		return err
+	}
+
+	if person.Version == 0 {
+		person.Version = before.Version
+	}
+	if person.Version != before.Version {
+		s.logger.Debug("Версия записи не совпадает", zap.Int("id", person.ID), zap.Int("expected", person.Version), zap.Int("actual", before.Version))
+		return customerrors.ErrVersionConflict
+	}
+
+	person.CreatedAt = before.CreatedAt
+	person.UpdatedAt = time.Now()
+	age, nationality, gender := nullStats(person)
+	err = tx.QueryRowContext(ctx, query, person.Name, person.Surname, person.Patronymic, age, nationality, gender, person.UpdatedAt, person.ID, person.Version).Scan(&person.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return customerrors.ErrVersionConflict
+	}
+	if err != nil {
+		s.logger.Error("Ошибка выполнения запроса при обновлении", zap.Int("id", person.ID), zap.Error(err))
+		return err
+	}
+	return s.insertHistory(ctx, tx, action, before, person)
+}
+
+// PatchPersonByID - версия проверяется по записи, прочитанной в транзакции, затем один UPDATE меняет
+// только колонки из патча
+func (s *SQLite) PatchPersonByID(ctx context.Context, id int, patch model.PersonPatch, version int) (*model.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		s.logger.Error("Ошибка начала транзакции при обновлении", zap.Error(err))
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := s.getPerson(ctx, tx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && before.DeletedAt != nil) {
+		s.logger.Debug("Нечего обновлять в базе", zap.Int("id", id))
+		return nil, customerrors.ErrNothingToUpdate
+	}
+	if err != nil {
+		s.logger.Error("Ошибка получения записи перед обновлением", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	if version != 0 && version != before.Version {
+		s.logger.Debug("Версия записи не совпадает", zap.Int("id", id), zap.Int("expected", version), zap.Int("actual", before.Version))
+		return nil, customerrors.ErrVersionConflict
+	}
+	values := patch.Values()
+	if len(values) == 0 {
+		return before, nil
+	}
+
+	after := *before
+	patch.Apply(&after)
+	after.UpdatedAt = time.Now()
+	b := &queryBuilder{}
+	set := make([]string, 0, len(values))
+	for _, v := range values {
+		if v.Value == nil {
+			set = append(set, v.Column+" = NULL")
+			continue
+		}
+		set = append(set, v.Column+" = "+b.arg(v.Value))
+	}
+	query := `UPDATE people SET ` + strings.Join(set, ", ") + `, updated_at = ` + b.arg(after.UpdatedAt) + `, version = version + 1 WHERE id = ` + b.arg(id) + ` RETURNING version`
+	if err := tx.QueryRowContext(ctx, query, b.args...).Scan(&after.Version); err != nil {
+		s.logger.Error("Ошибка выполнения запроса при частичном обновлении", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	if err := s.insertHistory(ctx, tx, model.HistoryUpdate, before, &after); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Ошибка коммита транзакции после обновления", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	s.logger.Info("Успешно обновлен пользователь", zap.Int("id", id), zap.Int("fields", len(values)))
+	return &after, nil
+}
+
+// GetPersonsByFilter - условия и сортировка собираются из заданных полей фильтра, страница выбирается по ключу
+// сортировки без OFFSET. Для курсора назад записи выбираются в обратном порядке и разворачиваются.
+// limit = 0 означает без ограничения
+func (s *SQLite) GetPersonsByFilter(ctx context.Context, filter model.PersonFilter, after *model.Cursor, limit int) ([]model.Person, error) {
+	// В SQLite LIMIT -1 означает без ограничения
+	if limit == 0 {
+		limit = -1
+	}
+	b := personFilter(filter)
+	backward := after != nil && after.Backward
+	if after != nil {
+		b.keyset(after, filter.Sort)
+	}
+	query := `SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version FROM people` + b.whereSQL() +
+		orderBy(filter.Sort, backward) + ` LIMIT ` + b.arg(limit)
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, b.args...)
+	if err != nil {
+		s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	persons := make([]model.Person, 0)
+	for rows.Next() {
+		person, err := scanPerson(rows)
+		if err != nil {
+			s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+			return nil, fmt.Errorf("repository find with filters scan failed: %w", err)
+		}
+		persons = append(persons, *person)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
+	}
+	if backward {
+		slices.Reverse(persons)
+	}
+	s.logger.Info("Получены записи из таблицы person", zap.Int("count", len(persons)))
+	return persons, nil
+}
+
+// CountPersons - в SQLite нет статистики планировщика, число всегда точное
+func (s *SQLite) CountPersons(ctx context.Context, filter model.PersonFilter, estimate bool) (int64, bool, error) {
+	b := personFilter(filter)
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var total int64
+	if err := s.conn(ctx).QueryRowContext(ctx, `SELECT COUNT(*) FROM people`+b.whereSQL(), b.args...).Scan(&total); err != nil {
+		s.logger.Error("Ошибка подсчета записей", zap.Error(err))
+		return 0, false, err
+	}
+	return total, false, nil
+}
+
+// GetDemographics - те же GROUP BY, что и в Postgres, в одной транзакции, чтобы счетчики были согласованы
+func (s *SQLite) GetDemographics(ctx context.Context, filter model.PersonFilter, opts model.DemographicsOptions) (*model.Demographics, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	tx, err := s.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		s.logger.Error("Ошибка начала транзакции", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stats := &model.Demographics{}
+	var withAge, withGender, withNationality, complete int64
+	b := personFilter(filter)
+	query := `SELECT COUNT(*), COUNT(age), COUNT(gender), COUNT(nationality),
+		COUNT(*) FILTER (WHERE age IS NOT NULL AND gender IS NOT NULL AND nationality IS NOT NULL) FROM people` + b.whereSQL()
+	if err := tx.QueryRowContext(ctx, query, b.args...).Scan(&stats.Total, &withAge, &withGender, &withNationality, &complete); err != nil {
+		s.logger.Error("Ошибка подсчета статистики", zap.Error(err))
+		return nil, err
+	}
+	stats.Coverage = model.NewCoverage(stats.Total, withAge, withGender, withNationality, complete)
+	if stats.Genders, err = s.groupCounts(ctx, tx, personFilter(filter), "COALESCE(gender, '')", 0); err != nil {
+		return nil, err
+	}
+	if stats.Nationalities, err = s.groupCounts(ctx, tx, personFilter(filter), "COALESCE(nationality, '')", 0); err != nil {
+		return nil, err
+	}
+	if stats.TopNames, err = s.groupCounts(ctx, tx, personFilter(filter), "name", opts.Top); err != nil {
+		return nil, err
+	}
+	if stats.TopSurnames, err = s.groupCounts(ctx, tx, personFilter(filter), "surname", opts.Top); err != nil {
+		return nil, err
+	}
+
+	b = personFilter(filter)
+	b.where("age IS NOT NULL")
+	if stats.AgeBuckets, err = s.ageBuckets(ctx, tx, b, opts.BucketWidth); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetPersonFacets - один GROUP BY на фасет с условием из personFilter, как в GetPersonsByFilter, но без курсора
+func (s *SQLite) GetPersonFacets(ctx context.Context, filter model.PersonFilter, facets []string) (map[string][]model.ValueCount, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	res := make(map[string][]model.ValueCount, len(facets))
+	for _, facet := range facets {
+		// имя колонки попадает в текст запроса, поэтому только из списка
+		if !slices.Contains(model.FacetFields, facet) {
+			continue
+		}
+		b := personFilter(filter)
+		b.where(facet + " IS NOT NULL")
+		if facet == "age" {
+			buckets, err := s.ageBuckets(ctx, s.db, b, model.FacetAgeBucketWidth)
+			if err != nil {
+				return nil, err
+			}
+			res[facet] = model.AgeFacet(buckets)
+			continue
+		}
+		counts, err := s.groupCounts(ctx, s.db, b, facet, 0)
+		if err != nil {
+			return nil, err
+		}
+		res[facet] = counts
+	}
+	return res, nil
+}
+
+// groupCounts - число людей по значениям column с условием b, порядок как в model.SortValueCounts
+// (строки в SQLite по умолчанию сравниваются побайтово). top = 0 означает все значения
+func (s *SQLite) groupCounts(ctx context.Context, q queryer, b *queryBuilder, column string, top int) ([]model.ValueCount, error) {
+	query := "SELECT " + column + ", COUNT(*) FROM people" + b.whereSQL() + " GROUP BY 1 ORDER BY 2 DESC, 1"
+	if top > 0 {
+		query += " LIMIT " + b.arg(top)
+	}
+	rows, err := q.QueryContext(ctx, query, b.args...)
+	if err != nil {
+		s.logger.Error("Ошибка подсчета статистики", zap.String("column", column), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make([]model.ValueCount, 0)
+	for rows.Next() {
+		var c model.ValueCount
+		if err := rows.Scan(&c.Value, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// ageBuckets - число людей по корзинам возраста шириной width с условием b, по возрастанию возраста
+func (s *SQLite) ageBuckets(ctx context.Context, q queryer, b *queryBuilder, width int64) ([]model.AgeBucket, error) {
+	rows, err := q.QueryContext(ctx, "SELECT age / "+b.arg(width)+", COUNT(*) FROM people"+b.whereSQL()+" GROUP BY 1 ORDER BY 1", b.args...)
+	if err != nil {
+		s.logger.Error("Ошибка подсчета статистики", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	buckets := make([]model.AgeBucket, 0)
+	for rows.Next() {
+		var bucket, count int64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, model.NewAgeBucket(bucket*width, width, count))
+	}
+	return buckets, rows.Err()
+}
+
+// queryer - conn или *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// SearchPersons - в SQLite нет pg_trgm, а lower() не работает с кириллицей, поэтому оценка считается в Go
+// по всем не удаленным записям. Для больших таблиц нужен Postgres. limit = 0 означает без ограничения
+func (s *SQLite) SearchPersons(ctx context.Context, query string, offset, limit int) ([]model.SearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, `SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version FROM people WHERE deleted_at IS NULL`)
+	if err != nil {
+		s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]model.SearchResult, 0)
+	for rows.Next() {
+		person, err := scanPerson(rows)
+		if err != nil {
+			s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+			return nil, fmt.Errorf("repository search scan failed: %w", err)
+		}
+		if score := search.Score(query, *person); score > 0 {
+			results = append(results, model.SearchResult{Person: *person, Score: score})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if offset >= len(results) {
+		return make([]model.SearchResult, 0), nil
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	s.logger.Info("Выполнен поиск людей", zap.Int("count", len(results)))
+	return results, nil
+}
+
+// GetNameStats - для каждого имени берется последняя обновленная запись с полностью заполненными данными обогащения
+func (s *SQLite) GetNameStats(ctx context.Context, afterName string, limit int) ([]model.NameStats, error) {
+	query := `SELECT name, age, gender, nationality FROM (
+		SELECT name, age, gender, nationality, ROW_NUMBER() OVER (PARTITION BY name ORDER BY updated_at DESC, id DESC) AS rn
+		FROM people WHERE name > ?1 AND age IS NOT NULL AND gender IS NOT NULL AND nationality IS NOT NULL AND deleted_at IS NULL
+	) WHERE rn = 1 ORDER BY name LIMIT ?2`
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, afterName, limit)
+	if err != nil {
+		s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]model.NameStats, 0, limit)
+	for rows.Next() {
+		var st model.NameStats
+		if err := rows.Scan(&st.Name, &st.Age, &st.Gender, &st.Nationality); err != nil {
+			s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+			return nil, fmt.Errorf("repository name stats scan failed: %w", err)
+		}
+		stats = append(stats, st)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
+	}
+	return stats, nil
+}
+
+func (s *SQLite) RestorePersonByID(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		s.logger.Error("Ошибка начала транзакции при восстановлении", zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := s.getPerson(ctx, tx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && before.DeletedAt == nil) {
+		s.logger.Debug("Нечего восстанавливать", zap.Int("id", id))
+		return customerrors.ErrNothingToRestore
+	}
+	if err != nil {
+		s.logger.Error("Ошибка получения записи перед восстановлением", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+
+	after := *before
+	after.DeletedAt = nil
+	after.UpdatedAt = time.Now()
+	if err := tx.QueryRowContext(ctx, `UPDATE people SET deleted_at = NULL, updated_at = ?1, version = version + 1 WHERE id = ?2 RETURNING version`, after.UpdatedAt, id).Scan(&after.Version); err != nil {
+		s.logger.Error("Ошибка выполнения запроса при восстановлении", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+	if err := s.insertHistory(ctx, tx, model.HistoryRestore, before, &after); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Ошибка коммита транзакции после восстановления", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+	s.logger.Info("Успешно восстановлен пользователь", zap.Int("id", id))
+	return nil
+}
+
+// GetDeletedPersons - limit = 0 означает без ограничения
+func (s *SQLite) GetDeletedPersons(ctx context.Context, offset, limit int) ([]model.Person, error) {
+	query := `SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version, deleted_at FROM people WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id LIMIT ?1 OFFSET ?2`
+	if limit == 0 {
+		limit = -1
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	persons := make([]model.Person, 0)
+	for rows.Next() {
+		var deletedAt time.Time
+		person, err := scanPerson(rows, &deletedAt)
+		if err != nil {
+			s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+			return nil, fmt.Errorf("repository deleted persons scan failed: %w", err)
+		}
+		person.DeletedAt = &deletedAt
+		persons = append(persons, *person)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
+	}
+	return persons, nil
+}
+
+// PurgeDeleted - вместе с записями удаляется и их история
+func (s *SQLite) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		s.logger.Error("Ошибка начала транзакции при очистке", zap.Error(err))
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM people_history WHERE person_id IN (SELECT id FROM people WHERE deleted_at IS NOT NULL AND deleted_at < ?1)`, before.UTC())
+	if err != nil {
+		s.logger.Error("Ошибка очистки истории удаленных записей", zap.Error(err))
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM person_merges WHERE survivor_id IN (SELECT id FROM people WHERE deleted_at IS NOT NULL AND deleted_at < ?1)
+		OR merged_id IN (SELECT id FROM people WHERE deleted_at IS NOT NULL AND deleted_at < ?1)`, before.UTC())
+	if err != nil {
+		s.logger.Error("Ошибка очистки слияний удаленных записей", zap.Error(err))
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM people WHERE deleted_at IS NOT NULL AND deleted_at < ?1`, before.UTC())
+	if err != nil {
+		s.logger.Error("Ошибка очистки удаленных записей", zap.Error(err))
+		return 0, err
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Ошибка коммита транзакции после очистки", zap.Error(err))
+		return 0, err
+	}
+	return purged, nil
+}
+
+func (s *SQLite) GetPersonHistory(ctx context.Context, id int) ([]model.PersonHistory, error) {
+	query := `SELECT version, action, before_data, after_data, actor, changed_at FROM people_history WHERE person_id = ?1 ORDER BY version`
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, id)
+	if err != nil {
+		s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]model.PersonHistory, 0)
+	for rows.Next() {
+		entry := model.PersonHistory{PersonID: id}
+		var before, after sql.NullString
+		if err := rows.Scan(&entry.Version, &entry.Action, &before, &after, &entry.Actor, &entry.ChangedAt); err != nil {
+			s.logger.Error("Ошибка выполнения запроса", zap.String("error", err.Error()))
+			return nil, fmt.Errorf("repository history scan failed: %w", err)
+		}
+		if entry.Before, err = fromSnapshot(before); err != nil {
+			return nil, err
+		}
+		if entry.After, err = fromSnapshot(after); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
+	}
+	return history, nil
+}
+
+func (s *SQLite) RevertPerson(ctx context.Context, id, version int) (*model.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		s.logger.Error("Ошибка начала транзакции при откате", zap.Error(err))
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var data sql.NullString
+	err = tx.QueryRowContext(ctx, `SELECT after_data FROM people_history WHERE person_id = ?1 AND version = ?2`, id, version).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, customerrors.ErrVersionNotFound
+	}
+	if err != nil {
+		s.logger.Error("Ошибка получения версии", zap.Int("id", id), zap.Int("version", version), zap.Error(err))
+		return nil, err
+	}
+	target, err := fromSnapshot(data)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, customerrors.ErrVersionNotFound
+	}
+
+	person := &model.Person{
+		ID:          id,
+		Name:        target.Name,
+		Surname:     target.Surname,
+		Patronymic:  target.Patronymic,
+		Age:         target.Age,
+		Nationality: target.Nationality,
+		Gender:      target.Gender,
+	}
+	if err := s.updateTx(ctx, tx, person, model.HistoryRevert); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Ошибка коммита транзакции после отката", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+	s.logger.Info("Данные пользователя возвращены к версии", zap.Int("id", id), zap.Int("version", version))
+	return person, nil
+}
+
+// FindDuplicates - lower() в SQLite не понимает кириллицу, поэтому все живые записи группируются в dedup.Group.
+// limit = 0 означает без ограничения
+func (s *SQLite) FindDuplicates(ctx context.Context, limit int) ([]model.DuplicateGroup, error) {
+	query := `SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version FROM people WHERE deleted_at IS NULL ORDER BY id`
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		s.logger.Error("Ошибка выполнения запроса", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	persons := make([]model.Person, 0)
+	for rows.Next() {
+		person, err := scanPerson(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repository duplicates scan failed: %w", err)
+		}
+		persons = append(persons, *person)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Ошибка при сканировании: %w", err)
+	}
+	groups := dedup.Group(persons, limit)
+	s.logger.Info("Найдены группы дубликатов", zap.Int("groups", len(groups)))
+	return groups, nil
+}
+
+// MergePersons - дубликаты удаляются мягко, прежние слияния в них переводятся на survivor,
+// чтобы старый ID вел на живую запись
+func (s *SQLite) MergePersons(ctx context.Context, ids []int, survivorID int) (*model.Person, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.conn(ctx).begin(ctx, nil)
+	if err != nil {
+		s.logger.Error("Ошибка начала транзакции при слиянии", zap.Error(err))
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	persons := make([]model.Person, 0, len(ids))
+	for _, id := range ids {
+		person, err := s.getPerson(ctx, tx, id)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && person.DeletedAt != nil) {
+			s.logger.Debug("Нечего объединять", zap.Int("id", id))
+			return nil, customerrors.ErrNothingToMerge
+		}
+		if err != nil {
+			s.logger.Error("Ошибка получения записи перед слиянием", zap.Int("id", id), zap.Error(err))
+			return nil, err
+		}
+		persons = append(persons, *person)
+	}
+	survivor, duplicates, ok := dedup.Split(persons, survivorID)
+	if !ok {
+		return nil, customerrors.ErrNothingToMerge
+	}
+
+	merged := dedup.Merge(survivor, duplicates)
+	if err := s.updateTx(ctx, tx, &merged, model.HistoryMerge); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	who := actor.FromContext(ctx)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM person_merges WHERE merged_id = ?1`, survivor.ID); err != nil {
+		s.logger.Error("Ошибка записи слияния", zap.Int("id", survivor.ID), zap.Error(err))
+		return nil, err
+	}
+	mergedIDs := make([]int, 0, len(duplicates))
+	for _, before := range duplicates {
+		after := before
+		after.DeletedAt = &now
+		if err := tx.QueryRowContext(ctx, `UPDATE people SET deleted_at = ?1, version = version + 1 WHERE id = ?2 RETURNING version`, now, before.ID).Scan(&after.Version); err != nil {
+			s.logger.Error("Ошибка удаления дубликата при слиянии", zap.Int("id", before.ID), zap.Error(err))
+			return nil, err
+		}
+		if err := s.insertHistory(ctx, tx, model.HistoryMerge, &before, &after); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE person_merges SET survivor_id = ?1 WHERE survivor_id = ?2`, survivor.ID, before.ID); err != nil {
+			s.logger.Error("Ошибка записи слияния", zap.Int("id", before.ID), zap.Error(err))
+			return nil, err
+		}
+		query := `INSERT INTO person_merges (merged_id, survivor_id, actor, merged_at) VALUES (?1, ?2, ?3, ?4)
+			ON CONFLICT (merged_id) DO UPDATE SET survivor_id = excluded.survivor_id, actor = excluded.actor, merged_at = excluded.merged_at`
+		if _, err := tx.ExecContext(ctx, query, before.ID, survivor.ID, who, now); err != nil {
+			s.logger.Error("Ошибка записи слияния", zap.Int("id", before.ID), zap.Error(err))
+			return nil, err
+		}
+		mergedIDs = append(mergedIDs, before.ID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Ошибка коммита транзакции после слияния", zap.Int("id", survivor.ID), zap.Error(err))
+		return nil, err
+	}
+	s.logger.Info("Записи объединены", zap.Int("id", survivor.ID), zap.Ints("merged", mergedIDs))
+	return &merged, nil
+}
+
+// ResolveMergedID - ID записи, в которую был слит id, ErrPersonNotFound если id не сливался
+func (s *SQLite) ResolveMergedID(ctx context.Context, id int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var survivorID int
+	err := s.conn(ctx).QueryRowContext(ctx, `SELECT survivor_id FROM person_merges WHERE merged_id = ?1`, id).Scan(&survivorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, customerrors.ErrPersonNotFound
+	}
+	if err != nil {
+		s.logger.Error("Ошибка получения записи о слиянии", zap.Int("id", id), zap.Error(err))
+		return 0, err
+	}
+	return survivorID, nil
+}
+
+// getPerson - читает запись в транзакции, в том числе удаленную. Блокировка строки не нужна:
+// соединение с базой одно, и транзакции SQLite выполняются по очереди.
+func (s *SQLite) getPerson(ctx context.Context, tx *txn, id int) (*model.Person, error) {
+	query := `SELECT id, name, surname, patronymic, age, nationality, gender, created_at, updated_at, version, deleted_at FROM people WHERE id = ?1`
+	var deletedAt sql.NullTime
+	person, err := scanPerson(tx.QueryRowContext(ctx, query, id), &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt.Valid {
+		person.DeletedAt = &deletedAt.Time
+	}
+	return person, nil
+}
+
+// insertHistory - пишет изменение в people_history и событие о нем в outbox в транзакции самого изменения.
+// Версия записи истории - after.Version, которую вернул RETURNING version изменившего строку запроса
+func (s *SQLite) insertHistory(ctx context.Context, tx *txn, action string, before, after *model.Person) error {
+	query := `INSERT INTO people_history (person_id, version, action, before_data, after_data, actor, changed_at) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)`
+
+	beforeData, err := toSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterData, err := toSnapshot(after)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, query, after.ID, after.Version, action, beforeData, afterData, actor.FromContext(ctx), time.Now()); err != nil {
+		s.logger.Error("Ошибка записи истории изменений", zap.Int("id", after.ID), zap.String("action", action), zap.Error(err))
+		return err
+	}
+	// INSERT в CTE SQLite не поддерживает, событие копируется из только что записанной строки истории
+	outbox := `INSERT INTO outbox (person_id, version, action, before_data, after_data, actor, occurred_at)
+		SELECT person_id, version, action, before_data, after_data, actor, changed_at FROM people_history WHERE id = last_insert_rowid()`
+	if _, err := tx.ExecContext(ctx, outbox); err != nil {
+		s.logger.Error("Ошибка записи события в outbox", zap.Int("id", after.ID), zap.String("action", action), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func toSnapshot(person *model.Person) (sql.NullString, error) {
+	if person == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(person)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("history snapshot marshal failed: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func fromSnapshot(data sql.NullString) (*model.Person, error) {
+	if !data.Valid {
+		return nil, nil
+	}
+	var person model.Person
+	if err := json.Unmarshal([]byte(data.String), &person); err != nil {
+		return nil, fmt.Errorf("history snapshot unmarshal failed: %w", err)
+	}
+	return &person, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanPerson - extra получает колонки, выбранные после version
+func scanPerson(row scanner, extra ...any) (*model.Person, error) {
+	var (
+		person      model.Person
+		patronymic  sql.NullString
+		age         sql.NullInt64
+		nationality sql.NullString
+		gender      sql.NullString
+	)
+	dest := append([]any{&person.ID, &person.Name, &person.Surname, &patronymic, &age, &nationality, &gender, &person.CreatedAt, &person.UpdatedAt, &person.Version}, extra...)
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	person.Patronymic = patronymic.String
+	person.Age = age.Int64
+	person.Nationality = nationality.String
+	person.Gender = gender.String
+	return &person, nil
+}
+
+func nullStats(person *model.Person) (sql.NullInt64, sql.NullString, sql.NullString) {
+	return sql.NullInt64{Int64: person.Age, Valid: person.Age != 0},
+		sql.NullString{String: person.Nationality, Valid: person.Nationality != ""},
+		sql.NullString{String: person.Gender, Valid: person.Gender != ""}
+}
@@ -0,0 +1,634 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/actor"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestSQLite(t *testing.T) *SQLite {
+	db, err := ConnectDB("file:"+filepath.Join(t.TempDir(), "people.db"), time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	s := NewSQLite(db, zap.NewNop(), time.Second)
+	migrations, err := s.Migrations("")
+	require.NoError(t, err)
+	_, err = migrations.Up(context.Background())
+	require.NoError(t, err)
+	return s
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestConnectDBTimeFormat(t *testing.T) {
+	s := newTestSQLite(t)
+	person := model.Person{Name: "Ivan", Surname: "Ivanov"}
+	require.NoError(t, s.CreatePerson(context.Background(), &person))
+
+	var createdAt string
+	var valid bool
+	err := s.db.QueryRow(`SELECT created_at, julianday(created_at) IS NOT NULL FROM people WHERE id = ?`, person.ID).Scan(&createdAt, &valid)
+	require.NoError(t, err)
+	assert.True(t, valid, "время должно читаться функциями даты SQLite: %s", createdAt)
+}
+
+func seed(t *testing.T, s *SQLite) {
+	persons := []model.Person{
+		{Name: "Ivan", Surname: "Ivanov", Patronymic: "Petrovich", Age: 30, Gender: "male", Nationality: "RU"},
+		{Name: "Anna", Surname: "Ivanova", Age: 25, Gender: "female", Nationality: "RU"},
+		{Name: "Olga", Surname: "Petrova", Age: 25, Gender: "female", Nationality: "KZ"},
+		{Name: "Ivan", Surname: "Petrov"},
+	}
+	for i := range persons {
+		require.NoError(t, s.CreatePerson(context.Background(), &persons[i]))
+	}
+}
+
+func TestCreateAndGetPerson(t *testing.T) {
+	s := newTestSQLite(t)
+	ctx := context.Background()
+
+	person := model.Person{Name: "Ivan", Surname: "Ivanov", Patronymic: "Petrovich", Age: 30, Gender: "male", Nationality: "RU"}
+	require.NoError(t, s.CreatePerson(ctx, &person))
+	assert.Equal(t, 1, person.ID)
+
+	got, err := s.GetPersonByID(ctx, person.ID)
+	require.NoError(t, err)
+	assert.Equal(t, person.Name, got.Name)
+	assert.Equal(t, person.Patronymic, got.Patronymic)
+	assert.Equal(t, person.Age, got.Age)
+	assert.Equal(t, person.Gender, got.Gender)
+	assert.Equal(t, person.Nationality, got.Nationality)
+	assert.True(t, person.CreatedAt.Equal(got.CreatedAt), "created_at: %v != %v", person.CreatedAt, got.CreatedAt)
+	assert.True(t, person.UpdatedAt.Equal(got.UpdatedAt))
+
+	empty := model.Person{Name: "Petr", Surname: "Petrov"}
+	require.NoError(t, s.CreatePerson(ctx, &empty))
+	var age, gender any
+	require.NoError(t, s.db.QueryRow(`SELECT age, gender FROM people WHERE id = ?1`, empty.ID).Scan(&age, &gender))
+	assert.Nil(t, age, "пустой возраст хранится как NULL")
+	assert.Nil(t, gender, "пустой пол хранится как NULL")
+
+	_, err = s.GetPersonByID(ctx, 99)
+	assert.ErrorIs(t, err, customerrors.ErrPersonNotFound)
+}
+
+func TestGetPersonsByFilter(t *testing.T) {
+	s := newTestSQLite(t)
+	seed(t, s)
+
+	tests := []struct {
+		name          string
+		filter        model.PersonFilter
+		after         *model.Cursor
+		limit         int
+		wantIDs       []int
+	}{
+		{name: "No filter", wantIDs: []int{1, 2, 3, 4}},
+		{name: "By name", filter: model.PersonFilter{Names: []string{"Ivan"}}, wantIDs: []int{1, 4}},
+		{name: "By patronymic", filter: model.PersonFilter{Patronymics: []string{"Petrovich"}}, wantIDs: []int{1}},
+		{name: "By age and gender", filter: model.PersonFilter{Ages: []int64{25}, Genders: []string{"female"}}, wantIDs: []int{2, 3}},
+		{name: "Nationality in list", filter: model.PersonFilter{Nationalities: []string{"RU", "KZ"}}, wantIDs: []int{1, 2, 3}},
+		{name: "Age range", filter: model.PersonFilter{AgeMin: ptr[int64](20), AgeMax: ptr[int64](29)}, wantIDs: []int{2, 3}},
+		{name: "Surname prefix", filter: model.PersonFilter{SurnamePrefix: "Petrov"}, wantIDs: []int{3, 4}},
+		{name: "Prefix is case sensitive", filter: model.PersonFilter{NamePrefix: "iv"}, wantIDs: []int{}},
+		{name: "Prefix is not a pattern", filter: model.PersonFilter{NamePrefix: "%"}, wantIDs: []int{}},
+		{name: "By IDs", filter: model.PersonFilter{IDs: []int{3, 1}}, wantIDs: []int{1, 3}},
+		{name: "Sorted by age desc", filter: model.PersonFilter{Sort: []model.SortField{{Field: "age", Desc: true}}}, wantIDs: []int{1, 2, 3, 4}},
+		{name: "Sorted by gender and age", filter: model.PersonFilter{Sort: []model.SortField{{Field: "gender"}, {Field: "age"}}}, wantIDs: []int{4, 2, 3, 1}},
+		{name: "Sorted with filter and page", filter: model.PersonFilter{Names: []string{"Ivan", "Olga"}, Sort: []model.SortField{{Field: "surname", Desc: true}}}, after: &model.Cursor{Key: model.Person{ID: 3, Surname: "Petrova"}}, limit: 1, wantIDs: []int{4}},
+		{name: "Sorted by age before cursor", filter: model.PersonFilter{Sort: []model.SortField{{Field: "age"}}}, after: &model.Cursor{Key: model.Person{ID: 1, Age: 30}, Backward: true}, limit: 2, wantIDs: []int{2, 3}},
+		{name: "Sorted by created_at desc", filter: model.PersonFilter{Sort: []model.SortField{{Field: "created_at", Desc: true}}}, limit: 1, wantIDs: []int{4}},
+		{name: "Created before now", filter: model.PersonFilter{CreatedBefore: ptr(time.Now().Add(time.Second))}, wantIDs: []int{1, 2, 3, 4}},
+		{name: "Limit", limit: 2, wantIDs: []int{1, 2}},
+		{name: "After cursor without limit", after: &model.Cursor{Key: model.Person{ID: 3}}, wantIDs: []int{4}},
+		{name: "After cursor with limit", after: &model.Cursor{Key: model.Person{ID: 1}}, limit: 2, wantIDs: []int{2, 3}},
+		{name: "Before cursor", after: &model.Cursor{Key: model.Person{ID: 3}, Backward: true}, wantIDs: []int{1, 2}},
+		{name: "Nothing found", filter: model.PersonFilter{Surnames: []string{"Sidorov"}}, wantIDs: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			persons, err := s.GetPersonsByFilter(context.Background(), tt.filter, tt.after, tt.limit)
+			require.NoError(t, err)
+
+			ids := make([]int, 0, len(persons))
+			for _, p := range persons {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+}
+
+func TestSearchPersons(t *testing.T) {
+	s := newTestSQLite(t)
+	seed(t, s)
+	ctx := context.Background()
+	require.NoError(t, s.CreatePerson(ctx, &model.Person{Name: "Иван", Surname: "Иванов", Patronymic: "Петрович"}))
+	require.NoError(t, s.DeletePersonByID(ctx, 2))
+
+	results, err := s.SearchPersons(ctx, "Иванов", 0, 0)
+	require.NoError(t, err)
+	ids := make([]int, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	assert.Equal(t, []int{1, 5, 4}, ids, "транслитерация находит Ivanov, похожее имя Ivan ниже, удаленная Ivanova не найдена")
+	assert.Equal(t, results[0].Score, results[1].Score)
+	assert.Greater(t, results[1].Score, results[2].Score)
+	assert.Equal(t, "Petrovich", results[0].Patronymic)
+
+	results, err = s.SearchPersons(ctx, "Petrovich", 0, 1)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, 1, results[0].ID)
+}
+
+func TestFilterByTime(t *testing.T) {
+	s := newTestSQLite(t)
+	seed(t, s)
+	ctx := context.Background()
+
+	mark := time.Now()
+	person, err := s.GetPersonByID(ctx, 3)
+	require.NoError(t, err)
+	person.Age = 26
+	require.NoError(t, s.UpdatePersonByID(ctx, person))
+
+	persons, err := s.GetPersonsByFilter(ctx, model.PersonFilter{UpdatedAfter: ptr(mark.UTC())}, nil, 0)
+	require.NoError(t, err)
+	require.Len(t, persons, 1, "граница в UTC сравнивается со временем в локальном поясе")
+	assert.Equal(t, 3, persons[0].ID)
+
+	persons, err = s.GetPersonsByFilter(ctx, model.PersonFilter{CreatedAfter: &mark}, nil, 0)
+	require.NoError(t, err)
+	assert.Empty(t, persons)
+}
+
+func TestUpdateAndDelete(t *testing.T) {
+	s := newTestSQLite(t)
+	seed(t, s)
+	ctx := context.Background()
+
+	person, err := s.GetPersonByID(ctx, 4)
+	require.NoError(t, err)
+	person.Age = 41
+	person.Nationality = "BY"
+	require.NoError(t, s.UpdatePersonByID(ctx, person))
+
+	got, err := s.GetPersonByID(ctx, 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(41), got.Age)
+	assert.Equal(t, "BY", got.Nationality)
+	assert.Equal(t, "", got.Gender)
+	assert.False(t, got.UpdatedAt.Before(got.CreatedAt))
+
+	assert.ErrorIs(t, s.UpdatePersonByID(ctx, &model.Person{ID: 99}), customerrors.ErrNothingToUpdate)
+
+	require.NoError(t, s.DeletePersonByID(ctx, 4))
+	assert.ErrorIs(t, s.DeletePersonByID(ctx, 4), customerrors.ErrNothingToDelete)
+	_, err = s.GetPersonByID(ctx, 4)
+	assert.ErrorIs(t, err, customerrors.ErrPersonNotFound)
+	assert.ErrorIs(t, s.UpdatePersonByID(ctx, got), customerrors.ErrNothingToUpdate)
+}
+
+func TestSoftDelete(t *testing.T) {
+	s := newTestSQLite(t)
+	seed(t, s)
+	ctx := context.Background()
+
+	require.NoError(t, s.DeletePersonByID(ctx, 1))
+	require.NoError(t, s.DeletePersonByID(ctx, 3))
+
+	persons, err := s.GetPersonsByFilter(ctx, model.PersonFilter{}, nil, 0)
+	require.NoError(t, err)
+	assert.Len(t, persons, 2)
+	stats, err := s.GetNameStats(ctx, "", 10)
+	require.NoError(t, err)
+	assert.Len(t, stats, 1, "удаленные записи не попадают в прогрев")
+
+	deleted, err := s.GetDeletedPersons(ctx, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, deleted, 2)
+	assert.Equal(t, 3, deleted[0].ID, "сначала последние удаленные")
+	require.NotNil(t, deleted[0].DeletedAt)
+
+	assert.ErrorIs(t, s.RestorePersonByID(ctx, 2), customerrors.ErrNothingToRestore)
+	require.NoError(t, s.RestorePersonByID(ctx, 1))
+	_, err = s.GetPersonByID(ctx, 1)
+	require.NoError(t, err)
+
+	purged, err := s.PurgeDeleted(ctx, deleted[0].DeletedAt.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+	purged, err = s.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+}
+
+func TestGetNameStats(t *testing.T) {
+	s := newTestSQLite(t)
+	seed(t, s)
+
+	stats, err := s.GetNameStats(context.Background(), "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []model.NameStats{
+		{Name: "Anna", PersonStats: model.PersonStats{Age: 25, Gender: "female", Nationality: "RU"}},
+		{Name: "Ivan", PersonStats: model.PersonStats{Age: 30, Gender: "male", Nationality: "RU"}},
+		{Name: "Olga", PersonStats: model.PersonStats{Age: 25, Gender: "female", Nationality: "KZ"}},
+	}, stats)
+
+	stats, err = s.GetNameStats(context.Background(), "Ivan", 10)
+	require.NoError(t, err)
+	assert.Len(t, stats, 1)
+}
+
+func TestHistory(t *testing.T) {
+	s := newTestSQLite(t)
+	ctx := actor.WithActor(context.Background(), "alice")
+
+	person := model.Person{Name: "Ivan", Surname: "Ivanov", Age: 30}
+	require.NoError(t, s.CreatePerson(ctx, &person))
+	person.Surname = "Petrov"
+	require.NoError(t, s.UpdatePersonByID(ctx, &person))
+	require.NoError(t, s.DeletePersonByID(ctx, person.ID))
+	require.NoError(t, s.RestorePersonByID(ctx, person.ID))
+
+	reverted, err := s.RevertPerson(ctx, person.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Ivanov", reverted.Surname)
+	got, err := s.GetPersonByID(ctx, person.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Ivanov", got.Surname)
+
+	history, err := s.GetPersonHistory(ctx, person.ID)
+	require.NoError(t, err)
+	actions := make([]string, 0, len(history))
+	for i, entry := range history {
+		assert.Equal(t, i+1, entry.Version)
+		assert.Equal(t, "alice", entry.Actor)
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{model.HistoryCreate, model.HistoryUpdate, model.HistoryDelete, model.HistoryRestore, model.HistoryRevert}, actions)
+	assert.Nil(t, history[0].Before)
+	assert.Equal(t, "Ivanov", history[1].Before.Surname)
+	assert.Equal(t, "Petrov", history[1].After.Surname)
+	assert.NotNil(t, history[2].After.DeletedAt)
+
+	_, err = s.RevertPerson(ctx, person.ID, 99)
+	assert.ErrorIs(t, err, customerrors.ErrVersionNotFound)
+
+	require.NoError(t, s.DeletePersonByID(ctx, person.ID))
+	_, err = s.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	history, err = s.GetPersonHistory(ctx, person.ID)
+	require.NoError(t, err)
+	assert.Empty(t, history, "история удаляется вместе с записью")
+}
+
+func TestHistoryVersionFollowsRow(t *testing.T) {
+	s := newTestSQLite(t)
+	ctx := context.Background()
+
+	// запись, измененная до появления истории: версия строки опережает историю
+	_, err := s.db.Exec(`INSERT INTO people (id, name, surname, created_at, updated_at, version) VALUES (1, 'Ivan', 'Ivanov', ?1, ?1, 3)`, time.Now())
+	require.NoError(t, err)
+
+	person, err := s.PatchPersonByID(ctx, 1, model.PersonPatch{Surname: model.Optional[string]{Set: true, Value: "Petrov"}}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 4, person.Version)
+	require.NoError(t, s.DeletePersonByID(ctx, 1))
+
+	history, err := s.GetPersonHistory(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, 4, history[0].Version)
+	assert.Equal(t, 4, history[0].After.Version)
+	assert.Equal(t, 5, history[1].Version, "версия истории совпадает с версией строки, а не со счетчиком истории")
+}
+
+func TestVersionConflict(t *testing.T) {
+	s := newTestSQLite(t)
+	ctx := context.Background()
+
+	person := model.Person{Name: "Ivan", Surname: "Ivanov"}
+	require.NoError(t, s.CreatePerson(ctx, &person))
+	assert.Equal(t, 1, person.Version)
+
+	first, second := person, person
+	first.Age = 30
+	require.NoError(t, s.UpdatePersonByID(ctx, &first))
+	assert.Equal(t, 2, first.Version)
+
+	second.Age = 40
+	assert.ErrorIs(t, s.UpdatePersonByID(ctx, &second), customerrors.ErrVersionConflict, "второй редактор работал со старой версией")
+
+	got, err := s.GetPersonByID(ctx, person.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), got.Age)
+	assert.Equal(t, 2, got.Version)
+
+	require.NoError(t, s.DeletePersonByID(ctx, person.ID))
+	deleted, err := s.GetDeletedPersons(ctx, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, deleted[0].Version, "удаление тоже увеличивает версию")
+}
+
+func TestBulkCreatePersons(t *testing.T) {
+	s := newTestSQLite(t)
+	ctx := actor.WithActor(context.Background(), "importer")
+	persons := []model.Person{
+		{Name: "Ivan", Surname: "Ivanov", Age: 30, Gender: "male", Nationality: "RU"},
+		{Name: "", Surname: "Nameless"},
+		{Name: "Anna", Surname: "Ivanova", Gender: "unknown"},
+		{Name: "Olga", Surname: "Petrova"},
+	}
+
+	_, err := s.BulkCreatePersons(ctx, slices.Clone(persons), true)
+	assert.ErrorIs(t, err, customerrors.ErrBulkRejected)
+	all, err := s.GetPersonsByFilter(ctx, model.PersonFilter{}, nil, 0)
+	require.NoError(t, err)
+	assert.Empty(t, all, "в атомарном режиме ничего не вставлено")
+
+	result, err := s.BulkCreatePersons(ctx, persons, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Created)
+	assert.Equal(t, []int{1, 0, 0, 2}, result.IDs)
+	assert.Equal(t, []int{1, 2}, []int{result.Errors[0].Index, result.Errors[1].Index})
+	assert.Equal(t, 2, persons[3].ID)
+
+	got, err := s.GetPersonByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "RU", got.Nationality)
+	assert.Equal(t, 1, got.Version)
+	history, err := s.GetPersonHistory(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, model.HistoryCreate, history[0].Action)
+	assert.Equal(t, "importer", history[0].Actor)
+}
+
+func TestGetDemographics(t *testing.T) {
+	s := newTestSQLite(t)
+	seed(t, s)
+	ctx := context.Background()
+
+	stats, err := s.GetDemographics(ctx, model.PersonFilter{}, model.DemographicsOptions{BucketWidth: 10, Top: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), stats.Total)
+	assert.Equal(t, []model.ValueCount{{Value: "female", Count: 2}, {Value: "", Count: 1}, {Value: "male", Count: 1}}, stats.Genders)
+	assert.Equal(t, []model.ValueCount{{Value: "RU", Count: 2}, {Value: "", Count: 1}, {Value: "KZ", Count: 1}}, stats.Nationalities)
+	assert.Equal(t, []model.AgeBucket{{From: 20, To: 29, Count: 2}, {From: 30, To: 39, Count: 1}}, stats.AgeBuckets)
+	assert.Equal(t, []model.ValueCount{{Value: "Ivan", Count: 2}}, stats.TopNames)
+	assert.Equal(t, []model.ValueCount{{Value: "Ivanov", Count: 1}}, stats.TopSurnames)
+	assert.Equal(t, model.Coverage{Age: 75, Gender: 75, Nationality: 75, Complete: 75}, stats.Coverage)
+
+	stats, err = s.GetDemographics(ctx, model.PersonFilter{Nationalities: []string{"RU"}}, model.DemographicsOptions{BucketWidth: 5})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Total)
+	assert.Equal(t, []model.AgeBucket{{From: 25, To: 29, Count: 1}, {From: 30, To: 34, Count: 1}}, stats.AgeBuckets)
+	assert.Len(t, stats.TopSurnames, 2, "top = 0 - все значения")
+	assert.Equal(t, 100.0, stats.Coverage.Complete)
+
+	stats, err = s.GetDemographics(ctx, model.PersonFilter{Names: []string{"Nobody"}}, model.DemographicsOptions{BucketWidth: 10, Top: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Total)
+	assert.Empty(t, stats.AgeBuckets)
+	assert.Equal(t, model.Coverage{}, stats.Coverage)
+}
+
+func TestGetPersonFacets(t *testing.T) {
+	s := newTestSQLite(t)
+	seed(t, s)
+	ctx := context.Background()
+
+	facets, err := s.GetPersonFacets(ctx, model.PersonFilter{}, []string{"nationality", "gender", "age"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]model.ValueCount{
+		"nationality": {{Value: "RU", Count: 2}, {Value: "KZ", Count: 1}},
+		"gender":      {{Value: "female", Count: 2}, {Value: "male", Count: 1}},
+		"age":         {{Value: "20-29", Count: 2}, {Value: "30-39", Count: 1}},
+	}, facets, "люди без обогащения не считаются")
+
+	facets, err = s.GetPersonFacets(ctx, model.PersonFilter{Genders: []string{"female"}, Sort: []model.SortField{{Field: "age"}}}, []string{"nationality"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]model.ValueCount{"nationality": {{Value: "KZ", Count: 1}, {Value: "RU", Count: 1}}}, facets)
+
+	facets, err = s.GetPersonFacets(ctx, model.PersonFilter{Names: []string{"Nobody"}}, []string{"gender"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]model.ValueCount{"gender": {}}, facets)
+}
+
+func TestMergePersons(t *testing.T) {
+	s := newTestSQLite(t)
+	ctx := context.Background()
+	persons := []model.Person{
+		{Name: "Ivan", Surname: "Petrov", Age: 30},
+		{Name: "ivan", Surname: "PETROV", Gender: "male"},
+		{Name: "Иван", Surname: "Петров"},
+		{Name: "IVAN", Surname: "petrov", Nationality: "RU"},
+	}
+	for i := range persons {
+		require.NoError(t, s.CreatePerson(ctx, &persons[i]))
+	}
+
+	groups, err := s.FindDuplicates(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, 1, groups[0].SurvivorID)
+	assert.Len(t, groups[0].Persons, 3)
+
+	merged, err := s.MergePersons(ctx, []int{2, 1}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, merged.ID)
+	assert.Equal(t, int64(30), merged.Age)
+	assert.Equal(t, "male", merged.Gender)
+	assert.Equal(t, 2, merged.Version)
+	_, err = s.GetPersonByID(ctx, 2)
+	assert.ErrorIs(t, err, customerrors.ErrPersonNotFound)
+	history, err := s.GetPersonHistory(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, model.HistoryMerge, history[len(history)-1].Action)
+
+	_, err = s.MergePersons(ctx, []int{1, 2}, 0)
+	assert.ErrorIs(t, err, customerrors.ErrNothingToMerge)
+
+	merged, err = s.MergePersons(ctx, []int{1, 4}, 4)
+	require.NoError(t, err)
+	assert.Equal(t, 4, merged.ID)
+	assert.Equal(t, "RU", merged.Nationality)
+	assert.Equal(t, "male", merged.Gender)
+
+	for id, want := range map[int]int{1: 4, 2: 4} {
+		got, err := s.ResolveMergedID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "id %d", id)
+	}
+	_, err = s.ResolveMergedID(ctx, 4)
+	assert.ErrorIs(t, err, customerrors.ErrPersonNotFound)
+
+	require.NoError(t, s.RestorePersonByID(ctx, 1))
+	_, err = s.MergePersons(ctx, []int{1, 4}, 1)
+	require.NoError(t, err)
+	_, err = s.ResolveMergedID(ctx, 1)
+	assert.ErrorIs(t, err, customerrors.ErrPersonNotFound, "оставшаяся запись больше не перенаправляется")
+	got, err := s.ResolveMergedID(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got)
+
+	require.NoError(t, s.RestorePersonByID(ctx, 2))
+	require.NoError(t, s.DeletePersonByID(ctx, 1))
+	purged, err := s.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+	for _, id := range []int{2, 4} {
+		_, err = s.ResolveMergedID(ctx, id)
+		assert.ErrorIs(t, err, customerrors.ErrPersonNotFound, "слияние с очищенной записью удаляется вместе с ней, id %d", id)
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	s := newTestSQLite(t)
+	ctx := context.Background()
+	errStop := errors.New("stop")
+	count := func(ctx context.Context) int64 {
+		total, _, err := s.CountPersons(ctx, model.PersonFilter{}, false)
+		require.NoError(t, err)
+		return total
+	}
+
+	person := model.Person{Name: "Ivan", Surname: "Petrov"}
+	err := s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+		if err := s.CreatePerson(ctx, &person); err != nil {
+			return err
+		}
+		person.Age = 30
+		return s.UpdatePersonByID(ctx, &person)
+	})
+	require.NoError(t, err)
+	got, err := s.GetPersonByID(ctx, person.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), got.Age)
+	assert.Equal(t, 2, got.Version)
+
+	err = s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+		require.NoError(t, s.CreatePerson(ctx, &model.Person{Name: "Anna", Surname: "Li"}))
+		require.NoError(t, s.DeletePersonByID(ctx, person.ID))
+		_, err := s.GetPersonByID(ctx, person.ID)
+		assert.ErrorIs(t, err, customerrors.ErrPersonNotFound, "внутри транзакции видны ее изменения")
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, int64(1), count(ctx), "ошибка fn откатывает все изменения")
+	_, err = s.GetPersonByID(ctx, person.ID)
+	require.NoError(t, err)
+
+	assert.Panics(t, func() {
+		_ = s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+			require.NoError(t, s.DeletePersonByID(ctx, person.ID))
+			panic("boom")
+		})
+	})
+	_, err = s.GetPersonByID(ctx, person.ID)
+	assert.NoError(t, err, "паника откатывает транзакцию")
+
+	err = s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+		require.NoError(t, s.CreatePerson(ctx, &model.Person{Name: "Olga", Surname: "Petrova"}))
+		nested := s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+			require.NoError(t, s.DeletePersonByID(ctx, person.ID))
+			return errStop
+		})
+		assert.ErrorIs(t, nested, errStop)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count(ctx), "вложенная транзакция откатывается отдельно от внешней")
+}
+
+func TestOutbox(t *testing.T) {
+	s := newTestSQLite(t)
+	ctx := context.Background()
+
+	person := model.Person{Name: "Ivan", Surname: "Petrov"}
+	require.NoError(t, s.CreatePerson(ctx, &person))
+	person.Age = 30
+	require.NoError(t, s.UpdatePersonByID(ctx, &person))
+	require.NoError(t, s.DeletePersonByID(ctx, person.ID))
+	err := s.WithTx(ctx, model.TxOptions{}, func(ctx context.Context) error {
+		require.NoError(t, s.CreatePerson(ctx, &model.Person{Name: "Anna", Surname: "Li"}))
+		return errors.New("stop")
+	})
+	require.Error(t, err)
+
+	events, err := s.GetOutboxEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 3, "событие откаченной транзакции не записано")
+	types := []string{events[0].Type, events[1].Type, events[2].Type}
+	assert.Equal(t, []string{"person.create", "person.update", "person.delete"}, types)
+	assert.Equal(t, []int{1, 2, 3}, []int{events[0].Version, events[1].Version, events[2].Version})
+	assert.Nil(t, events[0].Before)
+	assert.Equal(t, int64(30), events[1].After.Age)
+	assert.Equal(t, actor.System, events[2].Actor)
+
+	require.NoError(t, s.MarkOutboxDelivered(ctx, []int64{events[0].ID, events[1].ID}))
+	events, err = s.GetOutboxEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "person.delete", events[0].Type)
+
+	purged, err := s.PurgeOutbox(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged, "недоставленные события не удаляются")
+}
+
+func TestPatchPerson(t *testing.T) {
+	s := newTestSQLite(t)
+	ctx := context.Background()
+	person := model.Person{Name: "Ivan", Surname: "Ivanov", Patronymic: "Petrovich", Age: 30, Gender: "male", Nationality: "RU"}
+	require.NoError(t, s.CreatePerson(ctx, &person))
+
+	patch := model.PersonPatch{
+		Patronymic:  model.Optional[string]{Set: true, Null: true},
+		Nationality: model.Optional[string]{Set: true, Null: true},
+		Age:         model.Optional[int64]{Set: true, Value: 31},
+	}
+	patched, err := s.PatchPersonByID(ctx, person.ID, patch, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, patched.Version)
+
+	got, err := s.GetPersonByID(ctx, person.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Ivan", got.Name, "незаданные поля не меняются")
+	assert.Equal(t, "male", got.Gender)
+	assert.Empty(t, got.Patronymic)
+	assert.Empty(t, got.Nationality)
+	assert.Equal(t, int64(31), got.Age)
+	assert.Equal(t, 2, got.Version)
+
+	history, err := s.GetPersonHistory(ctx, person.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "Petrovich", history[1].Before.Patronymic)
+	assert.Empty(t, history[1].After.Patronymic)
+
+	_, err = s.PatchPersonByID(ctx, person.ID, patch, 1)
+	assert.ErrorIs(t, err, customerrors.ErrVersionConflict)
+	unchanged, err := s.PatchPersonByID(ctx, person.ID, model.PersonPatch{}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, unchanged.Version, "пустой патч не меняет запись")
+	_, err = s.PatchPersonByID(ctx, 100, patch, 0)
+	assert.ErrorIs(t, err, customerrors.ErrNothingToUpdate)
+}
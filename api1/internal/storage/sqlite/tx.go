@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"go.uber.org/zap"
+)
+
+// txKey - ключ транзакции WithTx в контексте, привязан к базе
+type txKey struct {
+	db *sql.DB
+}
+
+// unitOfWork - транзакция WithTx, savepoints - счетчик для имен точек сохранения
+type unitOfWork struct {
+	tx         *sql.Tx
+	savepoints int
+}
+
+// txn - транзакция метода хранилища, внутри WithTx - точка сохранения в общей транзакции
+type txn struct {
+	*sql.Tx
+	ctx       context.Context
+	savepoint string
+	done      bool
+}
+
+func (t *txn) Commit() error {
+	if t.savepoint == "" {
+		return t.Tx.Commit()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.Tx.ExecContext(t.ctx, "RELEASE SAVEPOINT "+t.savepoint)
+	return err
+}
+
+func (t *txn) Rollback() error {
+	if t.savepoint == "" {
+		return t.Tx.Rollback()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.Tx.ExecContext(t.ctx, "ROLLBACK TO SAVEPOINT "+t.savepoint)
+	return err
+}
+
+// conn - база или транзакция WithTx из контекста. У базы одно соединение, поэтому внутри WithTx
+// все запросы обязаны идти через транзакцию
+type conn struct {
+	db  *sql.DB
+	uow *unitOfWork
+}
+
+func (s *SQLite) conn(ctx context.Context) conn {
+	uow, _ := ctx.Value(txKey{s.db}).(*unitOfWork)
+	return conn{db: s.db, uow: uow}
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if c.uow != nil {
+		return c.uow.tx.QueryContext(ctx, query, args...)
+	}
+	return c.db.QueryContext(ctx, query, args...)
+}
+
+func (c conn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if c.uow != nil {
+		return c.uow.tx.QueryRowContext(ctx, query, args...)
+	}
+	return c.db.QueryRowContext(ctx, query, args...)
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if c.uow != nil {
+		return c.uow.tx.ExecContext(ctx, query, args...)
+	}
+	return c.db.ExecContext(ctx, query, args...)
+}
+
+// begin - новая транзакция, а внутри WithTx - точка сохранения
+func (c conn) begin(ctx context.Context, opts *sql.TxOptions) (*txn, error) {
+	if c.uow == nil {
+		tx, err := c.db.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &txn{Tx: tx}, nil
+	}
+	c.uow.savepoints++
+	name := "uow_" + strconv.Itoa(c.uow.savepoints)
+	if _, err := c.uow.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return nil, err
+	}
+	return &txn{Tx: c.uow.tx, ctx: context.WithoutCancel(ctx), savepoint: name}, nil
+}
+
+// WithTx - вызовы хранилища с контекстом, переданным в fn, выполняются в одной транзакции, ошибка
+// или паника fn ее откатывают. Транзакции SQLite всегда SERIALIZABLE, а писатель у базы один, поэтому
+// opts.Isolation и opts.MaxRetries не используются. Вложенный WithTx - точка сохранения во внешней транзакции
+func (s *SQLite) WithTx(ctx context.Context, opts model.TxOptions, fn func(ctx context.Context) error) error {
+	c := s.conn(ctx)
+	tx, err := c.begin(ctx, &sql.TxOptions{ReadOnly: opts.ReadOnly})
+	if err != nil {
+		s.logger.Error("Ошибка начала транзакции", zap.String("error", err.Error()))
+		return err
+	}
+	if c.uow == nil {
+		ctx = context.WithValue(ctx, txKey{s.db}, &unitOfWork{tx: tx.Tx})
+	}
+	return runTx(ctx, tx, fn)
+}
+
+// runTx - fn в транзакции tx: commit при успехе, rollback при ошибке или панике (паника пробрасывается дальше)
+func runTx(ctx context.Context, tx *txn, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if err = fn(ctx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
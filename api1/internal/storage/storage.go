@@ -2,24 +2,137 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"time"
 
 	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage/memory"
 	"github.com/nikita89756/testEffectiveMobile/internal/storage/postgres"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage/sqlite"
+	config "github.com/nikita89756/testEffectiveMobile/pkg/config"
 	"github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"github.com/pressly/goose/v3"
+	"go.uber.org/zap"
 )
 
 
 type Storage interface{
 GetPersonByID(context.Context,int)(*model.Person, error)
+// DeletePersonByID - мягкое удаление: запись помечается deleted_at и больше не видна в чтении
 DeletePersonByID(context.Context, int) error
-GetPersonsByFilter(context.Context,model.Person,int,int) ([]model.Person,error)
+// RestorePersonByID - снимает пометку удаления, ErrNothingToRestore если удаленной записи нет
+RestorePersonByID(ctx context.Context, id int) error
+// GetDeletedPersons - удаленные записи, сначала последние удаленные
+GetDeletedPersons(ctx context.Context, offset, limit int) ([]model.Person, error)
+// PurgeDeleted - окончательно удаляет записи, удаленные раньше before, возвращает их количество
+PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+// GetPersonsByFilter - страница в порядке filter.Sort после курсора after (keyset), для курсора назад - ближайшие записи перед ним.
+// after = nil - с начала списка, limit = 0 означает без ограничения
+GetPersonsByFilter(ctx context.Context, filter model.PersonFilter, after *model.Cursor, limit int) ([]model.Person, error)
+// CountPersons - число записей по фильтру. С estimate хранилище может вернуть оценку, тогда estimated = true
+CountPersons(ctx context.Context, filter model.PersonFilter, estimate bool) (total int64, estimated bool, err error)
+// GetDemographics - распределения по полу, национальности и возрасту, частые имена и фамилии и заполненность
+// полей обогащения для людей по фильтру. filter.Sort не используется
+GetDemographics(ctx context.Context, filter model.PersonFilter, opts model.DemographicsOptions) (*model.Demographics, error)
+// GetPersonFacets - число людей по значениям полей facets (из model.FacetFields) с тем же условием, что и GetPersonsByFilter.
+// Пустые значения не считаются, age группируется диапазонами model.FacetAgeBucketWidth
+GetPersonFacets(ctx context.Context, filter model.PersonFilter, facets []string) (map[string][]model.ValueCount, error)
 CreatePerson(context.Context, *model.Person) error
+// BulkCreatePersons - массовая вставка без обогащения. Невалидные строки пропускаются и попадают в result.Errors,
+// в persons заполняются ID и время создания. С atomic любая ошибка строки отменяет вставку всех строк (ErrBulkRejected)
+BulkCreatePersons(ctx context.Context, persons []model.Person, atomic bool) (model.BulkCreateResult, error)
+// UpdatePersonByID - если person.Version не 0, обновление выполняется только при совпадении версии (compare-and-swap),
+// иначе возвращается ErrVersionConflict. После обновления person.Version содержит новую версию
 UpdatePersonByID(context.Context,*model.Person) error
-Migrate(migrationsDir string) error
+// PatchPersonByID - JSON Merge Patch: в одной транзакции запись блокируется и читается (в Postgres SELECT ... FOR UPDATE),
+// UPDATE меняет только колонки, заданные в patch (null - NULL, у отчества пустая строка), и изменение пишется в историю и outbox.
+// version не 0 - обновление только при совпадении версии, иначе ErrVersionConflict. Возвращает запись после изменения,
+// пустой патч ничего не меняет и не пишется в историю
+PatchPersonByID(ctx context.Context, id int, patch model.PersonPatch, version int) (*model.Person, error)
+// GetPersonHistory - история изменений человека по возрастанию версии, включая удаленных
+GetPersonHistory(ctx context.Context, id int) ([]model.PersonHistory, error)
+// RevertPerson - возвращает данные человека к состоянию после версии version и записывает это как новое изменение
+RevertPerson(ctx context.Context, id, version int) (*model.Person, error)
+// FindDuplicates - группы вероятных дубликатов среди живых записей (см. dedup.Group), limit = 0 означает без ограничения
+FindDuplicates(ctx context.Context, limit int) ([]model.DuplicateGroup, error)
+// MergePersons - сливает записи ids в survivorID (0 - выбор по dedup.ChooseSurvivor): пустые поля заполняются по dedup.Merge,
+// остальные записи удаляются мягко, их ID запоминаются для ResolveMergedID. ErrNothingToMerge, если записи нет или она удалена
+MergePersons(ctx context.Context, ids []int, survivorID int) (*model.Person, error)
+// ResolveMergedID - ID записи, в которую был слит id, ErrPersonNotFound если id не сливался
+ResolveMergedID(ctx context.Context, id int) (int, error)
+// SearchPersons - нечеткий поиск по имени, фамилии и отчеству с учетом опечаток и транслитерации, лучшие совпадения первыми
+SearchPersons(ctx context.Context, query string, offset, limit int) ([]model.SearchResult, error)
+// GetNameStats - уникальные имена с заполненными возрастом, полом и национальностью, по алфавиту после afterName
+GetNameStats(ctx context.Context, afterName string, limit int) ([]model.NameStats, error)
+// GetOutboxEvents - первые limit недоставленных событий outbox по возрастанию ID. Событие пишется в одной транзакции
+// с изменением, которое его вызвало (создание, изменение, удаление, восстановление, откат, слияние)
+GetOutboxEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error)
+// MarkOutboxDelivered - отмечает события ids доставленными, больше GetOutboxEvents их не возвращает
+MarkOutboxDelivered(ctx context.Context, ids []int64) error
+// PurgeOutbox - удаляет события, доставленные раньше before, возвращает их количество
+PurgeOutbox(ctx context.Context, before time.Time) (int64, error)
+// WithTx - вызовы хранилища с контекстом, переданным в fn, выполняются в одной транзакции: ошибка или паника fn
+// откатывают все изменения. Конфликты сериализации повторяются до opts.MaxRetries раз, поэтому fn может вызываться несколько раз.
+// Транзакция передается через контекст, а не отдельным Storage: все методы и так принимают ctx, поэтому она проходит
+// через обертки (CachedStorage, маршрутизацию чтения на реплики, actor) без транзакционной копии каждой из них.
+// Обратная сторона - компилятор не проверяет, что внутри fn используется именно переданный контекст. Вызов с другим
+// контекстом (context.Background() или контекст запроса, полученный до WithTx) молча выполняется вне транзакции:
+// в Postgres на отдельном соединении и не откатывается вместе с fn, в SQLite и в памяти ждет конца транзакции.
+// Новый контекст внутри fn нужно строить от переданного
+WithTx(ctx context.Context, opts model.TxOptions, fn func(ctx context.Context) error) error
+// Migrations - миграции схемы из dir или встроенные в бинарник (dir пуст), nil - у хранилища нет схемы
+Migrations(dir string) (*goose.Provider, error)
+// PoolStats - состояние пулов соединений с базой, пусто для хранилища в памяти
+PoolStats() []model.PoolStats
 }
 
-func NewStorage(connectionString string,logger logger.Logger, timeout time.Duration	) Storage {
-	db := postgres.ConnectDB(connectionString,timeout)
-	return postgres.NewPostgres(db,logger,timeout)
+// NewStorage - создает хранилище по cfg.Driver: "postgres", "pgx" (тот же Postgres через pgxpool), "sqlite" или "memory"
+func NewStorage(cfg config.Database, logger logger.Logger) (Storage, error) {
+	if len(cfg.ReplicaConnections) > 0 && cfg.Driver != "postgres" {
+		logger.Warn("Реплики поддерживаются только для postgres, DATABASE_REPLICAS не используется", zap.String("driver", cfg.Driver))
+	}
+	switch cfg.Driver {
+	case "postgres":
+		pool := postgres.PoolConfig{
+			MaxOpenConns:    cfg.MaxOpenConns,
+			MaxIdleConns:    cfg.MaxIdleConns,
+			ConnMaxLifetime: cfg.ConnMaxLifetime,
+			ConnMaxIdleTime: cfg.ConnMaxIdleTime,
+		}
+		db := postgres.ConnectDB(cfg.DatabaseConnection, cfg.DBTimeout, pool)
+		p := postgres.NewPostgres(db, logger, cfg.DBTimeout)
+		if len(cfg.ReplicaConnections) == 0 {
+			return p, nil
+		}
+		replicas := make([]*sql.DB, 0, len(cfg.ReplicaConnections))
+		for _, dsn := range cfg.ReplicaConnections {
+			replica, err := postgres.OpenReplica(dsn, pool)
+			if err != nil {
+				return nil, fmt.Errorf("не удалось подключиться к реплике: %w", err)
+			}
+			replicas = append(replicas, replica)
+		}
+		return p.WithReplicas(cfg.ReplicaRetryInterval, replicas...), nil
+	case "pgx":
+		pool := postgres.PoolConfig{
+			MaxOpenConns:    cfg.MaxOpenConns,
+			ConnMaxLifetime: cfg.ConnMaxLifetime,
+			ConnMaxIdleTime: cfg.ConnMaxIdleTime,
+		}
+		db, err := postgres.ConnectPgx(cfg.DatabaseConnection, cfg.DBTimeout, pool)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось подключиться к базе данных через pgx: %w", err)
+		}
+		return postgres.NewPgx(db, logger, cfg.DBTimeout), nil
+	case "sqlite":
+		db, err := sqlite.ConnectDB(cfg.DatabaseConnection, cfg.DBTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось подключиться к SQLite: %w", err)
+		}
+		return sqlite.NewSQLite(db, logger, cfg.DBTimeout), nil
+	case "memory":
+		return memory.NewMemory(logger), nil
+	}
+	return nil, fmt.Errorf("неизвестный драйвер хранилища: %s", cfg.Driver)
 }
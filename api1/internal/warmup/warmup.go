@@ -0,0 +1,140 @@
+package warmup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cache "github.com/nikita89756/testEffectiveMobile/internal/cache"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage"
+	"github.com/nikita89756/testEffectiveMobile/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBatchSize = 500
+)
+
+// Warmer - прогрев кэша обогащения данными из таблицы people.
+// Имена читаются пачками по batchSize, между пачками выдерживается пауза interval,
+// так что в Redis пишется не больше batchSize ключей за interval.
+type Warmer struct {
+	storage   storage.Storage
+	cache     cache.Cache
+	logger    logger.Logger
+	batchSize int
+	interval  time.Duration
+
+	mu     sync.Mutex
+	status model.WarmupStatus
+}
+
+func NewWarmer(storage storage.Storage, cache cache.Cache, batchSize int, interval time.Duration, logger logger.Logger) *Warmer {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	return &Warmer{
+		storage:   storage,
+		cache:     cache,
+		logger:    logger,
+		batchSize: batchSize,
+		interval:  interval,
+	}
+}
+
+// Start - запускает прогрев в фоне, если прогрев уже идет, возвращает ErrWarmupRunning
+func (w *Warmer) Start(ctx context.Context) error {
+	if err := w.begin(); err != nil {
+		return err
+	}
+	go w.run(ctx)
+	return nil
+}
+
+// Run - синхронный прогрев, возвращает количество записанных имен
+func (w *Warmer) Run(ctx context.Context) (int, error) {
+	if err := w.begin(); err != nil {
+		return 0, err
+	}
+	err := w.run(ctx)
+	return w.Status().Processed, err
+}
+
+// Status - состояние текущего или последнего прогрева
+func (w *Warmer) Status() model.WarmupStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+func (w *Warmer) begin() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.status.Running {
+		return customerrors.ErrWarmupRunning
+	}
+	w.status = model.WarmupStatus{Running: true, StartedAt: time.Now()}
+	return nil
+}
+
+func (w *Warmer) run(ctx context.Context) error {
+	w.logger.Info("Начат прогрев кэша", zap.Int("batch_size", w.batchSize), zap.Duration("interval", w.interval))
+	err := w.warm(ctx)
+
+	w.mu.Lock()
+	w.status.Running = false
+	w.status.FinishedAt = time.Now()
+	if err != nil {
+		w.status.Error = err.Error()
+	}
+	status := w.status
+	w.mu.Unlock()
+
+	if err != nil {
+		w.logger.Error("Прогрев кэша прерван", zap.Int("processed", status.Processed), zap.Error(err))
+		return err
+	}
+	w.logger.Info("Прогрев кэша завершен", zap.Int("processed", status.Processed), zap.Duration("duration", status.FinishedAt.Sub(status.StartedAt)))
+	return nil
+}
+
+func (w *Warmer) warm(ctx context.Context) error {
+	var ticker *time.Ticker
+	if w.interval > 0 {
+		ticker = time.NewTicker(w.interval)
+		defer ticker.Stop()
+	}
+
+	afterName := ""
+	for {
+		stats, err := w.storage.GetNameStats(ctx, afterName, w.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(stats) == 0 {
+			return nil
+		}
+		if err := w.cache.SetPersons(ctx, stats); err != nil {
+			return err
+		}
+
+		w.mu.Lock()
+		w.status.Processed += len(stats)
+		w.mu.Unlock()
+
+		if len(stats) < w.batchSize {
+			return nil
+		}
+		afterName = stats[len(stats)-1].Name
+
+		if ticker != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	}
+}
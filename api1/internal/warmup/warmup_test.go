@@ -0,0 +1,70 @@
+package warmup
+
+import (
+	"context"
+	"testing"
+
+	cache "github.com/nikita89756/testEffectiveMobile/internal/cache"
+	customerrors "github.com/nikita89756/testEffectiveMobile/internal/errors"
+	"github.com/nikita89756/testEffectiveMobile/internal/model"
+	"github.com/nikita89756/testEffectiveMobile/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestWarmerRun(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemory(zap.NewNop())
+	persons := []model.Person{
+		{Name: "Anna", Surname: "Ivanova", Age: 25, Gender: "female", Nationality: "RU"},
+		{Name: "Ivan", Surname: "Ivanov", Age: 30, Gender: "male", Nationality: "RU"},
+		{Name: "Ivan", Surname: "Petrov", Age: 30, Gender: "male", Nationality: "UA"},
+		{Name: "Olga", Surname: "Petrova", Age: 41, Gender: "female", Nationality: "KZ"},
+		{Name: "Petr", Surname: "Sidorov"},
+	}
+	for i := range persons {
+		require.NoError(t, db.CreatePerson(ctx, &persons[i]))
+	}
+	c := cache.NewMemoryCache(cache.DefaultPolicy())
+
+	w := NewWarmer(db, c, 2, 0, zap.NewNop())
+	processed, err := w.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, processed)
+
+	stats, err := c.GetPerson(ctx, "Ivan")
+	require.NoError(t, err)
+	assert.Equal(t, "UA", stats.Nationality, "должна браться последняя обновленная запись")
+
+	_, err = c.GetPerson(ctx, "Petr")
+	assert.ErrorIs(t, err, customerrors.ErrKeyNotFound, "имена без данных обогащения не прогреваются")
+
+	status := w.Status()
+	assert.False(t, status.Running)
+	assert.Equal(t, 3, status.Processed)
+	assert.Empty(t, status.Error)
+}
+
+func TestWarmerDoesNotOverwrite(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemory(zap.NewNop())
+	require.NoError(t, db.CreatePerson(ctx, &model.Person{Name: "Ivan", Surname: "Ivanov", Age: 30, Gender: "male", Nationality: "RU"}))
+
+	c := cache.NewMemoryCache(cache.DefaultPolicy())
+	require.NoError(t, c.SetPersonWithTTL(ctx, "Ivan", model.PersonStats{Age: 35, Gender: "male", Nationality: "BY"}))
+
+	_, err := NewWarmer(db, c, 10, 0, zap.NewNop()).Run(ctx)
+	require.NoError(t, err)
+
+	stats, err := c.GetPerson(ctx, "Ivan")
+	require.NoError(t, err)
+	assert.Equal(t, "BY", stats.Nationality)
+}
+
+func TestWarmerAlreadyRunning(t *testing.T) {
+	w := NewWarmer(memory.NewMemory(zap.NewNop()), cache.NewMemoryCache(cache.DefaultPolicy()), 10, 0, zap.NewNop())
+	require.NoError(t, w.begin())
+
+	assert.ErrorIs(t, w.Start(context.Background()), customerrors.ErrWarmupRunning)
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -13,24 +14,88 @@ type Config struct {
 	Database
 	Server
 	Cache
+	Outbox
 	LogLevel string
 }
 
+// Database - настройки хранилища. Driver: "postgres", "pgx" (тот же Postgres через pgx и pgxpool, без реплик),
+// "sqlite" (DatabaseConnection - путь к файлу базы) или "memory" (данные только в памяти процесса, без внешних зависимостей)
 type Database struct {
+	Driver             string
 	DatabaseConnection string
-	MigrationDir       string
-	DBTimeout          time.Duration
+	// MigrationDir - каталог миграций вместо встроенных в бинарник, AutoMigrate - применять миграции при запуске сервера
+	MigrationDir string
+	AutoMigrate  bool
+	DBTimeout    time.Duration
+	// PurgeRetention - сколько хранятся мягко удаленные записи, PurgeInterval - как часто их очищать, 0 отключает очистку
+	PurgeRetention time.Duration
+	PurgeInterval  time.Duration
+	// ReplicaConnections - строки подключения к репликам Postgres для чтения, ReplicaRetryInterval - через сколько
+	// снова пробовать недоступную реплику
+	ReplicaConnections   []string
+	ReplicaRetryInterval time.Duration
+	// ReadYourWritesWindow - сколько после изменения чтения клиента идут в primary, 0 отключает
+	ReadYourWritesWindow time.Duration
+	// Пул соединений с Postgres (primary и каждая реплика): MaxOpenConns - не больше соединений, MaxIdleConns - сколько
+	// держать открытыми без запросов, ConnMaxLifetime и ConnMaxIdleTime - когда закрывать соединение. 0 - без ограничения
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// PoolStatsInterval - как часто писать состояние пула в лог, 0 отключает
+	PoolStatsInterval time.Duration
 }
 
+// Cache - настройки кэша. Driver: "redis", "memory" или "none".
+// Для redis пустой CACHE_ADDRESS означает, что кэш не настроен и используется no-op реализация.
 type Cache struct {
-	Address  string
-	Password string
-	Db       int
+	Driver string
+	// Mode - standalone, sentinel или cluster. Addresses - адрес Redis, адреса sentinel или начальные узлы кластера через запятую
+	Mode                  string
+	Addresses             []string
+	MasterName            string
+	Username              string
+	Password              string
+	SentinelUsername      string
+	SentinelPassword      string
+	Db                    int
+	TLS                   bool
+	TLSCAFile             string
+	TLSInsecureSkipVerify bool
+	// StartupMode - "background" (сервис стартует без Redis и переподключается в фоне) или "strict" (без Redis сервис не стартует)
+	StartupMode   string
+	RetryInterval time.Duration
+	Timeout       time.Duration
+	// FreshTTL - сколько данные обогащения считаются актуальными, StaleTTL - сколько после этого
+	// они еще отдаются как устаревшие, пока обновляются в фоне или внешние API недоступны
+	FreshTTL time.Duration
+	StaleTTL time.Duration
+	// ListTTL - время жизни закэшированных страниц GET /persons, 0 отключает кэш списков
+	ListTTL time.Duration
+	// Warmup* - прогрев кэша из таблицы people: при старте и не быстрее WarmupBatchSize ключей за WarmupInterval
+	WarmupOnStart   bool
+	WarmupBatchSize int
+	WarmupInterval  time.Duration
+}
+
+// Outbox - отправка событий об изменениях людей из таблицы outbox. Publisher: "log" (в лог сервиса), "http" (POST на HTTPURL),
+// "nats" (NATS JetStream, subject NATSSubject.<тип события>) или "none" (relay не запускается, события копятся в таблице)
+type Outbox struct {
+	Publisher string
+	// RelayInterval - как часто проверять новые события, BatchSize - сколько событий читать за раз
+	RelayInterval time.Duration
+	BatchSize     int
+	HTTPURL       string
+	HTTPTimeout   time.Duration
+	NATSURL       string
+	NATSSubject   string
 }
 
 type Server struct {
 	Host string
 	Port string
+	// AdminToken - токен для /api/admin, если не задан, административные эндпоинты отключены
+	AdminToken string
 }
 
 // type APIs{
@@ -40,57 +105,110 @@ type Server struct {
 func InitConfig() Config {
 	err := godotenv.Load()
 	if err != nil {
-		db := os.Getenv("CACHE_DB")
-		dbint, err := strconv.Atoi(db)
-		if err != nil {
-			log.Fatal("Не удалось преобразовать значение CACHE_DB в int:", err)
-		}
-		cfg := Config{
-			Database: Database{
-				DatabaseConnection: os.Getenv("DATABASE_CONNECTION"),
-				MigrationDir:       os.Getenv("MIGRATION_DIR"),
-				DBTimeout:          5 * time.Second,
-			},
-			Server: Server{
-				Host: os.Getenv("SERVER_HOST"),
-				Port: os.Getenv("SERVER_PORT"),
-			},
-			Cache: Cache{
-				Address:  os.Getenv("CACHE_ADDRESS"),
-				Password: os.Getenv("CACHE_PASSWORD"),
-				Db:       dbint,
-			},
-			LogLevel: os.Getenv("LOG_LEVEL"),
-		}
-		if cfg.Database.DatabaseConnection == "" {
-			log.Fatal("Не указана строка подключения к базе данных")
-		}
-		return cfg
-	}
-	db := os.Getenv("CACHE_DB")
-	dbint, err := strconv.Atoi(db)
-	if err != nil {
-		log.Fatal("Не удалось преобразовать значение HASH_DB в int:", err)
+		log.Println("Файл .env не найден, используются переменные окружения")
 	}
 	cfg := Config{
 		Database: Database{
-			DatabaseConnection: getEnv("DATABASE_CONNECTION", ""),
-			MigrationDir:       getEnv("MIGRATION_DIR", ""),
-			DBTimeout:          5 * time.Second,
+			Driver:               getEnv("STORAGE_DRIVER", "postgres"),
+			DatabaseConnection:   getEnv("DATABASE_CONNECTION", ""),
+			MigrationDir:         getEnv("MIGRATION_DIR", ""),
+			AutoMigrate:          getEnvBool("AUTO_MIGRATE", false),
+			DBTimeout:            5 * time.Second,
+			PurgeRetention:       getEnvDuration("PURGE_RETENTION", 30*24*time.Hour),
+			PurgeInterval:        getEnvDuration("PURGE_INTERVAL", time.Hour),
+			ReplicaConnections:   getEnvList("DATABASE_REPLICAS"),
+			ReplicaRetryInterval: getEnvDuration("DATABASE_REPLICA_RETRY_INTERVAL", 10*time.Second),
+			ReadYourWritesWindow: getEnvDuration("READ_YOUR_WRITES_WINDOW", 5*time.Second),
+			MaxOpenConns:         getEnvInt("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:         getEnvInt("DB_MAX_IDLE_CONNS", 10),
+			ConnMaxLifetime:      getEnvDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+			ConnMaxIdleTime:      getEnvDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+			PoolStatsInterval:    getEnvDuration("DB_POOL_STATS_INTERVAL", time.Minute),
 		},
 		Cache: Cache{
-			Address:  os.Getenv("CACHE_ADDRESS"),
-			Password: os.Getenv("CACHE_PASSWORD"),
-			Db:       dbint,
+			Driver:                getEnv("CACHE_DRIVER", "redis"),
+			Mode:                  getEnv("CACHE_MODE", "standalone"),
+			Addresses:             getEnvList("CACHE_ADDRESS"),
+			MasterName:            os.Getenv("CACHE_MASTER_NAME"),
+			Username:              os.Getenv("CACHE_USERNAME"),
+			Password:              os.Getenv("CACHE_PASSWORD"),
+			SentinelUsername:      os.Getenv("CACHE_SENTINEL_USERNAME"),
+			SentinelPassword:      os.Getenv("CACHE_SENTINEL_PASSWORD"),
+			TLS:                   getEnvBool("CACHE_TLS", false),
+			TLSCAFile:             os.Getenv("CACHE_TLS_CA_FILE"),
+			TLSInsecureSkipVerify: getEnvBool("CACHE_TLS_INSECURE_SKIP_VERIFY", false),
+			Db:                    getEnvInt("CACHE_DB", 0),
+			StartupMode:           getEnv("CACHE_STARTUP_MODE", "background"),
+			RetryInterval:         getEnvDuration("CACHE_RETRY_INTERVAL", 5*time.Second),
+			Timeout:               getEnvDuration("CACHE_TIMEOUT", 500*time.Millisecond),
+			FreshTTL:              getEnvDuration("CACHE_FRESH_TTL", 5*time.Hour),
+			StaleTTL:              getEnvDuration("CACHE_STALE_TTL", 24*time.Hour),
+			ListTTL:               getEnvDuration("CACHE_LIST_TTL", time.Minute),
+			WarmupOnStart:         getEnvBool("CACHE_WARMUP_ON_START", false),
+			WarmupBatchSize:       getEnvInt("CACHE_WARMUP_BATCH_SIZE", 500),
+			WarmupInterval:        getEnvDuration("CACHE_WARMUP_INTERVAL", 100*time.Millisecond),
+		},
+		Outbox: Outbox{
+			Publisher:     getEnv("OUTBOX_PUBLISHER", "log"),
+			RelayInterval: getEnvDuration("OUTBOX_RELAY_INTERVAL", time.Second),
+			BatchSize:     getEnvInt("OUTBOX_BATCH_SIZE", 100),
+			HTTPURL:       os.Getenv("OUTBOX_HTTP_URL"),
+			HTTPTimeout:   getEnvDuration("OUTBOX_HTTP_TIMEOUT", 5*time.Second),
+			NATSURL:       getEnv("OUTBOX_NATS_URL", "nats://localhost:4222"),
+			NATSSubject:   getEnv("OUTBOX_NATS_SUBJECT", "people.events"),
 		},
 		Server: Server{
-			Host: getEnv("SERVER_HOST", "0.0.0.0"),
-			Port: getEnv("SERVER_PORT", "8080"),
+			Host:       getEnv("SERVER_HOST", "0.0.0.0"),
+			Port:       getEnv("SERVER_PORT", "8080"),
+			AdminToken: os.Getenv("ADMIN_TOKEN"),
 		},
 		LogLevel: getEnv("LOG_LEVEL", "info"),
 	}
-	if cfg.Database.DatabaseConnection == "" {
-		log.Fatal("Не указана строка подключения к базе данных")
+	switch cfg.Database.Driver {
+	case "postgres", "pgx":
+		if cfg.Database.DatabaseConnection == "" {
+			log.Fatal("Не указана строка подключения к базе данных")
+		}
+	case "sqlite":
+		if cfg.Database.DatabaseConnection == "" {
+			log.Fatal("Не указан путь к файлу базы SQLite")
+		}
+	case "memory":
+	default:
+		log.Fatal("Неизвестное значение STORAGE_DRIVER: ", cfg.Database.Driver)
+	}
+	if cfg.Database.MaxOpenConns < 0 || cfg.Database.MaxIdleConns < 0 {
+		log.Fatal("DB_MAX_OPEN_CONNS и DB_MAX_IDLE_CONNS не могут быть отрицательными")
+	}
+	if cfg.Database.MaxOpenConns > 0 && cfg.Database.MaxIdleConns > cfg.Database.MaxOpenConns {
+		log.Fatal("DB_MAX_IDLE_CONNS не может быть больше DB_MAX_OPEN_CONNS")
+	}
+	if cfg.Cache.Driver != "redis" && cfg.Cache.Driver != "memory" && cfg.Cache.Driver != "none" {
+		log.Fatal("Неизвестное значение CACHE_DRIVER: ", cfg.Cache.Driver)
+	}
+	switch cfg.Cache.Mode {
+	case "standalone", "cluster":
+	case "sentinel":
+		if cfg.Cache.Driver == "redis" && cfg.Cache.MasterName == "" {
+			log.Fatal("Для CACHE_MODE=sentinel не указан CACHE_MASTER_NAME")
+		}
+	default:
+		log.Fatal("Неизвестное значение CACHE_MODE: ", cfg.Cache.Mode)
+	}
+	if cfg.Cache.StartupMode != "background" && cfg.Cache.StartupMode != "strict" {
+		log.Fatal("Неизвестное значение CACHE_STARTUP_MODE: ", cfg.Cache.StartupMode)
+	}
+	switch cfg.Outbox.Publisher {
+	case "none", "log", "nats":
+	case "http":
+		if cfg.Outbox.HTTPURL == "" {
+			log.Fatal("Для OUTBOX_PUBLISHER=http не указан OUTBOX_HTTP_URL")
+		}
+	default:
+		log.Fatal("Неизвестное значение OUTBOX_PUBLISHER: ", cfg.Outbox.Publisher)
+	}
+	if cfg.Outbox.Publisher != "none" && (cfg.Outbox.RelayInterval <= 0 || cfg.Outbox.BatchSize <= 0) {
+		log.Fatal("OUTBOX_RELAY_INTERVAL и OUTBOX_BATCH_SIZE должны быть больше нуля")
 	}
 	return cfg
 }
@@ -101,3 +219,50 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvList - значения через запятую, пустые элементы отбрасываются
+func getEnvList(key string) []string {
+	list := make([]string, 0)
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Не удалось преобразовать значение %s в int: %v", key, err)
+	}
+	return v
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	v, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Не удалось преобразовать значение %s в time.Duration: %v", key, err)
+	}
+	return v
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Не удалось преобразовать значение %s в bool: %v", key, err)
+	}
+	return v
+}